@@ -1,20 +1,36 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"math"
+	"math/rand/v2"
+	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/marianozunino/drop/internal/utils"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -34,15 +50,26 @@ type UploadResponse struct {
 	Size          int64  `json:"size"`
 	Token         string `json:"token"`
 	MD5           string `json:"md5"`
+	SHA256        string `json:"sha256,omitempty"`
 	ExpiresAt     string `json:"expires_at"`
 	ExpiresInDays int    `json:"expires_in_days"`
+	ScanStatus    string `json:"scan_status"`
+	ScanURL       string `json:"scan_url"`
 }
 
 type ChunkedUploadInitResponse struct {
 	UploadID       string `json:"upload_id"`
+	UploadToken    string `json:"upload_token"`
 	ChunkSize      int64  `json:"chunk_size"`
 	TotalChunks    int    `json:"total_chunks"`
 	UploadedChunks []int  `json:"uploaded_chunks"`
+
+	// Set when the server already stores a file with the same content hash
+	AlreadyExists bool   `json:"already_exists"`
+	FileURL       string `json:"file_url"`
+	MD5           string `json:"md5"`
+	ExpiresAt     string `json:"expires_at"`
+	ExpiresInDays int    `json:"expires_in_days"`
 }
 
 type ChunkedUploadStatusResponse struct {
@@ -50,19 +77,113 @@ type ChunkedUploadStatusResponse struct {
 	UploadedChunks []int `json:"uploaded_chunks"`
 }
 
+// UploadSession is an unfinished chunked upload on the server (GET /upload/sessions)
+type UploadSession struct {
+	UploadID       string    `json:"upload_id"`
+	Filename       string    `json:"filename"`
+	TotalSize      int64     `json:"total_size"`
+	UploadedChunks int       `json:"uploaded_chunks"`
+	TotalChunks    int       `json:"total_chunks"`
+	Progress       int       `json:"progress"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
 type ChunkedUploadCompleteResponse struct {
 	Message       string `json:"message"`
 	Progress      int    `json:"progress"`
 	FileURL       string `json:"file_url"`
 	MD5           string `json:"md5"`
+	SHA256        string `json:"sha256,omitempty"`
 	Token         string `json:"token"`
 	ExpiresAt     string `json:"expires_at"`
 	ExpiresInDays int    `json:"expires_in_days"`
+	ScanStatus    string `json:"scan_status"`
+	ScanURL       string `json:"scan_url"`
+}
+
+// ScanStatusResponse is the virus scan result of an upload (GET /:id/scan)
+type ScanStatusResponse struct {
+	Status    string `json:"status"`
+	Signature string `json:"signature"`
+}
+
+type LimitsResponse struct {
+	MaxSize           int64    `json:"max_size"`
+	ChunkSize         int64    `json:"chunk_size"`
+	AllowedTypes      []string `json:"allowed_types"`
+	BlockedTypes      []string `json:"blocked_types"`
+	BlockedExtensions []string `json:"blocked_extensions"`
+	RequireExpiration bool     `json:"require_expiration"`
+}
+
+// ServerStats is the server's summary of stored files and transfer
+// (GET /stats). Servers that predate the totals leave them nil.
+type ServerStats struct {
+	TotalFiles          *int                 `json:"total_files"`
+	TotalSize           *int64               `json:"total_size"`
+	Types               map[string]TypeStats `json:"types"`
+	ActiveUploads       int                  `json:"active_uploads"`
+	MaintenanceMode     bool                 `json:"maintenance_mode"`
+	TransferPeriod      string               `json:"transfer_period"`
+	TransferBytesServed int64                `json:"transfer_bytes_served"`
+	TransferCapBytes    int64                `json:"transfer_cap_bytes"`
+}
+
+// TypeStats is the number and total size of the stored files of a media type
+type TypeStats struct {
+	Files int   `json:"files"`
+	Size  int64 `json:"size"`
+}
+
+// FileMeta is the server's description of a stored file (GET /:id/meta.json)
+type FileMeta struct {
+	URL         string `json:"url"`
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	MD5         string `json:"md5"`
+	ExpiresAt   string `json:"expires_at"`
+
+	PasswordProtected bool `json:"password_protected"`
+
+	// Only sent to the holder of the management token
+	OneTimeView  bool `json:"one_time_view"`
+	AccessCount  int  `json:"access_count"`
+	MaxDownloads int  `json:"max_downloads"`
+}
+
+// HistoryEntry is a past upload recorded in the local history file
+type HistoryEntry struct {
+	URL        string    `json:"url"`
+	Server     string    `json:"server"`
+	Token      string    `json:"token"`
+	Name       string    `json:"name,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	MD5        string    `json:"md5,omitempty"`
+	ExpiresAt  string    `json:"expires_at,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
 }
 
 type Client struct {
 	BaseURL    string
 	HTTPClient *http.Client
+	// UseDeleteMethod makes DeleteFile send DELETE with the token in the X-Token header
+	UseDeleteMethod bool
+	// APIKey selects the server's upload tier, see SetAPIKey
+	APIKey string
+	// Retries is how often uploads failing with a network error, 429 or a 5xx
+	// status are sent again
+	Retries int
+	// RetryBackoff is the wait before the first retry, doubled for every
+	// further one and jittered
+	RetryBackoff time.Duration
+	// SessionsFile keeps the upload tokens of unfinished chunked uploads, so a
+	// later run can resume or cancel them. Empty keeps them in memory only.
+	SessionsFile string
+
+	tokensMu     sync.Mutex
+	uploadTokens map[string]string
 }
 
 func NewClient(baseURL string) *Client {
@@ -77,6 +198,42 @@ func NewClient(baseURL string) *Client {
 	}
 }
 
+// apiKeyHeader carries the API key that selects an upload tier on the server
+const apiKeyHeader = "X-API-Key"
+
+// SetAPIKey sends the key with every request to the server. Requests to other
+// hosts, like redirects away from the server, never carry it.
+func (c *Client) SetAPIKey(key string) {
+	c.APIKey = key
+	if key == "" {
+		return
+	}
+	server, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return
+	}
+	base := c.HTTPClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.HTTPClient.Transport = &apiKeyTransport{base: base, host: server.Host, key: key}
+}
+
+// apiKeyTransport adds the API key header to requests for the server's host
+type apiKeyTransport struct {
+	base http.RoundTripper
+	host string
+	key  string
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.host {
+		req = req.Clone(req.Context())
+		req.Header.Set(apiKeyHeader, t.key)
+	}
+	return t.base.RoundTrip(req)
+}
+
 func (c *Client) UploadFile(filePath string, options map[string]string) (*UploadResponse, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -105,13 +262,24 @@ func (c *Client) UploadFile(filePath string, options map[string]string) (*Upload
 
 	writer.Close()
 
-	req, err := http.NewRequest("POST", c.BaseURL, &buf)
+	var uploadResp *UploadResponse
+	err = c.withRetries(func() error {
+		uploadResp, err = c.sendUpload(buf.Bytes(), writer.FormDataContentType())
+		return err
+	})
+	return uploadResp, err
+}
+
+// sendUpload posts a multipart upload body once
+func (c *Client) sendUpload(body []byte, contentType string) (*UploadResponse, error) {
+	req, err := http.NewRequest("POST", c.BaseURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Accept", "application/json")
+	req.Header.Set("TE", "trailers")
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
@@ -120,8 +288,7 @@ func (c *Client) UploadFile(filePath string, options map[string]string) (*Upload
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newStatusError(resp, "upload failed")
 	}
 
 	var uploadResp UploadResponse
@@ -129,6 +296,12 @@ func (c *Client) UploadFile(filePath string, options map[string]string) (*Upload
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	// Trailers are only available once the body has been read to the end
+	io.Copy(io.Discard, resp.Body)
+	if md5 := resp.Trailer.Get("X-MD5"); md5 != "" {
+		uploadResp.MD5 = md5
+	}
+
 	return &uploadResp, nil
 }
 
@@ -216,6 +389,13 @@ func (c *Client) ShortenURL(url string, options map[string]string) (*UploadRespo
 }
 
 func (c *Client) InitChunkedUpload(filename string, size int64, chunkSize int64) (*ChunkedUploadInitResponse, error) {
+	return c.InitChunkedUploadWithHash(filename, size, chunkSize, "", "")
+}
+
+// InitChunkedUploadWithHash starts a chunked upload keyed by the file's MD5.
+// The server may answer that the file already exists, or resume an earlier
+// session for the same content. An empty expires uses the server's retention.
+func (c *Client) InitChunkedUploadWithHash(filename string, size int64, chunkSize int64, contentHash, expires string) (*ChunkedUploadInitResponse, error) {
 	var buf bytes.Buffer
 	writer := multipart.NewWriter(&buf)
 
@@ -224,33 +404,51 @@ func (c *Client) InitChunkedUpload(filename string, size int64, chunkSize int64)
 	if chunkSize > 0 {
 		writer.WriteField("chunk_size", strconv.FormatInt(chunkSize, 10))
 	}
+	if contentHash != "" {
+		writer.WriteField("content_hash", contentHash)
+		if token := c.resumeToken(contentHash); token != "" {
+			writer.WriteField("upload_token", token)
+		}
+	}
+	if expires != "" {
+		writer.WriteField("expires", expires)
+	}
 
 	writer.Close()
 
-	req, err := http.NewRequest("POST", c.BaseURL+"upload/init", &buf)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
+	// Only sessions whose upload token we hold are resumed, so a retried init
+	// after a lost response starts over and the lost session expires
+	var initResp ChunkedUploadInitResponse
+	err := c.withRetries(func() error {
+		req, err := http.NewRequest("POST", c.BaseURL+"upload/init", bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
 
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize chunked upload: %w", err)
-	}
-	defer resp.Body.Close()
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to initialize chunked upload: %w", err)
+		}
+		defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("init failed with status %d: %s", resp.StatusCode, string(body))
-	}
+		if resp.StatusCode != http.StatusOK {
+			return newStatusError(resp, "init failed")
+		}
 
-	var initResp ChunkedUploadInitResponse
-	if err := json.NewDecoder(resp.Body).Decode(&initResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		if err := json.NewDecoder(resp.Body).Decode(&initResp); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !initResp.AlreadyExists && initResp.UploadToken != "" {
+		c.rememberUploadToken(initResp.UploadID, initResp.UploadToken, contentHash)
 	}
-
 	return &initResp, nil
 }
 
@@ -277,6 +475,7 @@ func (c *Client) UploadChunk(uploadID string, chunkIndex int, chunkData []byte)
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	c.setUploadTokenHeader(req, uploadID)
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
@@ -285,8 +484,7 @@ func (c *Client) UploadChunk(uploadID string, chunkIndex int, chunkData []byte)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("chunk upload failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newStatusError(resp, "chunk upload failed")
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -296,6 +494,7 @@ func (c *Client) UploadChunk(uploadID string, chunkIndex int, chunkData []byte)
 
 	var completionResp ChunkedUploadCompleteResponse
 	if err := json.Unmarshal(body, &completionResp); err == nil && completionResp.Message == "Upload completed" {
+		c.forgetUploadToken(uploadID)
 		return &completionResp, nil
 	}
 
@@ -303,8 +502,13 @@ func (c *Client) UploadChunk(uploadID string, chunkIndex int, chunkData []byte)
 }
 
 func (c *Client) GetChunkedUploadStatus(uploadID string) (*ChunkedUploadStatusResponse, error) {
-	statusURL := fmt.Sprintf("%supload/status/%s", c.BaseURL, uploadID)
-	resp, err := c.HTTPClient.Get(statusURL)
+	req, err := http.NewRequest("GET", fmt.Sprintf("%supload/status/%s", c.BaseURL, uploadID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setUploadTokenHeader(req, uploadID)
+
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get upload status: %w", err)
 	}
@@ -323,200 +527,1110 @@ func (c *Client) GetChunkedUploadStatus(uploadID string) (*ChunkedUploadStatusRe
 	return &statusResp, nil
 }
 
-func (c *Client) UploadFileChunked(filePath string, chunkSize int64, showProgress bool) (*ChunkedUploadCompleteResponse, error) {
-	file, err := os.Open(filePath)
+// AbortChunkedUpload cancels an upload session, deleting the chunks already
+// sent to the server
+func (c *Client) AbortChunkedUpload(uploadID string) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%supload/%s", c.BaseURL, uploadID), nil)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to create request: %w", err)
 	}
-	defer file.Close()
+	c.setUploadTokenHeader(req, uploadID)
 
-	fileInfo, err := file.Stat()
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to abort upload: %w", err)
 	}
+	defer resp.Body.Close()
 
-	fileSize := fileInfo.Size()
-	if chunkSize <= 0 {
-		chunkSize = 4 * 1024 * 1024
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("abort failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	c.forgetUploadToken(uploadID)
+	return nil
+}
+
+// uploadTokenHeader carries the upload token of a chunked upload session
+const uploadTokenHeader = "X-Upload-Token"
+
+// setUploadTokenHeader sends the upload token of the session, when known
+func (c *Client) setUploadTokenHeader(req *http.Request, uploadID string) {
+	if token := c.uploadToken(uploadID); token != "" {
+		req.Header.Set(uploadTokenHeader, token)
+	}
+}
+
+// rememberUploadToken keeps the token of a new or resumed session, in
+// SessionsFile as well when one is set
+func (c *Client) rememberUploadToken(uploadID, token, contentHash string) {
+	c.tokensMu.Lock()
+	if c.uploadTokens == nil {
+		c.uploadTokens = make(map[string]string)
 	}
+	c.uploadTokens[uploadID] = token
+	c.tokensMu.Unlock()
 
-	initResp, err := c.InitChunkedUpload(filepath.Base(filePath), fileSize, chunkSize)
+	if c.SessionsFile == "" {
+		return
+	}
+	err := updateSessions(c.SessionsFile, func(entries []SessionEntry) []SessionEntry {
+		entries = slices.DeleteFunc(entries, func(e SessionEntry) bool {
+			return e.Server == c.BaseURL && e.UploadID == uploadID
+		})
+		return append(entries, SessionEntry{
+			Server:      c.BaseURL,
+			UploadID:    uploadID,
+			UploadToken: token,
+			ContentHash: contentHash,
+			CreatedAt:   time.Now(),
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize chunked upload: %w", err)
+		fmt.Fprintf(os.Stderr, "Warning: could not save upload session: %v\n", err)
 	}
+}
 
-	fmt.Printf("Initialized chunked upload: %s (%d chunks)\n", initResp.UploadID, initResp.TotalChunks)
-	if showProgress {
-		fmt.Printf("Uploading...\n")
+// uploadToken returns the token of a session, empty when it isn't known
+func (c *Client) uploadToken(uploadID string) string {
+	c.tokensMu.Lock()
+	token, ok := c.uploadTokens[uploadID]
+	c.tokensMu.Unlock()
+	if ok {
+		return token
 	}
 
-	for i := 0; i < initResp.TotalChunks; i++ {
-		chunkData := make([]byte, initResp.ChunkSize)
-		n, err := file.Read(chunkData)
-		if err != nil && err != io.EOF {
-			return nil, fmt.Errorf("failed to read chunk %d: %w", i, err)
-		}
+	entry, _ := c.findSession(func(e SessionEntry) bool { return e.UploadID == uploadID })
+	return entry.UploadToken
+}
 
-		if i == initResp.TotalChunks-1 {
-			chunkData = chunkData[:n]
-		}
+// resumeToken returns the token of an unfinished session for the content hash
+// recorded in SessionsFile
+func (c *Client) resumeToken(contentHash string) string {
+	entry, _ := c.findSession(func(e SessionEntry) bool { return e.ContentHash == contentHash })
+	return entry.UploadToken
+}
 
-		resp, err := c.UploadChunk(initResp.UploadID, i, chunkData)
-		if err != nil {
-			return nil, fmt.Errorf("failed to upload chunk %d: %w", i, err)
+// findSession returns the newest session of this server in SessionsFile that
+// matches
+func (c *Client) findSession(match func(SessionEntry) bool) (SessionEntry, bool) {
+	if c.SessionsFile == "" {
+		return SessionEntry{}, false
+	}
+	entries, err := loadSessions(c.SessionsFile)
+	if err != nil {
+		return SessionEntry{}, false
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Server == c.BaseURL && match(entries[i]) {
+			return entries[i], true
 		}
+	}
+	return SessionEntry{}, false
+}
 
-		if resp != nil {
-			printProgress(i+1, initResp.TotalChunks, showProgress)
-			return resp, nil
-		}
+// forgetUploadToken drops the token of a completed or aborted session
+func (c *Client) forgetUploadToken(uploadID string) {
+	c.tokensMu.Lock()
+	delete(c.uploadTokens, uploadID)
+	c.tokensMu.Unlock()
 
-		printProgress(i+1, initResp.TotalChunks, showProgress)
+	if c.SessionsFile == "" {
+		return
 	}
+	err := updateSessions(c.SessionsFile, func(entries []SessionEntry) []SessionEntry {
+		return slices.DeleteFunc(entries, func(e SessionEntry) bool {
+			return e.Server == c.BaseURL && e.UploadID == uploadID
+		})
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not save upload sessions: %v\n", err)
+	}
+}
 
-	statusResp, err := c.GetChunkedUploadStatus(initResp.UploadID)
+// ListUploadSessions lists the unfinished chunked uploads started from this
+// client's IP address
+func (c *Client) ListUploadSessions() ([]UploadSession, error) {
+	resp, err := c.HTTPClient.Get(c.BaseURL + "upload/sessions")
 	if err != nil {
-		return &ChunkedUploadCompleteResponse{
-			Message:  "Upload completed",
-			Progress: 100,
-			FileURL:  fmt.Sprintf("%s%s", c.BaseURL, initResp.UploadID),
-			MD5:      "",
-			Token:    "",
-		}, nil
+		return nil, fmt.Errorf("failed to list upload sessions: %w", err)
 	}
+	defer resp.Body.Close()
 
-	if statusResp.Progress != 100 {
-		return nil, fmt.Errorf("upload incomplete: %d%%", statusResp.Progress)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("listing upload sessions failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	return &ChunkedUploadCompleteResponse{
-		Message:  "Upload completed",
-		Progress: 100,
-		FileURL:  fmt.Sprintf("%s%s", c.BaseURL, initResp.UploadID),
-		MD5:      "",
-		Token:    "",
-	}, nil
+	var list struct {
+		Sessions []UploadSession `json:"sessions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode upload sessions: %w", err)
+	}
+	return list.Sessions, nil
 }
 
-func (c *Client) DeleteFile(fileURL, token string) error {
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-	writer.WriteField("token", token)
-	writer.WriteField("delete", "")
-	writer.Close()
-
-	req, err := http.NewRequest("POST", fileURL, &buf)
+func (c *Client) GetLimits() (*LimitsResponse, error) {
+	resp, err := c.HTTPClient.Get(c.BaseURL + "api/limits")
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to get server limits: %w", err)
 	}
+	defer resp.Body.Close()
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("limits request failed with status %d: %s", resp.StatusCode, string(body))
+	}
 
-	resp, err := c.HTTPClient.Do(req)
+	var limits LimitsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&limits); err != nil {
+		return nil, fmt.Errorf("failed to decode limits response: %w", err)
+	}
+
+	return &limits, nil
+}
+
+// GetVersion fetches the server version. It returns an empty version without
+// an error when the server predates the /version endpoint.
+func (c *Client) GetVersion() (string, error) {
+	resp, err := c.HTTPClient.Get(c.BaseURL + "version")
 	if err != nil {
-		return fmt.Errorf("failed to delete file: %w", err)
+		return "", fmt.Errorf("failed to get server version: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("delete failed with status %d: %s", resp.StatusCode, string(body))
+		return "", fmt.Errorf("version request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	return nil
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("failed to decode version response: %w", err)
+	}
+	return version.Version, nil
 }
 
-func (c *Client) SetExpiration(fileURL, token, expires string) error {
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-	writer.WriteField("token", token)
-	writer.WriteField("expires", expires)
-	writer.Close()
-
-	req, err := http.NewRequest("POST", fileURL, &buf)
+// GetStatsJSON fetches the server statistics as the JSON the server sent
+func (c *Client) GetStatsJSON() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"stats", nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to set expiration: %w", err)
+		return nil, fmt.Errorf("failed to get server stats: %w", err)
 	}
 	defer resp.Body.Close()
 
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats response: %w", err)
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("set expiration failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("stats request failed with status %d: %s", resp.StatusCode, string(body))
 	}
-
-	return nil
+	return body, nil
 }
 
-func printProgress(current, total int, showProgress bool) {
-	if !showProgress {
-		return
+// GetStats fetches the server statistics
+func (c *Client) GetStats() (*ServerStats, error) {
+	body, err := c.GetStatsJSON()
+	if err != nil {
+		return nil, err
 	}
 
-	percent := float64(current) / float64(total) * 100
-	barWidth := 30
-	filled := int(float64(barWidth) * percent / 100)
-
-	bar := strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
-	fmt.Printf("\r%s %.1f%% (%d/%d)", bar, percent, current, total)
-
-	if current == total {
-		fmt.Println()
+	var stats ServerStats
+	if err := json.Unmarshal(body, &stats); err != nil {
+		return nil, fmt.Errorf("failed to decode stats response: %w", err)
 	}
+	return &stats, nil
 }
 
-func FormatExpiration(expiration string) string {
-	if hours, err := strconv.Atoi(expiration); err == nil {
-		return strconv.Itoa(hours)
-	}
+// GetFileMeta fetches the metadata of an uploaded file. It returns nil without
+// an error when the file doesn't exist.
+func (c *Client) GetFileMeta(fileURL string) (*FileMeta, error) {
+	return c.GetFileMetaWithToken(fileURL, "")
+}
 
-	if _, err := time.Parse(time.RFC3339, expiration); err == nil {
-		return expiration
+// GetFileMetaWithToken fetches the metadata of an uploaded file, including the
+// fields only shown to the holder of its management token
+func (c *Client) GetFileMetaWithToken(fileURL, token string) (*FileMeta, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(fileURL, "/")+"/meta.json", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Token", token)
 	}
 
-	if _, err := time.Parse("2006-01-02", expiration); err == nil {
-		return expiration
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", fileURL, err)
 	}
+	defer resp.Body.Close()
 
-	if _, err := time.Parse("2006-01-02T15:04:05", expiration); err == nil {
-		return expiration
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		// Password protected files are only described with the password or token
+		var locked FileMeta
+		if resp.StatusCode == http.StatusUnauthorized && json.Unmarshal(body, &locked) == nil && locked.PasswordProtected {
+			return &FileMeta{URL: fileURL, PasswordProtected: true}, nil
+		}
+		return nil, fmt.Errorf("metadata request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	if _, err := time.Parse("2006-01-02 15:04:05", expiration); err == nil {
-		return expiration
+	var meta FileMeta
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata response: %w", err)
+	}
+	if meta.URL == "" {
+		meta.URL = fileURL
 	}
 
-	return expiration
+	return &meta, nil
 }
 
-func calculateFileMD5(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+// DownloadFile writes the content of an uploaded file to w. Downloading a
+// one-time file deletes it from the server.
+func (c *Client) DownloadFile(fileURL string, w io.Writer) (int64, error) {
+	resp, err := c.HTTPClient.Get(fileURL)
 	if err != nil {
-		return "", err
+		return 0, fmt.Errorf("failed to download %s: %w", fileURL, err)
 	}
-	defer file.Close()
+	defer resp.Body.Close()
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", fmt.Errorf("failed to calculate MD5: %w", err)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("download failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 
-	return hex.EncodeToString(hash.Sum(nil)), nil
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("failed to download %s: %w", fileURL, err)
+	}
+	return n, nil
 }
 
-func verifyMD5(localMD5, serverMD5 string) bool {
-	return strings.EqualFold(localMD5, serverMD5)
+// Download failures explained to the user
+var (
+	errFileNotFound = errors.New("file not found, check the id or URL")
+	errFileExpired  = errors.New("file has expired and was removed from the server")
+)
+
+// DownloadResult describes a file saved by DownloadToFile
+type DownloadResult struct {
+	Path string
+	Size int64
+	// Resumed is the number of bytes kept from an earlier, interrupted download
+	Resumed int64
+	// MD5 is the server's hash of the file, empty when it doesn't report one
+	MD5 string
+	// Verified is set when the saved file matched MD5
+	Verified bool
 }
 
-func formatExpirationDate(expiresAt string) string {
-	if expiresAt == "" {
-		return "Never"
+// DownloadToFile saves an uploaded file to output, or when output is empty to
+// the name in the Content-Disposition header, falling back to the file id.
+// Data is written to output + ".part" and renamed when complete; a .part file
+// left by an interrupted download is resumed with a Range request. With verify,
+// a file that doesn't match the server's MD5 is discarded.
+func (c *Client) DownloadToFile(fileURL, output string, verify, showProgress bool) (*DownloadResult, error) {
+	resp, err := c.HTTPClient.Head(fileURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", fileURL, err)
+	}
+	resp.Body.Close()
+	if err := downloadStatusError(resp); err != nil {
+		return nil, err
+	}
+	if output == "" {
+		output = downloadFilename(resp.Header.Get("Content-Disposition"), fileURL)
+	}
+
+	// Asked before downloading, downloads of one-time files delete them
+	meta, err := c.GetFileMeta(fileURL)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DownloadResult{Path: output}
+	if meta != nil {
+		result.MD5 = meta.MD5
+	}
+
+	partPath := output + ".part"
+	if info, err := os.Stat(partPath); err == nil {
+		result.Resumed = info.Size()
+	}
+
+	size, err := c.downloadPart(fileURL, partPath, result.Resumed, showProgress)
+	if errors.Is(err, errStaleDownload) {
+		// The .part file doesn't fit the file on the server, start over
+		result.Resumed = 0
+		size, err = c.downloadPart(fileURL, partPath, 0, showProgress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Size = size
+
+	if verify && result.MD5 != "" {
+		localMD5, err := calculateFileMD5(partPath)
+		if err != nil {
+			return nil, err
+		}
+		if !verifyHash(hashMD5, localMD5, result.MD5) {
+			os.Remove(partPath)
+			return nil, fmt.Errorf("MD5 verification failed: got %s, the server reports %s", localMD5, result.MD5)
+		}
+		result.Verified = true
+	}
+
+	if err := os.Rename(partPath, output); err != nil {
+		return nil, fmt.Errorf("failed to save %s: %w", output, err)
+	}
+	return result, nil
+}
+
+// errStaleDownload is a .part file longer than the file on the server
+var errStaleDownload = errors.New("partial download doesn't match the file")
+
+// downloadPart fetches fileURL into partPath from offset on and returns the
+// size of the complete file
+func (c *Client) downloadPart(fileURL, partPath string, offset int64, showProgress bool) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download %s: %w", fileURL, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	total := resp.ContentLength
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags = os.O_WRONLY | os.O_APPEND
+		if _, size, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			total, _ = strconv.ParseInt(size, 10, 64)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing left past the offset: the .part file is complete when it is
+		// exactly as long as the file
+		_, size, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		if total, err := strconv.ParseInt(size, 10, 64); err == nil && total == offset {
+			return total, nil
+		}
+		return 0, errStaleDownload
+	case http.StatusOK:
+		offset = 0 // the server ignored the range, the whole file is sent again
+	default:
+		if err := downloadStatusError(resp); err != nil {
+			return 0, err
+		}
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", partPath, err)
+	}
+	defer file.Close()
+
+	progress := &downloadProgress{done: offset, total: total, show: showProgress && total > 0}
+	n, err := io.Copy(file, io.TeeReader(resp.Body, progress))
+	if err != nil {
+		return 0, fmt.Errorf("download of %s interrupted after %d bytes, run the command again to resume: %w", fileURL, offset+n, err)
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", partPath, err)
+	}
+	if total > 0 && offset+n != total {
+		return 0, fmt.Errorf("download of %s incomplete: got %d of %d bytes, run the command again to resume", fileURL, offset+n, total)
+	}
+	return offset + n, nil
+}
+
+// downloadStatusError turns a failed download response into an error
+func downloadStatusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return nil
+	case http.StatusNotFound:
+		return errFileNotFound
+	case http.StatusGone:
+		return errFileExpired
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("download refused with status %d, the file may be password protected", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("download failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// downloadFilename picks the local name of a download: the filename of the
+// Content-Disposition header, or the last segment of the URL
+func downloadFilename(disposition, fileURL string) string {
+	if _, params, err := mime.ParseMediaType(disposition); err == nil {
+		name := filepath.Base(strings.ReplaceAll(params["filename"], "\\", "/"))
+		if name != "." && name != "/" && name != ".." {
+			return name
+		}
+	}
+	if u, err := url.Parse(fileURL); err == nil {
+		if name := path.Base(u.Path); name != "." && name != "/" {
+			return name
+		}
+	}
+	return "download"
+}
+
+// downloadProgress draws the progress bar of a download as bytes arrive
+type downloadProgress struct {
+	done, total int64
+	show        bool
+	percent     int
+}
+
+func (p *downloadProgress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	// Redrawn once per percent, not for every write
+	if percent := int(p.done * 100 / max(p.total, 1)); p.show && (percent != p.percent || p.done == p.total) {
+		p.percent = percent
+		printProgress(int(p.done), int(p.total), true)
+	}
+	return len(b), nil
+}
+
+// GetScanStatus fetches the virus scan result from the scan_url of an upload
+func (c *Client) GetScanStatus(scanURL string) (*ScanStatusResponse, error) {
+	resp, err := c.HTTPClient.Get(scanURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scan status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("scan status request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var status ScanStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode scan status response: %w", err)
+	}
+	return &status, nil
+}
+
+// WaitForScan polls the scan status every interval until the scan is no longer pending
+func (c *Client) WaitForScan(scanURL string, interval time.Duration) (*ScanStatusResponse, error) {
+	for {
+		status, err := c.GetScanStatus(scanURL)
+		if err != nil {
+			return nil, err
+		}
+		if status.Status != "pending" {
+			return status, nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// scanPollInterval is how often --wait-for-scan checks the scan status
+var scanPollInterval = 2 * time.Second
+
+// awaitScan waits for a pending scan and fails when the upload was deleted by it
+func awaitScan(status, scanURL string) error {
+	if status == "" {
+		fmt.Printf("Warning: the server did not report a virus scan status\n")
+		return nil
+	}
+
+	var signature string
+	if status == "pending" {
+		fmt.Printf("Waiting for virus scan...\n")
+		result, err := client.WaitForScan(scanURL, scanPollInterval)
+		if err != nil {
+			return err
+		}
+		status, signature = result.Status, result.Signature
+	}
+
+	switch status {
+	case "clean":
+		fmt.Printf("Virus scan: clean\n")
+		return nil
+	case "infected":
+		return fmt.Errorf("virus scan found %s, the file has been deleted", signature)
+	default:
+		return fmt.Errorf("virus scan failed (%s), the file has been deleted", status)
+	}
+}
+
+// existingUpload describes how an existing upload compares to the local content
+type existingUpload int
+
+const (
+	uploadMissing existingUpload = iota
+	uploadExists
+	uploadIdentical
+	uploadDifferent
+)
+
+// checkExistingUpload looks up target (an id or URL) on the server and compares
+// it to localMD5 when both sides have a hash
+func (c *Client) checkExistingUpload(target, localMD5 string) (*FileMeta, existingUpload, error) {
+	meta, err := c.GetFileMeta(buildFileURL(c.BaseURL, target))
+	if err != nil {
+		return nil, uploadMissing, err
+	}
+	if meta == nil {
+		return nil, uploadMissing, nil
+	}
+
+	switch {
+	case localMD5 == "" || meta.MD5 == "":
+		return meta, uploadExists, nil
+	case verifyHash(hashMD5, localMD5, meta.MD5):
+		return meta, uploadIdentical, nil
+	default:
+		return meta, uploadDifferent, nil
+	}
+}
+
+// ifNotExistsSlug stores an upload checked with --if-not-exists under the
+// checked id, so the next run finds it there. A --slug must name the same id.
+func ifNotExistsSlug(target string, options map[string]string) error {
+	if target == "" {
+		return nil
+	}
+	id := path.Base(strings.TrimSuffix(target, "/"))
+	if slug := options["slug"]; slug != "" && slug != id {
+		return fmt.Errorf("--if-not-exists %s and --slug %s name different files", target, slug)
+	}
+	options["slug"] = id
+	return nil
+}
+
+// skipIfExists reports whether the upload should be skipped because target
+// already exists, printing the existing URL
+func skipIfExists(target, localMD5 string) (bool, error) {
+	meta, state, err := client.checkExistingUpload(target, localMD5)
+	if err != nil {
+		return false, err
+	}
+
+	switch state {
+	case uploadMissing:
+		return false, nil
+	case uploadIdentical:
+		fmt.Printf("Already uploaded with identical content, skipping\n")
+	case uploadDifferent:
+		fmt.Fprintf(os.Stderr, "Warning: %s exists but its content differs from the local file (server MD5: %s, local MD5: %s)\n",
+			meta.URL, meta.MD5, localMD5)
+		fmt.Printf("Already uploaded, skipping\n")
+	default:
+		fmt.Printf("Already uploaded, skipping\n")
+	}
+	fmt.Printf("URL: %s\n", meta.URL)
+	return true, nil
+}
+
+// ensureExpiration asks for an expiration when the server requires one and none
+// was given. Without a prompt (stdin isn't a terminal) it fails with a hint.
+func (c *Client) ensureExpiration(options map[string]string, prompt io.Reader) error {
+	if options["expires"] != "" {
+		return nil
+	}
+
+	limits, err := c.GetLimits()
+	if err != nil || !limits.RequireExpiration {
+		return nil
+	}
+
+	if prompt == nil {
+		return fmt.Errorf("the server requires an expiration: pass --expires (e.g. --expires 24 for one day)")
+	}
+
+	fmt.Printf("The server requires an expiration. Expire in (hours or date): ")
+	line, _ := bufio.NewReader(prompt).ReadString('\n')
+	expires := strings.TrimSpace(line)
+	if expires == "" {
+		return fmt.Errorf("no expiration given, the server requires one")
+	}
+	options["expires"] = FormatExpiration(expires)
+	return nil
+}
+
+// terminalInput returns stdin when it is an interactive terminal, or nil
+func terminalInput() io.Reader {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return os.Stdin
+}
+
+// checkUploadLimits returns warnings for files the server will obviously
+// refuse. The upload is still attempted, since the server has the final say.
+// Servers that don't expose limits are not checked.
+func (c *Client) checkUploadLimits(filePath string) ([]string, error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := c.GetLimits()
+	if err != nil {
+		return nil, nil
+	}
+
+	var warnings []string
+	if limits.MaxSize > 0 && fileInfo.Size() > limits.MaxSize {
+		warnings = append(warnings, fmt.Sprintf("file size (%.1f MB) exceeds the server limit of %.1f MB",
+			float64(fileInfo.Size())/1024/1024, float64(limits.MaxSize)/1024/1024))
+	}
+
+	name := strings.ToLower(filepath.Base(filePath))
+	for _, ext := range limits.BlockedExtensions {
+		if ext != "" && strings.HasSuffix(name, strings.ToLower(ext)) {
+			warnings = append(warnings, fmt.Sprintf("files with extension %s are not accepted by the server", ext))
+		}
+	}
+
+	return warnings, nil
+}
+
+func (c *Client) UploadFileChunked(filePath string, chunkSize int64, expires string, showProgress bool) (*ChunkedUploadCompleteResponse, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	fileSize := fileInfo.Size()
+	if chunkSize <= 0 {
+		chunkSize = 4 * 1024 * 1024
+	}
+
+	contentHash, err := calculateFileMD5(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	initResp, err := c.InitChunkedUploadWithHash(filepath.Base(filePath), fileSize, chunkSize, contentHash, expires)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize chunked upload: %w", err)
+	}
+
+	if initResp.AlreadyExists {
+		fmt.Printf("File already exists on server, skipping upload\n")
+		return &ChunkedUploadCompleteResponse{
+			Message:       "File already exists",
+			Progress:      100,
+			FileURL:       initResp.FileURL,
+			MD5:           initResp.MD5,
+			ExpiresAt:     initResp.ExpiresAt,
+			ExpiresInDays: initResp.ExpiresInDays,
+		}, nil
+	}
+
+	uploaded := make(map[int]bool, len(initResp.UploadedChunks))
+	for _, i := range initResp.UploadedChunks {
+		uploaded[i] = true
+	}
+
+	if len(uploaded) > 0 {
+		fmt.Printf("Resuming chunked upload: %s (%d of %d chunks already uploaded)\n",
+			initResp.UploadID, len(uploaded), initResp.TotalChunks)
+	} else {
+		fmt.Printf("Initialized chunked upload: %s (%d chunks)\n", initResp.UploadID, initResp.TotalChunks)
+	}
+	if showProgress {
+		fmt.Printf("Uploading...\n")
+	}
+
+	for i := 0; i < initResp.TotalChunks; i++ {
+		if uploaded[i] {
+			printProgress(i+1, initResp.TotalChunks, showProgress)
+			continue
+		}
+
+		chunkData := make([]byte, initResp.ChunkSize)
+		n, err := file.ReadAt(chunkData, int64(i)*initResp.ChunkSize)
+		if err != nil && err != io.EOF {
+			c.abortAfterFailure(initResp.UploadID)
+			return nil, fmt.Errorf("failed to read chunk %d: %w", i, err)
+		}
+		chunkData = chunkData[:n]
+
+		resp, err := c.uploadChunkWithRetries(initResp.UploadID, i, chunkData)
+		if err != nil {
+			c.abortAfterFailure(initResp.UploadID)
+			return nil, fmt.Errorf("failed to upload chunk %d: %w", i, err)
+		}
+
+		if resp != nil {
+			printProgress(i+1, initResp.TotalChunks, showProgress)
+			return resp, nil
+		}
+
+		printProgress(i+1, initResp.TotalChunks, showProgress)
+	}
+
+	statusResp, err := c.GetChunkedUploadStatus(initResp.UploadID)
+	if err != nil {
+		return &ChunkedUploadCompleteResponse{
+			Message:  "Upload completed",
+			Progress: 100,
+			FileURL:  fmt.Sprintf("%s%s", c.BaseURL, initResp.UploadID),
+			MD5:      "",
+			Token:    "",
+		}, nil
+	}
+
+	if statusResp.Progress != 100 {
+		return nil, fmt.Errorf("upload incomplete: %d%%", statusResp.Progress)
+	}
+
+	return &ChunkedUploadCompleteResponse{
+		Message:  "Upload completed",
+		Progress: 100,
+		FileURL:  fmt.Sprintf("%s%s", c.BaseURL, initResp.UploadID),
+		MD5:      "",
+		Token:    "",
+	}, nil
+}
+
+// uploadChunkWithRetries uploads a chunk, retrying like withRetries. Before a
+// retry the session's status is fetched, so a chunk that reached the server
+// before its response was lost isn't sent again.
+func (c *Client) uploadChunkWithRetries(uploadID string, index int, data []byte) (*ChunkedUploadCompleteResponse, error) {
+	var resp *ChunkedUploadCompleteResponse
+	attempted := false
+	err := c.withRetries(func() error {
+		if attempted {
+			status, err := c.GetChunkedUploadStatus(uploadID)
+			if err == nil && slices.Contains(status.UploadedChunks, index) {
+				resp = nil
+				return nil
+			}
+		}
+		attempted = true
+
+		var err error
+		resp, err = c.UploadChunk(uploadID, index, data)
+		return err
+	})
+	return resp, err
+}
+
+// abortAfterFailure aborts an upload that can't continue, so its chunks don't
+// stay on the server until the session expires
+func (c *Client) abortAfterFailure(uploadID string) {
+	if err := c.AbortChunkedUpload(uploadID); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to abort upload %s: %v\n", uploadID, err)
+	}
+}
+
+// statusError is a response with an unexpected status
+type statusError struct {
+	StatusCode int
+	// RetryAfter is the wait asked for by the server's Retry-After header
+	RetryAfter time.Duration
+	message    string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// newStatusError reads the body of a failed response into an error starting
+// with what failed
+func newStatusError(resp *http.Response, what string) *statusError {
+	body, _ := io.ReadAll(resp.Body)
+	return &statusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		message:    fmt.Sprintf("%s with status %d: %s", what, resp.StatusCode, string(body)),
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// maxRetryWait is the longest Retry-After waited for; servers asking for more
+// fail the request right away
+const maxRetryWait = 5 * time.Minute
+
+// retrySleep waits between retries, replaced by tests
+var retrySleep = time.Sleep
+
+// transientError reports whether a request that failed with err may succeed
+// when sent again: network errors, 429 and 5xx responses. Responses that
+// succeeded or were refused for good are never sent twice.
+func transientError(err error) bool {
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(urlErr.Err, &netErr) || errors.Is(urlErr.Err, io.EOF) || errors.Is(urlErr.Err, io.ErrUnexpectedEOF)
+}
+
+// withRetries calls send until it succeeds or fails for good, sending it
+// again up to c.Retries times after transient errors. The waits grow
+// exponentially from c.RetryBackoff, with jitter, unless the server asked
+// for one with Retry-After.
+func (c *Client) withRetries(send func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := send()
+		if err == nil || attempt >= c.Retries || !transientError(err) {
+			return err
+		}
+
+		var wait time.Duration
+		var status *statusError
+		if errors.As(err, &status) && status.RetryAfter > 0 {
+			if status.RetryAfter > maxRetryWait {
+				return err
+			}
+			wait = status.RetryAfter
+		} else if backoff := c.RetryBackoff << attempt; backoff > 0 {
+			wait = backoff/2 + rand.N(backoff/2+1)
+		}
+
+		fmt.Fprintf(os.Stderr, "Warning: %v, retrying in %s (%d/%d)\n", err, wait.Round(time.Millisecond), attempt+1, c.Retries)
+		retrySleep(wait)
+	}
+}
+
+func (c *Client) DeleteFile(fileURL, token string) error {
+	var req *http.Request
+	var err error
+	if c.UseDeleteMethod {
+		req, err = http.NewRequest("DELETE", fileURL, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("X-Token", token)
+	} else {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		writer.WriteField("token", token)
+		writer.WriteField("delete", "")
+		writer.Close()
+
+		req, err = http.NewRequest("POST", fileURL, &buf)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("delete failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+func (c *Client) SetExpiration(fileURL, token, expires string) error {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("token", token)
+	writer.WriteField("expires", expires)
+	writer.Close()
+
+	req, err := http.NewRequest("POST", fileURL, &buf)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to set expiration: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("set expiration failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+func printProgress(current, total int, showProgress bool) {
+	if !showProgress {
+		return
+	}
+
+	percent := float64(current) / float64(total) * 100
+	barWidth := 30
+	filled := int(float64(barWidth) * percent / 100)
+
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
+	fmt.Printf("\r%s %.1f%% (%d/%d)", bar, percent, current, total)
+
+	if current == total {
+		fmt.Println()
+	}
+}
+
+// FormatExpiration prepares an --expires value for the server. Durations like
+// "7d" or "2w3d" become a Unix timestamp in milliseconds, which servers
+// without duration support accept too. A bare number stays hours.
+func FormatExpiration(expiration string) string {
+	if hours, err := strconv.Atoi(expiration); err == nil {
+		return strconv.Itoa(hours)
+	}
+
+	if d, err := utils.ParseDuration(expiration); err == nil {
+		return strconv.FormatInt(time.Now().Add(d).UnixMilli(), 10)
+	}
+
+	if _, err := time.Parse(time.RFC3339, expiration); err == nil {
+		return expiration
+	}
+
+	if _, err := time.Parse("2006-01-02", expiration); err == nil {
+		return expiration
+	}
+
+	if _, err := time.Parse("2006-01-02T15:04:05", expiration); err == nil {
+		return expiration
+	}
+
+	if _, err := time.Parse("2006-01-02 15:04:05", expiration); err == nil {
+		return expiration
+	}
+
+	return expiration
+}
+
+// Hash algorithms for verifying uploads with --hash
+const (
+	hashMD5    = "md5"
+	hashSHA256 = "sha256"
+)
+
+// hashLabels name the algorithms in upload output
+var hashLabels = map[string]string{
+	hashMD5:    "MD5",
+	hashSHA256: "SHA-256",
+}
+
+func calculateFileMD5(filePath string) (string, error) {
+	return calculateFileHash(hashMD5, filePath)
+}
+
+// calculateFileHash hashes a local file with the md5 or sha256 algorithm
+func calculateFileHash(algo, filePath string) (string, error) {
+	var h hash.Hash
+	switch algo {
+	case hashMD5:
+		h = md5.New()
+	case hashSHA256:
+		h = sha256.New()
+	default:
+		return "", fmt.Errorf("unsupported hash %q (use md5 or sha256)", algo)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to calculate %s: %w", hashLabels[algo], err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyHash compares a local hash with the one reported by the server. Hashes
+// of unknown algorithms never match.
+func verifyHash(algo, localHash, serverHash string) bool {
+	if _, ok := hashLabels[algo]; !ok {
+		return false
+	}
+	return strings.EqualFold(localHash, serverHash)
+}
+
+// printHash prints the server's hash of an upload, checked against the local
+// one when there is a local copy. Servers that predate SHA-256 don't report it.
+func printHash(algo, localHash, serverHash string) {
+	label := hashLabels[algo]
+	switch {
+	case serverHash == "" && localHash != "":
+		fmt.Printf("%s: not reported by the server (local: %s)\n", label, localHash)
+	case localHash == "":
+		fmt.Printf("%s: %s\n", label, serverHash)
+	case verifyHash(algo, localHash, serverHash):
+		fmt.Printf("%s: %s ✓\n", label, serverHash)
+	default:
+		fmt.Printf("%s: %s (verification failed - local: %s)\n", label, serverHash, localHash)
+	}
+}
+
+// reportedHash picks the server's hash for the algorithm
+func reportedHash(algo, md5Hash, sha256Hash string) string {
+	if algo == hashSHA256 {
+		return sha256Hash
+	}
+	return md5Hash
+}
+
+func formatExpirationDate(expiresAt string) string {
+	if expiresAt == "" {
+		return "Never"
 	}
 
 	// Parse the RFC3339 date
@@ -600,6 +1714,262 @@ func buildFileURL(baseURL, input string) string {
 	return baseURL + input
 }
 
+// historyFile overrides the history location, used by tests
+var historyFile string
+
+// historyFilePath returns where upload history is stored (~/.drop/uploads.json)
+func historyFilePath() string {
+	if historyFile != "" {
+		return historyFile
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".drop", "uploads.json")
+}
+
+// loadHistory reads the upload history; a missing file is an empty history
+func loadHistory() ([]HistoryEntry, error) {
+	data, err := os.ReadFile(historyFilePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []HistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("corrupt history file %s: %w", historyFilePath(), err)
+	}
+	return entries, nil
+}
+
+// saveHistory writes the upload history, readable only by the user since it holds tokens
+func saveHistory(entries []HistoryEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	historyPath := historyFilePath()
+	if err := os.MkdirAll(filepath.Dir(historyPath), 0o700); err != nil {
+		return err
+	}
+	tmpPath := historyPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, historyPath)
+}
+
+// historyMu serializes history updates of parallel uploads
+var historyMu sync.Mutex
+
+// SessionEntry is the upload token of an unfinished chunked upload
+type SessionEntry struct {
+	Server      string    `json:"server"`
+	UploadID    string    `json:"upload_id"`
+	UploadToken string    `json:"upload_token"`
+	ContentHash string    `json:"content_hash,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// sessionLifetime is how long the server keeps an unfinished chunked upload
+const sessionLifetime = 24 * time.Hour
+
+// sessionsFilePath returns where upload tokens are kept (~/.drop/sessions.json)
+func sessionsFilePath() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, ".drop", "sessions.json")
+}
+
+// loadSessions reads the sessions file, leaving out sessions the server has
+// already expired. A missing file has no sessions.
+func loadSessions(sessionsPath string) ([]SessionEntry, error) {
+	data, err := os.ReadFile(sessionsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []SessionEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("corrupt sessions file %s: %w", sessionsPath, err)
+	}
+	return slices.DeleteFunc(entries, func(e SessionEntry) bool {
+		return time.Since(e.CreatedAt) > sessionLifetime
+	}), nil
+}
+
+// sessionsMu serializes sessions file updates of parallel uploads
+var sessionsMu sync.Mutex
+
+// updateSessions rewrites the sessions file with what update returns. It is
+// readable only by the user since the tokens grant access to the sessions.
+func updateSessions(sessionsPath string, update func([]SessionEntry) []SessionEntry) error {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	entries, err := loadSessions(sessionsPath)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(update(entries), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(sessionsPath), 0o700); err != nil {
+		return err
+	}
+	tmpPath := sessionsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, sessionsPath)
+}
+
+// recordHistory appends an upload to the history. Failures only print a warning,
+// the upload itself already succeeded.
+func recordHistory(entry HistoryEntry) {
+	if entry.Token == "" {
+		return
+	}
+	if entry.Server == "" {
+		entry.Server = baseURL
+	}
+	if entry.UploadedAt.IsZero() {
+		entry.UploadedAt = time.Now()
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	entries, err := loadHistory()
+	if err == nil {
+		err = saveHistory(append(entries, entry))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not save upload history: %v\n", err)
+	}
+}
+
+// findHistoryEntry looks up the newest entry for a file ID, path or URL on the given server
+func findHistoryEntry(entries []HistoryEntry, server, input string) (HistoryEntry, bool) {
+	fileURL := buildFileURL(server, input)
+	id := path.Base(strings.TrimSuffix(fileURL, "/"))
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].URL == fileURL {
+			return entries[i], true
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Server == server && path.Base(entries[i].URL) == id {
+			return entries[i], true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// forgetHistory removes the entries of a deleted file. Failures only print a
+// warning, the file is already gone from the server.
+func forgetHistory(fileURL string) {
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not update upload history: %v\n", err)
+		return
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.URL != fileURL {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(entries) {
+		return
+	}
+	if err := saveHistory(kept); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not update upload history: %v\n", err)
+	}
+}
+
+// daysRemaining counts the days left before an upload expires, rounded up.
+// Uploads without an expiration never run out.
+func daysRemaining(expiresAt string, now time.Time) (int, bool) {
+	if expiresAt == "" {
+		return 0, false
+	}
+	t, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return 0, false
+	}
+	return int(math.Ceil(t.Sub(now).Hours() / 24)), true
+}
+
+// historyExpired reports whether the upload's expiration has passed
+func historyExpired(entry HistoryEntry, now time.Time) bool {
+	t, err := time.Parse(time.RFC3339, entry.ExpiresAt)
+	return err == nil && !t.After(now)
+}
+
+// printHistory lists recorded uploads, newest first. Expired uploads are left
+// out unless showExpired is set, in which case they are marked as expired.
+func printHistory(out io.Writer, entries []HistoryEntry, now time.Time, showExpired, asJSON bool) error {
+	listed := make([]HistoryEntry, 0, len(entries))
+	hidden := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !showExpired && historyExpired(entries[i], now) {
+			hidden++
+			continue
+		}
+		listed = append(listed, entries[i])
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listed)
+	}
+
+	if len(listed) == 0 {
+		fmt.Fprintf(out, "No uploads recorded in %s\n", historyFilePath())
+	} else {
+		rows := make([]utils.TableRow, 0, len(listed))
+		for _, entry := range listed {
+			expires := "never"
+			if days, ok := daysRemaining(entry.ExpiresAt, now); ok {
+				expires = formatDaysRemaining(days)
+			}
+			if historyExpired(entry, now) {
+				expires = "expired"
+			}
+			size := ""
+			if entry.Size > 0 {
+				size = utils.FormatFileSize(entry.Size)
+			}
+			rows = append(rows, utils.TableRow{Fields: []string{
+				entry.URL, entry.Name, size, entry.UploadedAt.Local().Format("2006-01-02 15:04"), expires, redactToken(entry.Token),
+			}})
+		}
+		fmt.Fprint(out, utils.GenerateASCIITable([]string{"URL", "Name", "Size", "Uploaded", "Expires", "Token"}, rows))
+	}
+
+	if hidden > 0 {
+		fmt.Fprintf(out, "%d expired upload(s) hidden, use --expired to show them\n", hidden)
+	}
+	return nil
+}
+
+// redactToken hides all but the first characters of a token
+func redactToken(token string) string {
+	if len(token) <= 4 {
+		return strings.Repeat("*", len(token))
+	}
+	return token[:4] + strings.Repeat("*", len(token)-4)
+}
+
 var rootCmd = &cobra.Command{
 	Use:   "drop",
 	Short: "Drop Client - Upload and manage files",
@@ -609,16 +1979,24 @@ Features:
   • Upload local files or files from URLs
   • Shorten URLs with custom options
   • Automatic chunked upload for large files
-  • File management (delete, set expiration)
+  • File management (download, delete, set expiration)
   • Configuration management
   • Progress tracking for uploads
-  • Automatic MD5 verification for integrity checking
+  • Automatic MD5 or SHA-256 verification for integrity checking
 
 Quick start:
   drop upload file.txt                    # Upload a file
+  drop upload *.png --concurrency 4       # Upload several files
+  echo hello | drop upload - --filename hello.txt  # Upload standard input
   drop upload --url https://example.com/file.txt  # Upload from URL
   drop shorten https://example.com/long/url  # Shorten a URL
   drop delete abc123 --token your-token   # Delete a file
+  drop download abc123                    # Download a file
+  drop token show abc123                  # Show the token of an earlier upload
+  drop list                               # List files uploaded from this machine
+  drop uploads list                       # List unfinished chunked uploads
+  drop migrate --to https://new.example.com/  # Copy your uploads to another server
+  drop whoami                             # Show the server and API key in use
   drop config set server https://drop.example.com/  # Set server URL`,
 	Version: fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date),
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
@@ -627,46 +2005,138 @@ Quick start:
 			baseURL = "http://localhost:3000/"
 		}
 		client = NewClient(baseURL)
+		client.SetAPIKey(viper.GetString("api-key"))
+		client.Retries = viper.GetInt("retries")
+		client.RetryBackoff = viper.GetDuration("retry-backoff")
+		client.SessionsFile = sessionsFilePath()
 	},
 }
 
+// addUploadOptionFlags registers the flags that map to upload form fields
+func addUploadOptionFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("secret", false, "Generate a hard-to-guess URL")
+	cmd.Flags().BoolP("one-time", "o", false, "Delete file after first download")
+	cmd.Flags().Bool("expire-on-download", false, "Delete file after first download (same as --one-time)")
+	cmd.Flags().Bool("self-destruct", false, "Delete file after first download (same as --one-time)")
+	cmd.Flags().Int("max-downloads", 0, "Delete file after this many downloads")
+	cmd.Flags().Int("max-views", 0, "Delete file after this many downloads (same as --max-downloads)")
+	cmd.Flags().StringP("expires", "e", "", "Set expiration time (hours, duration like 7d or 2w3d, RFC3339, ISO date/datetime, SQL datetime)")
+	cmd.Flags().String("slug", "", "Store the file under this readable name instead of a random id")
+	cmd.Flags().String("password", "", "Require this password to download the file")
+}
+
+// uploadOptionsFromFlags maps the upload flags to the server's form fields
+func uploadOptionsFromFlags(cmd *cobra.Command) (map[string]string, error) {
+	secret, _ := cmd.Flags().GetBool("secret")
+	oneTime, _ := cmd.Flags().GetBool("one-time")
+	expireOnDownload, _ := cmd.Flags().GetBool("expire-on-download")
+	selfDestruct, _ := cmd.Flags().GetBool("self-destruct")
+	maxDownloads, _ := cmd.Flags().GetInt("max-downloads")
+	if !cmd.Flags().Changed("max-downloads") {
+		maxDownloads, _ = cmd.Flags().GetInt("max-views")
+	}
+	expires, _ := cmd.Flags().GetString("expires")
+	slug, _ := cmd.Flags().GetString("slug")
+	password, _ := cmd.Flags().GetString("password")
+
+	options := make(map[string]string)
+	if secret {
+		options["secret"] = "true"
+	}
+	if oneTime || expireOnDownload || selfDestruct {
+		options["one_time"] = "true"
+	}
+	if maxDownloads < 0 {
+		return nil, fmt.Errorf("--max-downloads must be a positive number")
+	}
+	if maxDownloads > 0 {
+		options["max_downloads"] = strconv.Itoa(maxDownloads)
+	}
+	if expires != "" {
+		options["expires"] = FormatExpiration(expires)
+	}
+	if slug = strings.TrimSpace(slug); slug != "" {
+		options["slug"] = slug
+	}
+	if password != "" {
+		options["password"] = password
+	}
+	return options, nil
+}
+
 var uploadCmd = &cobra.Command{
-	Use:     "upload [file]",
+	Use:     "upload [file...]",
 	Aliases: []string{"u", "up"},
-	Short:   "Upload a file to the server",
-	Long: `Upload a file to the Drop server.
+	Short:   "Upload files to the server",
+	Long: `Upload files to the Drop server.
 
 You can upload:
   • Local files: drop upload file.txt
+  • Several files: drop upload *.png --concurrency 4
   • From URLs: drop upload --url https://example.com/file.txt
   • Large files (auto-chunked): drop upload large-file.zip
+  • Standard input: some-command | drop upload - --filename output.log
 
 Options:
-  --chunked, -c     Force chunked upload for any file size
-  --secret          Generate a hard-to-guess URL
-  --one-time, -o    Delete file after first download
-  --expires, -e     Set expiration time`,
-	Args: cobra.MaximumNArgs(1),
+  --chunked, -c             Force chunked upload for any file size
+  --secret                  Generate a hard-to-guess URL
+  --one-time, -o            Delete file after first download
+  --expire-on-download      Same as --one-time (sends one_time)
+  --self-destruct           Same as --one-time
+  --max-downloads N         Delete file after N downloads (sends max_downloads)
+  --max-views N             Same as --max-downloads
+  --expires, -e             Set expiration time
+  --slug NAME               Store the file as NAME plus its extension instead
+                            of a random id, e.g. --slug q3-report
+  --password PASSWORD       Require PASSWORD to download the file
+  --if-not-exists ID        Skip the upload if ID (or its URL) already exists
+                            on the server, warning when its content differs;
+                            otherwise store the file as ID, like --slug ID
+  --wait-for-scan           Wait for the server's virus scan and exit with an
+                            error if the file was found infected
+  --hash ALGO               Verify the upload with md5 (default) or sha256
+  --filename NAME           Name of an upload read from standard input (-)
+  --concurrency N           Upload up to N of several files at once (default 1)
+  --fail-fast               Stop uploading several files at the first failure
+                            instead of reporting all failures at the end
+
+Several files are summarized in a table; the command fails when any of them
+failed to upload or verify.
+
+--max-downloads requires a server that supports max_downloads; older
+servers ignore it.
+
+Servers that require an expiration make the CLI ask for one when --expires
+is missing.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		url, _ := cmd.Flags().GetString("url")
 		chunked, _ := cmd.Flags().GetBool("chunked")
 		chunkSize, _ := cmd.Flags().GetString("chunk-size")
-		secret, _ := cmd.Flags().GetBool("secret")
-		oneTime, _ := cmd.Flags().GetBool("one-time")
-		expires, _ := cmd.Flags().GetString("expires")
-
-		options := make(map[string]string)
-		if secret {
-			options["secret"] = ""
+		options, err := uploadOptionsFromFlags(cmd)
+		if err != nil {
+			return err
 		}
-		if oneTime {
-			options["one_time"] = ""
+		if err := client.ensureExpiration(options, terminalInput()); err != nil {
+			return err
 		}
-		if expires != "" {
-			options["expires"] = FormatExpiration(expires)
+		_, oneTime := options["one_time"]
+		ifNotExists, _ := cmd.Flags().GetString("if-not-exists")
+		if err := ifNotExistsSlug(ifNotExists, options); err != nil {
+			return err
+		}
+		waitForScan, _ := cmd.Flags().GetBool("wait-for-scan")
+		hashAlgo, _ := cmd.Flags().GetString("hash")
+		hashAlgo = strings.ToLower(hashAlgo)
+		if _, ok := hashLabels[hashAlgo]; !ok {
+			return fmt.Errorf("invalid --hash %q (use md5 or sha256)", hashAlgo)
 		}
 
 		if url != "" {
+			if ifNotExists != "" {
+				if skip, err := skipIfExists(ifNotExists, ""); err != nil || skip {
+					return err
+				}
+			}
 			if oneTime {
 				fmt.Printf("Starting one-time upload from URL (file will be deleted after first download)...\n")
 			}
@@ -674,7 +2144,11 @@ Options:
 			if err != nil {
 				return err
 			}
-			printUploadResponse(resp, "") // No local MD5 for URL uploads
+			recordHistory(HistoryEntry{URL: resp.URL, Token: resp.Token, Name: url, Size: resp.Size, MD5: resp.MD5, ExpiresAt: resp.ExpiresAt})
+			printUploadResponse(resp, hashAlgo, "") // No local copy to verify URL uploads against
+			if waitForScan {
+				return awaitScan(resp.ScanStatus, resp.ScanURL)
+			}
 			return nil
 		}
 
@@ -682,79 +2156,294 @@ Options:
 			return fmt.Errorf("file path required when not using --url")
 		}
 
-		filePath := args[0]
-
-		// Calculate MD5 hash of local file for verification (unless disabled)
-		var localMD5 string
+		settings := uploadSettings{options: options, chunked: chunked, hashAlgo: hashAlgo, ifNotExists: ifNotExists, oneTime: oneTime}
 		noVerify, _ := cmd.Root().PersistentFlags().GetBool("no-verify")
-		if !noVerify {
-			fmt.Printf("Calculating MD5 hash...\n")
-			var err error
-			localMD5, err = calculateFileMD5(filePath)
+		settings.verify = !noVerify
+		noProgress, _ := cmd.Root().PersistentFlags().GetBool("no-progress")
+		settings.showProgress = !noProgress
+		settings.thresholdLabel, _ = cmd.Root().PersistentFlags().GetString("auto-chunk-threshold")
+		if settings.threshold, err = parseSize(settings.thresholdLabel); err != nil {
+			return fmt.Errorf("invalid auto-chunk-threshold: %w", err)
+		}
+		if chunkSize != "" {
+			sizeMB, err := strconv.ParseInt(chunkSize, 10, 64)
 			if err != nil {
-				return err
+				return fmt.Errorf("invalid chunk size: %s", chunkSize)
 			}
+			settings.chunkSize = sizeMB * 1024 * 1024
 		}
 
-		// Check if we should auto-enable chunked upload
-		shouldUseChunked := chunked
-		if !shouldUseChunked {
-			// Get file size
-			fileInfo, err := os.Stat(filePath)
+		if len(args) > 1 {
+			return runBatchUpload(cmd, args, settings, waitForScan)
+		}
+
+		filePath := args[0]
+		filename, _ := cmd.Flags().GetString("filename")
+		if filePath == "-" {
+			// Spooled to a file first, stdin can't be sized, hashed or chunked
+			spooled, cleanup, err := spoolStdin(cmd.InOrStdin(), filename)
 			if err != nil {
 				return err
 			}
+			defer cleanup()
+			filePath = spooled
+		} else if filename != "" {
+			return fmt.Errorf("--filename is only used when uploading from standard input (-)")
+		}
 
-			// Get auto-chunk threshold
-			thresholdStr, _ := cmd.Root().PersistentFlags().GetString("auto-chunk-threshold")
-			threshold, err := parseSize(thresholdStr)
-			if err != nil {
-				return fmt.Errorf("invalid auto-chunk-threshold: %w", err)
+		uploaded, err := uploadPath(filePath, settings, false)
+		if err != nil || uploaded == nil {
+			return err
+		}
+		if waitForScan {
+			return awaitScan(uploaded.scanStatus, uploaded.scanURL)
+		}
+		return nil
+	},
+}
+
+// uploadSettings are the upload flags applying to every file of a drop upload
+type uploadSettings struct {
+	options        map[string]string
+	chunked        bool
+	chunkSize      int64
+	threshold      int64
+	thresholdLabel string
+	hashAlgo       string
+	verify         bool
+	showProgress   bool
+	ifNotExists    string
+	oneTime        bool
+}
+
+// uploadedFile is a local file uploaded by drop upload
+type uploadedFile struct {
+	Name  string
+	URL   string
+	Size  int64
+	Token string
+
+	scanStatus string
+	scanURL    string
+}
+
+// uploadPath uploads a local file, in chunks when it is larger than the
+// auto-chunk threshold, and records it in the history. Unless quiet, the
+// steps and the response are printed; quiet uploads return a hash mismatch as
+// an error instead, along with the uploaded file. The result is nil when
+// --if-not-exists skipped the upload.
+func uploadPath(filePath string, s uploadSettings, quiet bool) (*uploadedFile, error) {
+	warnings, err := client.checkUploadLimits(filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	// Hash the local file for verification (unless disabled)
+	var localHash string
+	if s.verify {
+		if !quiet {
+			fmt.Printf("Calculating %s hash...\n", hashLabels[s.hashAlgo])
+		}
+		var err error
+		localHash, err = calculateFileHash(s.hashAlgo, filePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Stored files are only compared by MD5
+	if s.ifNotExists != "" {
+		var existingMD5 string
+		if s.hashAlgo == hashMD5 {
+			existingMD5 = localHash
+		}
+		if existingMD5 == "" {
+			var err error
+			if existingMD5, err = calculateFileMD5(filePath); err != nil {
+				return nil, err
 			}
+		}
+		if skip, err := skipIfExists(s.ifNotExists, existingMD5); err != nil || skip {
+			return nil, err
+		}
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Auto-enable chunked upload for large files
+	useChunked := s.chunked
+	if !useChunked && fileInfo.Size() > s.threshold {
+		useChunked = true
+		if !quiet {
+			fmt.Printf("File size (%.1f MB) exceeds threshold (%s), using chunked upload\n",
+				float64(fileInfo.Size())/1024/1024, s.thresholdLabel)
+		}
+	}
+
+	if s.oneTime && !quiet {
+		fmt.Printf("Starting one-time upload (file will be deleted after first download)...\n")
+	}
+
+	name := filepath.Base(filePath)
+	if useChunked {
+		if s.options["slug"] != "" {
+			return nil, fmt.Errorf("--slug and --if-not-exists aren't supported for chunked uploads")
+		}
+		if s.options["password"] != "" {
+			return nil, fmt.Errorf("--password isn't supported for chunked uploads")
+		}
+
+		resp, err := client.UploadFileChunked(filePath, s.chunkSize, s.options["expires"], s.showProgress)
+		if err != nil {
+			return nil, err
+		}
+		recordHistory(HistoryEntry{URL: resp.FileURL, Token: resp.Token, Name: name, Size: fileInfo.Size(), MD5: resp.MD5, ExpiresAt: resp.ExpiresAt})
+		uploaded := &uploadedFile{Name: name, URL: resp.FileURL, Size: fileInfo.Size(), Token: resp.Token, scanStatus: resp.ScanStatus, scanURL: resp.ScanURL}
+		serverHash := reportedHash(s.hashAlgo, resp.MD5, resp.SHA256)
+		if quiet {
+			return uploaded, hashMismatch(s.hashAlgo, localHash, serverHash)
+		}
+		printChunkedUploadResponse(resp, s.hashAlgo, localHash)
+		return uploaded, nil
+	}
+
+	resp, err := client.UploadFile(filePath, s.options)
+	if err != nil {
+		return nil, err
+	}
+	recordHistory(HistoryEntry{URL: resp.URL, Token: resp.Token, Name: name, Size: resp.Size, MD5: resp.MD5, ExpiresAt: resp.ExpiresAt})
+	uploaded := &uploadedFile{Name: name, URL: resp.URL, Size: resp.Size, Token: resp.Token, scanStatus: resp.ScanStatus, scanURL: resp.ScanURL}
+	if quiet {
+		return uploaded, hashMismatch(s.hashAlgo, localHash, reportedHash(s.hashAlgo, resp.MD5, resp.SHA256))
+	}
+	printUploadResponse(resp, s.hashAlgo, localHash)
+	return uploaded, nil
+}
+
+// hashMismatch returns an error when the server's hash of an upload differs
+// from the local one. Unknown hashes aren't a mismatch.
+func hashMismatch(algo, localHash, serverHash string) error {
+	if localHash == "" || serverHash == "" || verifyHash(algo, localHash, serverHash) {
+		return nil
+	}
+	return fmt.Errorf("%s verification failed (server: %s, local: %s)", hashLabels[algo], serverHash, localHash)
+}
+
+// runBatchUpload uploads several files, e.g. drop upload *.png, with the
+// --concurrency and --fail-fast flags
+func runBatchUpload(cmd *cobra.Command, paths []string, s uploadSettings, waitForScan bool) error {
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	failFast, _ := cmd.Flags().GetBool("fail-fast")
+	if concurrency < 1 {
+		return fmt.Errorf("invalid --concurrency %d, expected 1 or more", concurrency)
+	}
+	for _, path := range paths {
+		if path == "-" {
+			return fmt.Errorf("standard input (-) can't be uploaded along with other files")
+		}
+	}
+	if s.ifNotExists != "" {
+		return fmt.Errorf("--if-not-exists only works with a single file")
+	}
+	if s.options["slug"] != "" {
+		return fmt.Errorf("--slug only works with a single file")
+	}
 
-			// Auto-enable chunked upload for large files
-			if fileInfo.Size() > threshold {
-				shouldUseChunked = true
-				fmt.Printf("File size (%.1f MB) exceeds threshold (%s), using chunked upload\n",
-					float64(fileInfo.Size())/1024/1024, thresholdStr)
-			}
-		}
+	// Progress bars of parallel uploads would overwrite each other
+	if concurrency > 1 {
+		s.showProgress = false
+	}
 
-		if shouldUseChunked {
-			var chunkSizeBytes int64
-			if chunkSize != "" {
-				if sizeMB, err := strconv.ParseInt(chunkSize, 10, 64); err == nil {
-					chunkSizeBytes = sizeMB * 1024 * 1024
-				} else {
-					return fmt.Errorf("invalid chunk size: %s", chunkSize)
-				}
-			}
+	return uploadBatch(cmd.OutOrStdout(), paths, concurrency, failFast, func(path string) (*uploadedFile, error) {
+		uploaded, err := uploadPath(path, s, true)
+		if err == nil && waitForScan {
+			err = awaitScan(uploaded.scanStatus, uploaded.scanURL)
+		}
+		return uploaded, err
+	})
+}
 
-			if oneTime {
-				fmt.Printf("Starting one-time upload (file will be deleted after first download)...\n")
+// uploadBatch uploads the files, up to concurrency at a time, and prints a
+// summary table. Every file is tried and the failures are reported at the
+// end, unless failFast stops the batch at the first one; files not started by
+// then are skipped. Any failure makes the result an error.
+func uploadBatch(out io.Writer, paths []string, concurrency int, failFast bool, upload func(path string) (*uploadedFile, error)) error {
+	uploaded := make([]*uploadedFile, len(paths))
+	errs := make([]error, len(paths))
+	started := make([]bool, len(paths))
+
+	var (
+		outMu  sync.Mutex
+		wg     sync.WaitGroup
+		failed atomic.Bool
+	)
+	slots := make(chan struct{}, concurrency)
+	for i, path := range paths {
+		slots <- struct{}{}
+		if failFast && failed.Load() {
+			break
+		}
+		started[i] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			uploaded[i], errs[i] = upload(path)
+
+			outMu.Lock()
+			defer outMu.Unlock()
+			if errs[i] != nil {
+				failed.Store(true)
+				fmt.Fprintf(out, "✗ %s: %v\n", path, errs[i])
+			} else {
+				fmt.Fprintf(out, "✓ %s\n", path)
 			}
+		}()
+	}
+	wg.Wait()
 
-			noProgress, _ := cmd.Root().PersistentFlags().GetBool("no-progress")
-			showProgress := !noProgress
-			resp, err := client.UploadFileChunked(filePath, chunkSizeBytes, showProgress)
-			if err != nil {
-				return err
-			}
-			printChunkedUploadResponse(resp, localMD5)
-			return nil
+	var failures, skipped int
+	rows := make([]utils.TableRow, 0, len(paths))
+	for i, path := range paths {
+		row := []string{filepath.Base(path), "", "", ""}
+		if file := uploaded[i]; file != nil {
+			row = []string{file.Name, file.URL, utils.FormatFileSize(file.Size), file.Token}
 		}
-
-		if oneTime {
-			fmt.Printf("Starting one-time upload (file will be deleted after first download)...\n")
+		switch {
+		case !started[i]:
+			skipped++
+			row[1] = "skipped"
+		case errs[i] != nil:
+			failures++
+			if uploaded[i] == nil {
+				row[1] = "failed"
+			}
 		}
+		rows = append(rows, utils.TableRow{Fields: row})
+	}
+	fmt.Fprint(out, utils.GenerateASCIITable([]string{"File", "URL", "Size", "Token"}, rows))
 
-		resp, err := client.UploadFile(filePath, options)
-		if err != nil {
-			return err
-		}
-		printUploadResponse(resp, localMD5)
+	if failures == 0 {
+		fmt.Fprintf(out, "Uploaded %d files\n", len(paths))
 		return nil
-	},
+	}
+	fmt.Fprintln(out, "Errors:")
+	for i, path := range paths {
+		if errs[i] != nil {
+			fmt.Fprintf(out, "  %s: %v\n", path, errs[i])
+		}
+	}
+	if skipped > 0 {
+		return fmt.Errorf("%d of %d uploads failed, %d skipped after the first failure", failures, len(paths), skipped)
+	}
+	return fmt.Errorf("%d of %d uploads failed", failures, len(paths))
 }
 
 var deleteCmd = &cobra.Command{
@@ -776,17 +2465,60 @@ Accepts various input formats:
 			return fmt.Errorf("token is required for deletion")
 		}
 
+		useDelete, _ := cmd.Flags().GetBool("use-delete")
+		client.UseDeleteMethod = useDelete
+
 		fileURL := buildFileURL(baseURL, fileInput)
 		err := client.DeleteFile(fileURL, token)
 		if err != nil {
 			return fmt.Errorf("error deleting file: %w", err)
 		}
 
+		forgetHistory(fileURL)
 		fmt.Printf("File %s deleted successfully!\n", fileInput)
 		return nil
 	},
 }
 
+var downloadCmd = &cobra.Command{
+	Use:     "download <file_id_or_url>",
+	Aliases: []string{"dl", "get"},
+	Short:   "Download an uploaded file",
+	Long: `Download a file from the server and verify it against the server's MD5.
+
+The file is saved under the name the server sends, or the file id, unless -o
+is given. It is written to <name>.part until complete, so an interrupted
+download continues where it stopped when the command is run again.
+
+Examples:
+  drop download abc123
+  drop download https://drop.example.com/abc123 -o report.pdf`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		noVerify, _ := cmd.Root().PersistentFlags().GetBool("no-verify")
+		noProgress, _ := cmd.Root().PersistentFlags().GetBool("no-progress")
+
+		fileURL := buildFileURL(baseURL, args[0])
+		result, err := client.DownloadToFile(fileURL, output, !noVerify, !noProgress)
+		if err != nil {
+			return fmt.Errorf("error downloading %s: %w", args[0], err)
+		}
+
+		fmt.Printf("Saved %s (%s)\n", result.Path, utils.FormatFileSize(result.Size))
+		if result.Resumed > 0 {
+			fmt.Printf("Resumed after %s\n", utils.FormatFileSize(result.Resumed))
+		}
+		switch {
+		case result.Verified:
+			fmt.Printf("MD5: %s ✓\n", result.MD5)
+		case !noVerify:
+			fmt.Println("MD5: not reported by the server, file not verified")
+		}
+		return nil
+	},
+}
+
 var shortenCmd = &cobra.Command{
 	Use:     "shorten <url>",
 	Aliases: []string{"s", "short"},
@@ -808,19 +2540,23 @@ Example: drop shorten https://example.com/some/long/url`,
 
 		options := make(map[string]string)
 		if secret {
-			options["secret"] = ""
+			options["secret"] = "true"
 		}
 		if oneTime {
-			options["one_time"] = ""
+			options["one_time"] = "true"
 		}
 		if expires != "" {
 			options["expires"] = FormatExpiration(expires)
 		}
+		if err := client.ensureExpiration(options, terminalInput()); err != nil {
+			return err
+		}
 
 		resp, err := client.ShortenURL(url, options)
 		if err != nil {
 			return err
 		}
+		recordHistory(HistoryEntry{URL: resp.URL, Token: resp.Token, Name: url, ExpiresAt: resp.ExpiresAt})
 		printURLShorteningResponse(resp)
 		return nil
 	},
@@ -869,6 +2605,518 @@ Example: drop expire abc123 --token your-token --expires 24`,
 	},
 }
 
+var uploadsCmd = &cobra.Command{
+	Use:   "uploads",
+	Short: "Manage unfinished chunked uploads",
+	Long: `Manage chunked uploads that were started but never completed.
+
+An interrupted chunked upload keeps its chunks on the server until the session
+expires after 24 hours. List the sessions started from this machine's IP
+address and cancel the ones that won't be resumed to free the space.`,
+}
+
+var uploadsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List unfinished chunked uploads",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessions, err := client.ListUploadSessions()
+		if err != nil {
+			return err
+		}
+		printUploadSessions(cmd.OutOrStdout(), sessions, time.Now())
+		return nil
+	},
+}
+
+var uploadsCancelCmd = &cobra.Command{
+	Use:   "cancel <upload_id>...",
+	Short: "Cancel unfinished chunked uploads and delete their chunks",
+	Long: `Cancel chunked upload sessions, deleting the chunks already sent.
+
+Example: drop uploads cancel k3j9x2 p0q7m1`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, uploadID := range args {
+			if err := client.AbortChunkedUpload(uploadID); err != nil {
+				return fmt.Errorf("error cancelling upload %s: %w", uploadID, err)
+			}
+			fmt.Printf("Upload %s cancelled\n", uploadID)
+		}
+		return nil
+	},
+}
+
+// defaultStdinFilename names uploads read from standard input without --filename
+const defaultStdinFilename = "stdin"
+
+// spoolStdin copies r to a temp file named filename, so an upload from
+// standard input can be sized, hashed and chunked like a local file. cleanup
+// removes the file.
+func spoolStdin(r io.Reader, filename string) (path string, cleanup func(), err error) {
+	name := filepath.Base(filename)
+	if filename == "" || name == "." || name == "/" || name == ".." {
+		name = defaultStdinFilename
+	}
+
+	dir, err := os.MkdirTemp("", "drop-stdin-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+
+	path = filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to read standard input: %w", err)
+	}
+	return path, cleanup, nil
+}
+
+// printUploadSessions prints the unfinished chunked uploads as a table
+func printUploadSessions(out io.Writer, sessions []UploadSession, now time.Time) {
+	if len(sessions) == 0 {
+		fmt.Fprintln(out, "No unfinished chunked uploads")
+		return
+	}
+
+	rows := make([]utils.TableRow, 0, len(sessions))
+	for _, session := range sessions {
+		rows = append(rows, utils.TableRow{Fields: []string{
+			session.UploadID,
+			session.Filename,
+			utils.FormatFileSize(session.TotalSize),
+			fmt.Sprintf("%d%% (%d/%d)", session.Progress, session.UploadedChunks, session.TotalChunks),
+			session.CreatedAt.Local().Format("2006-01-02 15:04"),
+			"in " + session.ExpiresAt.Sub(now).Round(time.Minute).String(),
+		}})
+	}
+	fmt.Fprint(out, utils.GenerateASCIITable([]string{"ID", "Name", "Size", "Progress", "Started", "Expires"}, rows))
+	fmt.Fprintln(out, "Cancel a session with: drop uploads cancel <id>")
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Look up management tokens of earlier uploads",
+	Long: `Look up management tokens of earlier uploads.
+
+Tokens are recorded in ~/.drop/uploads.json when uploading with this client.
+The server never returns a token again, so uploads missing from the local
+history can't be managed anymore.`,
+}
+
+var tokenShowCmd = &cobra.Command{
+	Use:   "show <file_id_or_url>",
+	Short: "Show the stored token for an upload",
+	Long: `Show the management token stored in the local history for an upload.
+
+The token is redacted unless --reveal is given.
+
+Example: drop token show abc123 --reveal`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		reveal, _ := cmd.Flags().GetBool("reveal")
+
+		entries, err := loadHistory()
+		if err != nil {
+			return err
+		}
+
+		entry, ok := findHistoryEntry(entries, baseURL, args[0])
+		if !ok {
+			return fmt.Errorf("no token for %s in the local history; tokens are only returned at upload time and can't be recovered", args[0])
+		}
+
+		token := redactToken(entry.Token)
+		if reveal {
+			token = entry.Token
+		}
+
+		fmt.Printf("URL: %s\n", entry.URL)
+		fmt.Printf("Token: %s\n", token)
+		if !reveal {
+			fmt.Printf("(use --reveal to show the full token)\n")
+		}
+		return nil
+	},
+}
+
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List files uploaded from this machine",
+	Long: `List the uploads recorded in ~/.drop/uploads.json, newest first.
+
+Every upload and shortened URL made with this client is recorded with its
+management token, and removed again when deleted with drop delete. Expired
+uploads are hidden unless --expired is given. Tokens are redacted in the
+table; --json prints the full entries.
+
+Example: drop list --expired`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		showExpired, _ := cmd.Flags().GetBool("expired")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		entries, err := loadHistory()
+		if err != nil {
+			return err
+		}
+		return printHistory(cmd.OutOrStdout(), entries, time.Now(), showExpired, asJSON)
+	},
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Copy your uploads to another server",
+	Long: `Copy the files uploaded from this machine to another server.
+
+Every upload to the --from server recorded in ~/.drop/uploads.json is
+downloaded and uploaded to the --to server with the same expiration date,
+one-time flag and remaining downloads, and the new upload is added to the
+history. Expired files, shortened URLs, files already gone from the old
+server and password protected files are skipped. A file that fails doesn't
+stop the migration; the command fails at the end if any did.
+
+Downloading a one-time file or one with a download limit uses up a download
+on the old server. --dry-run lists what would be copied without downloading
+anything.
+
+Options:
+  --from URL          Server to copy from (default: the configured server)
+  --to URL            Server to copy to (required)
+  --to-api-key KEY    API key for the new server
+  --dry-run           Only show what would be copied
+
+Example: drop migrate --to https://new-drop.example.com/`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		toAPIKey, _ := cmd.Flags().GetString("to-api-key")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		if to == "" {
+			return fmt.Errorf("--to is required")
+		}
+		if from == "" {
+			from = baseURL
+		}
+		source := NewClient(from)
+		target := NewClient(to)
+		target.SetAPIKey(toAPIKey)
+		if source.BaseURL == target.BaseURL {
+			return fmt.Errorf("--from and --to are the same server")
+		}
+
+		thresholdStr, _ := cmd.Root().PersistentFlags().GetString("auto-chunk-threshold")
+		threshold, err := parseSize(thresholdStr)
+		if err != nil {
+			return fmt.Errorf("invalid auto-chunk-threshold: %w", err)
+		}
+
+		entries, err := loadHistory()
+		if err != nil {
+			return err
+		}
+		result := migrateHistory(cmd.OutOrStdout(), source, target, entries, time.Now(), threshold, dryRun)
+		if result.Failed > 0 {
+			return fmt.Errorf("%d file(s) could not be migrated", result.Failed)
+		}
+		return nil
+	},
+}
+
+// migrateResult counts the outcomes of a migration
+type migrateResult struct {
+	Migrated int
+	Skipped  int
+	Failed   int
+}
+
+// migrateSkip is the reason a file isn't migrated, as opposed to a failure
+type migrateSkip string
+
+func (s migrateSkip) Error() string { return string(s) }
+
+// migrateHistory copies the history's uploads to the from server onto the to
+// server, printing one line per file and a summary. Each file is handled on
+// its own, so a failure only affects that file.
+func migrateHistory(out io.Writer, from, to *Client, entries []HistoryEntry, now time.Time, chunkThreshold int64, dryRun bool) migrateResult {
+	var selected []HistoryEntry
+	for _, entry := range entries {
+		if strings.TrimSuffix(entry.Server, "/") == strings.TrimSuffix(from.BaseURL, "/") {
+			selected = append(selected, entry)
+		}
+	}
+
+	var result migrateResult
+	if len(selected) == 0 {
+		fmt.Fprintf(out, "No uploads to %s recorded in %s\n", from.BaseURL, historyFilePath())
+		return result
+	}
+
+	for i, entry := range selected {
+		fmt.Fprintf(out, "[%d/%d] %s: ", i+1, len(selected), entry.URL)
+		if historyExpired(entry, now) {
+			fmt.Fprintln(out, "skipped, expired")
+			result.Skipped++
+			continue
+		}
+
+		newURL, err := migrateEntry(from, to, entry, now, chunkThreshold, dryRun)
+		var skip migrateSkip
+		switch {
+		case errors.As(err, &skip):
+			fmt.Fprintf(out, "skipped, %s\n", skip)
+			result.Skipped++
+		case err != nil:
+			fmt.Fprintf(out, "failed, %v\n", err)
+			result.Failed++
+		case dryRun:
+			fmt.Fprintln(out, "would be migrated")
+			result.Migrated++
+		default:
+			fmt.Fprintf(out, "migrated to %s\n", newURL)
+			result.Migrated++
+		}
+	}
+
+	if dryRun {
+		fmt.Fprintf(out, "Dry run: %d would be migrated, %d skipped, %d failed\n", result.Migrated, result.Skipped, result.Failed)
+	} else {
+		fmt.Fprintf(out, "Migrated %d, skipped %d, failed %d\n", result.Migrated, result.Skipped, result.Failed)
+	}
+	return result
+}
+
+// migrateEntry copies one upload and records the copy in the history,
+// returning its URL. The old server's metadata decides what is kept: the
+// expiration date, the one-time flag and the downloads left.
+func migrateEntry(from, to *Client, entry HistoryEntry, now time.Time, chunkThreshold int64, dryRun bool) (string, error) {
+	meta, err := from.GetFileMetaWithToken(entry.URL, entry.Token)
+	if err != nil {
+		return "", err
+	}
+	if meta == nil {
+		return "", migrateSkip("not found on the old server")
+	}
+	if meta.PasswordProtected {
+		return "", migrateSkip("password protected")
+	}
+
+	options := make(map[string]string)
+	if meta.ExpiresAt != "" {
+		if expiresAt, err := time.Parse(time.RFC3339, meta.ExpiresAt); err == nil && !expiresAt.After(now) {
+			return "", migrateSkip("expired")
+		}
+		options["expires"] = meta.ExpiresAt
+	}
+	if meta.OneTimeView {
+		options["one_time"] = "true"
+	}
+	if meta.MaxDownloads > 0 {
+		options["max_downloads"] = strconv.Itoa(max(meta.MaxDownloads-meta.AccessCount, 1))
+	}
+	if dryRun {
+		return "", nil
+	}
+
+	dir, err := os.MkdirTemp("", "drop-migrate-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Base(meta.Name)
+	if name == "." || name == string(filepath.Separator) {
+		name = path.Base(entry.URL)
+	}
+	filePath := filepath.Join(dir, name)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	size, err := from.DownloadFile(entry.URL, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	copied := HistoryEntry{Server: to.BaseURL, Name: entry.Name, Size: size}
+	if copied.Name == "" {
+		copied.Name = name
+	}
+	// Chunked uploads only carry the expiration
+	if size > chunkThreshold && options["one_time"] == "" && options["max_downloads"] == "" {
+		resp, err := to.UploadFileChunked(filePath, 0, options["expires"], false)
+		if err != nil {
+			return "", err
+		}
+		copied.URL, copied.Token, copied.MD5, copied.ExpiresAt = resp.FileURL, resp.Token, resp.MD5, resp.ExpiresAt
+	} else {
+		resp, err := to.UploadFile(filePath, options)
+		if err != nil {
+			return "", err
+		}
+		copied.URL, copied.Token, copied.MD5, copied.ExpiresAt = resp.URL, resp.Token, resp.MD5, resp.ExpiresAt
+	}
+
+	recordHistory(copied)
+	return copied.URL, nil
+}
+
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the server and credentials in use",
+	Long: `Show which server the client talks to, the configuration file it was
+loaded from and whether an API key is set, followed by the server's version
+and upload limits.
+
+Example: drop whoami --server https://drop.example.com/`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return printWhoami(cmd.OutOrStdout(), client, viper.ConfigFileUsed())
+	},
+}
+
+// printWhoami prints the client settings, then what the server reports about
+// itself. Servers without /version or /api/limits are still described.
+func printWhoami(out io.Writer, c *Client, configFile string) error {
+	fmt.Fprintf(out, "Server: %s\n", c.BaseURL)
+	if configFile == "" {
+		configFile = "none (defaults and flags only)"
+	}
+	fmt.Fprintf(out, "Config: %s\n", configFile)
+	if c.APIKey != "" {
+		fmt.Fprintf(out, "API key: %s\n", redactToken(c.APIKey))
+	} else {
+		fmt.Fprintf(out, "API key: not set\n")
+	}
+
+	version, err := c.GetVersion()
+	if err != nil {
+		return fmt.Errorf("server unreachable: %w", err)
+	}
+	if version == "" {
+		version = "unknown (no /version endpoint)"
+	}
+	fmt.Fprintf(out, "Server version: %s\n", version)
+
+	limits, err := c.GetLimits()
+	if err != nil {
+		fmt.Fprintf(out, "Limits: unknown (%v)\n", err)
+		return nil
+	}
+	if limits.MaxSize > 0 {
+		fmt.Fprintf(out, "Max upload size: %.1f MB\n", float64(limits.MaxSize)/1024/1024)
+	}
+	if limits.ChunkSize > 0 {
+		fmt.Fprintf(out, "Chunk size: %.1f MB\n", float64(limits.ChunkSize)/1024/1024)
+	}
+	if len(limits.AllowedTypes) > 0 {
+		fmt.Fprintf(out, "Allowed types: %s\n", strings.Join(limits.AllowedTypes, ", "))
+	}
+	if len(limits.BlockedExtensions) > 0 {
+		fmt.Fprintf(out, "Blocked extensions: %s\n", strings.Join(limits.BlockedExtensions, ", "))
+	}
+	fmt.Fprintf(out, "Expiration required: %t\n", limits.RequireExpiration)
+	return nil
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show how many files the server stores",
+	Long: `Show the number and total size of the files stored on the server,
+broken down by media type, along with this month's download transfer.
+
+--json prints the server's response as is.
+
+Example: drop stats --json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+		return printStats(cmd.OutOrStdout(), client, asJSON)
+	},
+}
+
+// printStats prints the server statistics, with the media types as a table
+// ordered by size
+func printStats(out io.Writer, c *Client, asJSON bool) error {
+	if asJSON {
+		body, err := c.GetStatsJSON()
+		if err != nil {
+			return err
+		}
+		out.Write(body)
+		if !bytes.HasSuffix(body, []byte("\n")) {
+			fmt.Fprintln(out)
+		}
+		return nil
+	}
+
+	stats, err := c.GetStats()
+	if err != nil {
+		return err
+	}
+
+	if stats.TotalFiles != nil && stats.TotalSize != nil {
+		fmt.Fprintf(out, "Files: %d\n", *stats.TotalFiles)
+		fmt.Fprintf(out, "Total size: %s\n", utils.FormatFileSize(*stats.TotalSize))
+	} else {
+		fmt.Fprintln(out, "Files: unknown (the server doesn't report totals)")
+	}
+	fmt.Fprintf(out, "Chunked uploads in progress: %d\n", stats.ActiveUploads)
+	if stats.TransferPeriod != "" {
+		transfer := utils.FormatFileSize(stats.TransferBytesServed)
+		if stats.TransferCapBytes > 0 {
+			transfer += " of " + utils.FormatFileSize(stats.TransferCapBytes)
+		}
+		fmt.Fprintf(out, "Served in %s: %s\n", stats.TransferPeriod, transfer)
+	}
+	if stats.MaintenanceMode {
+		fmt.Fprintln(out, "Maintenance mode: on")
+	}
+
+	if len(stats.Types) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(stats.Types))
+	for name := range stats.Types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := stats.Types[names[i]], stats.Types[names[j]]
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return names[i] < names[j]
+	})
+
+	rows := make([]utils.TableRow, 0, len(names))
+	for _, name := range names {
+		rows = append(rows, utils.TableRow{Fields: []string{
+			name,
+			strconv.Itoa(stats.Types[name].Files),
+			utils.FormatFileSize(stats.Types[name].Size),
+		}})
+	}
+	fmt.Fprint(out, utils.GenerateASCIITable([]string{"Type", "Files", "Size"}, rows))
+	return nil
+}
+
 var configCmd = &cobra.Command{
 	Use:     "config",
 	Aliases: []string{"c", "cfg"},
@@ -887,6 +3135,9 @@ var configSetCmd = &cobra.Command{
 Available keys:
   • server: Server URL (e.g., https://drop.example.com/)
   • auto-chunk-threshold: Auto-chunk threshold (e.g., 10MB)
+  • api-key: API key sent in the X-API-Key header to select an upload tier
+  • retries: Retries of uploads failing with network errors, 429 or 5xx (e.g., 5)
+  • retry-backoff: Wait before the first retry, doubled for each further one (e.g., 2s)
 
 Example: drop config set server https://drop.example.com/`,
 	Args: cobra.ExactArgs(2),
@@ -931,40 +3182,24 @@ Example: drop config get server`,
 	},
 }
 
-func printUploadResponse(resp *UploadResponse, localMD5 string) {
+func printUploadResponse(resp *UploadResponse, algo, localHash string) {
 	fmt.Printf("Upload successful!\n")
 	fmt.Printf("URL: %s\n", resp.URL)
 	fmt.Printf("Size: %d bytes\n", resp.Size)
 	fmt.Printf("Token: %s\n", resp.Token)
 
-	// Verify MD5 and show result inline
-	if localMD5 != "" {
-		if verifyMD5(localMD5, resp.MD5) {
-			fmt.Printf("MD5: %s ✓\n", resp.MD5)
-		} else {
-			fmt.Printf("MD5: %s (verification failed - local: %s)\n", resp.MD5, localMD5)
-		}
-	} else {
-		fmt.Printf("MD5: %s\n", resp.MD5)
-	}
+	// Verify the hash and show result inline
+	printHash(algo, localHash, reportedHash(algo, resp.MD5, resp.SHA256))
 
 	fmt.Printf("Expires: %s (%s)\n", formatExpirationDate(resp.ExpiresAt), formatDaysRemaining(resp.ExpiresInDays))
 }
 
-func printChunkedUploadResponse(resp *ChunkedUploadCompleteResponse, localMD5 string) {
+func printChunkedUploadResponse(resp *ChunkedUploadCompleteResponse, algo, localHash string) {
 	fmt.Printf("File URL: %s\n", resp.FileURL)
 	fmt.Printf("Token: %s\n", resp.Token)
 
-	// Verify MD5 and show result inline
-	if localMD5 != "" {
-		if verifyMD5(localMD5, resp.MD5) {
-			fmt.Printf("MD5: %s ✓\n", resp.MD5)
-		} else {
-			fmt.Printf("MD5: %s (verification failed - local: %s)\n", resp.MD5, localMD5)
-		}
-	} else {
-		fmt.Printf("MD5: %s\n", resp.MD5)
-	}
+	// Verify the hash and show result inline
+	printHash(algo, localHash, reportedHash(algo, resp.MD5, resp.SHA256))
 
 	// Show expiration information if available
 	if resp.ExpiresAt != "" {
@@ -992,37 +3227,73 @@ func init() {
 
 	rootCmd.PersistentFlags().StringP("server", "s", "", "Server URL (default: http://localhost:3000/)")
 	rootCmd.PersistentFlags().Bool("no-progress", false, "Disable progress bar for chunked uploads")
-	rootCmd.PersistentFlags().Bool("no-verify", false, "Skip MD5 verification after upload")
+	rootCmd.PersistentFlags().Bool("no-verify", false, "Skip hash verification after upload")
 	rootCmd.PersistentFlags().String("auto-chunk-threshold", "10MB", "Auto-enable chunked upload for files larger than this size (e.g., 10MB, 100MB)")
 
+	rootCmd.PersistentFlags().Int("retries", 3, "Retries of uploads failing with a network error, 429 or a 5xx status")
+	rootCmd.PersistentFlags().Duration("retry-backoff", time.Second, "Wait before the first retry, doubled for every further one")
+
 	viper.BindPFlag("server", rootCmd.PersistentFlags().Lookup("server"))
 	viper.BindPFlag("no-progress", rootCmd.PersistentFlags().Lookup("no-progress"))
+	viper.BindPFlag("retries", rootCmd.PersistentFlags().Lookup("retries"))
+	viper.BindPFlag("retry-backoff", rootCmd.PersistentFlags().Lookup("retry-backoff"))
 
 	uploadCmd.Flags().StringP("url", "u", "", "Upload file from URL instead of local file")
 	uploadCmd.Flags().BoolP("chunked", "c", false, "Force chunked upload for any file size")
 	uploadCmd.Flags().String("chunk-size", "4", "Chunk size in MB for chunked uploads (default: 4)")
-	uploadCmd.Flags().Bool("secret", false, "Generate a hard-to-guess URL")
-	uploadCmd.Flags().BoolP("one-time", "o", false, "Delete file after first download")
-	uploadCmd.Flags().StringP("expires", "e", "", "Set expiration time (hours, RFC3339, ISO date/datetime, SQL datetime)")
+	addUploadOptionFlags(uploadCmd)
+	uploadCmd.Flags().String("if-not-exists", "", "Skip the upload when this file id or URL already exists on the server")
+	uploadCmd.Flags().Bool("wait-for-scan", false, "Wait for the virus scan result and fail if the file is infected")
+	uploadCmd.Flags().String("hash", hashMD5, "Hash used to verify the upload: md5 or sha256")
+	uploadCmd.Flags().String("filename", "", "Name of the upload when reading from standard input with - (default: stdin)")
+	uploadCmd.Flags().Int("concurrency", 1, "Number of files uploaded at once when uploading several")
+	uploadCmd.Flags().Bool("fail-fast", false, "Stop at the first failed file when uploading several")
 
 	deleteCmd.Flags().StringP("token", "t", "", "File token (required)")
+	deleteCmd.Flags().Bool("use-delete", false, "Send an HTTP DELETE request instead of a form POST")
+
+	downloadCmd.Flags().StringP("output", "o", "", "File to save to (default: the server's filename, or the file id)")
 
 	shortenCmd.Flags().Bool("secret", false, "Generate a hard-to-guess URL")
 	shortenCmd.Flags().BoolP("one-time", "o", false, "Delete URL after first access")
-	shortenCmd.Flags().StringP("expires", "e", "", "Set expiration time (hours, RFC3339, ISO date/datetime, SQL datetime)")
+	shortenCmd.Flags().StringP("expires", "e", "", "Set expiration time (hours, duration like 7d or 2w3d, RFC3339, ISO date/datetime, SQL datetime)")
 
 	expireCmd.Flags().StringP("token", "t", "", "File token (required)")
-	expireCmd.Flags().StringP("expires", "e", "", "Expiration time (required)")
+	expireCmd.Flags().StringP("expires", "e", "", "Expiration time, e.g. 24 (hours), 7d or 2026-01-31 (required)")
+
+	tokenShowCmd.Flags().Bool("reveal", false, "Print the full token instead of a redacted one")
+
+	listCmd.Flags().Bool("expired", false, "Include expired uploads, marked as expired")
+	listCmd.Flags().Bool("json", false, "Print the entries as JSON, with full tokens")
+
+	statsCmd.Flags().Bool("json", false, "Print the server's JSON response as is")
+
+	migrateCmd.Flags().String("from", "", "Server to copy uploads from (default: the configured server)")
+	migrateCmd.Flags().String("to", "", "Server to copy uploads to (required)")
+	migrateCmd.Flags().String("to-api-key", "", "API key for the server copied to")
+	migrateCmd.Flags().Bool("dry-run", false, "Only show what would be copied")
 
 	rootCmd.AddCommand(uploadCmd)
 	rootCmd.AddCommand(shortenCmd)
 	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(downloadCmd)
 	rootCmd.AddCommand(expireCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(tokenCmd)
+	rootCmd.AddCommand(uploadsCmd)
+	rootCmd.AddCommand(whoamiCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(migrateCmd)
 
 	configCmd.AddCommand(configSetCmd)
 	configCmd.AddCommand(configGetCmd)
 
+	tokenCmd.AddCommand(tokenShowCmd)
+
+	uploadsCmd.AddCommand(uploadsListCmd)
+	uploadsCmd.AddCommand(uploadsCancelCmd)
+
 	// Add version flag
 	rootCmd.Flags().BoolP("version", "v", false, "Show version information")
 }
@@ -1,14 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/marianozunino/drop/internal/utils"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -405,18 +419,358 @@ func TestClientGetChunkedUploadStatusWithError(t *testing.T) {
 	assert.Nil(t, response)
 }
 
-func TestVerifyMD5(t *testing.T) {
-	result := verifyMD5("d41d8cd98f00b204e9800998ecf8427e", "d41d8cd98f00b204e9800998ecf8427e")
+func TestClientDeleteFileWithDeleteMethod(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "DELETE", r.Method)
+		assert.Equal(t, "/abc123.txt", r.URL.Path)
+		assert.Equal(t, "secret-token", r.Header.Get("X-Token"))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("File deleted successfully"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.UseDeleteMethod = true
+
+	err := client.DeleteFile(server.URL+"/abc123.txt", "secret-token")
+	assert.NoError(t, err)
+}
+
+func TestClientDeleteFileWithFormPost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		err := r.ParseMultipartForm(1 << 20)
+		require.NoError(t, err)
+		assert.Equal(t, "secret-token", r.FormValue("token"))
+		_, hasDelete := r.MultipartForm.Value["delete"]
+		assert.True(t, hasDelete)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Invalid management token"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	err := client.DeleteFile(server.URL+"/abc123.txt", "secret-token")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "delete failed with status 401")
+}
+
+func TestClientCheckUploadLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/limits", r.URL.Path)
+		json.NewEncoder(w).Encode(LimitsResponse{MaxSize: 10, BlockedExtensions: []string{".exe"}})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	tempDir := t.TempDir()
+
+	small := filepath.Join(tempDir, "small.txt")
+	require.NoError(t, os.WriteFile(small, []byte("tiny"), 0o644))
+	warnings, err := client.checkUploadLimits(small)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	large := filepath.Join(tempDir, "large.txt")
+	require.NoError(t, os.WriteFile(large, []byte("this is more than ten bytes"), 0o644))
+	warnings, err = client.checkUploadLimits(large)
+	assert.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "exceeds the server limit")
+
+	blocked := filepath.Join(tempDir, "tool.EXE")
+	require.NoError(t, os.WriteFile(blocked, []byte("MZ"), 0o644))
+	warnings, err = client.checkUploadLimits(blocked)
+	assert.NoError(t, err)
+	assert.Len(t, warnings, 1)
+
+	_, err = client.checkUploadLimits(filepath.Join(tempDir, "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestClientCheckUploadLimitsWithoutEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	path := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("content"), 0o644))
+
+	warnings, err := client.checkUploadLimits(path)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+}
+
+func TestUploadOptionsFromFlags(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		addUploadOptionFlags(cmd)
+		require.NoError(t, cmd.Flags().Parse(args))
+		return cmd
+	}
+
+	options, err := uploadOptionsFromFlags(newCmd("--expire-on-download", "--max-views", "3"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"one_time":      "true",
+		"max_downloads": "3",
+	}, options)
+
+	options, err = uploadOptionsFromFlags(newCmd("-o", "--secret"))
+	require.NoError(t, err)
+	assert.Equal(t, "true", options["one_time"])
+	assert.Equal(t, "true", options["secret"])
+
+	options, err = uploadOptionsFromFlags(newCmd("--self-destruct"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"one_time": "true"}, options)
+
+	_, err = uploadOptionsFromFlags(newCmd("--max-views", "-1"))
+	assert.Error(t, err)
+
+	options, err = uploadOptionsFromFlags(newCmd("--max-downloads", "5"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"max_downloads": "5"}, options)
+
+	_, err = uploadOptionsFromFlags(newCmd("--max-downloads", "-2"))
+	assert.Error(t, err)
+
+	options, err = uploadOptionsFromFlags(newCmd("--slug", " q3-report "))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"slug": "q3-report"}, options)
+
+	options, err = uploadOptionsFromFlags(newCmd("--password", " open sesame"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": " open sesame"}, options, "passwords are sent as typed")
+}
+
+func TestIfNotExistsSlug(t *testing.T) {
+	options := map[string]string{}
+	require.NoError(t, ifNotExistsSlug("https://drop.example.com/q3-report", options))
+	assert.Equal(t, "q3-report", options["slug"])
+
+	options = map[string]string{"slug": "q3-report"}
+	require.NoError(t, ifNotExistsSlug("q3-report", options))
+	assert.Equal(t, "q3-report", options["slug"])
+
+	options = map[string]string{"slug": "other"}
+	assert.Error(t, ifNotExistsSlug("q3-report", options))
+
+	options = map[string]string{}
+	require.NoError(t, ifNotExistsSlug("", options))
+	assert.Empty(t, options)
+}
+
+func TestClientUploadFileChunkedSkipsExistingContent(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "dup.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("hello world"), 0o644))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/upload/init", r.URL.Path, "no chunks should be uploaded")
+		assert.Equal(t, "5eb63bbbe01eeed093cb22bb8f5acdc3", r.FormValue("content_hash"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"already_exists": true,
+			"file_url":       "http://example.com/abcd.txt",
+			"md5":            "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	resp, err := client.UploadFileChunked(filePath, 4, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/abcd.txt", resp.FileURL)
+	assert.Equal(t, "5eb63bbbe01eeed093cb22bb8f5acdc3", resp.MD5)
+}
+
+func TestClientUploadFileChunkedResumesSession(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "resume.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("hello world"), 0o644))
+
+	var uploadedChunks []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload/init" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"upload_id":       "abcd",
+				"chunk_size":      4,
+				"total_chunks":    3,
+				"uploaded_chunks": []int{0},
+			})
+			return
+		}
+
+		file, _, err := r.FormFile("chunk")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(file)
+		uploadedChunks = append(uploadedChunks, filepath.Base(r.URL.Path)+":"+string(data))
+
+		response := map[string]interface{}{"message": "Chunk uploaded successfully", "progress": 66}
+		if filepath.Base(r.URL.Path) == "2" {
+			response = map[string]interface{}{"message": "Upload completed", "progress": 100, "file_url": "http://example.com/abcd.txt"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	resp, err := client.UploadFileChunked(filePath, 4, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/abcd.txt", resp.FileURL)
+	assert.Equal(t, []string{"1:o wo", "2:rld"}, uploadedChunks)
+}
+
+func TestClientUploadFileChunkedKeepsUploadToken(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "resume.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("hello world"), 0o644))
+	sessionsPath := filepath.Join(tempDir, "sessions.json")
+
+	var resumeTokens, chunkTokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/upload/init" {
+			resumeTokens = append(resumeTokens, r.FormValue("upload_token"))
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"upload_id":       "abcd",
+				"upload_token":    "secret-token",
+				"chunk_size":      4,
+				"total_chunks":    3,
+				"uploaded_chunks": []int{},
+			})
+			return
+		}
+
+		chunkTokens = append(chunkTokens, r.Header.Get(uploadTokenHeader))
+		if filepath.Base(r.URL.Path) == "1" && len(chunkTokens) == 2 {
+			http.Error(w, `{"error":"Failed to save chunk"}`, http.StatusBadRequest)
+			return
+		}
+		response := map[string]interface{}{"message": "Chunk uploaded successfully", "progress": 33}
+		if filepath.Base(r.URL.Path) == "2" {
+			response = map[string]interface{}{"message": "Upload completed", "progress": 100, "file_url": "http://example.com/abcd.txt"}
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	// The first run fails but its aborted session is forgotten as well
+	client := NewClient(server.URL)
+	client.SessionsFile = sessionsPath
+	_, err := client.UploadFileChunked(filePath, 4, "", false)
+	require.Error(t, err)
+	entries, err := loadSessions(sessionsPath)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// A session interrupted before completion is resumed with its token
+	client = NewClient(server.URL)
+	client.SessionsFile = sessionsPath
+	_, err = client.InitChunkedUploadWithHash("resume.txt", 11, 4, "5eb63bbbe01eeed093cb22bb8f5acdc3", "")
+	require.NoError(t, err)
+	info, err := os.Stat(sessionsPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	client = NewClient(server.URL)
+	client.SessionsFile = sessionsPath
+	resp, err := client.UploadFileChunked(filePath, 4, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/abcd.txt", resp.FileURL)
+
+	assert.Equal(t, []string{"", "", "secret-token"}, resumeTokens)
+	for _, token := range chunkTokens {
+		assert.Equal(t, "secret-token", token)
+	}
+	entries, err = loadSessions(sessionsPath)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "completed sessions are forgotten")
+}
+
+func TestClientUploadFileChunkedAbortsFailedUpload(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "broken.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("hello world"), 0o644))
+
+	var aborted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/upload/init":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"upload_id":       "abcd",
+				"chunk_size":      4,
+				"total_chunks":    3,
+				"uploaded_chunks": []int{},
+			})
+		case r.Method == http.MethodDelete && r.URL.Path != "/upload/abcd":
+			http.Error(w, `{"error":"Upload session not found"}`, http.StatusNotFound)
+		case r.Method == http.MethodDelete:
+			aborted = append(aborted, r.URL.Path)
+			json.NewEncoder(w).Encode(map[string]string{"message": "Upload aborted", "upload_id": "abcd"})
+		case filepath.Base(r.URL.Path) == "1":
+			http.Error(w, `{"error":"Failed to save chunk"}`, http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"message": "Chunk uploaded successfully", "progress": 33})
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	_, err := client.UploadFileChunked(filePath, 4, "", false)
+	require.Error(t, err)
+	assert.Equal(t, []string{"/upload/abcd"}, aborted)
+
+	assert.Error(t, client.AbortChunkedUpload("missing"), "aborting unknown sessions reports the server error")
+}
+
+func TestVerifyHash(t *testing.T) {
+	result := verifyHash(hashMD5, "d41d8cd98f00b204e9800998ecf8427e", "d41d8cd98f00b204e9800998ecf8427e")
 	assert.True(t, result)
 
-	result = verifyMD5("d41d8cd98f00b204e9800998ecf8427e", "5d41402abc4b2a76b9719d911017c592")
+	result = verifyHash(hashMD5, "d41d8cd98f00b204e9800998ecf8427e", "5d41402abc4b2a76b9719d911017c592")
 	assert.False(t, result)
 
-	result = verifyMD5("", "")
+	result = verifyHash(hashMD5, "", "")
 	assert.True(t, result)
 
-	result = verifyMD5("", "d41d8cd98f00b204e9800998ecf8427e")
+	result = verifyHash(hashMD5, "", "d41d8cd98f00b204e9800998ecf8427e")
 	assert.False(t, result)
+
+	emptySHA256 := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	assert.True(t, verifyHash(hashSHA256, emptySHA256, strings.ToUpper(emptySHA256)))
+	assert.False(t, verifyHash(hashSHA256, emptySHA256, ""))
+	assert.False(t, verifyHash("crc32", "abc", "abc"))
+}
+
+func TestCalculateFileHash(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.txt")
+	require.NoError(t, os.WriteFile(empty, nil, 0o644))
+	hello := filepath.Join(dir, "hello.txt")
+	require.NoError(t, os.WriteFile(hello, []byte("hello"), 0o644))
+
+	for _, tc := range []struct {
+		algo, path, want string
+	}{
+		{hashMD5, empty, "d41d8cd98f00b204e9800998ecf8427e"},
+		{hashSHA256, empty, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{hashMD5, hello, "5d41402abc4b2a76b9719d911017c592"},
+		{hashSHA256, hello, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+	} {
+		got, err := calculateFileHash(tc.algo, tc.path)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, tc.algo+" "+filepath.Base(tc.path))
+	}
+
+	_, err := calculateFileHash("crc32", hello)
+	assert.Error(t, err)
+}
+
+func TestReportedHash(t *testing.T) {
+	assert.Equal(t, "m", reportedHash(hashMD5, "m", "s"))
+	assert.Equal(t, "s", reportedHash(hashSHA256, "m", "s"))
+	assert.Empty(t, reportedHash(hashSHA256, "m", ""), "older servers don't report SHA-256")
 }
 
 func TestFormatExpirationDate(t *testing.T) {
@@ -430,6 +784,23 @@ func TestFormatExpirationDate(t *testing.T) {
 	assert.Equal(t, "invalid-date", result)
 }
 
+func TestFormatExpiration(t *testing.T) {
+	assert.Equal(t, "24", FormatExpiration("24"), "a bare number stays hours")
+	assert.Equal(t, "2023-12-31", FormatExpiration("2023-12-31"))
+	assert.Equal(t, "7x", FormatExpiration("7x"), "left for the server to reject")
+
+	for input, want := range map[string]time.Duration{
+		"90m":   90 * time.Minute,
+		"7d":    7 * 24 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"1d12h": 36 * time.Hour,
+	} {
+		ms, err := strconv.ParseInt(FormatExpiration(input), 10, 64)
+		require.NoError(t, err, input)
+		assert.WithinDuration(t, time.Now().Add(want), time.UnixMilli(ms), time.Second, input)
+	}
+}
+
 func TestFormatDaysRemaining(t *testing.T) {
 	result := formatDaysRemaining(30)
 	assert.Equal(t, "1 month", result)
@@ -443,3 +814,852 @@ func TestFormatDaysRemaining(t *testing.T) {
 	result = formatDaysRemaining(-5)
 	assert.Equal(t, "expired", result)
 }
+
+func TestHistoryRecordAndFind(t *testing.T) {
+	historyFile = filepath.Join(t.TempDir(), "uploads.json")
+	defer func() { historyFile = "" }()
+
+	entries, err := loadHistory()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	oldBaseURL := baseURL
+	baseURL = "http://drop.example.com/"
+	defer func() { baseURL = oldBaseURL }()
+	recordHistory(HistoryEntry{URL: "http://drop.example.com/abcd.txt", Token: "first-token"})
+	recordHistory(HistoryEntry{URL: "http://drop.example.com/efgh.png", Token: "second-token"})
+	recordHistory(HistoryEntry{URL: "http://drop.example.com/skip.png"})
+
+	info, err := os.Stat(historyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	entries, err = loadHistory()
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "uploads without a token are not recorded")
+	assert.Equal(t, "http://drop.example.com/", entries[0].Server)
+	assert.False(t, entries[0].UploadedAt.IsZero())
+
+	for _, input := range []string{"abcd.txt", "/abcd.txt", "http://drop.example.com/abcd.txt"} {
+		entry, ok := findHistoryEntry(entries, baseURL, input)
+		require.True(t, ok, input)
+		assert.Equal(t, "first-token", entry.Token)
+	}
+
+	_, ok := findHistoryEntry(entries, "http://other.example.com/", "abcd.txt")
+	assert.False(t, ok, "entries from other servers only match by full URL")
+
+	_, ok = findHistoryEntry(entries, baseURL, "missing")
+	assert.False(t, ok)
+}
+
+func TestRedactToken(t *testing.T) {
+	assert.Equal(t, "abcd************", redactToken("abcdefghijklmnop"))
+	assert.Equal(t, "***", redactToken("abc"))
+	assert.Equal(t, "", redactToken(""))
+}
+
+func TestClientCheckExistingUpload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/abcd.txt/meta.json":
+			json.NewEncoder(w).Encode(FileMeta{URL: "http://example.com/abcd.txt", MD5: "5d41402abc4b2a76b9719d911017c592"})
+		case "/nohash.txt/meta.json":
+			json.NewEncoder(w).Encode(FileMeta{URL: "http://example.com/nohash.txt"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	meta, state, err := client.checkExistingUpload("missing.txt", "5d41402abc4b2a76b9719d911017c592")
+	require.NoError(t, err)
+	assert.Nil(t, meta)
+	assert.Equal(t, uploadMissing, state)
+
+	meta, state, err = client.checkExistingUpload("abcd.txt", "5D41402ABC4B2A76B9719D911017C592")
+	require.NoError(t, err)
+	assert.Equal(t, uploadIdentical, state)
+	assert.Equal(t, "http://example.com/abcd.txt", meta.URL)
+
+	_, state, err = client.checkExistingUpload(server.URL+"/abcd.txt", "00000000000000000000000000000000")
+	require.NoError(t, err)
+	assert.Equal(t, uploadDifferent, state)
+
+	_, state, err = client.checkExistingUpload("nohash.txt", "5d41402abc4b2a76b9719d911017c592")
+	require.NoError(t, err)
+	assert.Equal(t, uploadExists, state)
+}
+
+func TestClientEnsureExpiration(t *testing.T) {
+	requireExpiration := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(LimitsResponse{RequireExpiration: requireExpiration})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+
+	options := map[string]string{}
+	err := client.ensureExpiration(options, nil)
+	assert.Error(t, err, "non-interactive uploads must pass --expires")
+	assert.Contains(t, err.Error(), "--expires")
+
+	options = map[string]string{}
+	require.NoError(t, client.ensureExpiration(options, strings.NewReader("48\n")))
+	assert.Equal(t, "48", options["expires"])
+
+	assert.Error(t, client.ensureExpiration(map[string]string{}, strings.NewReader("\n")))
+
+	options = map[string]string{"expires": "2"}
+	require.NoError(t, client.ensureExpiration(options, nil))
+	assert.Equal(t, "2", options["expires"])
+
+	requireExpiration = false
+	options = map[string]string{}
+	require.NoError(t, client.ensureExpiration(options, nil))
+	assert.Empty(t, options["expires"])
+}
+
+func TestAwaitScan(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/abc1.zip/scan", r.URL.Path)
+		polls++
+		status := ScanStatusResponse{Status: "pending"}
+		if polls == 3 {
+			status = ScanStatusResponse{Status: "infected", Signature: "Eicar-Test-Signature"}
+		}
+		json.NewEncoder(w).Encode(status)
+	}))
+	defer server.Close()
+
+	previousClient, previousInterval := client, scanPollInterval
+	defer func() { client, scanPollInterval = previousClient, previousInterval }()
+	client = NewClient(server.URL)
+	scanPollInterval = time.Millisecond
+
+	err := awaitScan("pending", server.URL+"/abc1.zip/scan")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Eicar-Test-Signature")
+	assert.Equal(t, 3, polls)
+
+	assert.NoError(t, awaitScan("clean", ""), "synchronous results need no polling")
+	assert.NoError(t, awaitScan("", ""), "servers without scanning only warn")
+	assert.Equal(t, 3, polls)
+}
+
+func TestPrintWhoami(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret-key", r.Header.Get("X-API-Key"))
+		switch r.URL.Path {
+		case "/version":
+			json.NewEncoder(w).Encode(map[string]string{"version": "1.2.3"})
+		case "/api/limits":
+			json.NewEncoder(w).Encode(LimitsResponse{MaxSize: 250 << 20, ChunkSize: 4 << 20, RequireExpiration: true})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.SetAPIKey("secret-key")
+
+	var out bytes.Buffer
+	require.NoError(t, printWhoami(&out, c, "/home/me/.drop/config.yaml"))
+	assert.Equal(t, "Server: "+server.URL+"/\n"+
+		"Config: /home/me/.drop/config.yaml\n"+
+		"API key: secr******\n"+
+		"Server version: 1.2.3\n"+
+		"Max upload size: 250.0 MB\n"+
+		"Chunk size: 4.0 MB\n"+
+		"Expiration required: true\n", out.String())
+}
+
+func TestPrintWhoamiWithOlderServer(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	var out bytes.Buffer
+	require.NoError(t, printWhoami(&out, NewClient(server.URL), ""))
+	assert.Contains(t, out.String(), "Config: none (defaults and flags only)\n")
+	assert.Contains(t, out.String(), "API key: not set\n")
+	assert.Contains(t, out.String(), "Server version: unknown (no /version endpoint)\n")
+	assert.Contains(t, out.String(), "Limits: unknown")
+
+	server.Close()
+	err := printWhoami(&out, NewClient(server.URL), "")
+	assert.ErrorContains(t, err, "server unreachable")
+}
+
+func TestAPIKeyIsOnlySentToTheServer(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("X-API-Key"))
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL)
+	c.SetAPIKey("secret-key")
+	resp, err := c.HTTPClient.Get(server.URL + "/version")
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestPrintHistory(t *testing.T) {
+	historyFile = filepath.Join(t.TempDir(), "uploads.json")
+	defer func() { historyFile = "" }()
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	entries := []HistoryEntry{
+		{URL: "http://drop.example.com/old1.txt", Token: "old-token-1", Name: "old.txt", Size: 10, ExpiresAt: "2025-02-01T00:00:00Z", UploadedAt: now.AddDate(0, -2, 0)},
+		{URL: "http://drop.example.com/abcd.txt", Token: "abcd-token", Name: "notes.txt", Size: 2048, MD5: "5d41402abc4b2a76b9719d911017c592", ExpiresAt: "2025-03-04T00:00:00Z", UploadedAt: now.Add(-time.Hour)},
+		{URL: "http://drop.example.com/link", Token: "link-token", Name: "https://example.com", UploadedAt: now},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printHistory(&out, entries, now, false, false))
+	table := out.String()
+	assert.Less(t, strings.Index(table, "/link"), strings.Index(table, "/abcd.txt"), "newest uploads come first")
+	assert.Contains(t, table, "2.0 KB")
+	assert.Contains(t, table, "3 days")
+	assert.Contains(t, table, "never")
+	assert.Contains(t, table, "abcd******")
+	assert.NotContains(t, table, "abcd-token")
+	assert.NotContains(t, table, "old1.txt")
+	assert.Contains(t, table, "1 expired upload(s) hidden, use --expired to show them")
+
+	out.Reset()
+	require.NoError(t, printHistory(&out, entries, now, true, false))
+	assert.Contains(t, out.String(), "old1.txt")
+	assert.Contains(t, out.String(), "expired")
+	assert.NotContains(t, out.String(), "hidden")
+
+	out.Reset()
+	require.NoError(t, printHistory(&out, entries, now, false, true))
+	var listed []HistoryEntry
+	require.NoError(t, json.Unmarshal(out.Bytes(), &listed))
+	require.Len(t, listed, 2)
+	assert.Equal(t, "link-token", listed[0].Token)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", listed[1].MD5)
+
+	out.Reset()
+	require.NoError(t, printHistory(&out, nil, now, false, false))
+	assert.Equal(t, "No uploads recorded in "+historyFile+"\n", out.String())
+}
+
+func TestForgetHistory(t *testing.T) {
+	historyFile = filepath.Join(t.TempDir(), "uploads.json")
+	defer func() { historyFile = "" }()
+
+	require.NoError(t, saveHistory([]HistoryEntry{
+		{URL: "http://drop.example.com/abcd.txt", Token: "first"},
+		{URL: "http://drop.example.com/efgh.png", Token: "second"},
+	}))
+
+	forgetHistory("http://drop.example.com/abcd.txt")
+	forgetHistory("http://drop.example.com/missing")
+
+	entries, err := loadHistory()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "second", entries[0].Token)
+}
+
+func TestClientUploadFileReadsMD5Trailer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "trailers", r.Header.Get("TE"))
+		w.Header().Set("Trailer", "X-MD5")
+		json.NewEncoder(w).Encode(UploadResponse{URL: "http://example.com/abcd.txt", Token: "token"})
+		w.Header().Set("X-MD5", "5d41402abc4b2a76b9719d911017c592")
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "hello.txt")
+	require.NoError(t, os.WriteFile(path, []byte("hello"), 0o644))
+
+	resp, err := NewClient(server.URL).UploadFile(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", resp.MD5)
+}
+
+func TestMigrateHistory(t *testing.T) {
+	historyFile = filepath.Join(t.TempDir(), "uploads.json")
+	defer func() { historyFile = "" }()
+
+	expires := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+	var downloads []string
+	oldServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.txt/meta.json":
+			meta := map[string]any{"name": "notes.txt", "expires_at": expires}
+			if r.Header.Get("X-Token") == "tok-a" {
+				meta["one_time_view"] = true
+			}
+			json.NewEncoder(w).Encode(meta)
+		case "/b.bin/meta.json":
+			json.NewEncoder(w).Encode(map[string]any{"name": "b.bin", "max_downloads": 5, "access_count": 2})
+		case "/secret.txt/meta.json":
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"error": "Password required", "password_protected": true})
+		case "/broken.txt/meta.json":
+			json.NewEncoder(w).Encode(map[string]any{"name": "broken.txt"})
+		case "/a.txt", "/b.bin":
+			downloads = append(downloads, r.URL.Path)
+			fmt.Fprint(w, "content of "+r.URL.Path)
+		case "/broken.txt":
+			http.Error(w, "disk on fire", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer oldServer.Close()
+
+	uploads := make(map[string]url.Values)
+	newServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		file, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		content, _ := io.ReadAll(file)
+		uploads[header.Filename] = r.MultipartForm.Value
+		uploads[header.Filename]["content"] = []string{string(content)}
+		json.NewEncoder(w).Encode(UploadResponse{URL: "http://new.example.com/" + header.Filename, Token: "new-" + header.Filename})
+	}))
+	defer newServer.Close()
+
+	from, to := NewClient(oldServer.URL), NewClient(newServer.URL)
+	entries := []HistoryEntry{
+		{URL: oldServer.URL + "/a.txt", Server: oldServer.URL, Token: "tok-a", Name: "notes.txt"},
+		{URL: oldServer.URL + "/b.bin", Server: oldServer.URL + "/", Token: "tok-b"},
+		{URL: oldServer.URL + "/expired.txt", Server: oldServer.URL, Token: "tok-c", ExpiresAt: "2020-01-01T00:00:00Z"},
+		{URL: oldServer.URL + "/gone.txt", Server: oldServer.URL, Token: "tok-d"},
+		{URL: oldServer.URL + "/secret.txt", Server: oldServer.URL, Token: "tok-e"},
+		{URL: oldServer.URL + "/broken.txt", Server: oldServer.URL, Token: "tok-f"},
+		{URL: "http://elsewhere.example.com/x.txt", Server: "http://elsewhere.example.com/", Token: "tok-g"},
+	}
+
+	var out bytes.Buffer
+	result := migrateHistory(&out, from, to, entries, time.Now(), 1<<20, true)
+	assert.Equal(t, migrateResult{Migrated: 3, Skipped: 3}, result, out.String())
+	assert.Empty(t, downloads, "dry runs download nothing")
+	assert.Empty(t, uploads)
+	assert.Contains(t, out.String(), "Dry run: 3 would be migrated")
+
+	out.Reset()
+	result = migrateHistory(&out, from, to, entries, time.Now(), 1<<20, false)
+	assert.Equal(t, migrateResult{Migrated: 2, Skipped: 3, Failed: 1}, result, out.String())
+	assert.Contains(t, out.String(), "expired.txt: skipped, expired")
+	assert.Contains(t, out.String(), "gone.txt: skipped, not found on the old server")
+	assert.Contains(t, out.String(), "secret.txt: skipped, password protected")
+	assert.Contains(t, out.String(), "broken.txt: failed, download failed with status 500: disk on fire")
+
+	require.Contains(t, uploads, "notes.txt")
+	assert.Equal(t, "content of /a.txt", uploads["notes.txt"]["content"][0])
+	assert.Equal(t, "true", uploads["notes.txt"]["one_time"][0])
+	assert.Equal(t, expires, uploads["notes.txt"]["expires"][0])
+	require.Contains(t, uploads, "b.bin")
+	assert.Equal(t, "3", uploads["b.bin"]["max_downloads"][0], "the downloads left are kept")
+
+	history, err := loadHistory()
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "http://new.example.com/notes.txt", history[0].URL)
+	assert.Equal(t, to.BaseURL, history[0].Server)
+	assert.Equal(t, "new-notes.txt", history[0].Token)
+	assert.Equal(t, "notes.txt", history[0].Name)
+}
+
+func TestClientDownloadToFile(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 100))
+	sum := md5.Sum(content)
+	serverMD5 := hex.EncodeToString(sum[:])
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/abc.txt/meta.json":
+			json.NewEncoder(w).Encode(FileMeta{Name: "report.txt", Size: int64(len(content)), MD5: serverMD5})
+		case "/abc.txt":
+			if r.Method == http.MethodGet {
+				ranges = append(ranges, r.Header.Get("Range"))
+			}
+			w.Header().Set("Content-Disposition", `attachment; filename="report.txt"`)
+			http.ServeContent(w, r, "abc.txt", time.Time{}, bytes.NewReader(content))
+		case "/gone.txt":
+			w.WriteHeader(http.StatusGone)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := NewClient(server.URL)
+
+	t.Run("resumes a partial download", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "report.txt")
+		require.NoError(t, os.WriteFile(output+".part", content[:300], 0o644))
+		ranges = nil
+
+		result, err := client.DownloadToFile(server.URL+"/abc.txt", output, true, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bytes=300-"}, ranges)
+		assert.Equal(t, int64(300), result.Resumed)
+		assert.Equal(t, int64(len(content)), result.Size)
+		assert.True(t, result.Verified)
+
+		saved, err := os.ReadFile(output)
+		require.NoError(t, err)
+		assert.Equal(t, content, saved)
+		assert.NoFileExists(t, output+".part")
+	})
+
+	t.Run("completes a fully downloaded part", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "report.txt")
+		require.NoError(t, os.WriteFile(output+".part", content, 0o644))
+
+		result, err := client.DownloadToFile(server.URL+"/abc.txt", output, true, false)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), result.Size)
+		saved, err := os.ReadFile(output)
+		require.NoError(t, err)
+		assert.Equal(t, content, saved)
+	})
+
+	t.Run("restarts a part longer than the file", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "report.txt")
+		require.NoError(t, os.WriteFile(output+".part", bytes.Repeat([]byte("x"), 2000), 0o644))
+
+		result, err := client.DownloadToFile(server.URL+"/abc.txt", output, true, false)
+		require.NoError(t, err)
+		assert.Zero(t, result.Resumed)
+		saved, err := os.ReadFile(output)
+		require.NoError(t, err)
+		assert.Equal(t, content, saved)
+	})
+
+	t.Run("names the file after Content-Disposition", func(t *testing.T) {
+		t.Chdir(t.TempDir())
+
+		result, err := client.DownloadToFile(server.URL+"/abc.txt", "", true, false)
+		require.NoError(t, err)
+		assert.Equal(t, "report.txt", result.Path)
+		assert.FileExists(t, "report.txt")
+	})
+
+	t.Run("discards a corrupt resume", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "report.txt")
+		require.NoError(t, os.WriteFile(output+".part", bytes.Repeat([]byte("x"), 300), 0o644))
+
+		_, err := client.DownloadToFile(server.URL+"/abc.txt", output, true, false)
+		assert.ErrorContains(t, err, "MD5 verification failed")
+		assert.NoFileExists(t, output)
+		assert.NoFileExists(t, output+".part")
+	})
+
+	t.Run("missing and expired files", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "out")
+		_, err := client.DownloadToFile(server.URL+"/missing.txt", output, true, false)
+		assert.ErrorIs(t, err, errFileNotFound)
+		_, err = client.DownloadToFile(server.URL+"/gone.txt", output, true, false)
+		assert.ErrorIs(t, err, errFileExpired)
+		assert.NoFileExists(t, output+".part")
+	})
+}
+
+func TestDownloadFilename(t *testing.T) {
+	assert.Equal(t, "report.pdf", downloadFilename(`attachment; filename="report.pdf"`, "http://drop.test/abc.pdf"))
+	assert.Equal(t, "résumé.pdf", downloadFilename(`inline; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`, "http://drop.test/abc.pdf"))
+	assert.Equal(t, "passwd", downloadFilename(`attachment; filename="../../etc/passwd"`, "http://drop.test/abc"))
+	assert.Equal(t, "abc.pdf", downloadFilename("", "http://drop.test/abc.pdf"))
+	assert.Equal(t, "download", downloadFilename("", "http://drop.test/"))
+}
+
+func TestClientListUploadSessions(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/upload/sessions", r.URL.Path)
+		w.Write([]byte(`{"sessions":[{"upload_id":"k3j9x2","filename":"video.mp4","total_size":10485760,` +
+			`"uploaded_chunks":1,"total_chunks":4,"progress":25,"created_at":"2026-03-01T12:00:00Z","expires_at":"2026-03-02T12:00:00Z"}]}`))
+	}))
+	defer server.Close()
+
+	sessions, err := NewClient(server.URL).ListUploadSessions()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "k3j9x2", sessions[0].UploadID)
+	assert.Equal(t, 25, sessions[0].Progress)
+	assert.Equal(t, created, sessions[0].CreatedAt)
+
+	var out bytes.Buffer
+	printUploadSessions(&out, sessions, created.Add(time.Hour))
+	assert.Contains(t, out.String(), "k3j9x2")
+	assert.Contains(t, out.String(), "25% (1/4)")
+	assert.Contains(t, out.String(), "in 23h0m0s")
+
+	out.Reset()
+	printUploadSessions(&out, nil, created)
+	assert.Equal(t, "No unfinished chunked uploads\n", out.String())
+}
+
+func TestUploadFromStdin(t *testing.T) {
+	content := []byte("piped \x00 content\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(32<<20))
+		file, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		defer file.Close()
+
+		body, err := io.ReadAll(file)
+		require.NoError(t, err)
+		assert.Equal(t, "build.log", header.Filename)
+		assert.Equal(t, content, body)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(UploadResponse{URL: "http://example.com/build.log"})
+	}))
+	defer server.Close()
+
+	path, cleanup, err := spoolStdin(bytes.NewBuffer(content), "build.log")
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), info.Size())
+
+	response, err := NewClient(server.URL).UploadFile(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/build.log", response.URL)
+
+	cleanup()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "spooled file is removed")
+}
+
+func TestSpoolStdinDefaultFilename(t *testing.T) {
+	for _, filename := range []string{"", "/", ".."} {
+		path, cleanup, err := spoolStdin(strings.NewReader("data"), filename)
+		require.NoError(t, err)
+		assert.Equal(t, defaultStdinFilename, filepath.Base(path))
+		cleanup()
+	}
+
+	path, cleanup, err := spoolStdin(strings.NewReader("data"), "../../etc/notes.txt")
+	require.NoError(t, err)
+	defer cleanup()
+	assert.Equal(t, "notes.txt", filepath.Base(path))
+}
+
+func TestUploadBatch(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+		uploads.Add(1)
+
+		sum := md5.Sum(data)
+		json.NewEncoder(w).Encode(UploadResponse{
+			URL:   "http://example.com/" + header.Filename,
+			Size:  int64(len(data)),
+			Token: "token-" + header.Filename,
+			MD5:   hex.EncodeToString(sum[:]),
+		})
+	}))
+	defer server.Close()
+
+	previousClient := client
+	defer func() { client = previousClient }()
+	client = NewClient(server.URL)
+	historyFile = filepath.Join(t.TempDir(), "uploads.json")
+	defer func() { historyFile = "" }()
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.png")
+	require.NoError(t, os.WriteFile(valid, []byte("png bytes"), 0644))
+	missing := filepath.Join(dir, "missing.png")
+
+	settings := uploadSettings{options: map[string]string{}, hashAlgo: hashMD5, verify: true, threshold: 10 << 20}
+	upload := func(path string) (*uploadedFile, error) { return uploadPath(path, settings, true) }
+
+	t.Run("continues past failures", func(t *testing.T) {
+		uploads.Store(0)
+		var out bytes.Buffer
+		err := uploadBatch(&out, []string{missing, valid}, 1, false, upload)
+		require.Error(t, err)
+		assert.Equal(t, "1 of 2 uploads failed", err.Error())
+		assert.Equal(t, int32(1), uploads.Load())
+
+		assert.Contains(t, out.String(), "http://example.com/valid.png")
+		assert.Contains(t, out.String(), "token-valid.png")
+		assert.Contains(t, out.String(), "Errors:\n  "+missing+": ")
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		uploads.Store(0)
+		var out bytes.Buffer
+		err := uploadBatch(&out, []string{missing, valid}, 1, true, upload)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "1 skipped")
+		assert.Zero(t, uploads.Load(), "the batch stops at the first failure")
+		assert.Contains(t, out.String(), "skipped")
+		assert.NotContains(t, out.String(), "http://example.com/valid.png")
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		uploads.Store(0)
+		other := filepath.Join(dir, "other.png")
+		require.NoError(t, os.WriteFile(other, []byte("more png bytes"), 0644))
+
+		var out bytes.Buffer
+		require.NoError(t, uploadBatch(&out, []string{valid, other}, 2, true, upload))
+		assert.Equal(t, int32(2), uploads.Load())
+		assert.Contains(t, out.String(), "http://example.com/other.png")
+		assert.Contains(t, out.String(), "Uploaded 2 files")
+
+		entries, err := loadHistory()
+		require.NoError(t, err)
+		assert.Len(t, entries, 3, "every upload is in the history")
+	})
+}
+
+func TestHashMismatch(t *testing.T) {
+	assert.NoError(t, hashMismatch(hashMD5, "abc", "ABC"))
+	assert.NoError(t, hashMismatch(hashMD5, "", "abc"), "nothing to verify without a local hash")
+	assert.NoError(t, hashMismatch(hashSHA256, "abc", ""), "servers may not report the hash")
+	assert.Error(t, hashMismatch(hashMD5, "abc", "def"))
+}
+
+// recordRetryWaits replaces the retry sleep for the test and returns the
+// waits it was asked for
+func recordRetryWaits(t *testing.T) *[]time.Duration {
+	waits := &[]time.Duration{}
+	previous := retrySleep
+	retrySleep = func(d time.Duration) { *waits = append(*waits, d) }
+	t.Cleanup(func() { retrySleep = previous })
+	return waits
+}
+
+func TestClientUploadFileRetries(t *testing.T) {
+	waits := recordRetryWaits(t)
+	filePath := filepath.Join(t.TempDir(), "flaky.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("flaky"), 0644))
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		file, _, err := r.FormFile("file")
+		require.NoError(t, err, "every attempt sends the whole body")
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "flaky", string(data))
+
+		switch attempts {
+		case 1:
+			w.Header().Set("Retry-After", "7")
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		case 2:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		default:
+			json.NewEncoder(w).Encode(UploadResponse{URL: "http://example.com/flaky.txt"})
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.Retries = 3
+	client.RetryBackoff = 100 * time.Millisecond
+
+	resp, err := client.UploadFile(filePath, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/flaky.txt", resp.URL)
+	assert.Equal(t, 3, attempts)
+	require.Len(t, *waits, 2)
+	assert.Equal(t, 7*time.Second, (*waits)[0], "Retry-After is respected")
+	assert.GreaterOrEqual(t, (*waits)[1], 100*time.Millisecond, "the second retry waits twice the backoff, jittered")
+	assert.LessOrEqual(t, (*waits)[1], 200*time.Millisecond)
+
+	// Out of retries, the last failure is returned
+	attempts = 0
+	client.Retries = 1
+	_, err = client.UploadFile(filePath, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 502")
+	assert.Equal(t, 2, attempts)
+}
+
+func TestClientUploadFileDoesNotRetryRefusals(t *testing.T) {
+	recordRetryWaits(t)
+	filePath := filepath.Join(t.TempDir(), "refused.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("refused"), 0644))
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.Retries = 3
+	_, err := client.UploadFile(filePath, nil)
+	require.Error(t, err)
+	assert.Equal(t, "upload failed with status 413: File too large\n", err.Error())
+	assert.Equal(t, 1, attempts)
+}
+
+func TestClientUploadFileChunkedRetries(t *testing.T) {
+	waits := recordRetryWaits(t)
+	filePath := filepath.Join(t.TempDir(), "flaky.bin")
+	require.NoError(t, os.WriteFile(filePath, []byte("hello world"), 0644))
+
+	stored := map[int]string{}
+	attempts := map[int]int{}
+	statusChecks := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/upload/init":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"upload_id":       "abcd",
+				"chunk_size":      4,
+				"total_chunks":    3,
+				"uploaded_chunks": []int{},
+			})
+		case r.URL.Path == "/upload/status/abcd":
+			statusChecks++
+			uploaded := []int{}
+			for i := range stored {
+				uploaded = append(uploaded, i)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"progress": len(stored) * 100 / 3, "uploaded_chunks": uploaded})
+		default:
+			index, err := strconv.Atoi(filepath.Base(r.URL.Path))
+			require.NoError(t, err)
+			attempts[index]++
+			file, _, err := r.FormFile("chunk")
+			require.NoError(t, err)
+			data, _ := io.ReadAll(file)
+
+			switch {
+			case index == 1 && attempts[index] <= 2:
+				// Fails twice before it is stored
+				http.Error(w, "try again", http.StatusServiceUnavailable)
+			case index == 2 && attempts[index] == 1:
+				// Stored, but the response is lost
+				stored[index] = string(data)
+				http.Error(w, "proxy timeout", http.StatusGatewayTimeout)
+			default:
+				stored[index] = string(data)
+				json.NewEncoder(w).Encode(map[string]interface{}{"message": "Chunk uploaded successfully"})
+			}
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.Retries = 2
+	client.RetryBackoff = time.Millisecond
+	_, err := client.UploadFileChunked(filePath, 4, "", false)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[int]string{0: "hell", 1: "o wo", 2: "rld"}, stored)
+	assert.Equal(t, map[int]int{0: 1, 1: 3, 2: 1}, attempts, "chunks the server has are skipped")
+	assert.Len(t, *waits, 3)
+	assert.GreaterOrEqual(t, statusChecks, 3, "every retry checks the session first")
+}
+
+func TestTransientError(t *testing.T) {
+	assert.True(t, transientError(&statusError{StatusCode: http.StatusServiceUnavailable}))
+	assert.True(t, transientError(&statusError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, transientError(&statusError{StatusCode: http.StatusBadRequest}))
+	assert.False(t, transientError(fmt.Errorf("failed to decode response: %w", io.ErrUnexpectedEOF)), "answered requests aren't sent again")
+
+	network := &url.Error{Op: "Post", URL: "http://drop.example/", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	assert.True(t, transientError(fmt.Errorf("failed to upload file: %w", network)))
+	assert.True(t, transientError(&url.Error{Op: "Post", URL: "http://drop.example/", Err: io.EOF}))
+	assert.False(t, transientError(&url.Error{Op: "Post", URL: "drop.example", Err: errors.New("unsupported protocol scheme")}))
+	assert.False(t, transientError(&url.Error{Op: "Post", URL: "http://drop.example/", Err: context.Canceled}))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 2*time.Minute, parseRetryAfter(now.Add(2*time.Minute).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+	assert.Zero(t, parseRetryAfter("", now))
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	waits := recordRetryWaits(t)
+	attempts := 0
+	client := NewClient("http://drop.example/")
+	client.Retries = 3
+	err := client.withRetries(func() error {
+		attempts++
+		return &statusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour, message: "slow down"}
+	})
+	assert.EqualError(t, err, "slow down")
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, *waits)
+}
+
+func TestPrintStats(t *testing.T) {
+	const body = `{"active_uploads":1,"maintenance_mode":false,"total_files":4,"total_size":3145828,` +
+		`"types":{"image":{"files":2,"size":3145728},"text":{"files":1,"size":93},"unknown":{"files":1,"size":7}},` +
+		`"transfer_period":"2026-10","transfer_bytes_served":2048,"transfer_cap_bytes":1073741824}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/stats", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	c := NewClient(server.URL)
+
+	var out bytes.Buffer
+	require.NoError(t, printStats(&out, c, false))
+	assert.Equal(t, "Files: 4\n"+
+		"Total size: 3.0 MB\n"+
+		"Chunked uploads in progress: 1\n"+
+		"Served in 2026-10: 2.0 KB of 1.0 GB\n"+
+		utils.GenerateASCIITable([]string{"Type", "Files", "Size"}, []utils.TableRow{
+			{Fields: []string{"image", "2", "3.0 MB"}},
+			{Fields: []string{"text", "1", "93 B"}},
+			{Fields: []string{"unknown", "1", "7 B"}},
+		}), out.String())
+
+	out.Reset()
+	require.NoError(t, printStats(&out, c, true))
+	assert.Equal(t, body+"\n", out.String(), "--json passes the response through")
+}
+
+func TestPrintStatsWithOlderServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/stats" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"active_uploads":0,"maintenance_mode":true}`))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	require.NoError(t, printStats(&out, NewClient(server.URL), false))
+	assert.Equal(t, "Files: unknown (the server doesn't report totals)\n"+
+		"Chunked uploads in progress: 0\n"+
+		"Maintenance mode: on\n", out.String())
+
+	server.Close()
+	assert.ErrorContains(t, printStats(&out, NewClient(server.URL), false), "failed to get server stats")
+}
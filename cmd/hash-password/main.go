@@ -0,0 +1,46 @@
+// Command hash-password prints the admin_password_hash line for config.yaml,
+// reading the password from standard input:
+//
+//	go run ./cmd/hash-password -user admin
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func main() {
+	var (
+		username = flag.String("user", "admin", "Admin username")
+		cost     = flag.Int("cost", bcrypt.DefaultCost, "bcrypt cost")
+	)
+	flag.Parse()
+
+	if *username == "" || strings.Contains(*username, ":") {
+		log.Fatal("Username must not be empty or contain ':'")
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		log.Fatalf("Failed to read password: %v", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		log.Fatal("Password must not be empty")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), *cost)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Printf("admin_password_hash: \"%s:%s\"\n", *username, hash)
+}
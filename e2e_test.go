@@ -519,7 +519,7 @@ func TestChunkedUpload(t *testing.T) {
 		}
 
 		// Check status
-		statusResp, err := getChunkedUploadStatus(initResp.UploadID)
+		statusResp, err := getChunkedUploadStatus(initResp.UploadID, initResp.UploadToken)
 		if err != nil {
 			t.Errorf("Status check failed: %v", err)
 			return
@@ -559,7 +559,7 @@ func TestChunkedUpload(t *testing.T) {
 			}
 
 			chunkContent := content[start:end]
-			err := uploadChunk(initResp.UploadID, i, chunkContent)
+			err := uploadChunk(initResp.UploadID, initResp.UploadToken, i, chunkContent)
 			if err != nil {
 				t.Errorf("Failed to upload chunk %d: %v", i, err)
 				return
@@ -1104,7 +1104,7 @@ func initChunkedUpload(filename string, totalSize int) (*ChunkedUploadInitRespon
 	return &initResp, nil
 }
 
-func uploadChunk(uploadID string, chunkIndex int, chunkContent string) error {
+func uploadChunk(uploadID, uploadToken string, chunkIndex int, chunkContent string) error {
 	var buf bytes.Buffer
 	writer := multipart.NewWriter(&buf)
 
@@ -1130,6 +1130,7 @@ func uploadChunk(uploadID string, chunkIndex int, chunkContent string) error {
 	}
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-Upload-Token", uploadToken)
 
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
@@ -1146,8 +1147,8 @@ func uploadChunk(uploadID string, chunkIndex int, chunkContent string) error {
 	return nil
 }
 
-func completeChunkedUpload(uploadID string) (string, error) {
-	statusResp, err := getChunkedUploadStatus(uploadID)
+func completeChunkedUpload(uploadID, uploadToken string) (string, error) {
+	statusResp, err := getChunkedUploadStatus(uploadID, uploadToken)
 	if err != nil {
 		return "", fmt.Errorf("failed to check upload status: %w", err)
 	}
@@ -1160,9 +1161,15 @@ func completeChunkedUpload(uploadID string) (string, error) {
 	return fmt.Sprintf("%s/%s%s", baseURL, uploadID, fileExt), nil
 }
 
-func getChunkedUploadStatus(uploadID string) (*ChunkedUploadStatusResponse, error) {
+func getChunkedUploadStatus(uploadID, uploadToken string) (*ChunkedUploadStatusResponse, error) {
 	url := fmt.Sprintf("%s/upload/status/%s", baseURL, uploadID)
-	resp, err := http.Get(url)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Upload-Token", uploadToken)
+
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -1227,6 +1234,7 @@ func deleteFile(fileID, token string) error {
 
 type ChunkedUploadInitResponse struct {
 	UploadID       string `json:"upload_id"`
+	UploadToken    string `json:"upload_token"`
 	ChunkSize      int64  `json:"chunk_size"`
 	TotalChunks    int    `json:"total_chunks"`
 	UploadedChunks []int  `json:"uploaded_chunks"`
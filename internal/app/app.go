@@ -1,13 +1,18 @@
 package app
 
 import (
+	"bytes"
 	"context"
 	"embed"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -18,6 +23,7 @@ import (
 	"github.com/marianozunino/drop/internal/expiration"
 	"github.com/marianozunino/drop/internal/handler"
 	middie "github.com/marianozunino/drop/internal/middleware"
+	"github.com/marianozunino/drop/internal/webhook"
 )
 
 //go:embed favicon.ico
@@ -28,7 +34,10 @@ type App struct {
 	server            *echo.Echo
 	expirationManager *expiration.ExpirationManager
 	config            *config.Config
-	db                *db.DB
+	db                db.Store
+	accessCounter     *db.AccessCounter
+	chunkedUploads    *handler.ChunkedUploadManager
+	webhooks          *webhook.Notifier
 	actualPort        int
 }
 
@@ -56,7 +65,11 @@ func logConfiguration(cfg *config.Config) {
 	log.Printf("Drop File Upload Service - Configuration:")
 	log.Printf("  Server Port: %d", cfg.Port)
 	log.Printf("  Upload Directory: %s", cfg.UploadPath)
-	log.Printf("  Database Path: %s", cfg.SQLitePath)
+	if cfg.MetadataBackend == config.PostgresBackend {
+		log.Printf("  Database: postgres")
+	} else {
+		log.Printf("  Database Path: %s", cfg.SQLitePath)
+	}
 	log.Printf("  Base URL: %s", cfg.BaseURL)
 	log.Printf("")
 	log.Printf("File Settings:")
@@ -74,6 +87,7 @@ func logConfiguration(cfg *config.Config) {
 	log.Printf("  Admin Panel: %s", map[bool]string{true: "Enabled", false: "Disabled"}[cfg.AdminPanelEnabled])
 	log.Printf("  IP Tracking: %s", map[bool]string{true: "Enabled", false: "Disabled"}[cfg.IPTrackingEnabled])
 	log.Printf("  URL Shortening: %s", map[bool]string{true: "Enabled", false: "Disabled"}[cfg.URLShorteningEnabled])
+	log.Printf("  Webhooks: %s", map[bool]string{true: "Enabled", false: "Disabled"}[cfg.WebhookURL != ""])
 	log.Printf("")
 	log.Printf("Preview Bots (%d configured):", len(cfg.PreviewBots))
 	for i, bot := range cfg.PreviewBots {
@@ -101,13 +115,19 @@ func New() (*App, error) {
 		return nil, err
 	}
 
-	db, err := db.NewDB(cfg)
+	store, err := db.NewStore(cfg)
 	if err != nil {
 		log.Printf("Failed to initialize database: %v", err)
 		return nil, err
 	}
 
-	expirationManager, err := expiration.NewExpirationManager(cfg, db)
+	if err := ensureSchema(store); err != nil {
+		log.Printf("Database schema check failed: %v", err)
+		store.Close()
+		return nil, err
+	}
+
+	expirationManager, err := expiration.NewExpirationManager(cfg, store)
 	if err != nil {
 		log.Printf("Failed to initialize expiration manager: %v", err)
 		return nil, err
@@ -116,6 +136,7 @@ func New() (*App, error) {
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
+	e.IPExtractor = ipExtractor(cfg)
 
 	e.Server.ReadTimeout = 10 * time.Minute
 	e.Server.WriteTimeout = 10 * time.Minute
@@ -126,12 +147,18 @@ func New() (*App, error) {
 		server:            e,
 		expirationManager: expirationManager,
 		config:            cfg,
-		db:                db,
+		db:                store,
+		accessCounter:     db.NewAccessCounter(store, cfg.AccessFlushInterval()),
+		webhooks:          webhook.NewNotifier(cfg),
 	}
+	expirationManager.SetWebhooks(app.webhooks)
 
-	e.Use(humanLogger())
+	e.Use(humanLogger(cfg, os.Stdout))
+	if threshold := cfg.SlowRequestThreshold(); threshold > 0 {
+		e.Use(middie.SlowRequests(threshold))
+	}
 	e.Use(middleware.Recover())
-	e.Use(middie.SecurityHeaders())
+	useSecurityMiddleware(e, cfg)
 
 	registerRoutes(e, app)
 	return app, nil
@@ -146,13 +173,19 @@ func NewWithConfig(cfg *config.Config) (*App, error) {
 		return nil, err
 	}
 
-	db, err := db.NewDB(cfg)
+	store, err := db.NewStore(cfg)
 	if err != nil {
 		log.Printf("Failed to initialize database: %v", err)
 		return nil, err
 	}
 
-	expirationManager, err := expiration.NewExpirationManager(cfg, db)
+	if err := ensureSchema(store); err != nil {
+		log.Printf("Database schema check failed: %v", err)
+		store.Close()
+		return nil, err
+	}
+
+	expirationManager, err := expiration.NewExpirationManager(cfg, store)
 	if err != nil {
 		log.Printf("Failed to initialize expiration manager: %v", err)
 		return nil, err
@@ -161,6 +194,7 @@ func NewWithConfig(cfg *config.Config) (*App, error) {
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
+	e.IPExtractor = ipExtractor(cfg)
 
 	e.Server.ReadTimeout = 10 * time.Minute
 	e.Server.WriteTimeout = 10 * time.Minute
@@ -171,25 +205,153 @@ func NewWithConfig(cfg *config.Config) (*App, error) {
 		server:            e,
 		expirationManager: expirationManager,
 		config:            cfg,
-		db:                db,
+		db:                store,
+		accessCounter:     db.NewAccessCounter(store, cfg.AccessFlushInterval()),
+		webhooks:          webhook.NewNotifier(cfg),
 	}
+	expirationManager.SetWebhooks(app.webhooks)
 
-	e.Use(humanLogger())
+	e.Use(humanLogger(cfg, os.Stdout))
+	if threshold := cfg.SlowRequestThreshold(); threshold > 0 {
+		e.Use(middie.SlowRequests(threshold))
+	}
 	e.Use(middleware.Recover())
-	e.Use(middie.SecurityHeaders())
+	useSecurityMiddleware(e, cfg)
 
 	registerRoutes(e, app)
 	return app, nil
 }
 
-// humanLogger creates a human-friendly logger middleware
-func humanLogger() echo.MiddlewareFunc {
+// uploadRateLimit limits uploads to uploads_per_minute_per_ip, or to the
+// uploads_per_minute of the tier whose API key the request sends. Every tier
+// with its own limit keeps its own buckets. It returns nil without any limit.
+func uploadRateLimit(cfg *config.Config) []echo.MiddlewareFunc {
+	tierLimits := make(map[string]echo.MiddlewareFunc)
+	for name, tier := range cfg.UploadTiers {
+		if tier.UploadsPerMinute > 0 {
+			tierLimits[name] = middie.NewRateLimiter(tier.UploadsPerMinute, cfg.RateLimitAllowlist).Middleware()
+		}
+	}
+	var globalLimit echo.MiddlewareFunc
+	if cfg.UploadsPerMinutePerIP > 0 {
+		globalLimit = middie.NewRateLimiter(cfg.UploadsPerMinutePerIP, cfg.RateLimitAllowlist).Middleware()
+	}
+	if globalLimit == nil && len(tierLimits) == 0 {
+		return nil
+	}
+
+	return []echo.MiddlewareFunc{func(next echo.HandlerFunc) echo.HandlerFunc {
+		limited := make(map[string]echo.HandlerFunc, len(tierLimits))
+		for name, limit := range tierLimits {
+			limited[name] = limit(next)
+		}
+		fallback := next
+		if globalLimit != nil {
+			fallback = globalLimit(next)
+		}
+
+		return func(c echo.Context) error {
+			// Unknown keys get the global limit and are rejected by the handler
+			tier := config.AnonymousTier
+			if key := c.Request().Header.Get(handler.APIKeyHeader); key != "" {
+				if name, ok := cfg.TierForAPIKey(key); ok {
+					tier = name
+				}
+			}
+			if limitedNext, ok := limited[tier]; ok {
+				return limitedNext(c)
+			}
+			return fallback(c)
+		}
+	}}
+}
+
+// ipExtractor picks where c.RealIP() comes from. Without trusted_proxies it is
+// the connection's address, so clients can't choose their own with
+// X-Forwarded-For to dodge the rate limit, password lockouts or the session
+// cap. Behind a proxy, X-Forwarded-For is read up to the first untrusted hop.
+func ipExtractor(cfg *config.Config) echo.IPExtractor {
+	// LoadConfig already rejected invalid entries
+	nets, _ := cfg.TrustedProxyNets()
+	if len(nets) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, ipNet := range nets {
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// useSecurityMiddleware adds the security headers and, with force_https, the
+// redirect of plain HTTP requests. Health checks are never redirected.
+func useSecurityMiddleware(e *echo.Echo, cfg *config.Config) {
+	e.Use(middie.SecurityHeadersWithHSTS(cfg.HSTSMaxAge()))
+	if cfg.ForceHTTPS {
+		e.Use(middie.ForceHTTPS(cfg.PathPrefix + "/health"))
+	}
+}
+
+// humanLogger creates a human-friendly logger middleware. Requests for the
+// log_exclude_paths, or anything below them, aren't logged, and secrets in
+// query strings are redacted.
+func humanLogger(cfg *config.Config, out io.Writer) echo.MiddlewareFunc {
 	return middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "${time_rfc3339} | ${method} ${uri} | ${status} | ${latency_human} | ${bytes_in_human}\n",
-		Output: os.Stdout,
+		Skipper: func(c echo.Context) bool {
+			path := strings.TrimPrefix(c.Request().URL.Path, cfg.PathPrefix)
+			for _, excluded := range cfg.LogExcludePaths {
+				excluded = strings.TrimSuffix(excluded, "/")
+				if excluded == "" {
+					continue
+				}
+				if path == excluded || strings.HasPrefix(path, excluded+"/") {
+					return true
+				}
+			}
+			return false
+		},
+		Format: "${time_rfc3339} | ${method} ${custom} | ${status} | ${latency_human} | ${bytes_in_human}\n",
+		CustomTagFunc: func(c echo.Context, buf *bytes.Buffer) (int, error) {
+			return buf.WriteString(redactedURI(c.Request()))
+		},
+		Output: out,
 	})
 }
 
+// sensitiveQueryParams are redacted from logged URLs. Management tokens and
+// download passwords may be sent in the query string.
+var sensitiveQueryParams = map[string]bool{"token": true, "password": true}
+
+// redactedURI returns the request URI with the values of sensitiveQueryParams
+// replaced, keeping the rest of the query as it was sent
+func redactedURI(r *http.Request) string {
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if sensitiveQueryParams[strings.ToLower(key)] {
+			params[i] = key + "=REDACTED"
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
 // Start starts the application
 func (a *App) Start() {
 	log.Printf("")
@@ -199,6 +361,14 @@ func (a *App) Start() {
 		a.expirationManager.Start()
 	}
 
+	if a.accessCounter != nil {
+		a.accessCounter.Start()
+	}
+
+	if a.chunkedUploads != nil {
+		a.chunkedUploads.Start()
+	}
+
 	if a.config.Port == 0 {
 		listener, err := net.Listen("tcp", ":0")
 		if err != nil {
@@ -245,6 +415,23 @@ func (a *App) Stop() {
 		log.Printf("Expiration manager stopped")
 	}
 
+	if a.chunkedUploads != nil {
+		a.chunkedUploads.Stop()
+		log.Printf("Chunked upload cleanup stopped")
+	}
+
+	if a.accessCounter != nil {
+		if err := a.accessCounter.Stop(); err != nil {
+			log.Printf("Failed to write access counts: %v", err)
+		}
+		log.Printf("Access counter stopped")
+	}
+
+	if a.webhooks != nil {
+		a.webhooks.Stop()
+		log.Printf("Webhook notifier stopped")
+	}
+
 	log.Printf("All services stopped")
 }
 
@@ -262,40 +449,90 @@ func setup(cfg *config.Config) error {
 	return nil
 }
 
+// ensureSchema verifies the database schema and applies pending migrations when
+// it is behind. A dirty database stops the server from starting.
+func ensureSchema(database db.Store) error {
+	err := database.VerifySchema()
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, db.ErrSchemaOutdated) {
+		return err
+	}
+
+	log.Printf("%v, applying migrations", err)
+	if err := database.Migrate(); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return database.VerifySchema()
+}
+
 // registerRoutes registers all HTTP routes
 func registerRoutes(e *echo.Echo, app *App) {
 	var favicon []byte
 
 	e.Use(middleware.BodyLimit(
-		fmt.Sprintf("%dM", int(app.config.MaxSize)),
+		fmt.Sprintf("%dM", int(app.config.LargestMaxSize())),
 	))
 	h := handler.NewHandler(app.expirationManager, app.config, app.db)
+	h.SetAccessCounter(app.accessCounter)
+	h.SetWebhooks(app.webhooks)
+	app.chunkedUploads = h.ChunkedUploads()
+
+	// Every route lives under path_prefix, so the server can sit behind a
+	// reverse proxy at a subpath
+	prefix := app.config.PathPrefix
+	r := e.Group(prefix)
+	if prefix != "" {
+		e.GET(prefix, func(c echo.Context) error {
+			return c.Redirect(http.StatusMovedPermanently, prefix+"/")
+		})
+	}
+
+	r.GET("/", h.HandleHome)
+	r.HEAD("/", h.HandleCapabilities)
+	r.OPTIONS("/", h.HandleCapabilities)
+	r.GET("/chunked", h.HandleChunkedUpload)
 
-	e.GET("/", h.HandleHome)
-	e.GET("/chunked", h.HandleChunkedUpload)
-	e.POST("/", h.HandleUpload)
+	// Uploads, URL shortening and chunks share one bucket per client IP
+	uploadLimit := uploadRateLimit(app.config)
+	r.POST("/", h.HandleUpload, uploadLimit...)
 
-	e.POST("/upload/init", h.InitiateChunkedUpload)
-	e.POST("/upload/chunk/:upload_id/:chunk", h.UploadChunk)
-	e.GET("/upload/status/:upload_id", h.GetUploadStatus)
+	r.POST("/upload/init", h.InitiateChunkedUpload, uploadLimit...)
+	r.POST("/upload/chunk/:upload_id/:chunk", h.UploadChunk, uploadLimit...)
+	r.GET("/upload/status/:upload_id", h.GetUploadStatus)
+	r.GET("/upload/sessions", h.ListUploadSessions)
+	r.DELETE("/upload/:upload_id", h.AbortChunkedUpload)
 
-	e.GET("/stats", h.HandleUploadStats)
+	r.GET("/stats", h.HandleUploadStats)
+	r.GET("/api/stats", h.HandleUploadStats)
+	r.GET("/api/limits", h.HandleLimits)
+	r.GET("/api/pow", h.HandlePoWChallenge)
+	r.GET("/health", h.HandleHealth)
+	r.GET("/version", h.HandleVersion)
 
 	if app.config.AdminPanelEnabled {
-		e.GET("/admin/login", h.HandleAdminLogin)
-		e.POST("/admin/login", h.HandleAdminLogin)
-		e.GET("/admin/logout", h.HandleAdminLogout)
-		e.GET("/admin", h.HandleAdminDashboard)
-		e.GET("/admin/file/:filename", h.HandleAdminFileView)
-		e.POST("/admin/file/:filename", h.HandleAdminFileUpdate)
-		e.GET("/admin/file/:filename/delete", h.HandleAdminFileDelete)
+		r.GET("/admin/login", h.HandleAdminLogin)
+		r.POST("/admin/login", h.HandleAdminLogin)
+		r.GET("/admin/logout", h.HandleAdminLogout)
+		r.GET("/admin", h.HandleAdminDashboard)
+		r.GET("/admin/api/files", h.HandleAdminAPIFiles)
+		r.GET("/admin/file/:filename", h.HandleAdminFileView)
+		r.POST("/admin/file/:filename", h.HandleAdminFileUpdate)
+		r.POST("/admin/file/:filename/delete", h.HandleAdminFileDelete)
+		r.POST("/admin/bulk-delete", h.HandleAdminBulkDelete)
+		r.POST("/admin/maintenance", h.HandleAdminMaintenance)
+		r.POST("/admin/reindex", h.HandleAdminReindex)
+		r.GET("/api/retention", h.HandleRetention)
 	}
 
-	e.GET("/binaries/:platform", h.HandleBinaryDownload)
-	e.GET("/binaries", h.HandleBinaryList)
-	e.GET("/download", h.HandleBinaryAutoDetect)
+	r.GET("/binaries/:platform", h.HandleBinaryDownload)
+	r.GET("/binaries", h.HandleBinaryList)
+	r.GET("/download", h.HandleBinaryAutoDetect)
+
+	r.GET("/robots.txt", h.HandleRobots)
 
-	e.GET("/favicon.ico", func(c echo.Context) error {
+	r.GET("/favicon.ico", func(c echo.Context) error {
 		if favicon == nil {
 			data, err := faviconFS.ReadFile("favicon.ico")
 			if err != nil {
@@ -306,6 +543,12 @@ func registerRoutes(e *echo.Echo, app *App) {
 		return c.Blob(http.StatusOK, "image/x-icon", favicon)
 	})
 
-	e.GET("/:filename", h.HandleFileAccess)
-	e.POST("/:filename", h.HandleFileManagement)
+	r.GET("/:filename", h.HandleFileAccess)
+	r.HEAD("/:filename", h.HandleFileHead)
+	r.GET("/:filename/meta.json", h.HandleFileMeta)
+	r.GET("/:filename/scan", h.HandleScanStatus)
+	r.GET("/:filename/thumb", h.HandleThumbnail)
+	r.GET("/:filename/*", h.HandleFolderFile)
+	r.POST("/:filename", h.HandleFileManagement)
+	r.DELETE("/:filename", h.HandleDelete)
 }
@@ -1,11 +1,15 @@
 package app
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +17,7 @@ import (
 	"github.com/marianozunino/drop/internal/config"
 	"github.com/marianozunino/drop/internal/db"
 	"github.com/marianozunino/drop/internal/expiration"
+	"github.com/marianozunino/drop/internal/handler"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -279,7 +284,7 @@ preview_bots:
 func TestHumanLogger(t *testing.T) {
 	e := echo.New()
 
-	e.Use(humanLogger())
+	e.Use(humanLogger(&config.Config{}, io.Discard))
 
 	e.GET("/test", func(c echo.Context) error {
 		return c.String(http.StatusOK, "test response")
@@ -294,6 +299,31 @@ func TestHumanLogger(t *testing.T) {
 	assert.Equal(t, "test response", rec.Body.String())
 }
 
+func TestHumanLoggerExcludesPaths(t *testing.T) {
+	var out bytes.Buffer
+	cfg := &config.Config{
+		PathPrefix:      "/drop",
+		LogExcludePaths: []string{"/health", "/static/"},
+	}
+
+	e := echo.New()
+	e.Use(humanLogger(cfg, &out))
+	e.GET("/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+
+	for _, path := range []string{"/drop/health", "/drop/static/app.css"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Empty(t, out.String(), path)
+	}
+
+	for _, path := range []string{"/drop/abcd.txt", "/drop/healthy.txt"} {
+		out.Reset()
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Contains(t, out.String(), "GET "+path, path)
+	}
+}
+
 func TestRegisterRoutes(t *testing.T) {
 	e := echo.New()
 
@@ -306,18 +336,18 @@ func TestRegisterRoutes(t *testing.T) {
 		MaxSize:    250.0,
 	}
 
-	db, err := db.NewDB(cfg)
+	store, err := db.NewStore(cfg)
 	require.NoError(t, err)
-	defer db.Close()
+	defer store.Close()
 
-	expManager, err := expiration.NewExpirationManager(cfg, db)
+	expManager, err := expiration.NewExpirationManager(cfg, store)
 	require.NoError(t, err)
 
 	app := &App{
 		server:            e,
 		expirationManager: expManager,
 		config:            cfg,
-		db:                db,
+		db:                store,
 	}
 
 	registerRoutes(e, app)
@@ -377,3 +407,281 @@ preview_bots:
 	time.Sleep(100 * time.Millisecond)
 	app.Stop()
 }
+
+func TestNewWithConfigMigratesOldSchema(t *testing.T) {
+	tempDir := t.TempDir()
+	dbPath := filepath.Join(tempDir, "old.db")
+
+	oldDB, err := db.NewSQLiteStore(&config.Config{SQLitePath: dbPath})
+	require.NoError(t, err)
+	initial, err := os.ReadFile("../migration/migrations/000001_initial_schema.up.sql")
+	require.NoError(t, err)
+	_, err = oldDB.Exec(string(initial))
+	require.NoError(t, err)
+	require.NoError(t, oldDB.Close())
+
+	cfg := &config.Config{
+		MinAge:     1,
+		MaxAge:     30,
+		MaxSize:    250,
+		UploadPath: filepath.Join(tempDir, "uploads"),
+		SQLitePath: dbPath,
+		BaseURL:    "http://localhost:8080/",
+		IdLength:   4,
+	}
+
+	app, err := NewWithConfig(cfg)
+	require.NoError(t, err)
+	defer app.db.Close()
+
+	assert.NoError(t, app.db.VerifySchema())
+}
+
+func TestNewWithConfigRefusesDirtyDatabase(t *testing.T) {
+	tempDir := t.TempDir()
+	dbPath := filepath.Join(tempDir, "dirty.db")
+
+	dirtyDB, err := db.NewSQLiteStore(&config.Config{SQLitePath: dbPath})
+	require.NoError(t, err)
+	_, err = dirtyDB.Exec(`CREATE TABLE schema_migrations (version uint64, dirty bool);
+		INSERT INTO schema_migrations (version, dirty) VALUES (2, 1);`)
+	require.NoError(t, err)
+	require.NoError(t, dirtyDB.Close())
+
+	cfg := &config.Config{
+		MaxSize:    250,
+		UploadPath: filepath.Join(tempDir, "uploads"),
+		SQLitePath: dbPath,
+	}
+
+	_, err = NewWithConfig(cfg)
+	assert.ErrorIs(t, err, db.ErrSchemaDirty)
+}
+
+func TestRootCapabilitiesProbe(t *testing.T) {
+	e := echo.New()
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		UploadPath: filepath.Join(tempDir, "uploads"),
+		SQLitePath: filepath.Join(tempDir, "test.db"),
+		MaxSize:    250.0,
+		ChunkSize:  4.0,
+	}
+
+	store, err := db.NewStore(cfg)
+	require.NoError(t, err)
+	defer store.Close()
+
+	expManager, err := expiration.NewExpirationManager(cfg, store)
+	require.NoError(t, err)
+
+	registerRoutes(e, &App{server: e, expirationManager: expManager, config: cfg, db: store})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "262144000", rec.Header().Get("X-Max-Upload-Size"))
+	assert.Equal(t, "4194304", rec.Header().Get("X-Chunk-Size"))
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	assert.Empty(t, rec.Header().Get("X-Max-Upload-Size"))
+}
+
+func TestPathPrefixRoutes(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		MinAge:            1,
+		MaxAge:            30,
+		MaxSize:           250,
+		UploadPath:        filepath.Join(tempDir, "uploads"),
+		SQLitePath:        filepath.Join(tempDir, "test.db"),
+		BaseURL:           "https://example.com/drop/",
+		PathPrefix:        "/drop",
+		IdLength:          4,
+		AdminPanelEnabled: true,
+	}
+
+	app, err := NewWithConfig(cfg)
+	require.NoError(t, err)
+	defer app.db.Close()
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		app.server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "notes.txt")
+	require.NoError(t, err)
+	part.Write([]byte("served under a prefix"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/drop/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := serve(req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	fileURL := strings.TrimSpace(rec.Body.String())
+	require.True(t, strings.HasPrefix(fileURL, "https://example.com/drop/"), fileURL)
+	id := strings.TrimPrefix(fileURL, "https://example.com/drop/")
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/drop/"+id, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "served under a prefix", rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Link"), "<https://example.com/drop/"+id+"/meta.json>")
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/"+id, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "routes outside the prefix don't exist")
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/drop", nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/drop/", rec.Header().Get("Location"))
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/drop/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `href="/drop/chunked"`)
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/drop/api/limits", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(httptest.NewRequest(http.MethodGet, "/drop/admin/logout", nil))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/drop/admin/login", rec.Header().Get("Location"))
+	assert.Contains(t, rec.Header().Get("Set-Cookie"), "Path=/drop/")
+}
+
+func TestForceHTTPSSkipsHealthChecks(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		MinAge:            1,
+		MaxAge:            30,
+		MaxSize:           250,
+		UploadPath:        filepath.Join(tempDir, "uploads"),
+		SQLitePath:        filepath.Join(tempDir, "test.db"),
+		BaseURL:           "https://example.com/drop/",
+		PathPrefix:        "/drop",
+		IdLength:          4,
+		ForceHTTPS:        true,
+		HSTSMaxAgeSeconds: 86400,
+	}
+
+	app, err := NewWithConfig(cfg)
+	require.NoError(t, err)
+	defer app.db.Close()
+
+	rec := httptest.NewRecorder()
+	app.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/drop/stats", nil))
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "https://example.com/drop/stats", rec.Header().Get("Location"))
+	assert.Equal(t, "max-age=86400; includeSubDomains", rec.Header().Get("Strict-Transport-Security"))
+
+	rec = httptest.NewRecorder()
+	app.server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://example.com/drop/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHumanLoggerRedactsTokens(t *testing.T) {
+	var out bytes.Buffer
+	e := echo.New()
+	e.Use(humanLogger(&config.Config{}, &out))
+	e.Any("/*", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+
+	requests := []string{
+		"/abcd.txt?token=secret-token-1",
+		"/abcd.txt?download=1&Token=secret-token-2&password=secret-password",
+		"/abcd.txt?%74oken=secret-token-3",
+		"/admin?sort=size&dir=asc",
+	}
+	for _, uri := range requests {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, uri, nil))
+	}
+
+	logged := out.String()
+	assert.NotContains(t, logged, "secret-")
+	assert.Contains(t, logged, "GET /abcd.txt?token=REDACTED ")
+	assert.Contains(t, logged, "GET /abcd.txt?download=1&Token=REDACTED&password=REDACTED ")
+	assert.Contains(t, logged, "GET /admin?sort=size&dir=asc ", "other params are kept")
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		MinAge:                1,
+		MaxAge:                30,
+		MaxSize:               250,
+		UploadPath:            filepath.Join(tempDir, "uploads"),
+		SQLitePath:            filepath.Join(tempDir, "test.db"),
+		BaseURL:               "http://example.com/",
+		IdLength:              4,
+		UploadsPerMinutePerIP: 1,
+		TrustedProxies:        []string{"10.0.0.1"},
+	}
+
+	app, err := NewWithConfig(cfg)
+	require.NoError(t, err)
+	defer app.db.Close()
+
+	upload := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = remoteAddr + ":1234"
+		if forwardedFor != "" {
+			req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		app.server.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.NotEqual(t, http.StatusTooManyRequests, upload("203.0.113.1", ""))
+	assert.Equal(t, http.StatusTooManyRequests, upload("203.0.113.1", "198.51.100.1"), "a forged header doesn't get a new bucket")
+	assert.Equal(t, http.StatusTooManyRequests, upload("203.0.113.1", "198.51.100.2, 10.0.0.1"))
+
+	// Behind a trusted proxy the forwarded client is limited instead of the proxy
+	assert.NotEqual(t, http.StatusTooManyRequests, upload("10.0.0.1", "198.51.100.1"))
+	assert.NotEqual(t, http.StatusTooManyRequests, upload("10.0.0.1", "198.51.100.2"))
+	assert.Equal(t, http.StatusTooManyRequests, upload("10.0.0.1", "198.51.100.2"))
+}
+
+func TestUploadRateLimitPerTier(t *testing.T) {
+	cfg := &config.Config{
+		UploadsPerMinutePerIP: 1,
+		UploadTiers:           map[string]config.UploadTier{"pro": {UploadsPerMinute: 3}},
+		APIKeys:               []config.APIKey{{Key: "pro-key", Tier: "pro"}},
+	}
+
+	e := echo.New()
+	e.POST("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}, uploadRateLimit(cfg)...)
+
+	upload := func(apiKey string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = "203.0.113.1:1234"
+		if apiKey != "" {
+			req.Header.Set(handler.APIKeyHeader, apiKey)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, upload(""))
+	assert.Equal(t, http.StatusTooManyRequests, upload(""))
+	assert.Equal(t, http.StatusTooManyRequests, upload("wrong-key"), "unknown keys get the global limit")
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, upload("pro-key"), "the tier has its own, higher limit")
+	}
+	assert.Equal(t, http.StatusTooManyRequests, upload("pro-key"))
+
+	assert.Nil(t, uploadRateLimit(&config.Config{}), "no limit without a configured rate")
+}
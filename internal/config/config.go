@@ -1,33 +1,191 @@
 package config
 
 import (
+	"crypto/subtle"
 	"fmt"
+	"log"
+	"net"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/tg123/go-htpasswd"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// Streaming buffer bounds in KB. In BenchmarkStreamFile, disk reads stop getting
+// faster around 64KB, while larger buffers only add memory per download.
+const (
+	MinStreamingBufferKB     = 4
+	DefaultStreamingBufferKB = 64
+	MaxStreamingBufferKB     = 1024
+)
+
+// DefaultGzipLevel is used when gzip_level is unset. In BenchmarkGzipTransformer
+// level 9 is many times slower than 6 for output only about 2% smaller.
+const DefaultGzipLevel = 6
+
+// ID strategies for id_strategy
+const (
+	IDStrategyHex    = "hex"
+	IDStrategyBase62 = "base62"
+	IDStrategyULID   = "ulid"
+)
+
+// Webhook events for webhook_events
+const (
+	WebhookEventUpload = "upload"
+	WebhookEventDelete = "delete"
+	WebhookEventExpire = "expire"
+)
+
+// DefaultInlineContentTypes are the types browsers may render instead of downloading.
+// HTML, SVG, XML and scripts are never rendered inline, even if listed.
+var DefaultInlineContentTypes = []string{"image/*", "audio/*", "video/*", "application/pdf", "text/*"}
+
 // Config represents the application configuration
 // All fields can be set via config file or environment variables.
 type Config struct {
-	Port                     int      `mapstructure:"port"`
-	MinAge                   int      `mapstructure:"min_age_days"`
-	MaxAge                   int      `mapstructure:"max_age_days"`
-	MaxSize                  float64  `mapstructure:"max_size_mib"`
-	UploadPath               string   `mapstructure:"upload_path"`
-	CheckInterval            int      `mapstructure:"check_interval_min"`
-	ExpirationManagerEnabled bool     `mapstructure:"expiration_manager_enabled"`
-	BaseURL                  string   `mapstructure:"base_url"`
-	SQLitePath               string   `mapstructure:"sqlite_path"`
-	IdLength                 int      `mapstructure:"id_length"`
-	ChunkSize                float64  `mapstructure:"chunk_size_mib"`
-	PreviewBots              []string `mapstructure:"preview_bots"`
-	StreamingBufferSize      int      `mapstructure:"streaming_buffer_size_kb"`
-	AdminPanelEnabled        bool     `mapstructure:"admin_panel_enabled"`
-	AdminPasswordHash        string   `mapstructure:"admin_password_hash"`
-	IPTrackingEnabled        bool     `mapstructure:"ip_tracking_enabled"`
-	URLShorteningEnabled     bool     `mapstructure:"url_shortening_enabled"`
+	Port                      int      `mapstructure:"port"`
+	MinAge                    int      `mapstructure:"min_age_days"`
+	MaxAge                    int      `mapstructure:"max_age_days"`
+	MaxSize                   float64  `mapstructure:"max_size_mib"`
+	UploadPath                string   `mapstructure:"upload_path"`
+	CheckInterval             int      `mapstructure:"check_interval_min"`
+	ExpirationManagerEnabled  bool     `mapstructure:"expiration_manager_enabled"`
+	BaseURL                   string   `mapstructure:"base_url"`
+	SQLitePath                string   `mapstructure:"sqlite_path"`
+	IdLength                  int      `mapstructure:"id_length"`
+	ChunkSize                 float64  `mapstructure:"chunk_size_mib"`
+	PreviewBots               []string `mapstructure:"preview_bots"`
+	StreamingBufferSize       int      `mapstructure:"streaming_buffer_size_kb"`
+	AdminPanelEnabled         bool     `mapstructure:"admin_panel_enabled"`
+	AdminPasswordHash         string   `mapstructure:"admin_password_hash"`
+	AdminPassword             string   `mapstructure:"admin_password"` // Deprecated: plaintext "username:password", use AdminPasswordHash
+	IPTrackingEnabled         bool     `mapstructure:"ip_tracking_enabled"`
+	URLShorteningEnabled      bool     `mapstructure:"url_shortening_enabled"`
+	UploadTransformers        []string `mapstructure:"upload_transformers"`
+	MaxPageSize               int      `mapstructure:"max_page_size"`
+	MaintenanceMode           bool     `mapstructure:"maintenance_mode"`
+	DefaultContentDisposition string   `mapstructure:"default_content_disposition"`
+	AppendDetectedExtension   bool     `mapstructure:"append_detected_extension"`
+	StrictUploadOptions       bool     `mapstructure:"strict_upload_options"`
+	AllowIndexing             bool     `mapstructure:"allow_indexing"`
+	RobotsTxt                 string   `mapstructure:"robots_txt"`
+	StaleUploadMinutes        int      `mapstructure:"stale_upload_minutes"`
+	MinExpirationMinutes      int      `mapstructure:"min_expiration_minutes"`
+	MaxShortenedURLLength     int      `mapstructure:"max_shortened_url_length"`
+	GzipLevel                 int      `mapstructure:"gzip_level"`
+	URLDownloadAttempts       int      `mapstructure:"url_download_attempts"`
+	InlineContentTypes        []string `mapstructure:"inline_content_types"`
+	RequireExplicitExpiration bool     `mapstructure:"require_explicit_expiration"`
+	NotFoundImagePath         string   `mapstructure:"not_found_image_path"`
+	IDStrategy                string   `mapstructure:"id_strategy"`
+	AccessFlushSeconds        int      `mapstructure:"access_flush_interval_sec"`
+	ScanEnabled               bool     `mapstructure:"scan_enabled"`
+	ScanAsync                 bool     `mapstructure:"scan_async"`
+	ClamdAddress              string   `mapstructure:"clamd_address"`
+	PathPrefix                string   `mapstructure:"path_prefix"`
+	FolderUploadsEnabled      bool     `mapstructure:"folder_uploads_enabled"`
+	RenderViewers             []string `mapstructure:"render_viewers"`
+	ForceHTTPS                bool     `mapstructure:"force_https"`
+	HSTSMaxAgeSeconds         int      `mapstructure:"hsts_max_age_sec"`
+	PasswordMaxAttempts       int      `mapstructure:"password_max_attempts"`
+	PasswordLockoutMinutes    int      `mapstructure:"password_lockout_minutes"`
+	MD5Trailers               bool     `mapstructure:"md5_trailers"`
+	SkipAssemblyVerification  bool     `mapstructure:"skip_assembly_verification"`
+	CascadeGroupDeletes       bool     `mapstructure:"cascade_group_deletes"`
+	PoWDifficulty             int      `mapstructure:"pow_difficulty"`
+	ChunkCleanupMinutes       int      `mapstructure:"chunk_session_cleanup_minutes"`
+	SlowRequestMs             int      `mapstructure:"slow_request_ms"`
+	SlowQueryMs               int      `mapstructure:"slow_query_ms"`
+	ContentEncodingUploads    bool     `mapstructure:"content_encoding_uploads"`
+	ThumbnailPath             string   `mapstructure:"thumbnail_path"`
+	PregenerateThumbnails     bool     `mapstructure:"pregenerate_thumbnails"`
+	AnonymousMaxAgeHours      int      `mapstructure:"anonymous_max_age_hours"`
+	MetadataBackend           string   `mapstructure:"metadata_backend"`
+	MetadataDSN               string   `mapstructure:"metadata_dsn"`
+	LogExcludePaths           []string `mapstructure:"log_exclude_paths"`
+	AdminSessionSecret        string   `mapstructure:"admin_session_secret"`
+	OneTimeGraceSeconds       int      `mapstructure:"one_time_grace_seconds"`
+	UploadsPerMinutePerIP     int      `mapstructure:"uploads_per_minute_per_ip"`
+	RateLimitAllowlist        []string `mapstructure:"rate_limit_allowlist"`
+	CleanupMissingFiles       bool     `mapstructure:"cleanup_missing_files"`
+	MaxChunkedSessionsPerIP   int      `mapstructure:"max_chunked_sessions_per_ip"`
+	AllowedContentTypes       []string `mapstructure:"allowed_content_types"`
+	BlockedContentTypes       []string `mapstructure:"blocked_content_types"`
+	WebhookURL                string   `mapstructure:"webhook_url"`
+	WebhookEvents             []string `mapstructure:"webhook_events"`
+	WebhookSecret             string   `mapstructure:"webhook_secret"`
+	URLDefaultFilename        string   `mapstructure:"url_default_filename"`
+	HeicConverter             string   `mapstructure:"heic_converter"`
+	MonthlyTransferCap        float64  `mapstructure:"monthly_transfer_cap_gib"`
+	ExpirationBatchSize       int      `mapstructure:"expiration_batch_size"`
+	ExpirationBatchPauseMs    int      `mapstructure:"expiration_batch_pause_ms"`
+	TrustedProxies            []string `mapstructure:"trusted_proxies"`
+
+	// Upload tiers, selected by the API key sent in the X-API-Key header
+	UploadTiers map[string]UploadTier `mapstructure:"upload_tiers"`
+	APIKeys     []APIKey              `mapstructure:"api_keys"`
+
+	// Extra content type corrections, checked before the defaults
+	ContentTypeCorrections []ContentTypeCorrection `mapstructure:"content_type_corrections"`
+}
+
+// ContentTypeCorrection replaces the type detected from a file's content with
+// a more useful one for files with the given extension
+type ContentTypeCorrection struct {
+	Extension string `mapstructure:"extension"`
+	Detected  string `mapstructure:"detected"`
+	Type      string `mapstructure:"type"`
+}
+
+// DefaultContentTypeCorrections cover formats that are zip archives inside, which
+// content sniffing reports as application/zip
+var DefaultContentTypeCorrections = []ContentTypeCorrection{
+	{".docx", "application/zip", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{".xlsx", "application/zip", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{".pptx", "application/zip", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	{".odt", "application/zip", "application/vnd.oasis.opendocument.text"},
+	{".ods", "application/zip", "application/vnd.oasis.opendocument.spreadsheet"},
+	{".odp", "application/zip", "application/vnd.oasis.opendocument.presentation"},
+	{".epub", "application/zip", "application/epub+zip"},
+	{".jar", "application/zip", "application/java-archive"},
+}
+
+// MaxPoWDifficulty is the largest pow_difficulty. Every extra bit doubles the
+// work, so anything near it is already far too slow for real clients.
+const MaxPoWDifficulty = 32
+
+// AnonymousTier is the tier of uploads made without an API key
+const AnonymousTier = "anonymous"
+
+// Metadata backends, selected by metadata_backend
+const (
+	SQLiteBackend   = "sqlite"
+	PostgresBackend = "postgres"
+)
+
+// UploadTier overrides the upload limits for its API keys. Zero fields fall
+// back to the global max_size_mib and max_age_days.
+type UploadTier struct {
+	MaxSize float64 `mapstructure:"max_size_mib"`
+	MaxAge  int     `mapstructure:"max_age_days"`
+
+	// MaxDownloads caps how often uploads of the tier can be downloaded
+	// before they are deleted, 0 for no cap
+	MaxDownloads int `mapstructure:"max_downloads"`
+
+	// UploadsPerMinute replaces uploads_per_minute_per_ip for keys of the
+	// tier, 0 keeps the global limit
+	UploadsPerMinute int `mapstructure:"uploads_per_minute"`
+}
+
+// APIKey assigns an upload tier to a key
+type APIKey struct {
+	Key  string `mapstructure:"key"`
+	Tier string `mapstructure:"tier"`
 }
 
 // LoadConfig loads configuration from file and environment variables using Viper.
@@ -66,11 +224,71 @@ func LoadConfig(configPath string) (*Config, error) {
 		"skype",
 		"viber",
 	})
-	v.SetDefault("streaming_buffer_size_kb", 64)
+	v.SetDefault("streaming_buffer_size_kb", DefaultStreamingBufferKB)
 	v.SetDefault("admin_panel_enabled", false)
 	v.SetDefault("admin_password_hash", "")
+	v.SetDefault("admin_password", "")
 	v.SetDefault("ip_tracking_enabled", true)
 	v.SetDefault("url_shortening_enabled", true)
+	v.SetDefault("upload_transformers", []string{})
+	v.SetDefault("max_page_size", 200)
+	v.SetDefault("maintenance_mode", false)
+	v.SetDefault("default_content_disposition", "attachment")
+	v.SetDefault("append_detected_extension", false)
+	v.SetDefault("strict_upload_options", false)
+	v.SetDefault("allow_indexing", false)
+	v.SetDefault("robots_txt", "")
+	v.SetDefault("stale_upload_minutes", 60)
+	v.SetDefault("min_expiration_minutes", 1)
+	v.SetDefault("max_shortened_url_length", 2048)
+	v.SetDefault("gzip_level", DefaultGzipLevel)
+	v.SetDefault("url_download_attempts", 3)
+	v.SetDefault("inline_content_types", DefaultInlineContentTypes)
+	v.SetDefault("require_explicit_expiration", false)
+	v.SetDefault("not_found_image_path", "")
+	v.SetDefault("id_strategy", IDStrategyHex)
+	v.SetDefault("access_flush_interval_sec", 10)
+	v.SetDefault("scan_enabled", false)
+	v.SetDefault("scan_async", false)
+	v.SetDefault("clamd_address", "tcp://127.0.0.1:3310")
+	v.SetDefault("path_prefix", "")
+	v.SetDefault("folder_uploads_enabled", false)
+	v.SetDefault("render_viewers", []string{})
+	v.SetDefault("force_https", false)
+	v.SetDefault("hsts_max_age_sec", DefaultHSTSMaxAgeSeconds)
+	v.SetDefault("password_max_attempts", 5)
+	v.SetDefault("password_lockout_minutes", 15)
+	v.SetDefault("md5_trailers", false)
+	v.SetDefault("skip_assembly_verification", false)
+	v.SetDefault("cascade_group_deletes", false)
+	v.SetDefault("pow_difficulty", 0)
+	v.SetDefault("chunk_session_cleanup_minutes", 30)
+	v.SetDefault("slow_request_ms", 0)
+	v.SetDefault("slow_query_ms", 0)
+	v.SetDefault("content_encoding_uploads", false)
+	v.SetDefault("thumbnail_path", "./thumbnails")
+	v.SetDefault("pregenerate_thumbnails", false)
+	v.SetDefault("anonymous_max_age_hours", 0)
+	v.SetDefault("metadata_backend", SQLiteBackend)
+	v.SetDefault("metadata_dsn", "")
+	v.SetDefault("log_exclude_paths", []string{"/health", "/healthz", "/favicon.ico", "/metrics"})
+	v.SetDefault("admin_session_secret", "")
+	v.SetDefault("one_time_grace_seconds", 0)
+	v.SetDefault("uploads_per_minute_per_ip", 0)
+	v.SetDefault("rate_limit_allowlist", []string{})
+	v.SetDefault("cleanup_missing_files", true)
+	v.SetDefault("max_chunked_sessions_per_ip", 10)
+	v.SetDefault("allowed_content_types", []string{})
+	v.SetDefault("blocked_content_types", []string{})
+	v.SetDefault("webhook_url", "")
+	v.SetDefault("webhook_events", []string{WebhookEventUpload, WebhookEventDelete, WebhookEventExpire})
+	v.SetDefault("webhook_secret", "")
+	v.SetDefault("url_default_filename", "download")
+	v.SetDefault("heic_converter", "heif-convert -q 90 {input} {output}")
+	v.SetDefault("monthly_transfer_cap_gib", 0.0)
+	v.SetDefault("expiration_batch_size", 500)
+	v.SetDefault("expiration_batch_pause_ms", 100)
+	v.SetDefault("trusted_proxies", []string{})
 
 	if err := v.ReadInConfig(); err != nil {
 		return nil, err
@@ -81,14 +299,147 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	cfg.PathPrefix = NormalizePathPrefix(cfg.PathPrefix)
+	cfg.BaseURL = NormalizeBaseURL(cfg.BaseURL)
+	if cfg.PathPrefix != "" && !strings.HasSuffix(cfg.BaseURL, cfg.PathPrefix+"/") {
+		cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/") + cfg.PathPrefix + "/"
+	}
+
+	switch strings.ToLower(cfg.DefaultContentDisposition) {
+	case "", "inline", "attachment":
+	default:
+		return nil, fmt.Errorf("invalid default_content_disposition %q, expected inline or attachment", cfg.DefaultContentDisposition)
+	}
+
+	switch strings.ToLower(cfg.IDStrategy) {
+	case "", IDStrategyHex, IDStrategyBase62, IDStrategyULID:
+	default:
+		return nil, fmt.Errorf("invalid id_strategy %q, expected hex, base62 or ulid", cfg.IDStrategy)
+	}
+
+	cfg.MetadataBackend = strings.ToLower(cfg.MetadataBackend)
+	switch cfg.MetadataBackend {
+	case "", SQLiteBackend:
+	case PostgresBackend:
+		if cfg.MetadataDSN == "" {
+			return nil, fmt.Errorf("metadata_backend is postgres but metadata_dsn is not set")
+		}
+	default:
+		return nil, fmt.Errorf("invalid metadata_backend %q, expected sqlite or postgres", cfg.MetadataBackend)
+	}
+
+	if cfg.GzipLevel < 0 || cfg.GzipLevel > 9 {
+		return nil, fmt.Errorf("invalid gzip_level %d, expected 1 (fastest) to 9 (smallest)", cfg.GzipLevel)
+	}
+
+	if cfg.PoWDifficulty < 0 || cfg.PoWDifficulty > MaxPoWDifficulty {
+		return nil, fmt.Errorf("invalid pow_difficulty %d, expected 0 (off) to %d leading zero bits", cfg.PoWDifficulty, MaxPoWDifficulty)
+	}
+
+	if err := cfg.validateUploadTiers(); err != nil {
+		return nil, err
+	}
+
+	if _, err := cfg.TrustedProxyNets(); err != nil {
+		return nil, err
+	}
+
+	for i, correction := range cfg.ContentTypeCorrections {
+		if !strings.HasPrefix(correction.Extension, ".") || correction.Detected == "" || correction.Type == "" {
+			return nil, fmt.Errorf("content_type_corrections[%d] needs an extension starting with a dot, a detected type and a type", i)
+		}
+	}
+
+	for _, patterns := range [][]string{cfg.AllowedContentTypes, cfg.BlockedContentTypes} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+				return nil, fmt.Errorf("invalid content type pattern %q, expected a type like image/png or image/*", pattern)
+			}
+		}
+	}
+
+	if cfg.WebhookURL != "" && !strings.HasPrefix(cfg.WebhookURL, "http://") && !strings.HasPrefix(cfg.WebhookURL, "https://") {
+		return nil, fmt.Errorf("invalid webhook_url %q, expected an http or https URL", cfg.WebhookURL)
+	}
+	for _, event := range cfg.WebhookEvents {
+		switch strings.ToLower(strings.TrimSpace(event)) {
+		case WebhookEventUpload, WebhookEventDelete, WebhookEventExpire:
+		default:
+			return nil, fmt.Errorf("invalid webhook event %q, expected upload, delete or expire", event)
+		}
+	}
+
+	if cfg.MonthlyTransferCap < 0 {
+		return nil, fmt.Errorf("invalid monthly_transfer_cap_gib %v, expected 0 or more", cfg.MonthlyTransferCap)
+	}
+
 	// Validate admin panel configuration
-	if cfg.AdminPanelEnabled && cfg.AdminPasswordHash == "" {
-		return nil, fmt.Errorf("admin panel is enabled but admin_password_hash is not set. Please generate a password hash using: htpasswd -n admin yourpassword")
+	if cfg.AdminPanelEnabled && cfg.AdminPasswordHash == "" && cfg.AdminPassword == "" {
+		return nil, fmt.Errorf("admin panel is enabled but admin_password_hash is not set. Please generate a password hash using: go run ./cmd/hash-password -user admin")
 	}
 
 	return &cfg, nil
 }
 
+// NormalizeBaseURL gives base_url exactly one trailing slash, so file ids can be
+// appended to it directly
+func NormalizeBaseURL(baseURL string) string {
+	if baseURL == "" {
+		return baseURL
+	}
+	return strings.TrimRight(baseURL, "/") + "/"
+}
+
+// NormalizePathPrefix turns path_prefix into "/segment" form, or "" when the
+// server is served from the root
+func NormalizePathPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
+// validateUploadTiers checks that every API key names a configured tier
+func (c *Config) validateUploadTiers() error {
+	for name, tier := range c.UploadTiers {
+		if tier.MaxSize < 0 || tier.MaxAge < 0 || tier.MaxDownloads < 0 || tier.UploadsPerMinute < 0 {
+			return fmt.Errorf("upload tier %q has a negative limit", name)
+		}
+		if tier.MaxAge > 0 && tier.MaxAge < c.MinAge {
+			return fmt.Errorf("upload tier %q has max_age_days below min_age_days", name)
+		}
+	}
+	for i, key := range c.APIKeys {
+		if key.Key == "" {
+			return fmt.Errorf("api_keys[%d] has an empty key", i)
+		}
+		if _, ok := c.UploadTiers[key.Tier]; !ok && key.Tier != AnonymousTier {
+			return fmt.Errorf("api_keys[%d] uses unknown upload tier %q", i, key.Tier)
+		}
+	}
+	return nil
+}
+
+// LargestMaxSize returns the highest max_size_mib of the global limits and all upload tiers
+func (c *Config) LargestMaxSize() float64 {
+	largest := c.MaxSize
+	for _, tier := range c.UploadTiers {
+		largest = max(largest, tier.MaxSize)
+	}
+	return largest
+}
+
+// TierForAPIKey returns the tier name assigned to key
+func (c *Config) TierForAPIKey(key string) (string, bool) {
+	for _, k := range c.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(key)) == 1 {
+			return k.Tier, true
+		}
+	}
+	return "", false
+}
+
 // MaxSizeToBytes converts the MaxSize from MiB to bytes
 func (c *Config) MaxSizeToBytes() int64 {
 	return int64(c.MaxSize * 1024 * 1024)
@@ -99,34 +450,289 @@ func (c *Config) ChunkSizeToBytes() int64 {
 	return int64(c.ChunkSize * 1024 * 1024)
 }
 
-// StreamingBufferSizeToBytes converts the StreamingBufferSize from KB to bytes
+// MonthlyTransferCapToBytes converts the MonthlyTransferCap from GiB to bytes, 0 for no cap
+func (c *Config) MonthlyTransferCapToBytes() int64 {
+	return int64(c.MonthlyTransferCap * 1024 * 1024 * 1024)
+}
+
+// PageSizeLimit returns the maximum number of records a listing may return
+func (c *Config) PageSizeLimit() int {
+	if c.MaxPageSize <= 0 {
+		return 200
+	}
+	return c.MaxPageSize
+}
+
+// ShortenedURLLengthLimit returns the longest URL accepted by the shortener
+func (c *Config) ShortenedURLLengthLimit() int {
+	if c.MaxShortenedURLLength <= 0 {
+		return 2048
+	}
+	return c.MaxShortenedURLLength
+}
+
+// InlineTypes returns the content types allowed to render inline, as exact types or "type/*"
+func (c *Config) InlineTypes() []string {
+	if len(c.InlineContentTypes) == 0 {
+		return DefaultInlineContentTypes
+	}
+	return c.InlineContentTypes
+}
+
+// ContentTypeCorrectionTable returns the configured corrections followed by the defaults
+func (c *Config) ContentTypeCorrectionTable() []ContentTypeCorrection {
+	return append(append([]ContentTypeCorrection{}, c.ContentTypeCorrections...), DefaultContentTypeCorrections...)
+}
+
+// RestrictsContentTypes reports whether uploads are checked against
+// allowed_content_types or blocked_content_types
+func (c *Config) RestrictsContentTypes() bool {
+	return len(c.AllowedContentTypes) > 0 || len(c.BlockedContentTypes) > 0
+}
+
+// ContentTypeAllowed reports whether uploads of the media type may be stored:
+// it must match allowed_content_types when that is set, and must not match
+// blocked_content_types. Patterns are globs like image/*.
+func (c *Config) ContentTypeAllowed(mediaType string) bool {
+	mediaType = strings.ToLower(strings.TrimSpace(strings.SplitN(mediaType, ";", 2)[0]))
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(strings.ToLower(strings.TrimSpace(pattern)), mediaType); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(c.AllowedContentTypes) > 0 && !matches(c.AllowedContentTypes) {
+		return false
+	}
+	return !matches(c.BlockedContentTypes)
+}
+
+// DefaultHSTSMaxAgeSeconds is two years, long enough for HSTS preload lists
+const DefaultHSTSMaxAgeSeconds = 63072000
+
+// HSTSMaxAge returns the Strict-Transport-Security max-age in seconds
+func (c *Config) HSTSMaxAge() int {
+	if c.HSTSMaxAgeSeconds <= 0 {
+		return DefaultHSTSMaxAgeSeconds
+	}
+	return c.HSTSMaxAgeSeconds
+}
+
+// PasswordAttemptLimit returns how many wrong download passwords lock a client out of a file
+func (c *Config) PasswordAttemptLimit() int {
+	if c.PasswordMaxAttempts <= 0 {
+		return 5
+	}
+	return c.PasswordMaxAttempts
+}
+
+// PasswordLockout returns how long a client stays locked out after too many wrong passwords
+func (c *Config) PasswordLockout() time.Duration {
+	if c.PasswordLockoutMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(c.PasswordLockoutMinutes) * time.Minute
+}
+
+// AccessFlushInterval returns how often batched download counts are written
+func (c *Config) AccessFlushInterval() time.Duration {
+	if c.AccessFlushSeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.AccessFlushSeconds) * time.Second
+}
+
+// URLDownloadAttemptLimit returns how many times a failed URL upload is fetched before giving up
+func (c *Config) URLDownloadAttemptLimit() int {
+	if c.URLDownloadAttempts <= 0 {
+		return 3
+	}
+	return c.URLDownloadAttempts
+}
+
+// DefaultURLFilename returns the name of URL uploads whose URL doesn't end in one
+func (c *Config) DefaultURLFilename() string {
+	if c.URLDefaultFilename == "" {
+		return "download"
+	}
+	return c.URLDefaultFilename
+}
+
+// MinExpiration returns the shortest time any file is kept before it may expire
+func (c *Config) MinExpiration() time.Duration {
+	if c.MinExpirationMinutes <= 0 {
+		return time.Minute
+	}
+	return time.Duration(c.MinExpirationMinutes) * time.Minute
+}
+
+// ExpirationBatchLimit returns how many upload directory entries the
+// expiration check handles before it pauses
+func (c *Config) ExpirationBatchLimit() int {
+	if c.ExpirationBatchSize <= 0 {
+		return 500
+	}
+	return c.ExpirationBatchSize
+}
+
+// ExpirationBatchPause returns how long the expiration check waits between
+// batches, 0 for no wait
+func (c *Config) ExpirationBatchPause() time.Duration {
+	if c.ExpirationBatchPauseMs <= 0 {
+		return 0
+	}
+	return time.Duration(c.ExpirationBatchPauseMs) * time.Millisecond
+}
+
+// TrustedProxyNets parses trusted_proxies, given as IPs or CIDR ranges
+func (c *Config) TrustedProxyNets() ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range c.TrustedProxies {
+		entry = strings.TrimSpace(entry)
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+			continue
+		}
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted_proxies entry %q, expected an IP or CIDR range", entry)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return nets, nil
+}
+
+// ChunkSessionCleanupInterval returns how often expired chunked upload sessions are removed
+func (c *Config) ChunkSessionCleanupInterval() time.Duration {
+	if c.ChunkCleanupMinutes <= 0 {
+		return 30 * time.Minute
+	}
+	return time.Duration(c.ChunkCleanupMinutes) * time.Minute
+}
+
+// SlowRequestThreshold returns how long a request may take before it is logged
+// in detail, 0 when slow requests aren't logged
+func (c *Config) SlowRequestThreshold() time.Duration {
+	if c.SlowRequestMs <= 0 {
+		return 0
+	}
+	return time.Duration(c.SlowRequestMs) * time.Millisecond
+}
+
+// SlowQueryThreshold returns how long a database query may take before it is
+// logged, 0 when slow queries aren't logged
+func (c *Config) SlowQueryThreshold() time.Duration {
+	if c.SlowQueryMs <= 0 {
+		return 0
+	}
+	return time.Duration(c.SlowQueryMs) * time.Millisecond
+}
+
+// AnonymousMaxAge returns the longest retention of uploads made without an API
+// key, 0 when they follow the same retention as everything else
+func (c *Config) AnonymousMaxAge() time.Duration {
+	if c.AnonymousMaxAgeHours <= 0 {
+		return 0
+	}
+	return time.Duration(c.AnonymousMaxAgeHours) * time.Hour
+}
+
+// OneTimeGracePeriod returns how long a one-time file, or one whose last
+// allowed download was served, can still be downloaded before it is deleted.
+// 0 deletes it right away.
+func (c *Config) OneTimeGracePeriod() time.Duration {
+	if c.OneTimeGraceSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(c.OneTimeGraceSeconds) * time.Second
+}
+
+// StaleUploadAge returns how old temp and zero-byte files, and chunk directories
+// without a session, must be before cleanup removes them
+func (c *Config) StaleUploadAge() time.Duration {
+	if c.StaleUploadMinutes <= 0 {
+		return 60 * time.Minute
+	}
+	return time.Duration(c.StaleUploadMinutes) * time.Minute
+}
+
+// DefaultDisposition returns the Content-Disposition type used for ambiguous content types
+func (c *Config) DefaultDisposition() string {
+	if strings.EqualFold(c.DefaultContentDisposition, "inline") {
+		return "inline"
+	}
+	return "attachment"
+}
+
+// StreamingBufferSizeToBytes converts the StreamingBufferSize from KB to bytes,
+// kept within MinStreamingBufferKB and MaxStreamingBufferKB
 func (c *Config) StreamingBufferSizeToBytes() int {
+	switch {
+	case c.StreamingBufferSize <= 0:
+		return DefaultStreamingBufferKB * 1024
+	case c.StreamingBufferSize < MinStreamingBufferKB:
+		return MinStreamingBufferKB * 1024
+	case c.StreamingBufferSize > MaxStreamingBufferKB:
+		return MaxStreamingBufferKB * 1024
+	}
 	return c.StreamingBufferSize * 1024
 }
 
+// GzipCompressionLevel returns the compress/gzip level used when compressing content
+func (c *Config) GzipCompressionLevel() int {
+	if c.GzipLevel <= 0 || c.GzipLevel > 9 {
+		return DefaultGzipLevel
+	}
+	return c.GzipLevel
+}
+
 // ValidateAdminPassword checks if the provided username and password matches the htpasswd hash
-// Supports Apache MD5 ($apr1$) format
-// Format: username:hash (e.g., "admin:$apr1$...")
+// Supports bcrypt ($2a$, $2b$, $2y$) and Apache MD5 ($apr1$) formats
+// Format: username:hash (e.g., "admin:$2y$10$...")
+// The deprecated plaintext admin_password is only checked when no hash is set.
 func (c *Config) ValidateAdminPassword(username, password string) bool {
 	if c.AdminPasswordHash == "" {
-		return false
+		return c.validateLegacyAdminPassword(username, password)
 	}
 
-	parts := strings.Split(c.AdminPasswordHash, ":")
-	if len(parts) != 2 {
+	expectedUsername, hash, ok := strings.Cut(c.AdminPasswordHash, ":")
+	if !ok {
 		return false
 	}
 
-	expectedUsername := parts[0]
-	hash := parts[1]
-
-	if username != expectedUsername {
-		return false
+	// The password is checked even for a wrong username, so the response time
+	// doesn't tell whether the username is right
+	usernameMatches := subtle.ConstantTimeCompare([]byte(username), []byte(expectedUsername)) == 1
+	passwordMatches := false
+	if isBcryptHash(hash) {
+		passwordMatches = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	} else if encodedPasswd, err := htpasswd.AcceptMd5(hash); err == nil {
+		passwordMatches = encodedPasswd.MatchesPassword(password)
 	}
+	return usernameMatches && passwordMatches
+}
 
-	encodedPasswd, err := htpasswd.AcceptMd5(hash)
-	if err != nil {
+// validateLegacyAdminPassword compares against the plaintext admin_password,
+// "username:password"
+func (c *Config) validateLegacyAdminPassword(username, password string) bool {
+	expectedUsername, expectedPassword, ok := strings.Cut(c.AdminPassword, ":")
+	if !ok {
 		return false
 	}
-	return encodedPasswd.MatchesPassword(password)
+
+	log.Printf("Warning: admin_password is deprecated and stores the admin password in plaintext, set admin_password_hash instead (go run ./cmd/hash-password)")
+	usernameMatches := subtle.ConstantTimeCompare([]byte(username), []byte(expectedUsername)) == 1
+	passwordMatches := subtle.ConstantTimeCompare([]byte(password), []byte(expectedPassword)) == 1
+	return usernameMatches && passwordMatches
+}
+
+// isBcryptHash reports whether an htpasswd hash is a bcrypt hash
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
 }
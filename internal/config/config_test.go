@@ -4,9 +4,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestLoadConfigWithDefaults(t *testing.T) {
@@ -161,3 +163,273 @@ func TestConfigConversionMethods(t *testing.T) {
 	expectedBufferBytes := 32 * 1024
 	assert.Equal(t, expectedBufferBytes, bufferBytes)
 }
+
+func TestStreamingBufferSizeBounds(t *testing.T) {
+	assert.Equal(t, DefaultStreamingBufferKB*1024, (&Config{}).StreamingBufferSizeToBytes())
+	assert.Equal(t, MinStreamingBufferKB*1024, (&Config{StreamingBufferSize: 1}).StreamingBufferSizeToBytes())
+	assert.Equal(t, MaxStreamingBufferKB*1024, (&Config{StreamingBufferSize: 1 << 20}).StreamingBufferSizeToBytes())
+}
+
+func TestGzipLevel(t *testing.T) {
+	assert.Equal(t, DefaultGzipLevel, (&Config{}).GzipCompressionLevel())
+	assert.Equal(t, 1, (&Config{GzipLevel: 1}).GzipCompressionLevel())
+	assert.Equal(t, 9, (&Config{GzipLevel: 9}).GzipCompressionLevel())
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("gzip_level: 10"), 0644))
+	_, err := LoadConfig(configPath)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("port: 8080"), 0644))
+	cfg, err := LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultGzipLevel, cfg.GzipLevel)
+}
+
+func TestUploadTiers(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := `min_age_days: 1
+upload_tiers:
+  pro:
+    max_size_mib: 2048
+    max_age_days: 90
+    max_downloads: 100
+    uploads_per_minute: 600
+api_keys:
+  - key: Pro-Key
+    tier: pro
+  - key: anon-key
+    tier: anonymous`
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, UploadTier{MaxSize: 2048, MaxAge: 90, MaxDownloads: 100, UploadsPerMinute: 600}, cfg.UploadTiers["pro"])
+
+	tier, ok := cfg.TierForAPIKey("Pro-Key")
+	assert.True(t, ok)
+	assert.Equal(t, "pro", tier)
+	_, ok = cfg.TierForAPIKey("pro-key")
+	assert.False(t, ok, "API keys are case sensitive")
+
+	require.NoError(t, os.WriteFile(configPath, []byte("api_keys:\n  - key: k\n    tier: gold"), 0644))
+	_, err = LoadConfig(configPath)
+	assert.ErrorContains(t, err, "unknown upload tier")
+
+	require.NoError(t, os.WriteFile(configPath, []byte("upload_tiers:\n  pro:\n    max_downloads: -1"), 0644))
+	_, err = LoadConfig(configPath)
+	assert.ErrorContains(t, err, "negative limit")
+}
+
+func TestLargestMaxSize(t *testing.T) {
+	cfg := &Config{MaxSize: 100}
+	assert.Equal(t, 100.0, cfg.LargestMaxSize())
+
+	cfg.UploadTiers = map[string]UploadTier{"basic": {MaxSize: 50}, "pro": {MaxSize: 2048}, "archive": {MaxAge: 365}}
+	assert.Equal(t, 2048.0, cfg.LargestMaxSize())
+}
+
+func TestIDStrategy(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("id_strategy: uuid"), 0644))
+	_, err := LoadConfig(configPath)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("id_strategy: ULID"), 0644))
+	_, err = LoadConfig(configPath)
+	assert.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("port: 8080"), 0644))
+	cfg, err := LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, IDStrategyHex, cfg.IDStrategy)
+}
+
+func TestMetadataBackend(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+
+	require.NoError(t, os.WriteFile(configPath, []byte("port: 8080"), 0644))
+	cfg, err := LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, SQLiteBackend, cfg.MetadataBackend)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("metadata_backend: mysql"), 0644))
+	_, err = LoadConfig(configPath)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("metadata_backend: postgres"), 0644))
+	_, err = LoadConfig(configPath)
+	assert.Error(t, err, "postgres needs a DSN")
+
+	require.NoError(t, os.WriteFile(configPath, []byte("metadata_backend: Postgres\nmetadata_dsn: postgres://localhost/drop"), 0644))
+	cfg, err = LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.Equal(t, PostgresBackend, cfg.MetadataBackend)
+}
+
+func TestContentTypeCorrections(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := `content_type_corrections:
+  - extension: .sketch
+    detected: application/zip
+    type: application/x-sketch`
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	require.NoError(t, err)
+	table := cfg.ContentTypeCorrectionTable()
+	assert.Equal(t, "application/x-sketch", table[0].Type, "configured corrections come first")
+	assert.Len(t, table, len(DefaultContentTypeCorrections)+1)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("content_type_corrections:\n  - extension: sketch\n    detected: application/zip\n    type: application/x-sketch"), 0644))
+	_, err = LoadConfig(configPath)
+	assert.Error(t, err)
+}
+
+func TestBaseURLIsNormalized(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	for _, baseURL := range []string{"https://drop.example.com", "https://drop.example.com/", "https://drop.example.com//"} {
+		require.NoError(t, os.WriteFile(configPath, []byte("base_url: "+baseURL), 0644))
+		cfg, err := LoadConfig(configPath)
+		require.NoError(t, err)
+		assert.Equal(t, "https://drop.example.com/", cfg.BaseURL)
+	}
+
+	assert.Equal(t, "https://host/drop/", NormalizeBaseURL("https://host/drop"))
+	assert.Equal(t, "", NormalizeBaseURL(""))
+}
+
+func TestPathPrefix(t *testing.T) {
+	assert.Equal(t, "", NormalizePathPrefix(""))
+	assert.Equal(t, "", NormalizePathPrefix("/"))
+	assert.Equal(t, "/drop", NormalizePathPrefix("drop/"))
+	assert.Equal(t, "/files/drop", NormalizePathPrefix("/files/drop"))
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	for _, baseURL := range []string{"https://example.com", "https://example.com/drop/"} {
+		require.NoError(t, os.WriteFile(configPath, []byte("path_prefix: drop\nbase_url: "+baseURL), 0644))
+		cfg, err := LoadConfig(configPath)
+		require.NoError(t, err)
+		assert.Equal(t, "/drop", cfg.PathPrefix)
+		assert.Equal(t, "https://example.com/drop/", cfg.BaseURL, "generated URLs include the prefix")
+	}
+}
+
+func TestValidateAdminPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	t.Run("bcrypt", func(t *testing.T) {
+		cfg := &Config{AdminPasswordHash: "admin:" + string(hash)}
+		assert.True(t, cfg.ValidateAdminPassword("admin", "secret"))
+		assert.False(t, cfg.ValidateAdminPassword("admin", "wrong"))
+		assert.False(t, cfg.ValidateAdminPassword("root", "secret"))
+	})
+
+	t.Run("apache md5", func(t *testing.T) {
+		cfg := &Config{AdminPasswordHash: "admin:$apr1$droptest$6Ln1OYE9/EJGXI2fLgi9W0"}
+		assert.True(t, cfg.ValidateAdminPassword("admin", "secret"))
+		assert.False(t, cfg.ValidateAdminPassword("admin", "wrong"))
+	})
+
+	t.Run("legacy plaintext", func(t *testing.T) {
+		cfg := &Config{AdminPassword: "admin:secret"}
+		assert.True(t, cfg.ValidateAdminPassword("admin", "secret"))
+		assert.False(t, cfg.ValidateAdminPassword("admin", "wrong"))
+
+		cfg.AdminPasswordHash = "admin:" + string(hash)
+		cfg.AdminPassword = "admin:plaintext"
+		assert.False(t, cfg.ValidateAdminPassword("admin", "plaintext"), "the hash wins over the plaintext password")
+	})
+
+	assert.False(t, (&Config{}).ValidateAdminPassword("", ""))
+}
+
+func TestContentTypeAllowed(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContent := `allowed_content_types: ["image/*", "application/pdf"]
+blocked_content_types: ["image/svg+xml"]`
+	require.NoError(t, os.WriteFile(configPath, []byte(configContent), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	require.NoError(t, err)
+	assert.True(t, cfg.RestrictsContentTypes())
+	assert.True(t, cfg.ContentTypeAllowed("image/jpeg"))
+	assert.True(t, cfg.ContentTypeAllowed("Application/PDF"))
+	assert.False(t, cfg.ContentTypeAllowed("text/plain; charset=utf-8"))
+	assert.False(t, cfg.ContentTypeAllowed("image/svg+xml"), "blocked types win over allowed ones")
+
+	cfg = &Config{BlockedContentTypes: []string{"application/x-msdownload"}}
+	assert.True(t, cfg.ContentTypeAllowed("text/plain"), "everything else is allowed without an allowlist")
+	assert.False(t, cfg.ContentTypeAllowed("application/x-msdownload"))
+	assert.False(t, (&Config{}).RestrictsContentTypes())
+
+	require.NoError(t, os.WriteFile(configPath, []byte(`blocked_content_types: ["image/["]`), 0644))
+	_, err = LoadConfig(configPath)
+	assert.Error(t, err)
+}
+
+func TestWebhookConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	require.NoError(t, os.WriteFile(path, []byte("webhook_url: https://hooks.example.com/drop\n"), 0644))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{WebhookEventUpload, WebhookEventDelete, WebhookEventExpire}, cfg.WebhookEvents)
+
+	require.NoError(t, os.WriteFile(path, []byte("webhook_url: ftp://hooks.example.com\n"), 0644))
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("webhook_url: https://hooks.example.com\nwebhook_events: [upload, download]\n"), 0644))
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+}
+
+func TestMonthlyTransferCapConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	require.NoError(t, os.WriteFile(path, []byte("monthly_transfer_cap_gib: 1.5\n"), 0644))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3<<29), cfg.MonthlyTransferCapToBytes())
+
+	require.NoError(t, os.WriteFile(path, []byte("monthly_transfer_cap_gib: -1\n"), 0644))
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+
+	assert.Zero(t, (&Config{}).MonthlyTransferCapToBytes())
+}
+
+func TestExpirationBatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	require.NoError(t, os.WriteFile(path, []byte("upload_path: /tmp\n"), 0644))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 500, cfg.ExpirationBatchLimit())
+	assert.Equal(t, 100*time.Millisecond, cfg.ExpirationBatchPause())
+
+	require.NoError(t, os.WriteFile(path, []byte("expiration_batch_size: 50\nexpiration_batch_pause_ms: 0\n"), 0644))
+	cfg, err = LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, 50, cfg.ExpirationBatchLimit())
+	assert.Zero(t, cfg.ExpirationBatchPause())
+
+	assert.Equal(t, 500, (&Config{}).ExpirationBatchLimit())
+}
+
+func TestTrustedProxyNets(t *testing.T) {
+	nets, err := (&Config{TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1", "::1"}}).TrustedProxyNets()
+	require.NoError(t, err)
+	require.Len(t, nets, 3)
+	assert.Equal(t, "10.0.0.0/8", nets[0].String())
+	assert.Equal(t, "127.0.0.1/32", nets[1].String())
+	assert.Equal(t, "::1/128", nets[2].String())
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("trusted_proxies: [\"proxy.local\"]"), 0644))
+	_, err = LoadConfig(configPath)
+	assert.ErrorContains(t, err, "trusted_proxies")
+}
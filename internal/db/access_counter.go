@@ -0,0 +1,108 @@
+package db
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// AccessCounter collects download counts in memory and writes them in batches,
+// so serving a file doesn't wait for a write on the single SQLite connection
+type AccessCounter struct {
+	store    Store
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[string]AccessDelta
+
+	stopChan chan struct{}
+	done     chan struct{}
+}
+
+// NewAccessCounter creates a counter that flushes to the store every
+// interval once started
+func NewAccessCounter(store Store, interval time.Duration) *AccessCounter {
+	return &AccessCounter{
+		store:    store,
+		interval: interval,
+		pending:  make(map[string]AccessDelta),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Record counts one access to the metadata row with the given ID
+func (a *AccessCounter) Record(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delta := a.pending[id]
+	delta.Count++
+	delta.Last = time.Now()
+	a.pending[id] = delta
+}
+
+// RecordBytes counts n bytes served of the metadata row with the given ID
+func (a *AccessCounter) RecordBytes(id string, n int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delta := a.pending[id]
+	delta.Bytes += n
+	delta.Last = time.Now()
+	a.pending[id] = delta
+}
+
+// Flush writes the pending counts. On failure they are kept for the next flush.
+func (a *AccessCounter) Flush() error {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[string]AccessDelta)
+	a.mu.Unlock()
+
+	if err := a.store.AddAccessCounts(pending); err != nil {
+		a.mu.Lock()
+		for id, delta := range pending {
+			merged := a.pending[id]
+			merged.Count += delta.Count
+			merged.Bytes += delta.Bytes
+			if delta.Last.After(merged.Last) {
+				merged.Last = delta.Last
+			}
+			a.pending[id] = merged
+		}
+		a.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Start flushes the counts periodically until Stop is called
+func (a *AccessCounter) Start() {
+	a.done = make(chan struct{})
+	go func() {
+		defer close(a.done)
+
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := a.Flush(); err != nil {
+					log.Printf("Warning: Failed to write access counts: %v", err)
+				}
+			case <-a.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic flushing and writes the remaining counts
+func (a *AccessCounter) Stop() error {
+	close(a.stopChan)
+	if a.done != nil {
+		<-a.done
+	}
+	return a.Flush()
+}
@@ -2,72 +2,258 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/marianozunino/drop/internal/config"
 	"github.com/marianozunino/drop/internal/model"
-	_ "github.com/mattn/go-sqlite3"
 )
 
-type DB struct {
+// Store keeps the metadata of uploads and shortened URLs. SQLiteStore is the
+// default; PostgresStore lets several replicas share one database.
+type Store interface {
+	// VerifySchema checks that migrations finished cleanly and that the
+	// metadata table has every column the queries use
+	VerifySchema() error
+	// Migrate applies the pending migrations of the backend
+	Migrate() error
+	Close() error
+
+	StoreMetadata(metadata Storeable) error
+	GetMetadataByID(ID string) (model.FileMetadata, error)
+	HasMetadata(ID string) (bool, error)
+	GetMetadataByToken(token string) (model.FileMetadata, error)
+	GetMetadataByContentHash(hash string) (model.FileMetadata, error)
+	ListAllMetadata() ([]model.FileMetadata, error)
+	ForEachMetadata(fn func(model.FileMetadata) error) error
+	ListMetadataByGroup(groupID string) ([]model.FileMetadata, error)
+	DeleteMetadata(meta Storeable) error
+	DeleteMetadataBatch(ids []string) error
+
+	AddAccessCounts(deltas map[string]AccessDelta) error
+	BytesServedIn(period string) (int64, error)
+	ReserveDownload(ID string, limit int) (int, error)
+	ReleaseDownload(ID string) error
+	ExpireBy(ID string, at time.Time) error
+	SetThumbnailPath(ID, path string) error
+
+	ListMetadataFilteredAndSorted(searchQuery, sortField, sortDirection string) ([]model.FileMetadata, error)
+	ListMetadataFilteredAndSortedWithPagination(searchQuery, sortField, sortDirection string, limit int, cursor string) ([]model.FileMetadata, string, error)
+	CountMetadataFiltered(searchQuery string) (int, error)
+	GetTotalSize() (int64, error)
+	UsageByContentType() ([]TypeUsage, error)
+}
+
+// NewStore opens the metadata store of the configured backend, SQLite unless
+// metadata_backend is postgres
+func NewStore(cfg *config.Config) (Store, error) {
+	// Typed nil stores are not returned, so callers can compare with nil
+	if cfg.MetadataBackend == config.PostgresBackend {
+		store, err := NewPostgresStore(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+
+	store, err := NewSQLiteStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// sqlStore holds the queries shared by the backends. They are written with ?
+// placeholders in SQL both SQLite and Postgres understand.
+type sqlStore struct {
 	*sqlx.DB
+
+	// slowQuery is the duration above which queries are logged, 0 for never
+	slowQuery time.Duration
 }
 
 type Storeable interface {
 	ID() string
 }
 
-// NewDB creates a new SQLite database connection
-func NewDB(config *config.Config) (*DB, error) {
-	// Configure SQLite with better concurrency settings
-	db, err := sqlx.Open("sqlite3", config.SQLitePath+"?_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL")
+// ErrNotFound is returned by lookups that match no metadata row
+var ErrNotFound = errors.New("no metadata found")
+
+// ErrDownloadLimitReached is returned by ReserveDownload once all downloads of
+// a file are used up
+var ErrDownloadLimitReached = errors.New("download limit reached")
+
+// metadataColumns lists the columns read by scanMetadata, in scan order
+const metadataColumns = `resource_path, token, original_name, upload_date, expires_at,
+		       size, content_type, one_time_view, original_url, is_url_shortener,
+		       access_count, ip_address, created_at, updated_at, content_hash, no_index,
+		       last_accessed_at, group_id, max_downloads, content_encoding, password_hash,
+		       thumbnail_path, bytes_served, public_id`
+
+// requiredColumns are the metadata columns read or written by this package
+var requiredColumns = []string{
+	"id", "resource_path", "token", "original_name", "upload_date", "expires_at",
+	"size", "content_type", "one_time_view", "original_url", "is_url_shortener",
+	"access_count", "ip_address", "created_at", "updated_at", "content_hash", "no_index",
+	"last_accessed_at", "group_id", "max_downloads", "content_encoding", "password_hash",
+	"thumbnail_path", "bytes_served", "public_id",
+}
+
+// storedColumns are the columns written by StoreMetadata, in argument order
+var storedColumns = []string{
+	"id", "resource_path", "token", "original_name",
+	"upload_date", "expires_at", "size", "content_type", "one_time_view",
+	"original_url", "is_url_shortener", "access_count", "ip_address",
+	"created_at", "updated_at", "content_hash", "no_index", "last_accessed_at", "group_id",
+	"max_downloads", "content_encoding", "password_hash", "thumbnail_path", "bytes_served",
+	"public_id",
+}
+
+// storeMetadataQuery inserts a metadata row or replaces every column of the
+// existing one. The upsert is understood by both SQLite and Postgres.
+var storeMetadataQuery = func() string {
+	updates := make([]string, 0, len(storedColumns)-1)
+	for _, column := range storedColumns[1:] {
+		updates = append(updates, column+" = excluded."+column)
+	}
+	return fmt.Sprintf(`INSERT INTO metadata (%s) VALUES (%s) ON CONFLICT (id) DO UPDATE SET %s`,
+		strings.Join(storedColumns, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(storedColumns)), ", "),
+		strings.Join(updates, ", "))
+}()
+
+// ErrSchemaOutdated is returned by VerifySchema when migrations have not been applied
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// ErrSchemaDirty is returned by VerifySchema when a migration failed halfway
+var ErrSchemaDirty = errors.New("database migration is dirty")
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMetadata scans a row selected with metadataColumns
+func scanMetadata(row rowScanner) (model.FileMetadata, error) {
+	var metadata model.FileMetadata
+	var expiresAt sql.NullTime
+	var contentHash sql.NullString
+	var noIndex sql.NullBool
+	var lastAccessedAt sql.NullTime
+	var groupID sql.NullString
+	var maxDownloads sql.NullInt64
+	var contentEncoding sql.NullString
+	var passwordHash sql.NullString
+	var thumbnailPath sql.NullString
+	var bytesServed sql.NullInt64
+	var publicID sql.NullBool
+
+	err := row.Scan(
+		&metadata.ResourcePath,
+		&metadata.Token,
+		&metadata.OriginalName,
+		&metadata.UploadDate,
+		&expiresAt,
+		&metadata.Size,
+		&metadata.ContentType,
+		&metadata.OneTimeView,
+		&metadata.OriginalURL,
+		&metadata.IsURLShortener,
+		&metadata.AccessCount,
+		&metadata.IPAddress,
+		&metadata.CreatedAt,
+		&metadata.UpdatedAt,
+		&contentHash,
+		&noIndex,
+		&lastAccessedAt,
+		&groupID,
+		&maxDownloads,
+		&contentEncoding,
+		&passwordHash,
+		&thumbnailPath,
+		&bytesServed,
+		&publicID,
+	)
 	if err != nil {
-		return nil, err
+		return metadata, err
 	}
 
-	// Set connection pool settings
-	db.SetMaxOpenConns(1) // SQLite doesn't handle multiple connections well
-	db.SetMaxIdleConns(1)
-	db.SetConnMaxLifetime(0)
+	// Handle NULL expires_at
+	if expiresAt.Valid {
+		metadata.ExpiresAt = &expiresAt.Time
+	}
+	metadata.ContentHash = contentHash.String
+	metadata.NoIndex = noIndex.Bool
+	if lastAccessedAt.Valid {
+		metadata.LastAccessedAt = &lastAccessedAt.Time
+	}
+	metadata.GroupID = groupID.String
+	metadata.MaxDownloads = int(maxDownloads.Int64)
+	metadata.ContentEncoding = contentEncoding.String
+	metadata.PasswordHash = passwordHash.String
+	metadata.ThumbnailPath = thumbnailPath.String
+	metadata.BytesServed = bytesServed.Int64
+	metadata.PublicID = publicID.Bool
 
-	if err := db.Ping(); err != nil {
-		return nil, err
+	return metadata, nil
+}
+
+// verifySchema implements VerifySchema for a backend whose columnsQuery lists
+// the columns of the metadata table
+func (db *sqlStore) verifySchema(columnsQuery string) error {
+	var version int64
+	var dirty bool
+	err := db.QueryRow(`SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err == nil && dirty {
+		return fmt.Errorf("%w at version %d: repair the database, then run migrate -action force -version %d", ErrSchemaDirty, version, version)
 	}
 
-	return &DB{db}, nil
+	var columns []string
+	if err := db.Select(&columns, columnsQuery); err != nil {
+		return fmt.Errorf("failed to read metadata schema: %w", err)
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("%w: metadata table does not exist", ErrSchemaOutdated)
+	}
+
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[strings.ToLower(column)] = true
+	}
+
+	var missing []string
+	for _, column := range requiredColumns {
+		if !existing[column] {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: metadata table is missing columns %s", ErrSchemaOutdated, strings.Join(missing, ", "))
+	}
+
+	return nil
 }
 
 // Close closes the database connection
-func (db *DB) Close() error {
+func (db *sqlStore) Close() error {
 	return db.DB.Close()
 }
 
-// StoreMetadata stores metadata in SQLite
-func (db *DB) StoreMetadata(metadata Storeable) error {
+// StoreMetadata stores metadata, replacing the row with the same ID
+func (db *sqlStore) StoreMetadata(metadata Storeable) error {
 	fileMeta, ok := metadata.(*model.FileMetadata)
 	if !ok {
 		return fmt.Errorf("metadata must be of type *FileMetadata")
 	}
 
-	stmt, err := db.Prepare(`
-		INSERT OR REPLACE INTO metadata (
-			id, resource_path, token, original_name, 
-			upload_date, expires_at, size, content_type, one_time_view,
-			original_url, is_url_shortener, access_count, ip_address, 
-			created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec(
+	_, err := db.Exec(storeMetadataQuery,
 		metadata.ID(),
 		fileMeta.ResourcePath,
-		fileMeta.Token,
+		secretArg(fileMeta.Token),
 		fileMeta.OriginalName,
 		fileMeta.UploadDate,
 		fileMeta.ExpiresAt,
@@ -80,100 +266,86 @@ func (db *DB) StoreMetadata(metadata Storeable) error {
 		fileMeta.IPAddress,
 		fileMeta.CreatedAt,
 		fileMeta.UpdatedAt,
+		fileMeta.ContentHash,
+		fileMeta.NoIndex,
+		fileMeta.LastAccessedAt,
+		fileMeta.GroupID,
+		fileMeta.MaxDownloads,
+		fileMeta.ContentEncoding,
+		fileMeta.PasswordHash,
+		fileMeta.ThumbnailPath,
+		fileMeta.BytesServed,
+		fileMeta.PublicID,
 	)
 	return err
 }
 
-// GetMetadataByID retrieves metadata from SQLite
-func (db *DB) GetMetadataByID(ID string) (model.FileMetadata, error) {
-	var metadata model.FileMetadata
-	var expiresAt sql.NullTime
-
-	err := db.QueryRow(`
-		SELECT resource_path, token, original_name, upload_date, expires_at, 
-		       size, content_type, one_time_view, original_url, is_url_shortener,
-		       access_count, ip_address, created_at, updated_at
+// GetMetadataByID retrieves metadata by ID
+func (db *sqlStore) GetMetadataByID(ID string) (model.FileMetadata, error) {
+	metadata, err := scanMetadata(db.QueryRow(`
+		SELECT `+metadataColumns+`
 		FROM metadata WHERE id = ?
-	`, ID).Scan(
-		&metadata.ResourcePath,
-		&metadata.Token,
-		&metadata.OriginalName,
-		&metadata.UploadDate,
-		&expiresAt,
-		&metadata.Size,
-		&metadata.ContentType,
-		&metadata.OneTimeView,
-		&metadata.OriginalURL,
-		&metadata.IsURLShortener,
-		&metadata.AccessCount,
-		&metadata.IPAddress,
-		&metadata.CreatedAt,
-		&metadata.UpdatedAt,
-	)
+	`, ID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return metadata, fmt.Errorf("no metadata found with ID: %s", ID)
+			return metadata, fmt.Errorf("%w with ID: %s", ErrNotFound, ID)
 		}
 		return metadata, err
 	}
 
-	// Handle NULL expires_at
-	if expiresAt.Valid {
-		metadata.ExpiresAt = &expiresAt.Time
-	}
-
 	return metadata, nil
 }
 
-// GetMetadataByToken retrieves metadata from SQLite by token
-func (db *DB) GetMetadataByToken(token string) (model.FileMetadata, error) {
-	var metadata model.FileMetadata
-	var expiresAt sql.NullTime
+// HasMetadata reports whether a metadata row exists for the given ID
+func (db *sqlStore) HasMetadata(ID string) (bool, error) {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM metadata WHERE id = ?)`, ID).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
 
-	err := db.QueryRow(`
-		SELECT resource_path, token, original_name, upload_date, expires_at, 
-		       size, content_type, one_time_view, original_url, is_url_shortener,
-		       access_count, ip_address, created_at, updated_at
+// GetMetadataByToken retrieves metadata by token
+func (db *sqlStore) GetMetadataByToken(token string) (model.FileMetadata, error) {
+	metadata, err := scanMetadata(db.QueryRow(`
+		SELECT `+metadataColumns+`
 		FROM metadata WHERE token = ?
-	`, token).Scan(
-		&metadata.ResourcePath,
-		&metadata.Token,
-		&metadata.OriginalName,
-		&metadata.UploadDate,
-		&expiresAt,
-		&metadata.Size,
-		&metadata.ContentType,
-		&metadata.OneTimeView,
-		&metadata.OriginalURL,
-		&metadata.IsURLShortener,
-		&metadata.AccessCount,
-		&metadata.IPAddress,
-		&metadata.CreatedAt,
-		&metadata.UpdatedAt,
-	)
+	`, secretArg(token)))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return metadata, fmt.Errorf("no metadata found with token: %s", token)
+			return metadata, fmt.Errorf("%w with token: %s", ErrNotFound, token)
 		}
 		return metadata, err
 	}
 
-	// Handle NULL expires_at
-	if expiresAt.Valid {
-		metadata.ExpiresAt = &expiresAt.Time
+	return metadata, nil
+}
+
+// GetMetadataByContentHash returns the most recent file upload with the given content hash
+func (db *sqlStore) GetMetadataByContentHash(hash string) (model.FileMetadata, error) {
+	metadata, err := scanMetadata(db.QueryRow(`
+		SELECT `+metadataColumns+`
+		FROM metadata
+		WHERE content_hash = ? AND is_url_shortener = FALSE
+		ORDER BY upload_date DESC
+		LIMIT 1
+	`, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return metadata, fmt.Errorf("%w with content hash: %s", ErrNotFound, hash)
+		}
+		return metadata, err
 	}
 
 	return metadata, nil
 }
 
 // ListAllMetadata lists all metadata
-func (db *DB) ListAllMetadata() ([]model.FileMetadata, error) {
+func (db *sqlStore) ListAllMetadata() ([]model.FileMetadata, error) {
 	var metadataList []model.FileMetadata
 
 	rows, err := db.Query(`
-		SELECT resource_path, token, original_name, upload_date, expires_at, 
-		       size, content_type, one_time_view, original_url, is_url_shortener,
-		       access_count, ip_address, created_at, updated_at
+		SELECT ` + metadataColumns + `
 		FROM metadata
 		WHERE resource_path IS NOT NULL
 	`)
@@ -183,53 +355,304 @@ func (db *DB) ListAllMetadata() ([]model.FileMetadata, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var metadata model.FileMetadata
-		var expiresAt sql.NullTime
-		err := rows.Scan(
-			&metadata.ResourcePath,
-			&metadata.Token,
-			&metadata.OriginalName,
-			&metadata.UploadDate,
-			&expiresAt,
-			&metadata.Size,
-			&metadata.ContentType,
-			&metadata.OneTimeView,
-			&metadata.OriginalURL,
-			&metadata.IsURLShortener,
-			&metadata.AccessCount,
-			&metadata.IPAddress,
-			&metadata.CreatedAt,
-			&metadata.UpdatedAt,
-		)
+		metadata, err := scanMetadata(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		// Handle NULL expires_at
-		if expiresAt.Valid {
-			metadata.ExpiresAt = &expiresAt.Time
-		}
-
 		metadataList = append(metadataList, metadata)
 	}
 
 	return metadataList, rows.Err()
 }
 
+// metadataScanBatchSize is the number of rows ForEachMetadata reads per query
+var metadataScanBatchSize = 500
+
+// ForEachMetadata calls fn for every metadata record without loading the whole
+// table into memory. Rows are read in id order in fixed-size batches and the
+// connection is released between batches, so fn may itself use the DB (for
+// example to delete the record it was given). Iteration stops at the first
+// error returned by fn.
+func (db *sqlStore) ForEachMetadata(fn func(model.FileMetadata) error) error {
+	lastID := ""
+	for {
+		batch, err := db.metadataBatchAfter(lastID, metadataScanBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, metadata := range batch {
+			if err := fn(metadata); err != nil {
+				return err
+			}
+		}
+
+		if len(batch) < metadataScanBatchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID()
+	}
+}
+
+// metadataBatchAfter returns up to limit records whose id sorts after lastID
+func (db *sqlStore) metadataBatchAfter(lastID string, limit int) ([]model.FileMetadata, error) {
+	rows, err := db.Query(`
+		SELECT `+metadataColumns+`
+		FROM metadata
+		WHERE resource_path IS NOT NULL AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`, lastID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batch := make([]model.FileMetadata, 0, limit)
+	for rows.Next() {
+		metadata, err := scanMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		batch = append(batch, metadata)
+	}
+
+	return batch, rows.Err()
+}
+
+// ListMetadataByGroup returns every resource uploaded with the group id
+func (db *sqlStore) ListMetadataByGroup(groupID string) ([]model.FileMetadata, error) {
+	if groupID == "" {
+		return nil, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT `+metadataColumns+`
+		FROM metadata WHERE group_id = ?
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []model.FileMetadata
+	for rows.Next() {
+		metadata, err := scanMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, metadata)
+	}
+	return members, rows.Err()
+}
+
 // DeleteMetadata deletes metadata
-func (db *DB) DeleteMetadata(meta Storeable) error {
-	stmt, err := db.Prepare("DELETE FROM metadata WHERE id = ?")
+func (db *sqlStore) DeleteMetadata(meta Storeable) error {
+	_, err := db.Exec("DELETE FROM metadata WHERE id = ?", meta.ID())
+	return err
+}
+
+// DeleteMetadataBatch deletes the metadata of several resources in one
+// transaction
+func (db *sqlStore) DeleteMetadataBatch(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	const query = `DELETE FROM metadata WHERE id = ?`
+	defer db.logSlowQuery(time.Now(), query, []interface{}{fmt.Sprintf("%d rows", len(ids))})
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(tx.Rebind(query))
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(meta.ID())
+	for _, id := range ids {
+		if _, err := stmt.Exec(id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// AccessDelta is the number of accesses and bytes served to add to a metadata
+// row and the time of the latest one
+type AccessDelta struct {
+	Count int
+	Bytes int64
+	Last  time.Time
+}
+
+// TransferPeriod is the month, in UTC, that bytes served at t count toward,
+// e.g. "2024-05"
+func TransferPeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// AddAccessCounts adds the access deltas, keyed by metadata ID, in one transaction.
+// Rows deleted in the meantime are skipped, but their bytes still count toward
+// the transfer usage of the period of their latest access.
+func (db *sqlStore) AddAccessCounts(deltas map[string]AccessDelta) error {
+	if len(deltas) == 0 {
+		return nil
+	}
+
+	const query = `UPDATE metadata SET access_count = access_count + ?, last_accessed_at = ? WHERE id = ?`
+	const bytesQuery = `UPDATE metadata SET bytes_served = bytes_served + ? WHERE id = ?`
+	const usageQuery = `INSERT INTO transfer_usage (period, bytes_served) VALUES (?, ?)
+		ON CONFLICT (period) DO UPDATE SET bytes_served = transfer_usage.bytes_served + excluded.bytes_served`
+	defer db.logSlowQuery(time.Now(), query, []interface{}{fmt.Sprintf("%d rows", len(deltas))})
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(tx.Rebind(query))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	bytesStmt, err := tx.Prepare(tx.Rebind(bytesQuery))
+	if err != nil {
+		return err
+	}
+	defer bytesStmt.Close()
+
+	usage := make(map[string]int64)
+	for id, delta := range deltas {
+		if delta.Count > 0 {
+			if _, err := stmt.Exec(delta.Count, delta.Last, id); err != nil {
+				return err
+			}
+		}
+		if delta.Bytes > 0 {
+			if _, err := bytesStmt.Exec(delta.Bytes, id); err != nil {
+				return err
+			}
+			usage[TransferPeriod(delta.Last)] += delta.Bytes
+		}
+	}
+	for period, bytes := range usage {
+		if _, err := tx.Exec(tx.Rebind(usageQuery), period, bytes); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// BytesServedIn returns the bytes served in a TransferPeriod
+func (db *sqlStore) BytesServedIn(period string) (int64, error) {
+	var bytes int64
+	err := db.QueryRow(db.Rebind(`SELECT bytes_served FROM transfer_usage WHERE period = ?`), period).Scan(&bytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return bytes, err
+}
+
+// ReserveDownload counts one download of a file with a download limit right
+// away and returns the new count. Downloads are counted here instead of in
+// batches, before the file is sent, so concurrent downloads can't exceed the
+// limit and the file can be deleted with its last allowed download.
+func (db *sqlStore) ReserveDownload(ID string, limit int) (int, error) {
+	defer db.logSlowQuery(time.Now(), "UPDATE metadata SET access_count = access_count + 1 (reserved download)", []interface{}{ID})
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(tx.Rebind(`UPDATE metadata SET access_count = access_count + 1, last_accessed_at = ?
+		WHERE id = ? AND access_count < ?`), time.Now(), ID, limit)
+	if err != nil {
+		return 0, err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		var exists int
+		err := tx.QueryRow(tx.Rebind(`SELECT 1 FROM metadata WHERE id = ?`), ID).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		if err != nil {
+			return 0, err
+		}
+		return 0, ErrDownloadLimitReached
+	}
+
+	var count int
+	if err := tx.QueryRow(tx.Rebind(`SELECT access_count FROM metadata WHERE id = ?`), ID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// ReleaseDownload gives back a download reserved by ReserveDownload that
+// wasn't served in full
+func (db *sqlStore) ReleaseDownload(ID string) error {
+	const query = `UPDATE metadata SET access_count = access_count - 1 WHERE id = ? AND access_count > 0`
+	defer db.logSlowQuery(time.Now(), query, []interface{}{ID})
+
+	_, err := db.Exec(db.Rebind(query), ID)
 	return err
 }
 
+// ExpireBy moves the expiration of a resource forward to at, unless it already
+// expires earlier
+func (db *sqlStore) ExpireBy(ID string, at time.Time) error {
+	defer db.logSlowQuery(time.Now(), "UPDATE metadata SET expires_at = ? (expire by)", []interface{}{ID})
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Compared here rather than in SQL, stored times aren't comparable as text
+	var expiresAt sql.NullTime
+	err = tx.QueryRow(tx.Rebind(`SELECT expires_at FROM metadata WHERE id = ?`), ID).Scan(&expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(at) {
+		return nil
+	}
+
+	if _, err := tx.Exec(tx.Rebind(`UPDATE metadata SET expires_at = ? WHERE id = ?`), at, ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetThumbnailPath records the generated thumbnail of a file
+func (db *sqlStore) SetThumbnailPath(ID, path string) error {
+	result, err := db.Exec(`UPDATE metadata SET thumbnail_path = ? WHERE id = ?`, path, ID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // ListMetadataFilteredAndSorted returns metadata with optional filtering and sorting
-func (db *DB) ListMetadataFilteredAndSorted(searchQuery, sortField, sortDirection string) ([]model.FileMetadata, error) {
+func (db *sqlStore) ListMetadataFilteredAndSorted(searchQuery, sortField, sortDirection string) ([]model.FileMetadata, error) {
 	var query string
 	var args []interface{}
 
@@ -252,9 +675,11 @@ func (db *DB) ListMetadataFilteredAndSorted(searchQuery, sortField, sortDirectio
 		orderBy += "size"
 	case "uploadDate":
 		orderBy += "upload_date"
+	case "accessCount":
+		orderBy += "access_count"
 	case "expires":
 		// For expires, we need to handle expired files specially
-		orderBy += "CASE WHEN expires_at IS NULL OR expires_at > datetime('now') THEN 0 ELSE 1 END, expires_at"
+		orderBy += "CASE WHEN expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP THEN 0 ELSE 1 END, expires_at"
 	default:
 		orderBy += "upload_date"
 	}
@@ -267,9 +692,7 @@ func (db *DB) ListMetadataFilteredAndSorted(searchQuery, sortField, sortDirectio
 
 	// Build the complete query
 	query = fmt.Sprintf(`
-		SELECT resource_path, token, original_name, upload_date, expires_at, 
-		       size, content_type, one_time_view, original_url, is_url_shortener,
-		       access_count, ip_address, created_at, updated_at
+		SELECT `+metadataColumns+`
 		FROM metadata 
 		%s 
 		%s
@@ -283,33 +706,11 @@ func (db *DB) ListMetadataFilteredAndSorted(searchQuery, sortField, sortDirectio
 
 	var metadataList []model.FileMetadata
 	for rows.Next() {
-		var metadata model.FileMetadata
-		var expiresAt sql.NullTime
-		err := rows.Scan(
-			&metadata.ResourcePath,
-			&metadata.Token,
-			&metadata.OriginalName,
-			&metadata.UploadDate,
-			&expiresAt,
-			&metadata.Size,
-			&metadata.ContentType,
-			&metadata.OneTimeView,
-			&metadata.OriginalURL,
-			&metadata.IsURLShortener,
-			&metadata.AccessCount,
-			&metadata.IPAddress,
-			&metadata.CreatedAt,
-			&metadata.UpdatedAt,
-		)
+		metadata, err := scanMetadata(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		// Handle NULL expires_at
-		if expiresAt.Valid {
-			metadata.ExpiresAt = &expiresAt.Time
-		}
-
 		metadataList = append(metadataList, metadata)
 	}
 
@@ -317,7 +718,7 @@ func (db *DB) ListMetadataFilteredAndSorted(searchQuery, sortField, sortDirectio
 }
 
 // CountMetadataFiltered returns count of metadata matching search criteria
-func (db *DB) CountMetadataFiltered(searchQuery string) (int, error) {
+func (db *sqlStore) CountMetadataFiltered(searchQuery string) (int, error) {
 	var count int
 
 	if searchQuery != "" {
@@ -331,14 +732,54 @@ func (db *DB) CountMetadataFiltered(searchQuery string) (int, error) {
 }
 
 // GetTotalSize returns the total size of all files in bytes
-func (db *DB) GetTotalSize() (int64, error) {
+func (db *sqlStore) GetTotalSize() (int64, error) {
 	var totalSize int64
 	err := db.Get(&totalSize, "SELECT COALESCE(SUM(size), 0) FROM metadata")
 	return totalSize, err
 }
 
+// TypeUsage is the number and total size of the stored files of a content type
+type TypeUsage struct {
+	ContentType string `db:"content_type"`
+	Files       int    `db:"files"`
+	Size        int64  `db:"size"`
+}
+
+// UsageByContentType sums up the stored files per content type. URL shorteners
+// have no file and are left out.
+func (db *sqlStore) UsageByContentType() ([]TypeUsage, error) {
+	const query = `SELECT COALESCE(content_type, '') AS content_type, COUNT(*) AS files, COALESCE(SUM(size), 0) AS size
+		FROM metadata WHERE is_url_shortener = FALSE GROUP BY content_type`
+	defer db.logSlowQuery(time.Now(), query, nil)
+
+	var usage []TypeUsage
+	err := db.Select(&usage, query)
+	return usage, err
+}
+
+// ParseCursor converts a pagination cursor into the typed value compared against
+// the sort column, rejecting cursors that don't match the column type
+func ParseCursor(sortField, cursor string) (interface{}, error) {
+	switch sortField {
+	case "filename", "originalName":
+		return cursor, nil
+	case "size", "accessCount":
+		n, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid cursor %q for sort field %s: expected a non-negative integer", cursor, sortField)
+		}
+		return n, nil
+	default:
+		t, err := time.Parse(time.RFC3339Nano, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %q for sort field %s: expected an RFC 3339 timestamp", cursor, sortField)
+		}
+		return t, nil
+	}
+}
+
 // ListMetadataFilteredAndSortedWithPagination returns metadata with pagination using cursor
-func (db *DB) ListMetadataFilteredAndSortedWithPagination(searchQuery, sortField, sortDirection string, limit int, cursor string) ([]model.FileMetadata, string, error) {
+func (db *sqlStore) ListMetadataFilteredAndSortedWithPagination(searchQuery, sortField, sortDirection string, limit int, cursor string) ([]model.FileMetadata, string, error) {
 	var query string
 	var args []interface{}
 
@@ -390,6 +831,15 @@ func (db *DB) ListMetadataFilteredAndSortedWithPagination(searchQuery, sortField
 				cursorCondition = " AND upload_date < ?"
 			}
 		}
+	case "accessCount":
+		orderBy += "access_count"
+		if cursor != "" {
+			if sortDirection == "asc" {
+				cursorCondition = " AND access_count > ?"
+			} else {
+				cursorCondition = " AND access_count < ?"
+			}
+		}
 	case "expires":
 		// Sort by expiration date, with NULL values (no expiration) at the end
 		orderBy += "expires_at"
@@ -424,9 +874,11 @@ func (db *DB) ListMetadataFilteredAndSortedWithPagination(searchQuery, sortField
 		} else {
 			whereClause += cursorCondition
 		}
-		if cursor != "" {
-			args = append(args, cursor)
+		cursorValue, err := ParseCursor(sortField, cursor)
+		if err != nil {
+			return nil, "", err
 		}
+		args = append(args, cursorValue)
 	}
 
 	// Add LIMIT
@@ -434,9 +886,7 @@ func (db *DB) ListMetadataFilteredAndSortedWithPagination(searchQuery, sortField
 
 	// Build the complete query
 	query = fmt.Sprintf(`
-		SELECT resource_path, token, original_name, upload_date, expires_at, 
-		       size, content_type, one_time_view, original_url, is_url_shortener,
-		       access_count, ip_address, created_at, updated_at
+		SELECT `+metadataColumns+`
 		FROM metadata 
 		%s 
 		%s
@@ -453,33 +903,11 @@ func (db *DB) ListMetadataFilteredAndSortedWithPagination(searchQuery, sortField
 	var nextCursor string
 
 	for rows.Next() {
-		var metadata model.FileMetadata
-		var expiresAt sql.NullTime
-		err := rows.Scan(
-			&metadata.ResourcePath,
-			&metadata.Token,
-			&metadata.OriginalName,
-			&metadata.UploadDate,
-			&expiresAt,
-			&metadata.Size,
-			&metadata.ContentType,
-			&metadata.OneTimeView,
-			&metadata.OriginalURL,
-			&metadata.IsURLShortener,
-			&metadata.AccessCount,
-			&metadata.IPAddress,
-			&metadata.CreatedAt,
-			&metadata.UpdatedAt,
-		)
+		metadata, err := scanMetadata(rows)
 		if err != nil {
 			return nil, "", err
 		}
 
-		// Handle NULL expires_at
-		if expiresAt.Valid {
-			metadata.ExpiresAt = &expiresAt.Time
-		}
-
 		metadataList = append(metadataList, metadata)
 
 		// If we have more than the limit, set the next cursor
@@ -493,15 +921,17 @@ func (db *DB) ListMetadataFilteredAndSortedWithPagination(searchQuery, sortField
 			case "size":
 				nextCursor = fmt.Sprintf("%d", metadata.Size)
 			case "uploadDate":
-				nextCursor = metadata.UploadDate.Format("2006-01-02T15:04:05Z07:00")
+				nextCursor = metadata.UploadDate.Format(time.RFC3339Nano)
+			case "accessCount":
+				nextCursor = strconv.Itoa(metadata.AccessCount)
 			case "expires":
 				if metadata.ExpiresAt != nil {
-					nextCursor = metadata.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
+					nextCursor = metadata.ExpiresAt.Format(time.RFC3339Nano)
 				} else {
-					nextCursor = metadata.UploadDate.Format("2006-01-02T15:04:05Z07:00")
+					nextCursor = metadata.UploadDate.Format(time.RFC3339Nano)
 				}
 			default:
-				nextCursor = metadata.UploadDate.Format("2006-01-02T15:04:05Z07:00")
+				nextCursor = metadata.UploadDate.Format(time.RFC3339Nano)
 			}
 			break
 		}
@@ -1,8 +1,12 @@
 package db
 
 import (
+	"bytes"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,7 +17,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func setupTestDB(t *testing.T) (*DB, func()) {
+func setupTestDB(t *testing.T) (*SQLiteStore, func()) {
 	tempDir := t.TempDir()
 	dbPath := filepath.Join(tempDir, "test.db")
 
@@ -21,7 +25,7 @@ func setupTestDB(t *testing.T) (*DB, func()) {
 		SQLitePath: dbPath,
 	}
 
-	db, err := NewDB(cfg)
+	db, err := NewSQLiteStore(cfg)
 	require.NoError(t, err)
 
 	// Run migrations for tests
@@ -36,7 +40,21 @@ func setupTestDB(t *testing.T) (*DB, func()) {
 	return db, cleanup
 }
 
-func TestNewDB(t *testing.T) {
+func TestNewStore(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := NewStore(&config.Config{SQLitePath: filepath.Join(tempDir, "store.db")})
+	require.NoError(t, err)
+	defer store.Close()
+	assert.IsType(t, &SQLiteStore{}, store, "SQLite is the default backend")
+
+	notADir := filepath.Join(tempDir, "file")
+	require.NoError(t, os.WriteFile(notADir, nil, 0o644))
+	store, err = NewStore(&config.Config{SQLitePath: filepath.Join(notADir, "store.db")})
+	assert.Error(t, err)
+	assert.Nil(t, store)
+}
+
+func TestNewSQLiteStore(t *testing.T) {
 	tempDir := t.TempDir()
 	dbPath := filepath.Join(tempDir, "new_test.db")
 
@@ -44,7 +62,7 @@ func TestNewDB(t *testing.T) {
 		SQLitePath: dbPath,
 	}
 
-	db, err := NewDB(cfg)
+	db, err := NewSQLiteStore(cfg)
 	require.NoError(t, err)
 	defer db.Close()
 
@@ -55,12 +73,12 @@ func TestNewDB(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestNewDBWithInvalidPath(t *testing.T) {
+func TestNewSQLiteStoreWithInvalidPath(t *testing.T) {
 	cfg := &config.Config{
 		SQLitePath: "/invalid/path/that/does/not/exist/test.db",
 	}
 
-	db, err := NewDB(cfg)
+	db, err := NewSQLiteStore(cfg)
 	assert.Error(t, err)
 	assert.Nil(t, db)
 }
@@ -143,6 +161,7 @@ func TestGetMetadataByIDNotFound(t *testing.T) {
 	metadata, err := db.GetMetadataByID("non-existent-id")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no metadata found with ID")
+	assert.ErrorIs(t, err, ErrNotFound)
 	assert.Empty(t, metadata.ResourcePath)
 }
 
@@ -241,6 +260,44 @@ func TestDeleteMetadataNonExistent(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestDeleteMetadataBatch(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		require.NoError(t, db.StoreMetadata(&model.FileMetadata{ResourcePath: "/uploads/" + name, Token: name}))
+	}
+
+	require.NoError(t, db.DeleteMetadataBatch([]string{"/uploads/a.txt", "/uploads/c.txt", "/uploads/missing.txt"}))
+	require.NoError(t, db.DeleteMetadataBatch(nil))
+
+	remaining, err := db.ListAllMetadata()
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, "/uploads/b.txt", remaining[0].ResourcePath)
+}
+
+func TestUsageByContentType(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, meta := range []model.FileMetadata{
+		{ResourcePath: "/uploads/a.png", Token: "a", Size: 100, ContentType: "image/png"},
+		{ResourcePath: "/uploads/b.png", Token: "b", Size: 50, ContentType: "image/png"},
+		{ResourcePath: "/uploads/c.txt", Token: "c", Size: 10, ContentType: "text/plain"},
+		{ResourcePath: "short", Token: "d", OriginalURL: "https://example.com", IsURLShortener: true},
+	} {
+		require.NoError(t, db.StoreMetadata(&meta))
+	}
+
+	usage, err := db.UsageByContentType()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []TypeUsage{
+		{ContentType: "image/png", Files: 2, Size: 150},
+		{ContentType: "text/plain", Files: 1, Size: 10},
+	}, usage)
+}
+
 func TestStoreMetadataReplace(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -318,3 +375,424 @@ func TestConcurrentOperations(t *testing.T) {
 	require.NoError(t, err)
 	assert.Len(t, allMetadata, 10)
 }
+
+func TestPaginationRejectsInvalidCursor(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, _, err := db.ListMetadataFilteredAndSortedWithPagination("", "uploadDate", "desc", 10, "not-a-date")
+	assert.Error(t, err)
+
+	_, _, err = db.ListMetadataFilteredAndSortedWithPagination("", "size", "asc", 10, "12abc")
+	assert.Error(t, err)
+
+	_, _, err = db.ListMetadataFilteredAndSortedWithPagination("", "accessCount", "asc", 10, "-1")
+	assert.Error(t, err)
+
+	_, _, err = db.ListMetadataFilteredAndSortedWithPagination("", "filename", "asc", 10, "anything goes")
+	assert.NoError(t, err)
+}
+
+func TestPaginationWithCursor(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		metadata := &model.FileMetadata{
+			ResourcePath: filepath.Join("/uploads", "page"+string(rune('a'+i))+".txt"),
+			Token:        "token" + string(rune('a'+i)),
+			Size:         int64(100 * (i + 1)),
+			UploadDate:   base.Add(time.Duration(i) * time.Minute),
+			AccessCount:  i,
+		}
+		require.NoError(t, db.StoreMetadata(metadata))
+	}
+
+	for _, sortField := range []string{"size", "uploadDate", "accessCount"} {
+		first, cursor, err := db.ListMetadataFilteredAndSortedWithPagination("", sortField, "asc", 2, "")
+		require.NoError(t, err)
+		require.Len(t, first, 2)
+		require.NotEmpty(t, cursor)
+
+		second, _, err := db.ListMetadataFilteredAndSortedWithPagination("", sortField, "asc", 2, cursor)
+		require.NoError(t, err)
+		require.Len(t, second, 2, sortField)
+		assert.Equal(t, int64(300), second[0].Size, sortField)
+		assert.Equal(t, int64(400), second[1].Size, sortField)
+	}
+}
+
+func TestForEachMetadataStreamsInBatches(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	originalBatchSize := metadataScanBatchSize
+	metadataScanBatchSize = 10
+	defer func() { metadataScanBatchSize = originalBatchSize }()
+
+	const total = 55
+	for i := 0; i < total; i++ {
+		metadata := &model.FileMetadata{
+			ResourcePath: filepath.Join("/uploads", fmt.Sprintf("stream-%03d.txt", i)),
+			Token:        fmt.Sprintf("token-%03d", i),
+			Size:         int64(i),
+		}
+		require.NoError(t, db.StoreMetadata(metadata))
+	}
+
+	seen := make(map[string]bool)
+	err := db.ForEachMetadata(func(meta model.FileMetadata) error {
+		assert.False(t, seen[meta.ResourcePath], "record visited twice: %s", meta.ResourcePath)
+		seen[meta.ResourcePath] = true
+		// The connection must be free between batches so callbacks can write
+		return db.DeleteMetadata(&meta)
+	})
+	require.NoError(t, err)
+	assert.Len(t, seen, total)
+
+	remaining, err := db.ListAllMetadata()
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+}
+
+func TestForEachMetadataStopsOnError(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.StoreMetadata(&model.FileMetadata{
+			ResourcePath: filepath.Join("/uploads", fmt.Sprintf("stop-%d.txt", i)),
+			Token:        fmt.Sprintf("stop-%d", i),
+		}))
+	}
+
+	calls := 0
+	stopErr := fmt.Errorf("stop")
+	err := db.ForEachMetadata(func(meta model.FileMetadata) error {
+		calls++
+		return stopErr
+	})
+	assert.Equal(t, stopErr, err)
+	assert.Equal(t, 1, calls)
+}
+
+func BenchmarkForEachMetadata(b *testing.B) {
+	dbPath := filepath.Join(b.TempDir(), "bench.db")
+	db, err := NewSQLiteStore(&config.Config{SQLitePath: dbPath})
+	require.NoError(b, err)
+	defer db.Close()
+	require.NoError(b, testutil.RunTestMigrations(dbPath))
+
+	for i := 0; i < 5000; i++ {
+		require.NoError(b, db.StoreMetadata(&model.FileMetadata{
+			ResourcePath: filepath.Join("/uploads", fmt.Sprintf("bench-%05d.txt", i)),
+			Token:        fmt.Sprintf("bench-%05d", i),
+			Size:         int64(i),
+		}))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		count := 0
+		err := db.ForEachMetadata(func(meta model.FileMetadata) error {
+			count++
+			return nil
+		})
+		require.NoError(b, err)
+		require.Equal(b, 5000, count)
+	}
+}
+
+func TestGetMetadataByContentHash(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	older := &model.FileMetadata{
+		ResourcePath: "/uploads/older.txt",
+		Token:        "older",
+		ContentHash:  "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		UploadDate:   time.Now().Add(-time.Hour),
+	}
+	newer := &model.FileMetadata{
+		ResourcePath: "/uploads/newer.txt",
+		Token:        "newer",
+		ContentHash:  "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		UploadDate:   time.Now(),
+	}
+	require.NoError(t, db.StoreMetadata(older))
+	require.NoError(t, db.StoreMetadata(newer))
+
+	found, err := db.GetMetadataByContentHash("5eb63bbbe01eeed093cb22bb8f5acdc3")
+	require.NoError(t, err)
+	assert.Equal(t, newer.ResourcePath, found.ResourcePath)
+	assert.Equal(t, newer.ContentHash, found.ContentHash)
+
+	_, err = db.GetMetadataByContentHash("00000000000000000000000000000000")
+	assert.Error(t, err)
+}
+
+func TestHasMetadata(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	exists, err := db.HasMetadata("/uploads/missing.txt")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, db.StoreMetadata(&model.FileMetadata{
+		ResourcePath: "/uploads/present.txt",
+		Token:        "present",
+		UploadDate:   time.Now(),
+	}))
+
+	exists, err = db.HasMetadata("/uploads/present.txt")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestListMetadataByGroup(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	for _, meta := range []model.FileMetadata{
+		{ResourcePath: "/uploads/a.txt", Token: "a", UploadDate: time.Now(), GroupID: "group1"},
+		{ResourcePath: "short1", Token: "b", UploadDate: time.Now(), IsURLShortener: true, GroupID: "group1"},
+		{ResourcePath: "/uploads/c.txt", Token: "c", UploadDate: time.Now(), GroupID: "group2"},
+		{ResourcePath: "/uploads/d.txt", Token: "d", UploadDate: time.Now()},
+	} {
+		require.NoError(t, db.StoreMetadata(&meta))
+	}
+
+	members, err := db.ListMetadataByGroup("group1")
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	for _, member := range members {
+		assert.Equal(t, "group1", member.GroupID)
+	}
+
+	// Resources without a group are never listed together
+	members, err = db.ListMetadataByGroup("")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func TestVerifySchema(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	assert.NoError(t, db.VerifySchema())
+}
+
+func TestVerifySchemaWithOldSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "old.db")
+	db, err := NewSQLiteStore(&config.Config{SQLitePath: dbPath})
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.VerifySchema()
+	assert.ErrorIs(t, err, ErrSchemaOutdated)
+	assert.ErrorContains(t, err, "does not exist")
+
+	initial, err := os.ReadFile("../migration/migrations/000001_initial_schema.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(string(initial))
+	require.NoError(t, err)
+
+	err = db.VerifySchema()
+	assert.ErrorIs(t, err, ErrSchemaOutdated)
+	assert.ErrorContains(t, err, "content_hash, no_index")
+}
+
+func TestVerifySchemaWithDirtyMigration(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, err := db.Exec(`UPDATE schema_migrations SET dirty = 1`)
+	require.NoError(t, err)
+
+	err = db.VerifySchema()
+	assert.ErrorIs(t, err, ErrSchemaDirty)
+	assert.NotErrorIs(t, err, ErrSchemaOutdated)
+}
+
+func TestAccessCounterConcurrentReads(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	metadata := &model.FileMetadata{ResourcePath: "/uploads/popular.txt", Token: "token", Size: 10}
+	require.NoError(t, db.StoreMetadata(metadata))
+
+	counter := NewAccessCounter(db, time.Hour)
+
+	const readers, readsEach = 50, 20
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < readsEach; j++ {
+				counter.Record(metadata.ID())
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Nothing is written before a flush
+	stored, err := db.GetMetadataByID(metadata.ID())
+	require.NoError(t, err)
+	assert.Equal(t, 0, stored.AccessCount)
+	assert.Nil(t, stored.LastAccessedAt)
+
+	require.NoError(t, counter.Flush())
+
+	stored, err = db.GetMetadataByID(metadata.ID())
+	require.NoError(t, err)
+	assert.Equal(t, readers*readsEach, stored.AccessCount)
+	require.NotNil(t, stored.LastAccessedAt)
+	assert.WithinDuration(t, time.Now(), *stored.LastAccessedAt, time.Minute)
+
+	// Counts recorded after the flush are added on top
+	counter.Record(metadata.ID())
+	require.NoError(t, counter.Flush())
+	stored, err = db.GetMetadataByID(metadata.ID())
+	require.NoError(t, err)
+	assert.Equal(t, readers*readsEach+1, stored.AccessCount)
+}
+
+func TestAccessCounterFlushesOnStop(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	metadata := &model.FileMetadata{ResourcePath: "/uploads/stop.txt", Token: "token", Size: 10}
+	require.NoError(t, db.StoreMetadata(metadata))
+
+	counter := NewAccessCounter(db, time.Hour)
+	counter.Start()
+	counter.Record(metadata.ID())
+	counter.Record(metadata.ID())
+	// Rows deleted before the flush are skipped
+	counter.Record("/uploads/deleted.txt")
+	require.NoError(t, counter.Stop())
+
+	stored, err := db.GetMetadataByID(metadata.ID())
+	require.NoError(t, err)
+	assert.Equal(t, 2, stored.AccessCount)
+}
+
+func TestAddAccessCountsBytesServed(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	metadata := &model.FileMetadata{ResourcePath: "/uploads/served.txt", Token: "token", Size: 100}
+	require.NoError(t, db.StoreMetadata(metadata))
+
+	may := time.Date(2024, 5, 31, 23, 0, 0, 0, time.UTC)
+	june := time.Date(2024, 6, 1, 1, 0, 0, 0, time.UTC)
+	require.NoError(t, db.AddAccessCounts(map[string]AccessDelta{
+		metadata.ID():          {Bytes: 100, Last: may},
+		"/uploads/deleted.txt": {Bytes: 50, Last: may},
+	}))
+	require.NoError(t, db.AddAccessCounts(map[string]AccessDelta{
+		metadata.ID(): {Count: 1, Bytes: 30, Last: june},
+	}))
+
+	stored, err := db.GetMetadataByID(metadata.ID())
+	require.NoError(t, err)
+	assert.Equal(t, int64(130), stored.BytesServed)
+	assert.Equal(t, 1, stored.AccessCount)
+	require.NotNil(t, stored.LastAccessedAt)
+	assert.True(t, stored.LastAccessedAt.Equal(june), "bytes alone don't count as an access")
+
+	// Deleted rows still count toward the server's usage
+	served, err := db.BytesServedIn(TransferPeriod(may))
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), served)
+	served, err = db.BytesServedIn("2024-06")
+	require.NoError(t, err)
+	assert.Equal(t, int64(30), served)
+	served, err = db.BytesServedIn("2024-07")
+	require.NoError(t, err)
+	assert.Zero(t, served)
+}
+
+func TestReserveDownload(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	metadata := &model.FileMetadata{ResourcePath: "/uploads/limited.txt", Token: "token", Size: 10, MaxDownloads: 2}
+	require.NoError(t, db.StoreMetadata(metadata))
+
+	for want := 1; want <= 2; want++ {
+		count, err := db.ReserveDownload(metadata.ID(), 2)
+		require.NoError(t, err)
+		assert.Equal(t, want, count)
+	}
+	_, err := db.ReserveDownload(metadata.ID(), 2)
+	assert.ErrorIs(t, err, ErrDownloadLimitReached)
+
+	stored, err := db.GetMetadataByID(metadata.ID())
+	require.NoError(t, err)
+	assert.Equal(t, 2, stored.AccessCount)
+	assert.Equal(t, 2, stored.MaxDownloads)
+	assert.NotNil(t, stored.LastAccessedAt)
+
+	// A released download can be reserved again
+	require.NoError(t, db.ReleaseDownload(metadata.ID()))
+	count, err := db.ReserveDownload(metadata.ID(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, err = db.ReserveDownload("/uploads/missing.txt", 2)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestExpireBy(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	metadata := &model.FileMetadata{ResourcePath: "/uploads/once.txt", Token: "token", Size: 10, OneTimeView: true}
+	require.NoError(t, db.StoreMetadata(metadata))
+
+	soon := time.Now().Add(time.Minute)
+	require.NoError(t, db.ExpireBy(metadata.ID(), soon))
+	require.NoError(t, db.ExpireBy(metadata.ID(), soon.Add(time.Hour)), "later expirations are ignored")
+
+	stored, err := db.GetMetadataByID(metadata.ID())
+	require.NoError(t, err)
+	require.NotNil(t, stored.ExpiresAt)
+	assert.True(t, stored.ExpiresAt.Equal(soon), "got %v, want %v", stored.ExpiresAt, soon)
+
+	assert.ErrorIs(t, db.ExpireBy("/uploads/missing.txt", soon), ErrNotFound)
+}
+
+func TestSlowQueriesAreLogged(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	require.NoError(t, db.StoreMetadata(&model.FileMetadata{
+		ResourcePath: "uploads/slow.txt",
+		Token:        "secret-token",
+		UploadDate:   time.Now(),
+	}))
+	assert.Empty(t, logs.String(), "nothing is logged without a threshold")
+
+	// Every query is slower than a nanosecond
+	db.slowQuery = time.Nanosecond
+
+	_, err := db.GetMetadataByID("uploads/slow.txt")
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "Slow query (")
+	assert.Contains(t, logs.String(), "FROM metadata WHERE id = ? [uploads/slow.txt]")
+
+	logs.Reset()
+	_, err = db.GetMetadataByToken("secret-token")
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "[redacted]")
+	assert.NotContains(t, logs.String(), "secret-token", "tokens are not logged")
+}
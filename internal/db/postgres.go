@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/marianozunino/drop/internal/config"
+	"github.com/marianozunino/drop/internal/migration"
+)
+
+// postgresDriver is the database/sql driver of the Postgres backend. It is
+// only registered in builds with the postgres tag.
+const postgresDriver = "postgres"
+
+// ErrPostgresUnavailable is returned when metadata_backend is postgres in a
+// build without the postgres tag
+var ErrPostgresUnavailable = errors.New("postgres metadata backend is not compiled in, build with -tags postgres")
+
+// postgresMaxConns caps the connections of one server. Postgres handles
+// concurrent writers, unlike SQLite which is limited to one connection.
+const postgresMaxConns = 16
+
+// PostgresStore keeps the metadata in the Postgres database at metadata_dsn,
+// which several replicas can share
+type PostgresStore struct {
+	sqlStore
+	dsn string
+}
+
+// NewPostgresStore connects to the Postgres database at metadata_dsn
+func NewPostgresStore(cfg *config.Config) (*PostgresStore, error) {
+	if !slices.Contains(sql.Drivers(), postgresDriver) {
+		return nil, ErrPostgresUnavailable
+	}
+
+	db, err := sqlx.Open(postgresDriver, cfg.MetadataDSN)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(postgresMaxConns)
+	db.SetMaxIdleConns(postgresMaxConns / 4)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &PostgresStore{
+		sqlStore: sqlStore{DB: db, slowQuery: cfg.SlowQueryThreshold()},
+		dsn:      cfg.MetadataDSN,
+	}, nil
+}
+
+// VerifySchema checks that migrations finished cleanly and that the metadata
+// table has every column the queries use
+func (s *PostgresStore) VerifySchema() error {
+	return s.verifySchema(`SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'metadata'`)
+}
+
+// Migrate applies the pending Postgres migrations
+func (s *PostgresStore) Migrate() error {
+	return migration.UpPostgres(s.dsn)
+}
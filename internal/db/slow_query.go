@@ -0,0 +1,60 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"log"
+	"strings"
+	"time"
+)
+
+// secretArg is a query argument that is never written to the logs
+type secretArg string
+
+func (s secretArg) String() string {
+	return "[redacted]"
+}
+
+// Value passes the secret to the driver as a plain string
+func (s secretArg) Value() (driver.Value, error) {
+	return string(s), nil
+}
+
+// logSlowQuery logs the query when it took longer than the slow query
+// threshold. Call it deferred with the time the query started.
+func (db *sqlStore) logSlowQuery(start time.Time, query string, args []interface{}) {
+	if db.slowQuery <= 0 {
+		return
+	}
+	if elapsed := time.Since(start); elapsed >= db.slowQuery {
+		log.Printf("Slow query (%s): %s %v", elapsed.Round(time.Microsecond), strings.Join(strings.Fields(query), " "), args)
+	}
+}
+
+// The methods below shadow those of sqlx.DB to time every query and turn the ?
+// placeholders into the ones of the backend
+
+func (db *sqlStore) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer db.logSlowQuery(time.Now(), query, args)
+	return db.DB.Exec(db.Rebind(query), args...)
+}
+
+func (db *sqlStore) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	defer db.logSlowQuery(time.Now(), query, args)
+	return db.DB.Query(db.Rebind(query), args...)
+}
+
+func (db *sqlStore) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer db.logSlowQuery(time.Now(), query, args)
+	return db.DB.QueryRow(db.Rebind(query), args...)
+}
+
+func (db *sqlStore) Select(dest interface{}, query string, args ...interface{}) error {
+	defer db.logSlowQuery(time.Now(), query, args)
+	return db.DB.Select(dest, db.Rebind(query), args...)
+}
+
+func (db *sqlStore) Get(dest interface{}, query string, args ...interface{}) error {
+	defer db.logSlowQuery(time.Now(), query, args)
+	return db.DB.Get(dest, db.Rebind(query), args...)
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/marianozunino/drop/internal/config"
+	"github.com/marianozunino/drop/internal/migration"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore keeps the metadata in the SQLite database at sqlite_path
+type SQLiteStore struct {
+	sqlStore
+	path string
+}
+
+// NewSQLiteStore opens the SQLite database at sqlite_path
+func NewSQLiteStore(cfg *config.Config) (*SQLiteStore, error) {
+	// Configure SQLite with better concurrency settings
+	db, err := sqlx.Open("sqlite3", cfg.SQLitePath+"?_busy_timeout=30000&_journal_mode=WAL&_synchronous=NORMAL")
+	if err != nil {
+		return nil, err
+	}
+
+	// Set connection pool settings
+	db.SetMaxOpenConns(1) // SQLite doesn't handle multiple connections well
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	return &SQLiteStore{
+		sqlStore: sqlStore{DB: db, slowQuery: cfg.SlowQueryThreshold()},
+		path:     cfg.SQLitePath,
+	}, nil
+}
+
+// VerifySchema checks that migrations finished cleanly and that the metadata
+// table has every column the queries use
+func (s *SQLiteStore) VerifySchema() error {
+	return s.verifySchema(`SELECT name FROM pragma_table_info('metadata')`)
+}
+
+// Migrate applies the pending SQLite migrations
+func (s *SQLiteStore) Migrate() error {
+	return migration.Up(s.path)
+}
@@ -1,15 +1,19 @@
 package expiration
 
 import (
+	"errors"
+	"io"
 	"log"
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/marianozunino/drop/internal/config"
 	"github.com/marianozunino/drop/internal/db"
 	"github.com/marianozunino/drop/internal/model"
+	"github.com/marianozunino/drop/internal/webhook"
 )
 
 // ExpirationManager handles the file expiration process
@@ -17,16 +21,22 @@ type ExpirationManager struct {
 	Config     *config.Config
 	configPath string
 	stopChan   chan struct{}
-	db         *db.DB
+	db         db.Store
+	webhooks   *webhook.Notifier
+
+	// pause waits between batches of the expiration check and reports
+	// whether to go on, false once the manager is stopped
+	pause func(time.Duration) bool
 }
 
 // NewExpirationManager creates a new expiration manager
-func NewExpirationManager(cfg *config.Config, db *db.DB) (*ExpirationManager, error) {
+func NewExpirationManager(cfg *config.Config, db db.Store) (*ExpirationManager, error) {
 	manager := &ExpirationManager{
 		Config:   cfg,
 		stopChan: make(chan struct{}),
 		db:       db,
 	}
+	manager.pause = manager.waitOrStop
 
 	return manager, nil
 }
@@ -56,8 +66,57 @@ func (m *ExpirationManager) Stop() {
 	close(m.stopChan)
 }
 
+// waitOrStop waits for d unless the manager is stopped first
+func (m *ExpirationManager) waitOrStop(d time.Duration) bool {
+	select {
+	case <-m.stopChan:
+		return false
+	default:
+	}
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-m.stopChan:
+		return false
+	}
+}
+
+// SetWebhooks reports expired files through the notifier
+func (m *ExpirationManager) SetWebhooks(notifier *webhook.Notifier) {
+	m.webhooks = notifier
+}
+
+// RetentionLimits bounds the retention curve. Zero fields use the configured
+// max_size_mib and max_age_days.
+type RetentionLimits struct {
+	MaxSize float64
+	MaxAge  int
+
+	// MaxRetention caps the retention whatever the size, 0 for no cap
+	MaxRetention time.Duration
+}
+
 // calculateRetention determines how long a file should be kept based on its size
 func (m *ExpirationManager) calculateRetention(fileSize float64) time.Duration {
+	return m.calculateRetentionWithin(fileSize, RetentionLimits{})
+}
+
+// calculateRetentionWithin applies the retention formula with the given limits
+func (m *ExpirationManager) calculateRetentionWithin(fileSize float64, limits RetentionLimits) time.Duration {
+	maxSize, maxAge := m.Config.MaxSize, m.Config.MaxAge
+	if limits.MaxSize > 0 {
+		maxSize = limits.MaxSize
+	}
+	if limits.MaxAge > 0 {
+		maxAge = limits.MaxAge
+	}
+
 	// Convert file size to MiB
 	fileSizeMiB := fileSize / (1024 * 1024)
 
@@ -66,8 +125,8 @@ func (m *ExpirationManager) calculateRetention(fileSize float64) time.Duration {
 	// This creates a curve where:
 	// - Small files (file_size < max_size) get longer retention (closer to max_age)
 	// - Large files (file_size > max_size) get shorter retention (closer to min_age)
-	fileSizeRatio := fileSizeMiB/m.Config.MaxSize - 1
-	ageDiff := float64(m.Config.MinAge - m.Config.MaxAge)
+	fileSizeRatio := fileSizeMiB/maxSize - 1
+	ageDiff := float64(m.Config.MinAge - maxAge)
 	additionalDays := ageDiff * math.Pow(fileSizeRatio, 3)
 
 	// Calculate total days
@@ -76,11 +135,19 @@ func (m *ExpirationManager) calculateRetention(fileSize float64) time.Duration {
 	// Clamp to valid range: min_age <= retention <= max_age
 	if totalDays < float64(m.Config.MinAge) {
 		totalDays = float64(m.Config.MinAge)
-	} else if totalDays > float64(m.Config.MaxAge) {
-		totalDays = float64(m.Config.MaxAge)
+	} else if totalDays > float64(maxAge) {
+		totalDays = float64(maxAge)
 	}
 
-	return time.Duration(totalDays) * 24 * time.Hour
+	// Never hand out a retention shorter than the floor, even with min_age_days: 0
+	retention := time.Duration(totalDays) * 24 * time.Hour
+	if limits.MaxRetention > 0 && retention > limits.MaxRetention {
+		retention = limits.MaxRetention
+	}
+	if floor := m.Config.MinExpiration(); retention < floor {
+		return floor
+	}
+	return retention
 }
 
 // CheckMetadataExpiration checks if a file has expired based on its metadata
@@ -99,7 +166,10 @@ func (m *ExpirationManager) CheckMetadataExpiration(meta model.FileMetadata) (bo
 	return time.Now().After(expirationTime), nil
 }
 
-// cleanupExpiredFiles checks all files and removes those that have expired
+// cleanupExpiredFiles checks all files and removes those that have expired.
+// The upload directory is read in batches of expiration_batch_size entries
+// with a pause of expiration_batch_pause_ms in between, so large directories
+// are worked through over time instead of in one burst.
 func (m *ExpirationManager) cleanupExpiredFiles() {
 	if !m.Config.ExpirationManagerEnabled {
 		return
@@ -108,39 +178,112 @@ func (m *ExpirationManager) cleanupExpiredFiles() {
 
 	log.Println("Checking for expired files...")
 
-	files, err := os.ReadDir(uploadPath)
+	failedCount := m.cleanupFailedUploads(uploadPath)
+
+	dir, err := os.Open(uploadPath)
 	if err != nil {
 		log.Printf("Error reading upload directory: %v", err)
 		return
 	}
+	defer dir.Close()
 
+	batchSize := m.Config.ExpirationBatchLimit()
 	var removed, total int
+	for {
+		files, err := dir.ReadDir(batchSize)
+		batchRemoved, batchTotal := m.cleanupBatch(uploadPath, files)
+		removed += batchRemoved
+		total += batchTotal
+
+		if errors.Is(err, io.EOF) || (err == nil && len(files) < batchSize) {
+			break
+		}
+		if err != nil {
+			log.Printf("Error reading upload directory: %v", err)
+			break
+		}
+		if !m.pause(m.Config.ExpirationBatchPause()) {
+			log.Printf("Expiration check interrupted after removing %d of %d files", removed, total)
+			return
+		}
+	}
+
+	orphanCount := m.cleanupOrphanRecords(uploadPath)
+	m.cleanupOrphanThumbnails(uploadPath)
+
+	log.Printf("Expiration check complete. Removed %d of %d files, cleaned %d orphan records and %d failed uploads", removed, total, orphanCount, failedCount)
+}
+
+// isDatabaseFile reports whether the path is the SQLite database or one of its
+// WAL/journal files, which may be kept in the upload directory
+func (m *ExpirationManager) isDatabaseFile(filePath string) bool {
+	if m.Config.SQLitePath == "" {
+		return false
+	}
+	dbPath := filepath.Clean(m.Config.SQLitePath)
+	return filePath == dbPath || strings.HasPrefix(filePath, dbPath+"-")
+}
+
+// cleanupBatch removes the expired files among a batch of upload directory
+// entries and deletes their metadata in one transaction. Returns how many
+// resources were removed and how many files were checked.
+func (m *ExpirationManager) cleanupBatch(uploadPath string, files []os.DirEntry) (removed, total int) {
+	// The metadata, group and webhook of removed files are handled once the
+	// whole batch is done
+	var expiredFiles []model.FileMetadata
 	for _, file := range files {
-		if file.IsDir() {
+		// Temp files belong to uploads in progress, stale ones are swept above
+		if strings.HasSuffix(file.Name(), ".tmp") {
 			continue
 		}
 
-		total++
 		filePath := filepath.Join(uploadPath, file.Name())
+		if m.isDatabaseFile(filePath) {
+			continue
+		}
 
+		// Directories are chunked upload sessions, except folder uploads which have metadata
+		if file.IsDir() {
+			if exists, err := m.db.HasMetadata(filePath); err != nil || !exists {
+				continue
+			}
+		}
+		total++
+
+		// Files without metadata, imported by hand or not reindexed yet, are
+		// served as legacy files until their age and size retention is up.
+		// Other errors leave the file for the next check.
 		meta, err := m.db.GetMetadataByID(filePath)
-		expired := false
-		if err != nil {
+		legacy := errors.Is(err, db.ErrNotFound)
+		if err != nil && !legacy {
 			log.Printf("Error checking metadata expiration for %s: %v", file.Name(), err)
-			expired = true
-		} else {
-			expired, err = m.CheckMetadataExpiration(meta)
+			continue
+		}
+		expired := false
+		if !legacy {
+			expired, _ = m.CheckMetadataExpiration(meta)
+		}
+
+		remove := os.Remove
+		if file.IsDir() {
+			remove = os.RemoveAll
 		}
 
 		if expired {
+			// Either way the file is done with, a failed removal is retried
+			// on the next check
 			log.Printf("Removing expired file: %s", file.Name())
-			if err := os.Remove(filePath); err != nil {
+			if err := remove(filePath); err != nil {
 				log.Printf("Error removing expired file %s: %v", filePath, err)
 			} else {
-				m.db.DeleteMetadata(&meta)
-				removed++
-				continue
+				expiredFiles = append(expiredFiles, meta)
 			}
+			continue
+		}
+
+		// Folder uploads only expire through their metadata
+		if file.IsDir() {
+			continue
 		}
 
 		fileInfo, err := os.Stat(filePath)
@@ -161,30 +304,83 @@ func (m *ExpirationManager) cleanupExpiredFiles() {
 					time.Since(fileInfo.ModTime()).Round(time.Hour),
 					float64(fileInfo.Size())/(1024*1024))
 				removed++
+				m.webhooks.NotifyEvent(webhook.Event{Type: webhook.EventExpire, FileID: file.Name(), Size: fileInfo.Size()})
 			}
 		}
 	}
 
-	orphanCount := m.cleanupOrphanRecords(uploadPath)
+	ids := make([]string, 0, len(expiredFiles))
+	for _, meta := range expiredFiles {
+		ids = append(ids, meta.ID())
+	}
+	// Records left behind by a failed delete are removed as orphans
+	if err := m.db.DeleteMetadataBatch(ids); err != nil {
+		log.Printf("Error removing metadata of %d expired files: %v", len(ids), err)
+	}
 
-	log.Printf("Expiration check complete. Removed %d of %d files, cleaned %d orphan records", removed, total, orphanCount)
+	for _, meta := range expiredFiles {
+		removed++
+		removed += DeleteGroupMembers(m.Config, m.db, meta)
+		m.webhooks.Notify(webhook.EventExpire, meta)
+	}
+	return removed, total
 }
 
-// cleanupOrphanRecords removes database records for files that no longer exist on disk
-func (m *ExpirationManager) cleanupOrphanRecords(uploadPath string) int {
-	log.Println("Checking for orphan database records...")
-
-	allMetadata, err := m.db.ListAllMetadata()
+// cleanupFailedUploads removes leftovers of failed uploads: stale .tmp files and
+// zero-byte files without metadata. Files younger than the configured threshold
+// may still be written to and are kept.
+func (m *ExpirationManager) cleanupFailedUploads(uploadPath string) int {
+	files, err := os.ReadDir(uploadPath)
 	if err != nil {
-		log.Printf("Error retrieving metadata for orphan check: %v", err)
+		log.Printf("Error reading upload directory: %v", err)
 		return 0
 	}
 
+	threshold := m.Config.StaleUploadAge()
+	var removed int
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil || time.Since(info.ModTime()) < threshold {
+			continue
+		}
+
+		filePath := filepath.Join(uploadPath, file.Name())
+		reason := ""
+		if strings.HasSuffix(file.Name(), ".tmp") {
+			reason = "stale temp file"
+		} else if info.Size() == 0 {
+			if exists, err := m.db.HasMetadata(filePath); err != nil || exists {
+				continue
+			}
+			reason = "zero-byte file without metadata"
+		} else {
+			continue
+		}
+
+		if err := os.Remove(filePath); err != nil {
+			log.Printf("Error removing %s %s: %v", reason, filePath, err)
+			continue
+		}
+		log.Printf("Removed %s: %s (age: %v)", reason, file.Name(), time.Since(info.ModTime()).Round(time.Minute))
+		removed++
+	}
+
+	return removed
+}
+
+// cleanupOrphanRecords removes database records for files that no longer exist on disk
+func (m *ExpirationManager) cleanupOrphanRecords(uploadPath string) int {
+	log.Println("Checking for orphan database records...")
+
 	var orphanCount int
-	for _, meta := range allMetadata {
+	err := m.db.ForEachMetadata(func(meta model.FileMetadata) error {
 		// Skip URL shorteners - they don't have actual files on disk
 		if meta.IsURLShortener {
-			continue
+			return nil
 		}
 
 		if _, err := os.Stat(meta.ResourcePath); os.IsNotExist(err) {
@@ -195,6 +391,10 @@ func (m *ExpirationManager) cleanupOrphanRecords(uploadPath string) int {
 				orphanCount++
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error retrieving metadata for orphan check: %v", err)
 	}
 
 	if orphanCount > 0 {
@@ -204,8 +404,95 @@ func (m *ExpirationManager) cleanupOrphanRecords(uploadPath string) int {
 	return orphanCount
 }
 
+// cleanupOrphanThumbnails removes the thumbnails of files that were deleted.
+// Thumbnails are named after the stored file with a .jpg suffix.
+func (m *ExpirationManager) cleanupOrphanThumbnails(uploadPath string) int {
+	files, err := os.ReadDir(m.Config.ThumbnailPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading thumbnail directory: %v", err)
+		}
+		return 0
+	}
+
+	var removed int
+	for _, file := range files {
+		name, ok := strings.CutSuffix(file.Name(), ".jpg")
+		if file.IsDir() || !ok {
+			continue
+		}
+		if exists, err := m.db.HasMetadata(filepath.Join(uploadPath, name)); err != nil || exists {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.Config.ThumbnailPath, file.Name())); err != nil {
+			log.Printf("Error removing orphan thumbnail %s: %v", file.Name(), err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		log.Printf("Removed %d orphan thumbnails", removed)
+	}
+	return removed
+}
+
+// Retention returns how long a file of the given size in bytes is kept
+func (m *ExpirationManager) Retention(fileSize int64) time.Duration {
+	return m.calculateRetention(float64(fileSize))
+}
+
 // GetExpirationDate calculates when a file will expire based on its size
 func (m *ExpirationManager) GetExpirationDate(fileSize int64) time.Time {
 	retention := m.calculateRetention(float64(fileSize))
 	return time.Now().Add(retention)
 }
+
+// GetExpirationDateWithin calculates when a file will expire using the given limits
+func (m *ExpirationManager) GetExpirationDateWithin(fileSize int64, limits RetentionLimits) time.Time {
+	retention := m.calculateRetentionWithin(float64(fileSize), limits)
+	return time.Now().Add(retention)
+}
+
+// DeleteGroupMembers removes the other resources uploaded in the same group as
+// meta, once meta itself has been deleted, consumed or has expired. It does
+// nothing unless cascade_group_deletes is enabled. Returns how many members
+// were removed.
+func DeleteGroupMembers(cfg *config.Config, database db.Store, meta model.FileMetadata) int {
+	if !cfg.CascadeGroupDeletes || meta.GroupID == "" {
+		return 0
+	}
+
+	members, err := database.ListMetadataByGroup(meta.GroupID)
+	if err != nil {
+		log.Printf("Error listing group %s of %s: %v", meta.GroupID, meta.ResourcePath, err)
+		return 0
+	}
+
+	var removed int
+	for _, member := range members {
+		if member.ResourcePath == meta.ResourcePath {
+			continue
+		}
+
+		// URL shorteners only exist in the database
+		if !member.IsURLShortener {
+			remove := os.Remove
+			if member.IsFolder() {
+				remove = os.RemoveAll
+			}
+			if err := remove(member.ResourcePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Error removing group member %s: %v", member.ResourcePath, err)
+				continue
+			}
+		}
+		if err := database.DeleteMetadata(&member); err != nil {
+			log.Printf("Error removing metadata of group member %s: %v", member.ResourcePath, err)
+			continue
+		}
+
+		log.Printf("Removed %s along with %s from its group", member.ResourcePath, meta.ResourcePath)
+		removed++
+	}
+	return removed
+}
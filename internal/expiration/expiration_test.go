@@ -1,6 +1,7 @@
 package expiration
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -14,7 +15,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func setupTestExpirationManager(t *testing.T) (*ExpirationManager, *db.DB, func()) {
+func setupTestExpirationManager(t *testing.T) (*ExpirationManager, db.Store, func()) {
 	tempDir, err := os.MkdirTemp("", "expiration-test")
 	require.NoError(t, err)
 
@@ -31,7 +32,7 @@ func setupTestExpirationManager(t *testing.T) (*ExpirationManager, *db.DB, func(
 		SQLitePath:               testDBPath,
 	}
 
-	testDB, err := db.NewDB(cfg)
+	testDB, err := db.NewStore(cfg)
 	require.NoError(t, err)
 
 	// Run migrations for tests
@@ -49,7 +50,7 @@ func setupTestExpirationManager(t *testing.T) (*ExpirationManager, *db.DB, func(
 	return manager, testDB, cleanup
 }
 
-func createTestFileWithMetadata(t *testing.T, tempDir string, db *db.DB, filename string, content string, uploadTime time.Time, expiresAt time.Time) string {
+func createTestFileWithMetadata(t *testing.T, tempDir string, db db.Store, filename string, content string, uploadTime time.Time, expiresAt time.Time) string {
 	filePath := filepath.Join(tempDir, filename)
 	err := os.WriteFile(filePath, []byte(content), 0644)
 	require.NoError(t, err)
@@ -106,7 +107,7 @@ func TestNewExpirationManagerWithNilConfig(t *testing.T) {
 		ExpirationManagerEnabled: true,
 	}
 
-	testDB, err := db.NewDB(cfg)
+	testDB, err := db.NewStore(cfg)
 	require.NoError(t, err)
 	defer testDB.Close()
 
@@ -252,8 +253,8 @@ func TestCleanupExpiredFiles_WithoutMetadata(t *testing.T) {
 
 	now := time.Now()
 
-	// Create file without metadata (old file - should be removed)
-	oldTime := now.Add(-2 * 24 * time.Hour)
+	// Create file without metadata (older than max_age - should be removed)
+	oldTime := now.Add(-90 * 24 * time.Hour)
 	oldFile := filepath.Join(manager.Config.UploadPath, "old-file.txt")
 	err := os.WriteFile(oldFile, []byte("old content"), 0644)
 	require.NoError(t, err)
@@ -261,7 +262,7 @@ func TestCleanupExpiredFiles_WithoutMetadata(t *testing.T) {
 	err = os.Chtimes(oldFile, oldTime, oldTime)
 	require.NoError(t, err)
 
-	// Create recent file without metadata (should be removed too since no metadata = expired)
+	// Create recent file without metadata (kept until its retention is up)
 	recentTime := now.Add(-1 * time.Hour)
 	recentFile := filepath.Join(manager.Config.UploadPath, "recent-file.txt")
 	err = os.WriteFile(recentFile, []byte("recent content"), 0644)
@@ -273,12 +274,15 @@ func TestCleanupExpiredFiles_WithoutMetadata(t *testing.T) {
 	// Run cleanup
 	manager.cleanupExpiredFiles()
 
-	// Check that both files were removed (files without metadata are treated as expired)
+	// Files without metadata expire by age and size like any other file
 	_, err = os.Stat(oldFile)
 	assert.True(t, os.IsNotExist(err))
 
 	_, err = os.Stat(recentFile)
-	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, err)
+
+	_, err = os.Stat(manager.Config.SQLitePath)
+	assert.NoError(t, err, "the database in the upload directory is kept")
 }
 
 func TestCleanupExpiredFiles_Disabled(t *testing.T) {
@@ -308,15 +312,33 @@ func TestCleanupExpiredFiles_ErrorHandling(t *testing.T) {
 	invalidFile := filepath.Join(manager.Config.UploadPath, "invalid.txt")
 	err := os.WriteFile(invalidFile, []byte("invalid content"), 0644)
 	require.NoError(t, err)
+	oldTime := time.Now().Add(-90 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(invalidFile, oldTime, oldTime))
 
 	// Run cleanup - should handle the error gracefully
 	manager.cleanupExpiredFiles()
 
-	// The file should be removed due to metadata error
+	// The file should be removed once its retention is up
 	_, err = os.Stat(invalidFile)
 	assert.True(t, os.IsNotExist(err))
 }
 
+func TestCleanupExpiredFiles_DatabaseError(t *testing.T) {
+	manager, db, cleanup := setupTestExpirationManager(t)
+	defer cleanup()
+
+	expiredTime := time.Now().Add(-2 * 24 * time.Hour)
+	expiredFile := createTestFileWithMetadata(t, manager.Config.UploadPath, db, "expired.txt", "expired content", expiredTime, expiredTime)
+
+	// Run cleanup with a failing database - should handle the error gracefully
+	require.NoError(t, db.Close())
+	manager.cleanupExpiredFiles()
+
+	// Files are only removed once their metadata could be read
+	_, err := os.Stat(expiredFile)
+	assert.NoError(t, err)
+}
+
 // Integration Tests
 
 func TestExpirationManagerIntegration(t *testing.T) {
@@ -613,3 +635,193 @@ func TestExtremeFileSizes(t *testing.T) {
 			"Extremely large files should be clamped to MinAge")
 	}
 }
+
+func TestCleanupFailedUploads(t *testing.T) {
+	manager, db, cleanup := setupTestExpirationManager(t)
+	defer cleanup()
+
+	uploadPath := manager.Config.UploadPath
+	stale := time.Now().Add(-2 * time.Hour)
+
+	writeFile := func(name, content string, modTime time.Time) string {
+		path := filepath.Join(uploadPath, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+		return path
+	}
+
+	staleTmp := writeFile("abcd.txt.tmp", "partial upload", stale)
+	freshTmp := writeFile("efgh.txt.tmp", "upload in progress", time.Now())
+	staleEmpty := writeFile("empty.txt", "", stale)
+	freshEmpty := writeFile("new.txt", "", time.Now())
+	trackedEmpty := createTestFileWithMetadata(t, uploadPath, db, "tracked.txt", "", time.Now(), time.Now().Add(24*time.Hour))
+	require.NoError(t, os.Chtimes(trackedEmpty, stale, stale))
+
+	removed := manager.cleanupFailedUploads(uploadPath)
+	assert.Equal(t, 2, removed)
+
+	for _, path := range []string{staleTmp, staleEmpty} {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), "%s should be removed", path)
+	}
+	for _, path := range []string{freshTmp, freshEmpty, trackedEmpty} {
+		_, err := os.Stat(path)
+		assert.NoError(t, err, "%s should be kept", path)
+	}
+
+	// The regular sweep leaves temp files of uploads in progress alone
+	manager.cleanupExpiredFiles()
+	_, err := os.Stat(freshTmp)
+	assert.NoError(t, err)
+}
+
+func TestRetentionRespectsExpirationFloor(t *testing.T) {
+	cfg := &config.Config{
+		MinAge:  0,
+		MaxAge:  0,
+		MaxSize: 250.0,
+	}
+	manager := &ExpirationManager{Config: cfg}
+
+	assert.Equal(t, time.Minute, manager.calculateRetention(1024), "default floor is one minute")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), manager.GetExpirationDate(1024), time.Second)
+
+	cfg.MinExpirationMinutes = 30
+	assert.Equal(t, 30*time.Minute, manager.calculateRetention(1024))
+
+	cfg.MaxAge = 2
+	assert.Greater(t, manager.calculateRetention(1024), 30*time.Minute, "longer retentions are unaffected")
+}
+
+func TestRetentionWithinTierLimits(t *testing.T) {
+	cfg := &config.Config{
+		MinAge:  1,
+		MaxAge:  30,
+		MaxSize: 250.0,
+	}
+	manager := &ExpirationManager{Config: cfg}
+
+	assert.Equal(t, manager.calculateRetention(1024), manager.calculateRetentionWithin(1024, RetentionLimits{}))
+	assert.Greater(t, manager.calculateRetentionWithin(1024, RetentionLimits{MaxAge: 90}), 30*24*time.Hour)
+
+	large := float64(500 * 1024 * 1024)
+	assert.Equal(t, 24*time.Hour, manager.calculateRetention(large), "over the global max size")
+	assert.Greater(t, manager.calculateRetentionWithin(large, RetentionLimits{MaxSize: 2048}), 24*time.Hour)
+}
+
+func TestCleanupExpiredFiles_CascadesToGroup(t *testing.T) {
+	manager, db, cleanup := setupTestExpirationManager(t)
+	defer cleanup()
+
+	now := time.Now()
+	expiredTime := now.Add(-2 * 24 * time.Hour)
+	futureTime := now.Add(24 * time.Hour)
+	expiredFile := createTestFileWithMetadata(t, manager.Config.UploadPath, db, "expired.txt", "expired content", expiredTime, expiredTime)
+	partnerFile := createTestFileWithMetadata(t, manager.Config.UploadPath, db, "partner.txt", "partner content", now, futureTime)
+
+	group := "0123456789abcdef0123456789abcdef"
+	for _, path := range []string{expiredFile, partnerFile} {
+		meta, err := db.GetMetadataByID(path)
+		require.NoError(t, err)
+		meta.GroupID = group
+		require.NoError(t, db.StoreMetadata(&meta))
+	}
+	shortener := model.FileMetadata{ResourcePath: "short1", Token: "short-token", OriginalURL: "https://example.com", IsURLShortener: true, GroupID: group}
+	require.NoError(t, db.StoreMetadata(&shortener))
+
+	// Without cascading only the expired file goes
+	manager.cleanupExpiredFiles()
+	_, err := os.Stat(partnerFile)
+	assert.NoError(t, err)
+	members, err := db.ListMetadataByGroup(group)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	expiredFile = createTestFileWithMetadata(t, manager.Config.UploadPath, db, "expired.txt", "expired content", expiredTime, expiredTime)
+	meta, err := db.GetMetadataByID(expiredFile)
+	require.NoError(t, err)
+	meta.GroupID = group
+	require.NoError(t, db.StoreMetadata(&meta))
+
+	manager.Config.CascadeGroupDeletes = true
+	manager.cleanupExpiredFiles()
+
+	_, err = os.Stat(partnerFile)
+	assert.True(t, os.IsNotExist(err), "Group members should be removed with the expired file")
+	members, err = db.ListMetadataByGroup(group)
+	require.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func TestCleanupExpiredFiles_Batches(t *testing.T) {
+	manager, db, cleanup := setupTestExpirationManager(t)
+	defer cleanup()
+
+	// Keep the database out of the directory being reaped
+	uploadPath := filepath.Join(manager.Config.UploadPath, "uploads")
+	require.NoError(t, os.Mkdir(uploadPath, 0755))
+	manager.Config.UploadPath = uploadPath
+	manager.Config.ExpirationBatchSize = 10
+	manager.Config.ExpirationBatchPauseMs = 250
+
+	expiredTime := time.Now().Add(-2 * 24 * time.Hour)
+	for i := range 25 {
+		createTestFileWithMetadata(t, uploadPath, db, fmt.Sprintf("expired-%02d.txt", i), "expired content", expiredTime, expiredTime)
+	}
+
+	remaining := func() (files, records int) {
+		entries, err := os.ReadDir(uploadPath)
+		require.NoError(t, err)
+		metadata, err := db.ListAllMetadata()
+		require.NoError(t, err)
+		return len(entries), len(metadata)
+	}
+
+	var pauses []time.Duration
+	var filesLeft, recordsLeft []int
+	manager.pause = func(d time.Duration) bool {
+		pauses = append(pauses, d)
+		files, records := remaining()
+		filesLeft = append(filesLeft, files)
+		recordsLeft = append(recordsLeft, records)
+		return true
+	}
+
+	manager.cleanupExpiredFiles()
+
+	// Each batch removes at most expiration_batch_size files and their
+	// metadata before the pause, nothing is paused for after the last one
+	assert.Equal(t, []time.Duration{250 * time.Millisecond, 250 * time.Millisecond}, pauses)
+	assert.Equal(t, []int{15, 5}, filesLeft)
+	assert.Equal(t, []int{15, 5}, recordsLeft)
+
+	files, records := remaining()
+	assert.Zero(t, files)
+	assert.Zero(t, records)
+}
+
+func TestCleanupExpiredFiles_StopsBetweenBatches(t *testing.T) {
+	manager, db, cleanup := setupTestExpirationManager(t)
+	defer cleanup()
+
+	uploadPath := filepath.Join(manager.Config.UploadPath, "uploads")
+	require.NoError(t, os.Mkdir(uploadPath, 0755))
+	manager.Config.UploadPath = uploadPath
+	manager.Config.ExpirationBatchSize = 4
+
+	expiredTime := time.Now().Add(-2 * 24 * time.Hour)
+	for i := range 10 {
+		createTestFileWithMetadata(t, uploadPath, db, fmt.Sprintf("expired-%02d.txt", i), "expired content", expiredTime, expiredTime)
+	}
+
+	// A stopped manager doesn't start the next batch
+	manager.Stop()
+	manager.cleanupExpiredFiles()
+
+	entries, err := os.ReadDir(uploadPath)
+	require.NoError(t, err)
+	assert.Len(t, entries, 6)
+	metadata, err := db.ListAllMetadata()
+	require.NoError(t, err)
+	assert.Len(t, metadata, 6)
+}
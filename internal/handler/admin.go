@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -11,8 +14,10 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/db"
 	"github.com/marianozunino/drop/internal/model"
 	"github.com/marianozunino/drop/internal/utils"
+	"github.com/marianozunino/drop/internal/webhook"
 	"github.com/marianozunino/drop/templates"
 )
 
@@ -22,16 +27,65 @@ func (h *Handler) HandleAdminDashboard(c echo.Context) error {
 		return c.String(http.StatusUnauthorized, "Unauthorized")
 	}
 
-	sortField := c.QueryParam("sort")
-	sortDirection := c.QueryParam("dir")
-	searchQuery := strings.TrimSpace(c.QueryParam("search"))
-	cursor := c.QueryParam("cursor")
-	limit := 10
+	list, err := h.listAdminFiles(c)
+	if errors.Is(err, errInvalidCursor) {
+		return c.String(http.StatusBadRequest, "Invalid cursor")
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to get files")
+	}
 
-	if limitStr := c.QueryParam("limit"); limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 && parsedLimit <= 200 {
-			limit = parsedLimit
-		}
+	return templates.AdminDashboardPage(list.Files, list.Sort, list.Dir, list.Search, list.Cursor, list.NextCursor, list.Limit, list.TotalFiles, list.MatchingFiles, list.TotalSize, h.MaintenanceMode()).Render(h.templateContext(c), c.Response())
+}
+
+// HandleAdminAPIFiles serves the page of the admin file listing the dashboard
+// would show, as JSON for monitoring scripts
+func (h *Handler) HandleAdminAPIFiles(c echo.Context) error {
+	if !h.isAdminAuthenticated(c) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	// Check if admin panel is enabled
+	if !h.cfg.AdminPanelEnabled {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Admin panel is disabled"})
+	}
+
+	list, err := h.listAdminFiles(c)
+	if errors.Is(err, errInvalidCursor) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cursor"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get files"})
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// AdminFileList is a page of the admin file listing along with the totals
+// shown above it
+type AdminFileList struct {
+	Files         []model.AdminFileInfo `json:"files"`
+	Sort          string                `json:"sort"`
+	Dir           string                `json:"dir"`
+	Search        string                `json:"search,omitempty"`
+	Limit         int                   `json:"limit"`
+	Cursor        string                `json:"cursor,omitempty"`
+	NextCursor    string                `json:"next_cursor,omitempty"`
+	TotalFiles    int                   `json:"total_files"`
+	MatchingFiles int                   `json:"matching_files"`
+	TotalSize     int64                 `json:"total_size"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// listAdminFiles reads the search, sort, dir, limit and cursor query params
+// and returns the matching page of files
+func (h *Handler) listAdminFiles(c echo.Context) (AdminFileList, error) {
+	list := AdminFileList{
+		Sort:   c.QueryParam("sort"),
+		Dir:    c.QueryParam("dir"),
+		Search: strings.TrimSpace(c.QueryParam("search")),
+		Cursor: c.QueryParam("cursor"),
+		Limit:  h.parsePageLimit(c.QueryParam("limit")),
 	}
 
 	validSortFields := map[string]bool{
@@ -40,44 +94,74 @@ func (h *Handler) HandleAdminDashboard(c echo.Context) error {
 		"size":         true,
 		"uploadDate":   true,
 		"expires":      true,
+		"accessCount":  true,
 	}
 
-	if sortField == "" || !validSortFields[sortField] {
-		sortField = "uploadDate"
+	if list.Sort == "" || !validSortFields[list.Sort] {
+		list.Sort = "uploadDate"
 	}
 
-	if sortDirection != "asc" && sortDirection != "desc" {
-		sortDirection = "desc"
+	if list.Dir != "asc" && list.Dir != "desc" {
+		list.Dir = "desc"
 	}
 
-	files, nextCursor, err := h.getAllFilesForAdminSortedAndFilteredWithPagination(sortField, sortDirection, searchQuery, limit, cursor)
+	if list.Cursor != "" {
+		if _, err := db.ParseCursor(list.Sort, list.Cursor); err != nil {
+			log.Printf("Invalid admin cursor from %s: %v", c.RealIP(), err)
+			return list, errInvalidCursor
+		}
+	}
+
+	files, nextCursor, err := h.getAllFilesForAdminSortedAndFilteredWithPagination(list.Sort, list.Dir, list.Search, list.Limit, list.Cursor)
 	if err != nil {
 		log.Printf("Error getting files for admin: %v", err)
-		return c.String(http.StatusInternalServerError, "Failed to get files")
+		return list, err
+	}
+	list.Files = files
+	list.NextCursor = nextCursor
+	if list.Files == nil {
+		list.Files = []model.AdminFileInfo{}
 	}
 
-	totalFiles, err := h.db.CountMetadataFiltered("")
+	list.TotalFiles, err = h.db.CountMetadataFiltered("")
 	if err != nil {
 		log.Printf("Error getting total file count: %v", err)
-		totalFiles = 0
+		list.TotalFiles = 0
 	}
 
-	matchingFiles := len(files)
-	if searchQuery != "" {
-		matchingFiles, err = h.db.CountMetadataFiltered(searchQuery)
+	list.MatchingFiles = list.TotalFiles
+	if list.Search != "" {
+		list.MatchingFiles, err = h.db.CountMetadataFiltered(list.Search)
 		if err != nil {
 			log.Printf("Error getting matching file count: %v", err)
-			matchingFiles = len(files)
+			list.MatchingFiles = len(files)
 		}
 	}
 
-	totalSize, err := h.db.GetTotalSize()
+	list.TotalSize, err = h.db.GetTotalSize()
 	if err != nil {
 		log.Printf("Error getting total size: %v", err)
-		totalSize = 0
+		list.TotalSize = 0
 	}
 
-	return templates.AdminDashboardPage(files, sortField, sortDirection, searchQuery, cursor, nextCursor, limit, totalFiles, matchingFiles, totalSize).Render(c.Request().Context(), c.Response())
+	return list, nil
+}
+
+// parsePageLimit parses the limit query param, defaulting to 10 and clamping to the configured maximum
+func (h *Handler) parsePageLimit(limitStr string) int {
+	limit := 10
+	if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
+		limit = parsedLimit
+	}
+	if maxLimit := h.cfg.PageSizeLimit(); limit > maxLimit {
+		limit = maxLimit
+	}
+	return limit
+}
+
+// templateContext lets admin templates link under the configured path prefix
+func (h *Handler) templateContext(c echo.Context) context.Context {
+	return templates.WithPathPrefix(c.Request().Context(), h.cfg.PathPrefix)
 }
 
 // HandleAdminFileView shows detailed view of a single file
@@ -91,41 +175,41 @@ func (h *Handler) HandleAdminFileView(c echo.Context) error {
 		return c.String(http.StatusNotFound, "Admin panel is disabled")
 	}
 
-	filename := c.Param("filename")
-	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+	meta, err := h.adminResource(c.Param("filename"))
+	if errors.Is(err, errInvalidAdminResource) {
 		return c.String(http.StatusBadRequest, "Invalid file path")
 	}
-
-	token := c.QueryParam("token")
-	if token == "" {
-		return c.String(http.StatusBadRequest, "Missing management token")
-	}
-
-	meta, err := h.db.GetMetadataByToken(token)
 	if err != nil {
-		log.Printf("Invalid management token for admin view of %s: %v", filename, err)
-		return c.String(http.StatusUnauthorized, "Invalid management token")
+		return c.String(http.StatusNotFound, "File not found")
 	}
 
-	// Verify that the token belongs to the requested resource
-	if meta.IsFile() {
-		expectedFilename := filepath.Base(meta.ResourcePath)
-		if expectedFilename != filename {
-			log.Printf("Token mismatch: token belongs to %s but requested %s", expectedFilename, filename)
-			return c.String(http.StatusUnauthorized, "Invalid management token")
-		}
-	} else {
-		if meta.ResourcePath != filename {
-			log.Printf("Token mismatch: token belongs to %s but requested %s", meta.ResourcePath, filename)
-			return c.String(http.StatusUnauthorized, "Invalid management token")
-		}
+	adminFile := h.enrichFileMetadata(meta)
+	return templates.AdminFileView(adminFile).Render(h.templateContext(c), c.Response())
+}
+
+var errInvalidAdminResource = errors.New("invalid file path")
+
+// adminResource finds the file or URL shortener an admin page is about by its
+// name. The admin session authorizes the request, so management tokens never
+// travel in admin URLs where logs and browser history would keep them.
+func (h *Handler) adminResource(filename string) (model.FileMetadata, error) {
+	if filename == "" || strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+		return model.FileMetadata{}, errInvalidAdminResource
 	}
 
-	adminFile := h.enrichFileMetadata(meta)
-	return templates.AdminFileView(adminFile).Render(c.Request().Context(), c.Response())
+	meta, err := h.db.GetMetadataByID(filepath.Join(h.cfg.UploadPath, filename))
+	if !errors.Is(err, db.ErrNotFound) {
+		return meta, err
+	}
+	// URL shorteners are stored under their bare id
+	meta, err = h.db.GetMetadataByID(filename)
+	if err == nil && !meta.IsURLShortener {
+		return model.FileMetadata{}, db.ErrNotFound
+	}
+	return meta, err
 }
 
-// HandleAdminFileDelete deletes a file from admin panel using token-based approach
+// HandleAdminFileDelete deletes a file or URL shortener from the admin panel
 func (h *Handler) HandleAdminFileDelete(c echo.Context) error {
 	if !h.isAdminAuthenticated(c) {
 		return c.String(http.StatusUnauthorized, "Unauthorized")
@@ -136,62 +220,22 @@ func (h *Handler) HandleAdminFileDelete(c echo.Context) error {
 		return c.String(http.StatusNotFound, "Admin panel is disabled")
 	}
 
-	filename := c.Param("filename")
-	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+	meta, err := h.adminResource(c.Param("filename"))
+	if errors.Is(err, errInvalidAdminResource) {
 		return c.String(http.StatusBadRequest, "Invalid file path")
 	}
-
-	token := c.QueryParam("token")
-	if token == "" {
-		return c.String(http.StatusBadRequest, "Missing management token")
-	}
-
-	// Get metadata by token - this is much more reliable than filename resolution
-	meta, err := h.db.GetMetadataByToken(token)
 	if err != nil {
-		log.Printf("Invalid management token for admin deletion of %s: %v", filename, err)
-		return c.String(http.StatusUnauthorized, "Invalid management token")
-	}
-
-	// Verify that the token belongs to the requested resource
-	// For URL shorteners, check if the filename matches the ResourcePath
-	// For regular files, check if the filename matches the ResourcePath (without extension)
-	if meta.IsFile() {
-		expectedFilename := filepath.Base(meta.ResourcePath)
-		if expectedFilename != filename {
-			log.Printf("Token mismatch: token belongs to %s but requested %s", expectedFilename, filename)
-			return c.String(http.StatusUnauthorized, "Invalid management token")
-		}
-	} else {
-		if meta.ResourcePath != filename {
-			log.Printf("Token mismatch: token belongs to %s but requested %s", meta.ResourcePath, filename)
-			return c.String(http.StatusUnauthorized, "Invalid management token")
-		}
+		return c.String(http.StatusNotFound, "File not found")
 	}
 
-	// Handle URL shorteners differently - they don't have physical files
-	if meta.IsURLShortener {
-		if err := h.db.DeleteMetadata(&meta); err != nil {
-			log.Printf("Warning: Failed to delete metadata for URL shortener %s: %v", filename, err)
+	if err := h.deleteAdminResource(meta); err != nil {
+		if meta.IsURLShortener {
 			return c.String(http.StatusInternalServerError, "Failed to delete URL shortener")
 		}
-		log.Printf("Admin deleted URL shortener: %s", filename)
-	} else {
-		// Handle regular files - use the actual resource path
-		filePath := meta.ResourcePath
-		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
-			log.Printf("Error deleting file %s: %v", filePath, err)
-			return c.String(http.StatusInternalServerError, "Failed to delete file")
-		}
-
-		if err := h.db.DeleteMetadata(&meta); err != nil {
-			log.Printf("Warning: Failed to delete metadata for %s: %v", filePath, err)
-		}
-
-		log.Printf("Admin deleted file: %s", filePath)
+		return c.String(http.StatusInternalServerError, "Failed to delete file")
 	}
 
-	redirectURL := "/admin"
+	redirectURL := h.appPath("/admin")
 	params := []string{}
 
 	if searchQuery := c.QueryParam("search"); searchQuery != "" {
@@ -214,8 +258,60 @@ func (h *Handler) HandleAdminFileDelete(c echo.Context) error {
 	return c.Redirect(http.StatusSeeOther, redirectURL)
 }
 
-// HandleAdminFileUpdate updates file metadata
-func (h *Handler) HandleAdminFileUpdate(c echo.Context) error {
+// deleteAdminResource deletes a file or URL shortener, along with its group
+// when groups cascade
+func (h *Handler) deleteAdminResource(meta model.FileMetadata) error {
+	// Handle URL shorteners differently - they don't have physical files
+	if meta.IsURLShortener {
+		if err := h.db.DeleteMetadata(&meta); err != nil {
+			log.Printf("Warning: Failed to delete metadata for URL shortener %s: %v", meta.ResourcePath, err)
+			return err
+		}
+		h.deleteGroupMembers(meta)
+		h.webhooks.Notify(webhook.EventDelete, meta)
+		log.Printf("Admin deleted URL shortener: %s", meta.ResourcePath)
+		return nil
+	}
+
+	// Handle regular files - use the actual resource path
+	filePath := meta.ResourcePath
+	if err := removeStoredUpload(meta); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error deleting file %s: %v", filePath, err)
+		return err
+	}
+
+	if err := h.db.DeleteMetadata(&meta); err != nil {
+		log.Printf("Warning: Failed to delete metadata for %s: %v", filePath, err)
+	}
+	h.deleteGroupMembers(meta)
+	h.webhooks.Notify(webhook.EventDelete, meta)
+
+	log.Printf("Admin deleted file: %s", filePath)
+	return nil
+}
+
+// maxBulkDelete bounds how many resources one bulk delete may remove
+const maxBulkDelete = 1000
+
+// BulkDeleteResult reports what a bulk delete did
+type BulkDeleteResult struct {
+	Deleted  int                 `json:"deleted"`
+	Failed   int                 `json:"failed"`
+	Failures []BulkDeleteFailure `json:"failures,omitempty"`
+}
+
+// BulkDeleteFailure names an entry of a bulk delete that wasn't deleted, by
+// its position in the request since tokens aren't echoed back
+type BulkDeleteFailure struct {
+	Entry    int    `json:"entry"`
+	Filename string `json:"filename,omitempty"`
+	Error    string `json:"error"`
+}
+
+// HandleAdminBulkDelete deletes the files and URL shorteners whose management
+// tokens are sent as repeated token fields. Each entry is deleted on its own,
+// so a bad one doesn't stop the rest.
+func (h *Handler) HandleAdminBulkDelete(c echo.Context) error {
 	if !h.isAdminAuthenticated(c) {
 		return c.String(http.StatusUnauthorized, "Unauthorized")
 	}
@@ -225,38 +321,68 @@ func (h *Handler) HandleAdminFileUpdate(c echo.Context) error {
 		return c.String(http.StatusNotFound, "Admin panel is disabled")
 	}
 
-	filename := c.Param("filename")
-	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
-		return c.String(http.StatusBadRequest, "Invalid file path")
+	if err := c.Request().ParseForm(); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid request form")
 	}
-
-	token := c.FormValue("token")
-	if token == "" {
-		return c.String(http.StatusBadRequest, "Missing management token")
+	tokens := c.Request().Form["token"]
+	if len(tokens) == 0 {
+		return c.String(http.StatusBadRequest, "Missing management tokens")
+	}
+	if len(tokens) > maxBulkDelete {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Too many entries, at most %d can be deleted at once", maxBulkDelete))
 	}
 
-	meta, err := h.db.GetMetadataByToken(token)
-	if err != nil {
-		log.Printf("Invalid management token for admin update of %s: %v", filename, err)
-		return c.String(http.StatusUnauthorized, "Invalid management token")
+	var result BulkDeleteResult
+	fail := func(entry int, filename, reason string) {
+		result.Failed++
+		result.Failures = append(result.Failures, BulkDeleteFailure{Entry: entry, Filename: filename, Error: reason})
 	}
+	seen := make(map[string]bool, len(tokens))
+	for i, token := range tokens {
+		if token == "" || seen[token] {
+			fail(i, "", "missing or repeated management token")
+			continue
+		}
+		seen[token] = true
 
-	// Verify that the token belongs to the requested resource
-	if meta.IsFile() {
-		expectedFilename := filepath.Base(meta.ResourcePath)
-		if expectedFilename != filename {
-			log.Printf("Token mismatch: token belongs to %s but requested %s", expectedFilename, filename)
-			return c.String(http.StatusUnauthorized, "Invalid management token")
+		meta, err := h.db.GetMetadataByToken(token)
+		if err != nil {
+			fail(i, "", "invalid management token")
+			continue
 		}
-	} else {
-		if meta.ResourcePath != filename {
-			log.Printf("Token mismatch: token belongs to %s but requested %s", meta.ResourcePath, filename)
-			return c.String(http.StatusUnauthorized, "Invalid management token")
+		if err := h.deleteAdminResource(meta); err != nil {
+			fail(i, filepath.Base(meta.ResourcePath), "failed to delete")
+			continue
 		}
+		result.Deleted++
+	}
+
+	log.Printf("Bulk delete by %s: deleted %d, failed %d", c.RealIP(), result.Deleted, result.Failed)
+	return c.JSON(http.StatusOK, result)
+}
+
+// HandleAdminFileUpdate updates file metadata
+func (h *Handler) HandleAdminFileUpdate(c echo.Context) error {
+	if !h.isAdminAuthenticated(c) {
+		return c.String(http.StatusUnauthorized, "Unauthorized")
+	}
+
+	// Check if admin panel is enabled
+	if !h.cfg.AdminPanelEnabled {
+		return c.String(http.StatusNotFound, "Admin panel is disabled")
+	}
+
+	filename := c.Param("filename")
+	meta, err := h.adminResource(filename)
+	if errors.Is(err, errInvalidAdminResource) {
+		return c.String(http.StatusBadRequest, "Invalid file path")
+	}
+	if err != nil {
+		return c.String(http.StatusNotFound, "File not found")
 	}
 
 	if expiresStr := c.FormValue("expires"); expiresStr != "" {
-		expirationDate, err := utils.ParseExpirationTime(expiresStr)
+		expirationDate, err := utils.ParseExpirationTimeWithFloor(expiresStr, h.cfg.MinExpiration())
 		if err != nil {
 			return c.String(http.StatusBadRequest, fmt.Sprintf("Invalid expiration format: %v", err))
 		}
@@ -279,50 +405,138 @@ func (h *Handler) HandleAdminFileUpdate(c echo.Context) error {
 	}
 
 	log.Printf("Admin updated file: %s", meta.ResourcePath)
-	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/admin/file/%s?token=%s", filename, token))
+	return c.Redirect(http.StatusSeeOther, h.appPath("/admin/file/"+filename))
 }
 
 // HandleAdminLogin handles admin login (simple implementation)
 func (h *Handler) HandleAdminLogin(c echo.Context) error {
 	if c.Request().Method == "GET" {
-		return templates.AdminLogin().Render(c.Request().Context(), c.Response())
+		return templates.AdminLogin().Render(h.templateContext(c), c.Response())
 	}
 
 	username := c.FormValue("username")
 	password := c.FormValue("password")
-	if h.cfg.ValidateAdminPassword(username, password) {
-		c.SetCookie(&http.Cookie{
-			Name:     "admin_auth",
-			Value:    "true",
-			Path:     "/",
-			MaxAge:   3600,
-			HttpOnly: true,
-		})
-		return c.Redirect(http.StatusSeeOther, "/admin")
+	if !h.cfg.ValidateAdminPassword(username, password) {
+		return c.String(http.StatusUnauthorized, "Invalid username or password")
 	}
 
-	return c.String(http.StatusUnauthorized, "Invalid username or password")
+	session, err := h.adminSessions.create()
+	if err != nil {
+		log.Printf("Error creating admin session: %v", err)
+		return c.String(http.StatusInternalServerError, "Failed to log in")
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     adminSessionCookie,
+		Value:    session,
+		Path:     h.appPath("/"),
+		MaxAge:   int(adminSessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return c.Redirect(http.StatusSeeOther, h.appPath("/admin"))
 }
 
-// HandleAdminLogout handles admin logout
+// HandleAdminLogout ends the admin session and clears its cookie
 func (h *Handler) HandleAdminLogout(c echo.Context) error {
+	if cookie, err := c.Cookie(adminSessionCookie); err == nil {
+		h.adminSessions.end(cookie.Value)
+	}
 	c.SetCookie(&http.Cookie{
-		Name:     "admin_auth",
+		Name:     adminSessionCookie,
 		Value:    "",
-		Path:     "/",
+		Path:     h.appPath("/"),
 		MaxAge:   -1,
 		HttpOnly: true,
 	})
-	return c.Redirect(http.StatusSeeOther, "/admin/login")
+	return c.Redirect(http.StatusSeeOther, h.appPath("/admin/login"))
+}
+
+// retentionFormula documents the curve computed by the expiration manager
+const retentionFormula = "min_age + (min_age - max_age) * pow((file_size / max_size - 1), 3), clamped to [min_age, max_age]"
+
+// maxRetentionSizes bounds how many sizes one retention request may evaluate
+const maxRetentionSizes = 100
+
+// defaultRetentionSizes are the sizes in MiB evaluated when none are requested
+var defaultRetentionSizes = []float64{1, 10, 50, 100, 250, 500}
+
+// RetentionPoint is the retention computed for one file size
+type RetentionPoint struct {
+	SizeMiB       float64 `json:"size_mib"`
+	RetentionDays float64 `json:"retention_days"`
+}
+
+// RetentionResponse describes the retention curve and the parameters it is computed from
+type RetentionResponse struct {
+	MinAgeDays           int              `json:"min_age_days"`
+	MaxAgeDays           int              `json:"max_age_days"`
+	MaxSizeMiB           float64          `json:"max_size_mib"`
+	MinExpirationMinutes float64          `json:"min_expiration_minutes"`
+	Formula              string           `json:"formula"`
+	Points               []RetentionPoint `json:"points"`
+}
+
+// HandleRetention returns the retention for the sizes (in MiB) given as ?sizes=1,10,100
+func (h *Handler) HandleRetention(c echo.Context) error {
+	if !h.isAdminAuthenticated(c) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	sizes, err := parseRetentionSizes(c.QueryParam("sizes"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	response := RetentionResponse{
+		MinAgeDays:           h.cfg.MinAge,
+		MaxAgeDays:           h.cfg.MaxAge,
+		MaxSizeMiB:           h.cfg.MaxSize,
+		MinExpirationMinutes: h.cfg.MinExpiration().Minutes(),
+		Formula:              retentionFormula,
+		Points:               make([]RetentionPoint, 0, len(sizes)),
+	}
+	for _, size := range sizes {
+		retention := h.expManager.Retention(int64(size * 1024 * 1024))
+		response.Points = append(response.Points, RetentionPoint{
+			SizeMiB:       size,
+			RetentionDays: retention.Hours() / 24,
+		})
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// parseRetentionSizes parses a comma separated list of sizes in MiB
+func parseRetentionSizes(sizesStr string) ([]float64, error) {
+	if strings.TrimSpace(sizesStr) == "" {
+		return defaultRetentionSizes, nil
+	}
+
+	parts := strings.Split(sizesStr, ",")
+	if len(parts) > maxRetentionSizes {
+		return nil, fmt.Errorf("too many sizes, at most %d are allowed", maxRetentionSizes)
+	}
+
+	sizes := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		size, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || size < 0 || math.IsInf(size, 0) || math.IsNaN(size) {
+			return nil, fmt.Errorf("invalid size %q, expected a non-negative number of MiB", part)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
 }
 
-// isAdminAuthenticated checks if the user is authenticated as admin
+// isAdminAuthenticated checks that the request carries the cookie of a live
+// admin session
 func (h *Handler) isAdminAuthenticated(c echo.Context) bool {
-	cookie, err := c.Cookie("admin_auth")
+	cookie, err := c.Cookie(adminSessionCookie)
 	if err != nil {
 		return false
 	}
-	return cookie.Value == "true"
+	return h.adminSessions.valid(cookie.Value)
 }
 
 // getAllFilesForAdminSortedAndFilteredWithPagination retrieves files with pagination
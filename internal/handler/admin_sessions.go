@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// adminSessionCookie holds the session of a logged in admin
+const adminSessionCookie = "admin_auth"
+
+// adminSessionTTL is how long an admin stays logged in
+const adminSessionTTL = time.Hour
+
+// adminSessions keeps the sessions of logged in admins in memory. The cookie
+// carries "<id>.<signature>" and is only accepted while the id is known, so
+// logging out or restarting the server ends the session.
+type adminSessions struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]time.Time
+}
+
+// newAdminSessions signs cookies with secret, or with a random key when it is
+// empty
+func newAdminSessions(secret string, ttl time.Duration) *adminSessions {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &adminSessions{key: key, ttl: ttl, now: time.Now, sessions: make(map[string]time.Time)}
+}
+
+func (s *adminSessions) sign(id string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// create starts a session and returns the cookie value for it
+func (s *adminSessions) create() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(random)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for session, expiry := range s.sessions {
+		if now.After(expiry) {
+			delete(s.sessions, session)
+		}
+	}
+	s.sessions[id] = now.Add(s.ttl)
+	return id + "." + s.sign(id), nil
+}
+
+// valid reports whether the cookie value is signed by us and names a live session
+func (s *adminSessions) valid(value string) bool {
+	id, ok := s.verify(value)
+	if !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.sessions[id]
+	if ok && s.now().After(expiry) {
+		delete(s.sessions, id)
+		return false
+	}
+	return ok
+}
+
+// end forgets the session of the cookie value
+func (s *adminSessions) end(value string) {
+	if id, ok := s.verify(value); ok {
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+	}
+}
+
+// verify returns the session id of a cookie value with a valid signature
+func (s *adminSessions) verify(value string) (string, bool) {
+	id, signature, ok := strings.Cut(value, ".")
+	if !ok || id == "" || !hmac.Equal([]byte(signature), []byte(s.sign(id))) {
+		return "", false
+	}
+	return id, true
+}
@@ -131,6 +131,9 @@ func (h *Handler) HandleBinaryAutoDetect(c echo.Context) error {
 	userAgent := c.Request().Header.Get("User-Agent")
 	baseURL := strings.TrimSuffix(h.cfg.BaseURL, "/")
 
+	// The response is chosen from these headers
+	addVary(c, "Accept", "User-Agent")
+
 	// Check if this is a shell request (pipe to sh)
 	acceptHeader := c.Request().Header.Get("Accept")
 	if strings.Contains(acceptHeader, "text/plain") || strings.Contains(userAgent, "curl") || strings.Contains(userAgent, "wget") {
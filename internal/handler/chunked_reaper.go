@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Start removes expired upload sessions and orphaned chunk directories
+// periodically until Stop is called. Sessions otherwise only expire when a
+// client sends another chunk.
+func (m *ChunkedUploadManager) Start() {
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+
+		ticker := time.NewTicker(m.cfg.ChunkSessionCleanupInterval())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.reap(time.Now())
+			case <-m.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the periodic cleanup
+func (m *ChunkedUploadManager) Stop() {
+	close(m.stopChan)
+	if m.done != nil {
+		<-m.done
+	}
+}
+
+// reap removes the sessions expired at now, then the directories in the upload
+// path that belong to no session and no folder upload, like the chunks of
+// sessions lost in a restart. Directories younger than stale_upload_minutes
+// may be a session or folder upload being created and are kept.
+func (m *ChunkedUploadManager) reap(now time.Time) (sessions, orphans int) {
+	m.mu.RLock()
+	var expired []string
+	for id, upload := range m.uploads {
+		if now.After(upload.ExpiresAt) {
+			expired = append(expired, id)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, id := range expired {
+		log.Printf("Removing expired chunked upload session %s", id)
+		m.remove(id)
+	}
+
+	entries, err := os.ReadDir(m.cfg.UploadPath)
+	if err != nil {
+		log.Printf("Error reading upload directory: %v", err)
+		return len(expired), 0
+	}
+
+	threshold := m.cfg.StaleUploadAge()
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		m.mu.RLock()
+		_, active := m.uploads[entry.Name()]
+		m.mu.RUnlock()
+		if active {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < threshold {
+			continue
+		}
+
+		dir := filepath.Join(m.cfg.UploadPath, entry.Name())
+		if stored, err := m.db.HasMetadata(dir); err != nil || stored {
+			continue
+		}
+
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Error removing orphaned chunk directory %s: %v", dir, err)
+			continue
+		}
+		log.Printf("Removed orphaned chunk directory: %s (age: %v)", entry.Name(), now.Sub(info.ModTime()).Round(time.Minute))
+		orphans++
+	}
+
+	if len(expired) > 0 || orphans > 0 {
+		log.Printf("Chunked upload cleanup removed %d expired sessions and %d orphaned directories", len(expired), orphans)
+	}
+	return len(expired), orphans
+}
@@ -1,6 +1,11 @@
 package handler
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -8,16 +13,25 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/marianozunino/drop/internal/config"
+	"github.com/marianozunino/drop/internal/db"
+	"github.com/marianozunino/drop/internal/expiration"
 	"github.com/marianozunino/drop/internal/model"
 	"github.com/marianozunino/drop/internal/utils"
+	"github.com/marianozunino/drop/internal/webhook"
 )
 
+// UploadTokenHeader carries the upload token returned when a chunked upload
+// is started. Chunks, status and abort requests of the session must send it.
+const UploadTokenHeader = "X-Upload-Token"
+
 // ChunkedUpload handles resumable file uploads
 type ChunkedUpload struct {
 	UploadID       string       `json:"upload_id"`
@@ -26,9 +40,30 @@ type ChunkedUpload struct {
 	ChunkSize      int64        `json:"chunk_size"`
 	TotalChunks    int          `json:"total_chunks"`
 	UploadedChunks map[int]bool `json:"uploaded_chunks"`
+	ContentHash    string       `json:"content_hash,omitempty"`
+	SHA256         string       `json:"sha256,omitempty"`
+	Expires        string       `json:"expires,omitempty"`
+	MaxDownloads   int          `json:"max_downloads,omitempty"`
+	StoredFilename string       `json:"stored_filename,omitempty"`
 	CreatedAt      time.Time    `json:"created_at"`
 	ExpiresAt      time.Time    `json:"expires_at"`
 	mu             sync.RWMutex
+
+	// ChunkHashes holds the MD5 of each chunk as it was received
+	ChunkHashes map[int]string `json:"chunk_hashes,omitempty"`
+
+	// Limits are the retention limits of the upload tier that started the session
+	Limits expiration.RetentionLimits `json:"-"`
+
+	// MaxSize is the max_size of the upload tier that started the session
+	MaxSize int64 `json:"-"`
+
+	// ClientIP started the session, see max_chunked_sessions_per_ip
+	ClientIP string `json:"-"`
+
+	// UploadToken is the secret handed to the client that started the
+	// session, see UploadTokenHeader
+	UploadToken string `json:"-"`
 }
 
 // ChunkedUploadManager manages chunked uploads
@@ -36,36 +71,109 @@ type ChunkedUploadManager struct {
 	uploads map[string]*ChunkedUpload
 	mu      sync.RWMutex
 	cfg     *config.Config
+	db      db.Store
+
+	stopChan chan struct{}
+	done     chan struct{}
 }
 
 // NewChunkedUploadManager creates a new chunked upload manager
-func NewChunkedUploadManager(cfg *config.Config) *ChunkedUploadManager {
+func NewChunkedUploadManager(cfg *config.Config, database db.Store) *ChunkedUploadManager {
 	return &ChunkedUploadManager{
-		uploads: make(map[string]*ChunkedUpload),
-		cfg:     cfg,
+		uploads:  make(map[string]*ChunkedUpload),
+		cfg:      cfg,
+		db:       database,
+		stopChan: make(chan struct{}),
 	}
 }
 
 // InitiateChunkedUpload starts a new chunked upload session
 func (h *Handler) InitiateChunkedUpload(c echo.Context) error {
+	if h.MaintenanceMode() {
+		return h.maintenanceResponse(c, true)
+	}
+
+	if err := h.checkProofOfWork(c); err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	policy, err := h.resolveUploadPolicy(c)
+	if err != nil {
+		log.Printf("Rejected chunked upload from %s: %v", c.RealIP(), err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid API key"})
+	}
+
 	filename := c.FormValue("filename")
 	totalSize, err := strconv.ParseInt(c.FormValue("size"), 10, 64)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid size parameter"})
 	}
 
-	if totalSize > h.cfg.MaxSizeToBytes() {
+	if totalSize > policy.MaxSize {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "File too large"})
 	}
 
+	expires, err := requestedExpiration(c)
+	if err == nil {
+		_, err = h.resolveExpiration(expires, totalSize, policy.Limits)
+	}
+	if err != nil {
+		if errors.Is(err, errExpirationRequired) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid expiration format"})
+	}
+
+	contentHash := strings.ToLower(strings.TrimSpace(c.FormValue("content_hash")))
+	if contentHash != "" {
+		if !isValidContentHash(contentHash) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid content_hash, expected an MD5 hex digest"})
+		}
+
+		if existing, ok := h.findStoredFileByHash(contentHash, totalSize); ok {
+			log.Printf("Chunked upload of %s matches existing file %s, skipping upload", filename, existing.ResourcePath)
+			response := map[string]interface{}{
+				"already_exists": true,
+				"file_url":       joinURL(h.cfg.BaseURL, filepath.Base(existing.ResourcePath)),
+				"md5":            contentHash,
+			}
+			if existing.ExpiresAt != nil && !existing.ExpiresAt.IsZero() {
+				response["expires_at"] = existing.ExpiresAt.Format(time.RFC3339)
+				response["expires_in_days"] = int(time.Until(*existing.ExpiresAt).Hours() / 24)
+			}
+			return c.JSON(http.StatusOK, response)
+		}
+
+		// Only the client holding the session's token may resume it
+		if upload := h.chunkedManager.findByContentHash(contentHash, totalSize, c.FormValue("upload_token")); upload != nil {
+			log.Printf("Resuming chunked upload %s for %s (Progress: %d%%)",
+				upload.UploadID, filename, h.calculateProgress(upload))
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"upload_id":       upload.UploadID,
+				"upload_token":    upload.UploadToken,
+				"chunk_size":      upload.ChunkSize,
+				"total_chunks":    upload.TotalChunks,
+				"uploaded_chunks": upload.uploadedChunkList(),
+			})
+		}
+	}
+
 	uploadID, err := h.generateFileID(false)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate upload ID"})
 	}
 
+	uploadToken, err := generateID(ManagementTokenLength)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate upload token"})
+	}
+
+	// Clients may ask for smaller chunks, never for larger ones
 	chunkSize := h.cfg.ChunkSizeToBytes()
 	if customChunkSize, err := strconv.ParseInt(c.FormValue("chunk_size"), 10, 64); err == nil && customChunkSize > 0 {
-		chunkSize = customChunkSize
+		if chunkSize <= 0 || customChunkSize < chunkSize {
+			chunkSize = customChunkSize
+		}
 	}
 
 	totalChunks := int((totalSize + chunkSize - 1) / chunkSize)
@@ -77,13 +185,23 @@ func (h *Handler) InitiateChunkedUpload(c echo.Context) error {
 		ChunkSize:      chunkSize,
 		TotalChunks:    totalChunks,
 		UploadedChunks: make(map[int]bool),
+		ContentHash:    contentHash,
+		Expires:        expires,
+		Limits:         policy.Limits,
+		MaxSize:        policy.MaxSize,
+		MaxDownloads:   policy.downloadLimit(0),
 		CreatedAt:      time.Now(),
 		ExpiresAt:      time.Now().Add(24 * time.Hour),
+		ClientIP:       c.RealIP(),
+		UploadToken:    uploadToken,
 	}
 
-	h.chunkedManager.mu.Lock()
-	h.chunkedManager.uploads[uploadID] = upload
-	h.chunkedManager.mu.Unlock()
+	if !h.chunkedManager.add(upload, h.cfg.MaxChunkedSessionsPerIP) {
+		log.Printf("Rejected chunked upload from %s: %d sessions already in progress", upload.ClientIP, h.cfg.MaxChunkedSessionsPerIP)
+		return c.JSON(http.StatusTooManyRequests, map[string]string{
+			"error": "Too many chunked uploads in progress, finish or abort one first",
+		})
+	}
 
 	uploadDir := filepath.Join(h.cfg.UploadPath, uploadID)
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
@@ -95,6 +213,7 @@ func (h *Handler) InitiateChunkedUpload(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"upload_id":       uploadID,
+		"upload_token":    uploadToken,
 		"chunk_size":      chunkSize,
 		"total_chunks":    totalChunks,
 		"uploaded_chunks": []int{},
@@ -103,6 +222,10 @@ func (h *Handler) InitiateChunkedUpload(c echo.Context) error {
 
 // UploadChunk handles individual chunk uploads
 func (h *Handler) UploadChunk(c echo.Context) error {
+	if h.MaintenanceMode() {
+		return h.maintenanceResponse(c, true)
+	}
+
 	uploadID := c.Param("upload_id")
 	chunkIndex, err := strconv.Atoi(c.Param("chunk"))
 	if err != nil {
@@ -117,6 +240,10 @@ func (h *Handler) UploadChunk(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Upload session not found"})
 	}
 
+	if !upload.authorized(c.Request().Header.Get(UploadTokenHeader)) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Invalid upload token"})
+	}
+
 	if time.Now().After(upload.ExpiresAt) {
 		h.cleanupChunkedUpload(uploadID)
 		return c.JSON(http.StatusGone, map[string]string{"error": "Upload session expired"})
@@ -127,8 +254,11 @@ func (h *Handler) UploadChunk(c echo.Context) error {
 	}
 
 	upload.mu.RLock()
-	if upload.UploadedChunks[chunkIndex] {
-		upload.mu.RUnlock()
+	alreadyUploaded := upload.UploadedChunks[chunkIndex]
+	upload.mu.RUnlock()
+
+	// Resending a chunk of a complete session retries a failed finalization
+	if alreadyUploaded && !h.isUploadComplete(upload) {
 		progress := h.calculateProgress(upload)
 		log.Printf("Chunk %d/%d already uploaded for %s (Progress: %d%%)",
 			chunkIndex+1, upload.TotalChunks, upload.Filename, progress)
@@ -137,24 +267,44 @@ func (h *Handler) UploadChunk(c echo.Context) error {
 			"progress": progress,
 		})
 	}
-	upload.mu.RUnlock()
 
-	file, err := c.FormFile("chunk")
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "No chunk data provided"})
-	}
+	if !alreadyUploaded {
+		file, err := c.FormFile("chunk")
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "No chunk data provided"})
+		}
 
-	// Save chunk
-	chunkPath := filepath.Join(h.cfg.UploadPath, uploadID, fmt.Sprintf("chunk_%d", chunkIndex))
-	if err := h.saveChunk(file, chunkPath); err != nil {
-		log.Printf("Failed to save chunk %d/%d for %s: %v",
-			chunkIndex+1, upload.TotalChunks, upload.Filename, err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save chunk"})
-	}
+		// Chunks can't be longer than the session's chunk size or the bytes left
+		maxChunkSize := upload.chunkLength(chunkIndex)
+		if file.Size > maxChunkSize {
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+				"error": fmt.Sprintf("Chunk %d is larger than %d bytes", chunkIndex, maxChunkSize),
+			})
+		}
 
-	upload.mu.Lock()
-	upload.UploadedChunks[chunkIndex] = true
-	upload.mu.Unlock()
+		// Save chunk
+		chunkPath := filepath.Join(h.cfg.UploadPath, uploadID, fmt.Sprintf("chunk_%d", chunkIndex))
+		chunkHash, err := h.saveChunk(file, chunkPath, maxChunkSize)
+		if errors.Is(err, errUploadTooLarge) {
+			os.Remove(chunkPath)
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+				"error": fmt.Sprintf("Chunk %d is larger than %d bytes", chunkIndex, maxChunkSize),
+			})
+		}
+		if err != nil {
+			log.Printf("Failed to save chunk %d/%d for %s: %v",
+				chunkIndex+1, upload.TotalChunks, upload.Filename, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save chunk"})
+		}
+
+		upload.mu.Lock()
+		upload.UploadedChunks[chunkIndex] = true
+		if upload.ChunkHashes == nil {
+			upload.ChunkHashes = make(map[int]string)
+		}
+		upload.ChunkHashes[chunkIndex] = chunkHash
+		upload.mu.Unlock()
+	}
 
 	progress := h.calculateProgress(upload)
 	log.Printf("Chunk %d/%d uploaded for %s (Progress: %d%%)",
@@ -163,6 +313,28 @@ func (h *Handler) UploadChunk(c echo.Context) error {
 	if h.isUploadComplete(upload) {
 		log.Printf("All chunks uploaded for %s, finalizing...", upload.Filename)
 		managementToken, err := h.finalizeChunkedUpload(upload, c)
+		if errors.Is(err, errAssemblyCorrupted) {
+			log.Printf("Error: Discarding chunked upload %s for %s: %v", upload.UploadID, upload.Filename, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Upload assembly corruption detected, please upload the file again"})
+		}
+		if errors.Is(err, errContentTypeNotAllowed) {
+			return c.JSON(http.StatusUnsupportedMediaType, map[string]string{"error": err.Error()})
+		}
+		if errors.Is(err, errChunkedSizeMismatch) {
+			log.Printf("Rejected chunked upload %s for %s: %v", upload.UploadID, upload.Filename, err)
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Uploaded chunks don't add up to the declared size"})
+		}
+		if errors.Is(err, errUploadTooLarge) {
+			log.Printf("Rejected chunked upload %s for %s: %v", upload.UploadID, upload.Filename, err)
+			return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "File too large"})
+		}
+		if errors.Is(err, errFinalizeRetryable) {
+			log.Printf("Failed to finalize upload for %s, keeping the session for a retry: %v", upload.Filename, err)
+			return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+				"error":           "Failed to finalize upload, resume the upload to retry",
+				"uploaded_chunks": upload.uploadedChunkList(),
+			})
+		}
 		if err != nil {
 			log.Printf("Failed to finalize upload for %s: %v", upload.Filename, err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to finalize upload"})
@@ -170,26 +342,22 @@ func (h *Handler) UploadChunk(c echo.Context) error {
 		log.Printf("✓ Chunked upload completed: %s (%s) with ID: %s",
 			upload.Filename, formatBytes(upload.TotalSize), upload.UploadID)
 
-		fileExt := filepath.Ext(upload.Filename)
-		fileURL := h.cfg.BaseURL + upload.UploadID
-		if fileExt != "" {
-			fileURL += fileExt
-		} else {
-			fileURL += "_file"
-		}
-
-		// Calculate MD5 hash
-		finalFilename := upload.UploadID
-		if fileExt != "" {
-			finalFilename += fileExt
-		} else {
-			finalFilename += "_file"
-		}
+		upload.mu.RLock()
+		finalFilename := upload.StoredFilename
+		md5Hash := upload.ContentHash
+		sha256Hash := upload.SHA256
+		upload.mu.RUnlock()
+		fileURL := joinURL(h.cfg.BaseURL, finalFilename)
 		finalPath := filepath.Join(h.cfg.UploadPath, finalFilename)
-		md5Hash, err := utils.CalculateMD5(finalPath)
+
+		scanStatus, err := h.scanUpload(finalPath)
 		if err != nil {
-			log.Printf("Warning: Failed to calculate MD5 for %s: %v", finalFilename, err)
-			md5Hash = "" // Set empty string if calculation fails
+			log.Printf("Rejected chunked upload %s: %v", upload.Filename, err)
+			code, message := scanFailureResponse(err)
+			return c.JSON(code, map[string]string{"error": message})
+		}
+		if scanStatus != ScanPending {
+			h.queueThumbnail(finalPath)
 		}
 
 		response := map[string]interface{}{
@@ -197,6 +365,7 @@ func (h *Handler) UploadChunk(c echo.Context) error {
 			"progress": 100,
 			"file_url": fileURL,
 			"md5":      md5Hash,
+			"sha256":   sha256Hash,
 			"token":    managementToken,
 		}
 
@@ -208,6 +377,11 @@ func (h *Handler) UploadChunk(c echo.Context) error {
 			response["expires_in_days"] = days
 		}
 
+		if scanStatus != "" {
+			response["scan_status"] = scanStatus
+			response["scan_url"] = h.scanURL(finalFilename)
+		}
+
 		return c.JSON(http.StatusOK, response)
 	}
 
@@ -229,6 +403,10 @@ func (h *Handler) GetUploadStatus(c echo.Context) error {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Upload session not found"})
 	}
 
+	if !upload.authorized(c.Request().Header.Get(UploadTokenHeader)) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Invalid upload token"})
+	}
+
 	upload.mu.RLock()
 	defer upload.mu.RUnlock()
 
@@ -250,22 +428,111 @@ func (h *Handler) GetUploadStatus(c echo.Context) error {
 	})
 }
 
-// saveChunk saves an individual chunk to disk
-func (h *Handler) saveChunk(file *multipart.FileHeader, chunkPath string) error {
+// UploadSession is an unfinished chunked upload listed by ListUploadSessions
+type UploadSession struct {
+	UploadID       string    `json:"upload_id"`
+	Filename       string    `json:"filename"`
+	TotalSize      int64     `json:"total_size"`
+	UploadedChunks int       `json:"uploaded_chunks"`
+	TotalChunks    int       `json:"total_chunks"`
+	Progress       int       `json:"progress"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+
+	// Only shown to admins, who see the sessions of every client
+	ClientIP string `json:"client_ip,omitempty"`
+}
+
+// ListUploadSessions lists the unexpired chunked upload sessions, oldest
+// first. A logged in admin sees every session, other clients the sessions
+// started from their IP address, the same one max_chunked_sessions_per_ip counts.
+func (h *Handler) ListUploadSessions(c echo.Context) error {
+	admin := h.cfg.AdminPanelEnabled && h.isAdminAuthenticated(c)
+	clientIP := c.RealIP()
+	if admin {
+		clientIP = ""
+	}
+
+	sessions := []UploadSession{}
+	for _, upload := range h.chunkedManager.active(clientIP, time.Now()) {
+		upload.mu.RLock()
+		session := UploadSession{
+			UploadID:       upload.UploadID,
+			Filename:       upload.Filename,
+			TotalSize:      upload.TotalSize,
+			UploadedChunks: len(upload.UploadedChunks),
+			TotalChunks:    upload.TotalChunks,
+			CreatedAt:      upload.CreatedAt,
+			ExpiresAt:      upload.ExpiresAt,
+		}
+		if admin {
+			session.ClientIP = upload.ClientIP
+		}
+		upload.mu.RUnlock()
+		session.Progress = h.calculateProgress(upload)
+		sessions = append(sessions, session)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"sessions": sessions})
+}
+
+// AbortChunkedUpload cancels an upload session and removes its chunks right
+// away instead of when the session expires. It takes the session's upload
+// token, or a logged in admin.
+func (h *Handler) AbortChunkedUpload(c echo.Context) error {
+	uploadID := c.Param("upload_id")
+
+	h.chunkedManager.mu.RLock()
+	upload, exists := h.chunkedManager.uploads[uploadID]
+	h.chunkedManager.mu.RUnlock()
+
+	if !exists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Upload session not found"})
+	}
+
+	admin := h.cfg.AdminPanelEnabled && h.isAdminAuthenticated(c)
+	if !admin && !upload.authorized(c.Request().Header.Get(UploadTokenHeader)) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Invalid upload token"})
+	}
+
+	h.cleanupChunkedUpload(uploadID)
+	log.Printf("Chunked upload %s aborted for %s", uploadID, upload.Filename)
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message":   "Upload aborted",
+		"upload_id": uploadID,
+	})
+}
+
+// saveChunk saves an individual chunk of at most maxSize bytes to disk and
+// returns the MD5 hex digest of what was written
+func (h *Handler) saveChunk(file *multipart.FileHeader, chunkPath string, maxSize int64) (string, error) {
 	src, err := file.Open()
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer src.Close()
 
 	dst, err := os.Create(chunkPath)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer dst.Close()
 
-	_, err = io.Copy(dst, src)
-	return err
+	hash := md5.New()
+	written, err := io.Copy(io.MultiWriter(dst, hash), io.LimitReader(src, maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if written > maxSize {
+		return "", fmt.Errorf("%w (chunk over %d bytes)", errUploadTooLarge, maxSize)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// chunkLength is the length of a chunk of the session, shorter for the last one
+func (u *ChunkedUpload) chunkLength(index int) int64 {
+	return min(u.ChunkSize, u.TotalSize-int64(index)*u.ChunkSize)
 }
 
 // isUploadComplete checks if all chunks have been uploaded
@@ -285,49 +552,96 @@ func (h *Handler) calculateProgress(upload *ChunkedUpload) int {
 	return int(float64(len(upload.UploadedChunks)) / float64(upload.TotalChunks) * 100)
 }
 
-// finalizeChunkedUpload combines all chunks into the final file
+// finalizeChunkedUpload combines all chunks into the final file. When it fails
+// with errFinalizeRetryable nothing is left at the final path and the session
+// and its chunks are kept, minus any chunk that went missing, so the client can
+// resume instead of starting over.
 func (h *Handler) finalizeChunkedUpload(upload *ChunkedUpload, c echo.Context) (string, error) {
 	uploadDir := filepath.Join(h.cfg.UploadPath, upload.UploadID)
 
-	fileExt := filepath.Ext(upload.Filename)
-	finalFilename := upload.UploadID
-	if fileExt != "" {
-		finalFilename += fileExt
-	} else {
-		finalFilename += "_file"
+	// Assemble inside the upload directory and rename into place once complete,
+	// so the final path never exposes a half-written file
+	tmpPath := filepath.Join(uploadDir, upload.UploadID+".tmp")
+	upload.mu.RLock()
+	chunkHashes := make(map[int]string, len(upload.ChunkHashes))
+	for i, hash := range upload.ChunkHashes {
+		chunkHashes[i] = hash
+	}
+	upload.mu.RUnlock()
+
+	contentHash, sha, err := assembleChunks(uploadDir, upload.TotalChunks, chunkHashes, tmpPath)
+	if err == nil && !h.cfg.SkipAssemblyVerification {
+		err = verifyAssembledFile(tmpPath, contentHash)
+	}
+	if errors.Is(err, errAssemblyCorrupted) {
+		h.cleanupChunkedUpload(upload.UploadID)
+		return "", err
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		if missing := upload.forgetMissingChunks(uploadDir); len(missing) > 0 {
+			log.Printf("Warning: Chunks %v of %s are missing and must be uploaded again", missing, upload.Filename)
+		}
+		return "", fmt.Errorf("%w: %v", errFinalizeRetryable, err)
+	}
+
+	upload.mu.RLock()
+	expectedHash := upload.ContentHash
+	upload.mu.RUnlock()
+
+	// A mismatch means the chunks are corrupt, so the session can't be resumed
+	if expectedHash != "" && expectedHash != contentHash {
+		h.cleanupChunkedUpload(upload.UploadID)
+		return "", fmt.Errorf("content hash mismatch: expected %s, got %s", expectedHash, contentHash)
+	}
+
+	// Chunks are checked against the session's chunk size, but short ones only
+	// show here. Sizes are measured, the declared size isn't trusted.
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("%w: %v", errFinalizeRetryable, err)
+	}
+	size := info.Size()
+	if size != upload.TotalSize {
+		err = fmt.Errorf("%w: assembled %d bytes, declared %d", errChunkedSizeMismatch, size, upload.TotalSize)
+	}
+	if err == nil && upload.MaxSize > 0 && size > upload.MaxSize {
+		err = fmt.Errorf("%w (max %d bytes)", errUploadTooLarge, upload.MaxSize)
+	}
+	if err != nil {
+		h.cleanupChunkedUpload(upload.UploadID)
+		return "", err
 	}
-	finalPath := filepath.Join(h.cfg.UploadPath, finalFilename)
 
-	finalFile, err := os.Create(finalPath)
+	// Relative expirations count from completion, not from the start of the upload
+	expirationDate, err := h.resolveExpiration(upload.Expires, size, upload.Limits)
 	if err != nil {
+		h.cleanupChunkedUpload(upload.UploadID)
 		return "", err
 	}
-	defer finalFile.Close()
 
-	for i := 0; i < upload.TotalChunks; i++ {
-		chunkPath := filepath.Join(uploadDir, fmt.Sprintf("chunk_%d", i))
-		chunkFile, err := os.Open(chunkPath)
-		if err != nil {
-			return "", err
-		}
+	sniffed := sniffContentType(tmpPath)
+	if err := h.checkContentType(sniffed, filepath.Ext(upload.Filename)); err != nil {
+		h.cleanupChunkedUpload(upload.UploadID)
+		return "", err
+	}
 
-		_, err = io.Copy(finalFile, chunkFile)
-		chunkFile.Close()
-		if err != nil {
-			return "", err
-		}
+	contentType := h.correctContentType(sniffed, filepath.Ext(upload.Filename))
+	finalFilename := h.chunkedStoredFilename(upload.UploadID, upload.Filename, contentType)
+	finalPath := filepath.Join(h.cfg.UploadPath, finalFilename)
+
+	if err := os.Rename(tmpPath, finalPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("%w: %v", errFinalizeRetryable, err)
 	}
 
-	managementToken, err := h.generateFileID(false)
+	managementToken, err := generateID(ManagementTokenLength)
 	if err != nil {
 		log.Printf("Warning: Failed to generate management token: %v", err)
 		managementToken = filepath.Base(finalPath)
 	}
 
-	contentType := h.detectContentType(finalPath)
-
-	expirationDate := h.expManager.GetExpirationDate(upload.TotalSize)
-
 	var ipAddress string
 	if h.cfg.IPTrackingEnabled {
 		ipAddress = c.RealIP()
@@ -338,13 +652,16 @@ func (h *Handler) finalizeChunkedUpload(upload *ChunkedUpload, c echo.Context) (
 		Token:        managementToken,
 		OriginalName: upload.Filename,
 		UploadDate:   time.Now(),
-		Size:         upload.TotalSize,
+		Size:         size,
 		ContentType:  contentType,
 		OneTimeView:  false,
 		AccessCount:  0,
 		IPAddress:    ipAddress,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
+		ContentHash:  contentHash,
+		PublicID:     true,
+		MaxDownloads: upload.MaxDownloads,
 	}
 
 	if !expirationDate.IsZero() {
@@ -353,11 +670,19 @@ func (h *Handler) finalizeChunkedUpload(upload *ChunkedUpload, c echo.Context) (
 
 	if err := h.db.StoreMetadata(&metadata); err != nil {
 		log.Printf("Failed to store metadata for chunked upload: %v", err)
-		return "", err
+		os.Remove(finalPath)
+		return "", fmt.Errorf("%w: %v", errFinalizeRetryable, err)
 	}
+	h.webhooks.Notify(webhook.EventUpload, metadata)
 
 	os.RemoveAll(uploadDir)
 
+	upload.mu.Lock()
+	upload.ContentHash = contentHash
+	upload.SHA256 = sha
+	upload.StoredFilename = finalFilename
+	upload.mu.Unlock()
+
 	h.chunkedManager.mu.Lock()
 	delete(h.chunkedManager.uploads, upload.UploadID)
 	h.chunkedManager.mu.Unlock()
@@ -365,12 +690,227 @@ func (h *Handler) finalizeChunkedUpload(upload *ChunkedUpload, c echo.Context) (
 	return managementToken, nil
 }
 
-// cleanupChunkedUpload removes expired upload sessions
+// errChunkedSizeMismatch means the assembled chunks don't add up to the size
+// the session was started with
+var errChunkedSizeMismatch = errors.New("chunked upload size mismatch")
+
+// errFinalizeRetryable means finalization failed without damaging the session,
+// which can be resumed to try again
+var errFinalizeRetryable = errors.New("finalization failed")
+
+// forgetMissingChunks unmarks received chunks whose files are gone so they can be
+// uploaded again, returning their indexes
+func (u *ChunkedUpload) forgetMissingChunks(uploadDir string) []int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var missing []int
+	for i := 0; i < u.TotalChunks; i++ {
+		if !u.UploadedChunks[i] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(uploadDir, fmt.Sprintf("chunk_%d", i))); os.IsNotExist(err) {
+			delete(u.UploadedChunks, i)
+			delete(u.ChunkHashes, i)
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// errAssemblyCorrupted means the assembled file doesn't match the chunks as they
+// were received. The session is discarded since its chunks can't be trusted.
+var errAssemblyCorrupted = errors.New("assembly corruption")
+
+// assembleChunks concatenates the uploaded chunks in order into dstPath and
+// returns the MD5 and SHA-256 hex digests of the assembled content. Chunks
+// with a recorded hash must still match it.
+func assembleChunks(uploadDir string, totalChunks int, chunkHashes map[int]string, dstPath string) (string, string, error) {
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	hash, sha := md5.New(), sha256.New()
+	for i := 0; i < totalChunks; i++ {
+		chunkPath := filepath.Join(uploadDir, fmt.Sprintf("chunk_%d", i))
+		chunkFile, err := os.Open(chunkPath)
+		if err != nil {
+			dst.Close()
+			return "", "", err
+		}
+
+		chunkHash := md5.New()
+		_, err = io.Copy(io.MultiWriter(dst, hash, sha, chunkHash), chunkFile)
+		chunkFile.Close()
+		if err != nil {
+			dst.Close()
+			return "", "", err
+		}
+
+		if expected, ok := chunkHashes[i]; ok && expected != hex.EncodeToString(chunkHash.Sum(nil)) {
+			dst.Close()
+			return "", "", fmt.Errorf("%w: chunk %d changed on disk after it was received", errAssemblyCorrupted, i)
+		}
+	}
+
+	if err := dst.Close(); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), hex.EncodeToString(sha.Sum(nil)), nil
+}
+
+// verifyAssembledFile re-reads the assembled file and compares it with the hash
+// computed while writing it
+func verifyAssembledFile(path, expectedHash string) error {
+	actualHash, err := utils.CalculateMD5(path)
+	if err != nil {
+		return err
+	}
+	if actualHash != expectedHash {
+		return fmt.Errorf("%w: assembled file hashes to %s, expected %s", errAssemblyCorrupted, actualHash, expectedHash)
+	}
+	return nil
+}
+
+// isValidContentHash reports whether hash looks like a lowercase MD5 hex digest
+func isValidContentHash(hash string) bool {
+	if len(hash) != md5.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// findStoredFileByHash returns a live, reusable stored file with the given
+// content hash and size. Only public files without a password or download
+// limit qualify, so deduplication never hands out a secret or protected URL.
+func (h *Handler) findStoredFileByHash(hash string, size int64) (model.FileMetadata, bool) {
+	meta, err := h.db.GetMetadataByContentHash(hash)
+	if err != nil || !meta.PublicID || meta.Size != size || meta.LimitsDownloads() || meta.HasPassword() {
+		return model.FileMetadata{}, false
+	}
+
+	if expired, err := h.expManager.CheckMetadataExpiration(meta); err != nil || expired {
+		return model.FileMetadata{}, false
+	}
+
+	if _, err := os.Stat(meta.ResourcePath); err != nil {
+		return model.FileMetadata{}, false
+	}
+
+	return meta, true
+}
+
+// findByContentHash returns an unfinished, unexpired session for the same
+// content that was started by the holder of token
+func (m *ChunkedUploadManager) findByContentHash(hash string, size int64, token string) *ChunkedUpload {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, upload := range m.uploads {
+		upload.mu.RLock()
+		matches := upload.authorized(token) &&
+			upload.ContentHash == hash &&
+			upload.TotalSize == size &&
+			len(upload.UploadedChunks) < upload.TotalChunks &&
+			time.Now().Before(upload.ExpiresAt)
+		upload.mu.RUnlock()
+		if matches {
+			return upload
+		}
+	}
+	return nil
+}
+
+// active returns the sessions unexpired at now, oldest first. A non-empty
+// clientIP only returns the sessions started from that address.
+func (m *ChunkedUploadManager) active(clientIP string, now time.Time) []*ChunkedUpload {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var uploads []*ChunkedUpload
+	for _, upload := range m.uploads {
+		upload.mu.RLock()
+		matches := now.Before(upload.ExpiresAt) && (clientIP == "" || upload.ClientIP == clientIP)
+		upload.mu.RUnlock()
+		if matches {
+			uploads = append(uploads, upload)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].CreatedAt.Before(uploads[j].CreatedAt)
+	})
+	return uploads
+}
+
+// add registers the session unless its client already has limit unexpired
+// sessions. A limit of 0 allows any number.
+func (m *ChunkedUploadManager) add(upload *ChunkedUpload, limit int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if limit > 0 {
+		active := 0
+		now := time.Now()
+		for _, other := range m.uploads {
+			other.mu.RLock()
+			if other.ClientIP == upload.ClientIP && now.Before(other.ExpiresAt) {
+				active++
+			}
+			other.mu.RUnlock()
+		}
+		if active >= limit {
+			return false
+		}
+	}
+	m.uploads[upload.UploadID] = upload
+	return true
+}
+
+// authorized reports whether token is the session's upload token
+func (u *ChunkedUpload) authorized(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(u.UploadToken)) == 1
+}
+
+// uploadedChunkList returns the indexes of received chunks in ascending order
+func (u *ChunkedUpload) uploadedChunkList() []int {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	chunks := make([]int, 0, len(u.UploadedChunks))
+	for i := range u.UploadedChunks {
+		chunks = append(chunks, i)
+	}
+	sort.Ints(chunks)
+	return chunks
+}
+
+// cleanupChunkedUpload removes an expired or aborted upload session and its chunks
 func (h *Handler) cleanupChunkedUpload(uploadID string) {
-	uploadDir := filepath.Join(h.cfg.UploadPath, uploadID)
+	h.chunkedManager.remove(uploadID)
+}
+
+// remove deletes the session and its chunk directory
+func (m *ChunkedUploadManager) remove(uploadID string) {
+	uploadDir := filepath.Join(m.cfg.UploadPath, uploadID)
 	os.RemoveAll(uploadDir)
 
-	h.chunkedManager.mu.Lock()
-	delete(h.chunkedManager.uploads, uploadID)
-	h.chunkedManager.mu.Unlock()
+	m.mu.Lock()
+	delete(m.uploads, uploadID)
+	m.mu.Unlock()
+}
+
+// chunkedStoredFilename names an assembled chunked upload: the upload id plus the
+// original extension, or the detected one when the name has none. The chunk
+// directory already uses the bare id, so files of unknown type get the
+// chunkedFileSuffix instead.
+func (h *Handler) chunkedStoredFilename(uploadID, originalName, contentType string) string {
+	if ext := filepath.Ext(originalName); ext != "" {
+		return uploadID + ext
+	}
+	if ext := canonicalExtension(contentType); ext != "" {
+		return uploadID + ext
+	}
+	return uploadID + chunkedFileSuffix
 }
@@ -1,18 +1,24 @@
 package handler
 
 import (
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/db"
 	"github.com/marianozunino/drop/internal/model"
 	"github.com/marianozunino/drop/templates"
 )
@@ -24,68 +30,269 @@ func (h *Handler) HandleFileAccess(c echo.Context) error {
 	if err == nil && meta.IsURLShortener {
 		return h.HandleURLRedirect(c)
 	}
+	if ok, err := h.checkTransferCap(c); !ok {
+		return err
+	}
 	filePath, err := h.validateAndResolvePath(c)
 	if err != nil {
+		if os.IsNotExist(err) {
+			h.forgetMissingFile(filename)
+		}
 		if os.IsNotExist(err) || os.IsPermission(err) {
 			log.Printf("Warning: File access error: %v", err)
-			return c.String(http.StatusNotFound, "File not found")
+			return h.notFoundResponse(c)
 		}
 		log.Printf("Error: File access error: %v", err)
 		return c.String(http.StatusInternalServerError, "Server error")
 	}
 
+	if h.scanPending(filePath) {
+		c.Response().Header().Set("Retry-After", "5")
+		return c.String(http.StatusServiceUnavailable, "File is still being scanned")
+	}
+
+	// Files without metadata (imported by hand, DB loss) are still served as downloads
 	meta, err = h.getFileMetadata(filePath)
-	if err != nil {
+	legacy := errors.Is(err, db.ErrNotFound)
+	if legacy {
+		log.Printf("Warning: No metadata for %s, serving it as a legacy file", filePath)
+		meta = h.legacyFileMetadata(filePath)
+	} else if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to get metadata")
 	}
 
+	// Expired files stay on disk until the next cleanup but are gone already
+	if meta.ExpiresAt != nil && meta.ExpiresAt.Before(time.Now()) {
+		return h.goneResponse(c)
+	}
+
+	if meta.IsFolder() {
+		return h.serveFolderListing(c, meta, "")
+	}
+
+	// Files consumed by downloads serve a placeholder to preview bots, detected
+	// from these headers, so link previews don't use up their downloads
+	if meta.LimitsDownloads() {
+		addVary(c, "User-Agent", "Accept")
+	}
+
 	isPreviewBot := h.isLinkPreviewBot(c.Request())
-	if meta.OneTimeView && isPreviewBot {
+	if meta.LimitsDownloads() && isPreviewBot {
 		return h.servePlaceholderForPreviewBot(c)
 	}
 
+	// Protected files need their password before anything of them is served,
+	// preview bots included, which get the password page
+	if meta.HasPassword() {
+		if ok, err := h.checkFilePassword(c, meta); !ok {
+			return err
+		}
+	}
+
+	// Files with a viewer are rendered for browsers and served raw to everything else
+	if !legacy && h.hasViewer(meta) {
+		addVary(c, "Accept")
+		if h.wantsViewer(c, meta) {
+			if body, ok := viewerBody(filePath, meta); ok {
+				return h.serveViewer(c, filePath, meta, body)
+			}
+		}
+	}
+
+	// Limited downloads are reserved before anything is sent, so concurrent
+	// requests can't serve more than max_downloads. The reservation is given
+	// back unless the whole file was served.
+	var downloads int
+	served := false
+	if meta.MaxDownloads > 0 && !meta.OneTimeView {
+		downloads, err = h.reserveDownload(filePath, meta)
+		if errors.Is(err, db.ErrDownloadLimitReached) {
+			return h.goneResponse(c)
+		}
+		if err != nil {
+			return c.String(http.StatusInternalServerError, "Failed to count download")
+		}
+		if downloads <= meta.MaxDownloads {
+			defer func() {
+				if !served {
+					h.releaseDownload(filePath, meta)
+				}
+			}()
+		}
+	}
+
 	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		// Removed since it was resolved
+		h.forgetMissingFile(filepath.Base(filePath))
+		return h.notFoundResponse(c)
+	}
 	if err != nil {
 		log.Printf("Error: Failed to open file for download: %v", err)
 		return c.String(http.StatusInternalServerError, "Failed to open file")
 	}
 	defer file.Close()
 
+	// Whatever is sent of the file, whole, ranges or compressed, counts
+	// toward its bytes_served and the monthly transfer
+	defer func() { h.recordTransfer(meta, c.Response().Size) }()
+
 	fileInfo, err := file.Stat()
 	if err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to stat file")
 	}
 
 	h.setResponseHeaders(c, meta, fileInfo)
+	h.setLinkHeaders(c, filepath.Base(filePath), meta)
+
+	disposition := h.contentDisposition(meta)
+	if legacy {
+		disposition = formatDisposition("attachment", meta.OriginalName)
+	}
+	c.Response().Header().Set("Content-Disposition", disposition)
 
 	if h.handleConditionalRequest(c, meta, fileInfo) {
 		return nil
 	}
 
-	if rangeHeader := c.Request().Header.Get("Range"); rangeHeader != "" {
+	// Encoded files are decompressed for clients that don't accept the encoding.
+	// Ranges of the decoded content can't be served, so they get all of it.
+	decode := meta.ContentEncoding != "" && !acceptsGzip(c.Request())
+
+	if rangeHeader := c.Request().Header.Get("Range"); rangeHeader != "" && !decode {
 		return h.handleRangeRequest(c, file, fileInfo, meta)
 	}
 
-	contentDisposition := c.Response().Header().Get("Content-Disposition")
-	if contentDisposition == "" {
-		if shouldDisplayInline(meta.ContentType) {
-			c.Response().Header().Set("Content-Disposition", "inline; filename=\""+meta.OriginalName+"\"")
-		} else {
-			c.Response().Header().Set("Content-Disposition", "attachment; filename=\""+meta.OriginalName+"\"")
+	var body io.Reader = file
+	if decode {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			log.Printf("Error: Failed to decompress %s: %v", filePath, err)
+			return c.String(http.StatusInternalServerError, "Failed to read file")
 		}
+		defer zr.Close()
+		body = zr
 	}
 
 	log.Printf("File served: %s (%s) to %s", meta.OriginalName, formatBytes(fileInfo.Size()), c.RealIP())
+	var gz *gzip.Writer
+	if meta.ContentEncoding == "" {
+		gz = h.gzipResponse(c, meta.ContentType)
+	}
 	c.Response().WriteHeader(http.StatusOK)
-	_, err = h.streamFileOptimized(c.Response(), file)
+	if gz != nil {
+		_, err = h.streamFileOptimized(c.Request().Context(), gz, body)
+		if closeErr := gz.Close(); err == nil {
+			err = closeErr
+		}
+	} else {
+		_, err = h.streamFileOptimized(c.Request().Context(), c.Response(), body)
+	}
+	if err != nil && c.Request().Context().Err() != nil {
+		log.Printf("Download aborted: %s to %s: %v", meta.OriginalName, c.RealIP(), err)
+	}
 
+	// Files consumed by downloads are counted or deleted right away and never go
+	// through the batched counter. Link previews aren't downloads.
 	if err == nil && meta.OneTimeView {
-		err = h.deleteOneTimeViewFile(filePath, meta)
+		err = h.consumeFile(filePath, meta)
+	} else if err == nil && meta.MaxDownloads > 0 {
+		served = true
+		err = h.countLimitedDownload(filePath, meta, downloads)
+	} else if err == nil && !legacy && !isPreviewBot {
+		h.recordAccess(meta)
 	}
 
 	return err
 }
 
+// HandleFileHead answers HEAD requests for a file with the headers a GET would
+// send. Nothing is counted or consumed, so one-time files survive it.
+func (h *Handler) HandleFileHead(c echo.Context) error {
+	filename := c.Param("filename")
+
+	if meta, err := h.db.GetMetadataByID(filename); err == nil && meta.IsURLShortener {
+		if meta.ExpiresAt != nil && meta.ExpiresAt.Before(time.Now()) {
+			return c.NoContent(http.StatusGone)
+		}
+		location, err := redirectLocation(meta.OriginalURL)
+		if err != nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+		c.Response().Header().Set("Cache-Control", "no-store")
+		c.Response().Header().Set("Location", location)
+		return c.NoContent(http.StatusFound)
+	}
+
+	filePath, err := h.validateAndResolvePath(c)
+	if err != nil {
+		if os.IsNotExist(err) {
+			h.forgetMissingFile(c.Param("filename"))
+		}
+		if os.IsNotExist(err) || os.IsPermission(err) {
+			return h.notFoundResponse(c)
+		}
+		log.Printf("Error: File access error: %v", err)
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	if h.scanPending(filePath) {
+		c.Response().Header().Set("Retry-After", "5")
+		return c.NoContent(http.StatusServiceUnavailable)
+	}
+
+	meta, err := h.getFileMetadata(filePath)
+	legacy := errors.Is(err, db.ErrNotFound)
+	if legacy {
+		meta = h.legacyFileMetadata(filePath)
+	} else if err != nil {
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	// Expired files stay on disk until the next cleanup but are gone already
+	if meta.ExpiresAt != nil && meta.ExpiresAt.Before(time.Now()) {
+		return c.NoContent(http.StatusGone)
+	}
+
+	if meta.IsFolder() {
+		return h.serveFolderListing(c, meta, "")
+	}
+
+	if meta.HasPassword() {
+		if ok, err := h.checkFilePassword(c, meta); !ok {
+			return err
+		}
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return c.NoContent(http.StatusInternalServerError)
+	}
+
+	h.setResponseHeaders(c, meta, fileInfo)
+	h.setLinkHeaders(c, filepath.Base(filePath), meta)
+
+	header := c.Response().Header()
+	disposition := h.contentDisposition(meta)
+	if legacy {
+		disposition = formatDisposition("attachment", meta.OriginalName)
+	}
+	header.Set("Content-Disposition", disposition)
+
+	if h.handleConditionalRequest(c, meta, fileInfo) {
+		return nil
+	}
+
+	// A GET would gzip the response, whose length isn't known up front
+	if meta.ContentEncoding == "" && shouldCompress(meta.ContentType) && acceptsGzip(c.Request()) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+	}
+
+	c.Response().WriteHeader(http.StatusOK)
+	return nil
+}
+
 // handleRangeRequest handles HTTP Range requests for better streaming
 func (h *Handler) handleRangeRequest(c echo.Context, file *os.File, fileInfo os.FileInfo, meta model.FileMetadata) error {
 	rangeHeader := c.Request().Header.Get("Range")
@@ -95,18 +302,47 @@ func (h *Handler) handleRangeRequest(c echo.Context, file *os.File, fileInfo os.
 		return c.String(http.StatusBadRequest, "Invalid range header")
 	}
 
+	// No range of an empty file is satisfiable, e.g. "bytes=0-" would end
+	// before it starts
+	if fileInfo.Size() == 0 {
+		return rangeNotSatisfiable(c, 0, "Range not satisfiable")
+	}
+
 	rangeStr := strings.TrimPrefix(rangeHeader, "bytes=")
 	ranges := strings.Split(rangeStr, ",")
-
-	// For now, handle single range only
 	if len(ranges) > 1 {
-		return c.String(http.StatusRequestedRangeNotSatisfiable, "Multiple ranges not supported")
+		return h.handleMultiRangeRequest(c, file, fileInfo, meta, ranges)
 	}
 
-	rangeStr = ranges[0]
-	parts := strings.Split(rangeStr, "-")
+	start, end, err := parseByteRange(ranges[0], fileInfo.Size())
+	if err != nil && err.status == http.StatusRequestedRangeNotSatisfiable {
+		return rangeNotSatisfiable(c, fileInfo.Size(), err.message)
+	}
+	if err != nil {
+		return c.String(err.status, err.message)
+	}
+	return h.serveRange(c, file, fileInfo, meta, start, end)
+}
+
+// rangeNotSatisfiable answers with 416 and the Content-Range that tells the
+// client the size of the file
+func rangeNotSatisfiable(c echo.Context, size int64, message string) error {
+	c.Response().Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	return c.String(http.StatusRequestedRangeNotSatisfiable, message)
+}
+
+// rangeError is the response to a range that can't be served
+type rangeError struct {
+	status  int
+	message string
+}
+
+// parseByteRange parses one "start-end", "start-" or "-suffix" range of a file
+// of the given size into the first and last byte offsets
+func parseByteRange(spec string, size int64) (int64, int64, *rangeError) {
+	parts := strings.Split(strings.TrimSpace(spec), "-")
 	if len(parts) != 2 {
-		return c.String(http.StatusBadRequest, "Invalid range format")
+		return 0, 0, &rangeError{http.StatusBadRequest, "Invalid range format"}
 	}
 
 	startStr := parts[0]
@@ -119,34 +355,39 @@ func (h *Handler) handleRangeRequest(c echo.Context, file *os.File, fileInfo os.
 		// Range like "bytes=-1023" (last 1023 bytes)
 		end, err = strconv.ParseInt(endStr, 10, 64)
 		if err != nil {
-			return c.String(http.StatusBadRequest, "Invalid range end")
+			return 0, 0, &rangeError{http.StatusBadRequest, "Invalid range end"}
 		}
-		start = fileInfo.Size() - end
-		end = fileInfo.Size() - 1
+		start = size - end
+		end = size - 1
 	} else if endStr == "" {
 		// Range like "bytes=1024-" (from byte 1024 to end)
 		start, err = strconv.ParseInt(startStr, 10, 64)
 		if err != nil {
-			return c.String(http.StatusBadRequest, "Invalid range start")
+			return 0, 0, &rangeError{http.StatusBadRequest, "Invalid range start"}
 		}
-		end = fileInfo.Size() - 1
+		end = size - 1
 	} else {
 		// Range like "bytes=1024-2047"
 		start, err = strconv.ParseInt(startStr, 10, 64)
 		if err != nil {
-			return c.String(http.StatusBadRequest, "Invalid range start")
+			return 0, 0, &rangeError{http.StatusBadRequest, "Invalid range start"}
 		}
 		end, err = strconv.ParseInt(endStr, 10, 64)
 		if err != nil {
-			return c.String(http.StatusBadRequest, "Invalid range end")
+			return 0, 0, &rangeError{http.StatusBadRequest, "Invalid range end"}
 		}
 	}
 
 	// Validate range
-	if start < 0 || end >= fileInfo.Size() || start > end {
-		return c.String(http.StatusRequestedRangeNotSatisfiable, "Range not satisfiable")
+	if start < 0 || end >= size || start > end {
+		return 0, 0, &rangeError{http.StatusRequestedRangeNotSatisfiable, "Range not satisfiable"}
 	}
+	return start, end, nil
+}
 
+// serveRange sends the bytes from start to end, both included, as a single
+// partial response
+func (h *Handler) serveRange(c echo.Context, file *os.File, fileInfo os.FileInfo, meta model.FileMetadata, start, end int64) error {
 	// Seek to start position
 	if _, err := file.Seek(start, io.SeekStart); err != nil {
 		return c.String(http.StatusInternalServerError, "Failed to seek file")
@@ -158,23 +399,89 @@ func (h *Handler) handleRangeRequest(c echo.Context, file *os.File, fileInfo os.
 	c.Response().Header().Set("Content-Length", fmt.Sprintf("%d", contentLength))
 	c.Response().Header().Set("Accept-Ranges", "bytes")
 
-	// Set Content-Disposition header
-	if shouldDisplayInline(meta.ContentType) {
-		c.Response().Header().Set("Content-Disposition", "inline; filename=\""+meta.OriginalName+"\"")
-	} else {
-		c.Response().Header().Set("Content-Disposition", "attachment; filename=\""+meta.OriginalName+"\"")
-	}
-
 	log.Printf("Range request served: %s (%d-%d/%d) to %s", meta.OriginalName, start, end, fileInfo.Size(), c.RealIP())
 	c.Response().WriteHeader(http.StatusPartialContent)
 
 	// Copy only the requested range
-	_, err = io.CopyN(c.Response(), file, contentLength)
+	_, err := h.streamFileOptimized(c.Request().Context(), c.Response(), io.LimitReader(file, contentLength))
 	return err
 }
 
-// handleConditionalRequest handles If-None-Match and If-Modified-Since headers
+// maxRangeParts is the most ranges served in one multipart response, more
+// small ranges than this only cost seeks and part headers
+const maxRangeParts = 32
+
+// handleMultiRangeRequest serves several ranges as a multipart/byteranges
+// body. Unsatisfiable ranges are left out as long as one can be served; a
+// single remaining range is sent as a plain partial response.
+func (h *Handler) handleMultiRangeRequest(c echo.Context, file *os.File, fileInfo os.FileInfo, meta model.FileMetadata, specs []string) error {
+	if len(specs) > maxRangeParts {
+		return rangeNotSatisfiable(c, fileInfo.Size(), "Too many ranges")
+	}
+
+	type byteRange struct{ start, end int64 }
+	var ranges []byteRange
+	for _, spec := range specs {
+		start, end, err := parseByteRange(spec, fileInfo.Size())
+		if err != nil && err.status == http.StatusRequestedRangeNotSatisfiable {
+			continue
+		}
+		if err != nil {
+			return c.String(err.status, err.message)
+		}
+		ranges = append(ranges, byteRange{start, end})
+	}
+
+	switch len(ranges) {
+	case 0:
+		return rangeNotSatisfiable(c, fileInfo.Size(), "Range not satisfiable")
+	case 1:
+		return h.serveRange(c, file, fileInfo, meta, ranges[0].start, ranges[0].end)
+	}
+
+	header := c.Response().Header()
+	contentType := header.Get("Content-Type")
+	mw := multipart.NewWriter(c.Response())
+	header.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	header.Set("Accept-Ranges", "bytes")
+	header.Del("Content-Length")
+
+	log.Printf("Multi-range request served: %s (%d ranges of %d) to %s", meta.OriginalName, len(ranges), fileInfo.Size(), c.RealIP())
+	c.Response().WriteHeader(http.StatusPartialContent)
+
+	ctx := c.Request().Context()
+	for _, r := range ranges {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, fileInfo.Size())},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := file.Seek(r.start, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := h.streamFileOptimized(ctx, part, io.LimitReader(file, r.end-r.start+1)); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+// handleConditionalRequest handles If-Unmodified-Since, If-None-Match and
+// If-Modified-Since headers. It returns true when it answered the request.
 func (h *Handler) handleConditionalRequest(c echo.Context, meta model.FileMetadata, fileInfo os.FileInfo) bool {
+	// Last-Modified only has second precision, so compare against what was sent
+	modTime := fileInfo.ModTime().Truncate(time.Second)
+
+	// Handle If-Unmodified-Since, the file changed since the client's copy
+	if ifUnmodifiedSince := c.Request().Header.Get("If-Unmodified-Since"); ifUnmodifiedSince != "" {
+		if t, err := time.Parse(http.TimeFormat, ifUnmodifiedSince); err == nil && modTime.After(t) {
+			c.Response().WriteHeader(http.StatusPreconditionFailed)
+			return true
+		}
+	}
+
 	// Handle If-None-Match (ETag)
 	if ifNoneMatch := c.Request().Header.Get("If-None-Match"); ifNoneMatch != "" {
 		etag := fmt.Sprintf("\"%d-%d\"", fileInfo.Size(), fileInfo.ModTime().Unix())
@@ -187,7 +494,7 @@ func (h *Handler) handleConditionalRequest(c echo.Context, meta model.FileMetada
 	// Handle If-Modified-Since
 	if ifModifiedSince := c.Request().Header.Get("If-Modified-Since"); ifModifiedSince != "" {
 		if t, err := time.Parse(http.TimeFormat, ifModifiedSince); err == nil {
-			if !fileInfo.ModTime().After(t) {
+			if !modTime.After(t) {
 				c.Response().WriteHeader(http.StatusNotModified)
 				return true
 			}
@@ -197,17 +504,19 @@ func (h *Handler) handleConditionalRequest(c echo.Context, meta model.FileMetada
 	return false
 }
 
-// streamFileOptimized streams a file with optimized buffering
-func (h *Handler) streamFileOptimized(w http.ResponseWriter, file *os.File) (int64, error) {
-	bufferSize := h.cfg.StreamingBufferSizeToBytes()
-	if bufferSize <= 0 {
-		bufferSize = 64 * 1024 // Default 64KB
-	}
-
-	buffer := make([]byte, bufferSize)
+// streamFileOptimized streams a file with optimized buffering. The copy stops as
+// soon as ctx is done, so a disconnected client does not keep the file open.
+func (h *Handler) streamFileOptimized(ctx context.Context, w io.Writer, file io.Reader) (int64, error) {
+	bufferPtr := h.getStreamBuffer()
+	defer h.streamBuffers.Put(bufferPtr)
+	buffer := *bufferPtr
 	var totalWritten int64
 
 	for {
+		if err := ctx.Err(); err != nil {
+			return totalWritten, err
+		}
+
 		n, err := file.Read(buffer)
 		if n > 0 {
 			written, writeErr := w.Write(buffer[:n])
@@ -227,6 +536,16 @@ func (h *Handler) streamFileOptimized(w http.ResponseWriter, file *os.File) (int
 	return totalWritten, nil
 }
 
+// getStreamBuffer takes a download buffer from the pool, allocating one of the
+// configured streaming buffer size when the pool is empty
+func (h *Handler) getStreamBuffer() *[]byte {
+	if buffer, ok := h.streamBuffers.Get().(*[]byte); ok {
+		return buffer
+	}
+	buffer := make([]byte, h.cfg.StreamingBufferSizeToBytes())
+	return &buffer
+}
+
 // isLinkPreviewBot determines if the request is likely from a preview bot
 func (h *Handler) isLinkPreviewBot(req *http.Request) bool {
 	userAgent := req.Header.Get("User-Agent")
@@ -302,11 +621,80 @@ func (h *Handler) deleteOneTimeViewFile(path string, meta model.FileMetadata) er
 	if err = h.db.DeleteMetadata(&meta); err != nil {
 		log.Printf("Warning: Failed to delete metadata for one-time view file %s: %v", path, err)
 	}
+	h.deleteGroupMembers(meta)
 
 	return err
 }
 
-// validateAndResolvePath validates and resolves the file path from the request
+// reserveDownload takes one of the downloads of a file with max_downloads and
+// returns how many are taken. Files already used up but still in their
+// one_time_grace_seconds are served again without counting, like one-time
+// files, and report one more download than the limit.
+func (h *Handler) reserveDownload(path string, meta model.FileMetadata) (int, error) {
+	count, err := h.db.ReserveDownload(meta.ID(), meta.MaxDownloads)
+	if errors.Is(err, db.ErrDownloadLimitReached) && h.cfg.OneTimeGracePeriod() > 0 && meta.ExpiresAt != nil {
+		return meta.MaxDownloads + 1, nil
+	}
+	if err != nil && !errors.Is(err, db.ErrDownloadLimitReached) {
+		log.Printf("Error: Failed to count download of %s: %v", path, err)
+	}
+	return count, err
+}
+
+// releaseDownload gives back a reserved download that wasn't served in full
+func (h *Handler) releaseDownload(path string, meta model.FileMetadata) {
+	if err := h.db.ReleaseDownload(meta.ID()); err != nil {
+		log.Printf("Warning: Failed to release aborted download of %s: %v", path, err)
+	}
+}
+
+// countLimitedDownload deletes a file with max_downloads once its last allowed
+// download was served
+func (h *Handler) countLimitedDownload(path string, meta model.FileMetadata, count int) error {
+	if count < meta.MaxDownloads {
+		return nil
+	}
+	log.Printf("Download limit of %d reached for %s", meta.MaxDownloads, path)
+	return h.consumeFile(path, meta)
+}
+
+// consumeFile deletes a file whose downloads are used up. With
+// one_time_grace_seconds it expires at the end of the grace period instead,
+// so a browser fetching it twice or a retry still gets it; it is deleted
+// then, or by the expiration manager after a restart.
+func (h *Handler) consumeFile(path string, meta model.FileMetadata) error {
+	grace := h.cfg.OneTimeGracePeriod()
+	if grace <= 0 {
+		return h.deleteOneTimeViewFile(path, meta)
+	}
+
+	if err := h.db.ExpireBy(meta.ID(), time.Now().Add(grace)); err != nil {
+		log.Printf("Warning: Failed to start the grace period of %s, deleting it: %v", path, err)
+		return h.deleteOneTimeViewFile(path, meta)
+	}
+	time.AfterFunc(grace, func() {
+		h.deleteConsumedFile(path, meta.ID())
+	})
+	return nil
+}
+
+// deleteConsumedFile deletes a consumed file once its grace period is over.
+// Files replaced or given a later expiration in the meantime are kept.
+func (h *Handler) deleteConsumedFile(path, id string) {
+	meta, err := h.db.GetMetadataByID(id)
+	if err != nil || meta.ExpiresAt == nil || meta.ExpiresAt.After(time.Now()) {
+		return
+	}
+	h.deleteOneTimeViewFile(path, meta)
+}
+
+// chunkedFileSuffix names chunked uploads with no known extension. Requests for
+// the bare id resolve to it.
+const chunkedFileSuffix = "_file"
+
+// validateAndResolvePath validates and resolves the file path from the request.
+// Entries of upload_path that are no uploads, the ones reindex skips too, are
+// reported as not existing.
 func (h *Handler) validateAndResolvePath(c echo.Context) (string, error) {
 	filename := c.Param("filename")
 
@@ -314,13 +702,38 @@ func (h *Handler) validateAndResolvePath(c echo.Context) (string, error) {
 	filename = parts[0]
 	filePath := filepath.Join(h.cfg.UploadPath, filename)
 
-	if _, err := os.Stat(filePath); err != nil {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) && filepath.Ext(filename) == "" {
+		suffixedPath := filePath + chunkedFileSuffix
+		if suffixInfo, suffixErr := os.Stat(suffixedPath); suffixErr == nil {
+			filePath, info, err = suffixedPath, suffixInfo, nil
+		}
+	}
+	if err != nil {
 		return "", err
 	}
 
+	if !h.isServablePath(filePath, info) {
+		return "", &os.PathError{Op: "open", Path: filePath, Err: os.ErrNotExist}
+	}
 	return filePath, nil
 }
 
+// isServablePath reports whether an entry of upload_path may be served. Temp
+// files of uploads in progress and the SQLite database are never served,
+// directories only when they are folder uploads with metadata, chunked upload
+// sessions are not.
+func (h *Handler) isServablePath(filePath string, info os.FileInfo) bool {
+	if strings.HasSuffix(filePath, ".tmp") || h.isDatabaseFile(filePath) {
+		return false
+	}
+	if info.IsDir() {
+		exists, err := h.db.HasMetadata(filePath)
+		return err == nil && exists
+	}
+	return true
+}
+
 // getFileMetadata retrieves metadata for the specified file
 func (h *Handler) getFileMetadata(filePath string) (model.FileMetadata, error) {
 	meta, err := h.db.GetMetadataByID(filePath)
@@ -331,6 +744,54 @@ func (h *Handler) getFileMetadata(filePath string) (model.FileMetadata, error) {
 	return meta, nil
 }
 
+// forgetMissingFile deletes, in the background, the metadata of a requested
+// file that is gone from upload_path, e.g. removed by hand, instead of leaving
+// it until the next orphan sweep. Disabled by cleanup_missing_files.
+func (h *Handler) forgetMissingFile(filename string) {
+	if !h.cfg.CleanupMissingFiles {
+		return
+	}
+	filename, _, _ = strings.Cut(filename, "/")
+	if filename == "" || filename == "." || filename == ".." {
+		return
+	}
+	filePath := filepath.Join(h.cfg.UploadPath, filename)
+	paths := []string{filePath}
+	if filepath.Ext(filename) == "" {
+		paths = append(paths, filePath+chunkedFileSuffix)
+	}
+
+	go func() {
+		for _, path := range paths {
+			meta, err := h.db.GetMetadataByID(path)
+			if err != nil || meta.IsURLShortener {
+				continue
+			}
+			// Check again, the file may have been uploaded again meanwhile
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				continue
+			}
+			if err := h.db.DeleteMetadata(&meta); err != nil {
+				log.Printf("Warning: Failed to delete metadata of missing file %s: %v", path, err)
+				continue
+			}
+			if meta.ThumbnailPath != "" {
+				os.Remove(meta.ThumbnailPath)
+			}
+			log.Printf("Deleted metadata of missing file %s", path)
+		}
+	}()
+}
+
+// legacyFileMetadata describes a file that exists on disk without a metadata row
+func (h *Handler) legacyFileMetadata(filePath string) model.FileMetadata {
+	return model.FileMetadata{
+		ResourcePath: filePath,
+		OriginalName: filepath.Base(filePath),
+		ContentType:  h.detectContentType(filePath),
+	}
+}
+
 // setResponseHeaders sets appropriate response headers based on file metadata
 func (h *Handler) setResponseHeaders(c echo.Context, meta model.FileMetadata, fileInfo os.FileInfo) {
 	contentType := "application/octet-stream"
@@ -345,13 +806,15 @@ func (h *Handler) setResponseHeaders(c echo.Context, meta model.FileMetadata, fi
 	}
 
 	c.Response().Header().Set("Content-Type", contentType)
+	c.Response().Header().Set("Last-Modified", fileInfo.ModTime().UTC().Format(http.TimeFormat))
 
 	// Enable range requests for better streaming
 	c.Response().Header().Set("Accept-Ranges", "bytes")
+	c.Response().Header().Set("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
 
 	// Add caching headers for better performance
-	// For one-time files, no caching
-	if meta.OneTimeView {
+	// For files consumed by downloads or protected by a password, no caching
+	if meta.LimitsDownloads() || meta.HasPassword() {
 		c.Response().Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 		c.Response().Header().Set("Pragma", "no-cache")
 		c.Response().Header().Set("Expires", "0")
@@ -365,30 +828,177 @@ func (h *Handler) setResponseHeaders(c echo.Context, meta model.FileMetadata, fi
 		c.Response().Header().Set("X-One-Time-View", "true")
 	}
 
+	// Keep random file URLs out of search engines unless indexing is allowed
+	if !h.cfg.AllowIndexing || meta.NoIndex {
+		c.Response().Header().Set("X-Robots-Tag", "noindex, nofollow")
+	}
+
 	log.Printf("Content-Type: %s", contentType)
 
-	// Set content disposition based on content type
-	if shouldDisplayInline(contentType) {
-		c.Response().Header().Set("Content-Disposition", "inline")
+	// Files stored encoded are sent as they are to clients accepting the
+	// encoding. Text-based content is gzipped for clients accepting it, see
+	// gzipResponse.
+	if meta.ContentEncoding != "" {
+		addVary(c, "Accept-Encoding")
+		if acceptsGzip(c.Request()) {
+			c.Response().Header().Set("Content-Encoding", meta.ContentEncoding)
+		} else {
+			c.Response().Header().Set("Accept-Ranges", "none")
+			c.Response().Header().Del("Content-Length")
+		}
+	} else if shouldCompress(contentType) {
+		addVary(c, "Accept-Encoding")
+	}
+}
+
+// gzipResponse starts gzip encoding a full response for a compressible type
+// when the client accepts it, returning nil otherwise. Range responses are
+// never compressed since their byte offsets refer to the stored file. The
+// writer must be closed after the body is written.
+func (h *Handler) gzipResponse(c echo.Context, contentType string) *gzip.Writer {
+	if !shouldCompress(contentType) || !acceptsGzip(c.Request()) {
+		return nil
+	}
+
+	gz, err := gzip.NewWriterLevel(c.Response(), h.cfg.GzipCompressionLevel())
+	if err != nil {
+		log.Printf("Warning: Failed to create gzip writer: %v", err)
+		return nil
+	}
+
+	// The compressed length isn't known up front
+	header := c.Response().Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+	return gz
+}
+
+// acceptsGzip reports whether Accept-Encoding allows gzip, by name or with *.
+// gzip;q=0 refuses it even when * is accepted.
+func acceptsGzip(req *http.Request) bool {
+	accepted := false
+	for _, value := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(value, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "x-gzip" && coding != "*" {
+			continue
+		}
+
+		refused := false
+		if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			refused = err == nil && weight == 0
+		}
+		if coding != "*" && refused {
+			return false
+		}
+		accepted = accepted || !refused
+	}
+	return accepted
+}
+
+// contentDisposition picks inline or attachment for the file. Known inline types
+// are displayed, ambiguous types use the configured default and everything else
+// is downloaded.
+func (h *Handler) contentDisposition(meta model.FileMetadata) string {
+	disposition := "attachment"
+	if h.canRenderInline(meta.ContentType) {
+		disposition = "inline"
+	} else if isAmbiguousContentType(meta.ContentType) {
+		disposition = h.cfg.DefaultDisposition()
+	}
+	return formatDisposition(disposition, meta.OriginalName)
+}
+
+// formatDisposition builds a Content-Disposition value naming the file. Names
+// that aren't plain ASCII get an ASCII filename for old clients plus the exact
+// name as an RFC 5987 filename* parameter, which clients prefer. Control
+// characters are dropped so a name can't break out of the header.
+func formatDisposition(disposition, name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	fallback := strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r > unicode.MaxASCII {
+			return '_'
+		}
+		return r
+	}, name)
+
+	value := disposition + "; filename=\"" + fallback + "\""
+	if fallback != name {
+		value += "; filename*=UTF-8''" + encodeRFC5987(name)
 	}
+	return value
+}
 
-	// Add compression for text-based content types
-	if shouldCompress(contentType) {
-		c.Response().Header().Set("Content-Encoding", "gzip")
+// encodeRFC5987 percent-encodes every byte outside the attr-char set of RFC 5987
+func encodeRFC5987(s string) string {
+	const attrChars = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || strings.IndexByte(attrChars, ch) >= 0 {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
 	}
+	return b.String()
 }
 
-// shouldDisplayInline determines if the content should be displayed inline in the browser
-func shouldDisplayInline(contentType string) bool {
-	return strings.HasPrefix(contentType, "video/") ||
-		strings.HasPrefix(contentType, "audio/") ||
-		strings.HasPrefix(contentType, "image/") ||
-		contentType == "application/pdf" ||
-		strings.HasPrefix(contentType, "text/")
+// isAmbiguousContentType reports whether the content type says nothing about how to present the file
+func isAmbiguousContentType(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	return mediaType == "" || mediaType == "application/octet-stream"
+}
+
+// neverInlineTypes can run scripts in the site's origin when rendered, so they
+// are always downloaded whatever inline_content_types allows
+var neverInlineTypes = map[string]bool{
+	"text/html":              true,
+	"application/xhtml+xml":  true,
+	"image/svg+xml":          true,
+	"text/xml":               true,
+	"application/xml":        true,
+	"text/xsl":               true,
+	"text/javascript":        true,
+	"application/javascript": true,
+}
+
+// canRenderInline reports whether a file of this content type may be shown in
+// the browser. Any type can still be downloaded as an attachment.
+func (h *Handler) canRenderInline(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	if mediaType == "" || neverInlineTypes[mediaType] {
+		return false
+	}
+
+	return matchesContentType(h.cfg.InlineTypes(), mediaType)
+}
+
+// matchesContentType reports whether the media type is listed in patterns, as
+// an exact type or a "type/*" wildcard
+func matchesContentType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasSuffix(prefix, "/") && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // shouldCompress determines if the content type should be compressed
 func shouldCompress(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
 	return strings.HasPrefix(contentType, "text/") ||
 		contentType == "application/json" ||
 		contentType == "application/xml" ||
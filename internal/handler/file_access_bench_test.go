@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/marianozunino/drop/internal/config"
+)
+
+// Representative download sizes: a small text paste, a photo and a larger archive
+var benchFileSizes = []int{64 << 10, 1 << 20, 16 << 20}
+
+// benchPayload returns size bytes of half text, half random data so neither
+// compression nor copying gets an unrealistically easy input
+func benchPayload(size int) []byte {
+	words := strings.Fields("upload file server token expires download chunk link secret " +
+		"the a of to and in is for on with request response header content length")
+	rng := rand.New(rand.NewSource(1))
+
+	var text bytes.Buffer
+	for text.Len() < size/2 {
+		text.WriteString(words[rng.Intn(len(words))])
+		text.WriteByte(" \n"[rng.Intn(10)/9])
+	}
+
+	random := make([]byte, size-size/2)
+	rng.Read(random)
+	return append(text.Bytes()[:size/2], random...)
+}
+
+// benchFile writes the payload to disk so reads go through the OS like real downloads
+func benchFile(b *testing.B, payload []byte) *os.File {
+	b.Helper()
+	path := filepath.Join(b.TempDir(), "bench.bin")
+	if err := os.WriteFile(path, payload, 0644); err != nil {
+		b.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { file.Close() })
+	return file
+}
+
+func BenchmarkStreamFile(b *testing.B) {
+	for _, size := range benchFileSizes {
+		payload := benchPayload(size)
+		for _, bufferKB := range []int{4, 16, 64, 256, 1024} {
+			h := &Handler{cfg: &config.Config{StreamingBufferSize: bufferKB}}
+			b.Run(fmt.Sprintf("file=%dKB/buffer=%dKB", size>>10, bufferKB), func(b *testing.B) {
+				file := benchFile(b, payload)
+				w := discardResponseWriter{httptest.NewRecorder()}
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := file.Seek(0, io.SeekStart); err != nil {
+						b.Fatal(err)
+					}
+					if _, err := h.streamFileOptimized(context.Background(), w, file); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkStreamFileConcurrent serves many small downloads in parallel, where
+// pooled buffers keep allocations per download near zero
+func BenchmarkStreamFileConcurrent(b *testing.B) {
+	payload := benchPayload(64 << 10)
+	h := &Handler{cfg: &config.Config{StreamingBufferSize: config.DefaultStreamingBufferKB}}
+
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		w := discardResponseWriter{httptest.NewRecorder()}
+		reader := bytes.NewReader(payload)
+		for pb.Next() {
+			reader.Reset(payload)
+			if _, err := h.streamFileOptimized(context.Background(), w, reader); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkGzipTransformer(b *testing.B) {
+	for _, size := range benchFileSizes {
+		payload := benchPayload(size)
+		for _, level := range []int{gzip.BestSpeed, 3, config.DefaultGzipLevel, gzip.BestCompression} {
+			t := &GzipTransformer{Level: level}
+			b.Run(fmt.Sprintf("file=%dKB/level=%d", size>>10, level), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				var compressed int64
+				for i := 0; i < b.N; i++ {
+					r, err := t.Transform(bytes.NewReader(payload), &FileInfo{})
+					if err != nil {
+						b.Fatal(err)
+					}
+					if compressed, err = io.Copy(io.Discard, r); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(compressed)/float64(size), "ratio")
+			})
+		}
+	}
+}
+
+// discardResponseWriter drops the body so the benchmark measures the copy loop
+type discardResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w discardResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/marianozunino/drop/internal/model"
 	"github.com/marianozunino/drop/internal/utils"
+	"github.com/marianozunino/drop/internal/webhook"
 )
 
 // HandleFileManagement handles file management operations (delete, update expiration)
@@ -25,59 +27,115 @@ func (h *Handler) HandleFileManagement(c echo.Context) error {
 	}
 
 	token := c.FormValue("token")
+	if token == "" && c.FormValue("password") != "" {
+		// Sent by the password page of a protected file
+		return h.HandleFileAccess(c)
+	}
+	if token == "" {
+		log.Printf("Missing management token for %s by %s", filename, c.RealIP())
+		return c.String(http.StatusBadRequest, "Missing management token")
+	}
+
+	meta, err := h.authorizeManagementToken(c, filename, token)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "Invalid management token")
+	}
+
+	if _, deleteRequested := c.Request().Form["delete"]; deleteRequested {
+		return h.deleteManagedResource(c, filename, meta)
+	}
+
+	if expiresStr := c.FormValue("expires"); expiresStr != "" {
+		return h.handleExpirationUpdate(c, expiresStr, meta)
+	}
+
+	return c.String(http.StatusBadRequest, "No valid operation specified. Use 'delete' or 'expires'.")
+}
+
+// HandleDelete handles DELETE requests for files and URL shorteners.
+// The management token is read from the X-Token or Authorization header,
+// falling back to the token query parameter.
+func (h *Handler) HandleDelete(c echo.Context) error {
+	filename := c.Param("filename")
+	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+		return c.String(http.StatusBadRequest, "Invalid file path")
+	}
+
+	token := managementTokenFromRequest(c)
 	if token == "" {
 		log.Printf("Missing management token for %s by %s", filename, c.RealIP())
 		return c.String(http.StatusBadRequest, "Missing management token")
 	}
 
+	meta, err := h.authorizeManagementToken(c, filename, token)
+	if err != nil {
+		return c.String(http.StatusUnauthorized, "Invalid management token")
+	}
+
+	return h.deleteManagedResource(c, filename, meta)
+}
+
+// managementTokenFromRequest extracts the management token from headers or query
+func managementTokenFromRequest(c echo.Context) string {
+	if token := c.Request().Header.Get("X-Token"); token != "" {
+		return token
+	}
+	if auth := c.Request().Header.Get("Authorization"); auth != "" {
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			return strings.TrimSpace(auth[7:])
+		}
+		return strings.TrimSpace(auth)
+	}
+	return c.QueryParam("token")
+}
+
+// authorizeManagementToken looks up the token and verifies it belongs to the requested resource
+func (h *Handler) authorizeManagementToken(c echo.Context, filename, token string) (model.FileMetadata, error) {
 	meta, err := h.db.GetMetadataByToken(token)
 	if err != nil {
 		log.Printf("Invalid management token for %s by %s: %v", filename, c.RealIP(), err)
-		return c.String(http.StatusUnauthorized, "Invalid management token")
+		return model.FileMetadata{}, err
 	}
 
 	// Verify that the token belongs to the requested resource
 	// For URL shorteners, check if the filename matches the ResourcePath
 	// For regular files, check if the filename matches the ResourcePath (without extension)
+	owner := meta.ResourcePath
 	if meta.IsFile() {
-		expectedFilename := filepath.Base(meta.ResourcePath)
-		if expectedFilename != filename {
-			log.Printf("Token mismatch: token belongs to %s but requested %s", expectedFilename, filename)
-			return c.String(http.StatusUnauthorized, "Invalid management token")
-		}
-	} else {
-		if meta.ResourcePath != filename {
-			log.Printf("Token mismatch: token belongs to %s but requested %s", meta.ResourcePath, filename)
-			return c.String(http.StatusUnauthorized, "Invalid management token")
-		}
+		owner = filepath.Base(meta.ResourcePath)
 	}
-
-	if _, deleteRequested := c.Request().Form["delete"]; deleteRequested {
-		if meta.IsURLShortener {
-			return h.handleURLShortenerDelete(c, filename, meta)
-		} else if meta.IsFile() {
-			filePath := meta.ResourcePath
-			if _, err := os.Stat(filePath); os.IsNotExist(err) {
-				log.Printf("Physical file %s not found, cleaning up metadata", filePath)
-				if err := h.db.DeleteMetadata(&meta); err != nil {
-					log.Printf("Warning: Failed to delete orphaned metadata for %s: %v", filename, err)
-				}
-				return c.String(http.StatusNotFound, "File not found")
-			}
-			return h.handleFileDelete(c, filePath, meta)
-		}
+	if owner != filename {
+		log.Printf("Token mismatch: token belongs to %s but requested %s", owner, filename)
+		return model.FileMetadata{}, fmt.Errorf("token does not belong to %s", filename)
 	}
 
-	if expiresStr := c.FormValue("expires"); expiresStr != "" {
-		return h.handleExpirationUpdate(c, expiresStr, meta)
+	return meta, nil
+}
+
+// deleteManagedResource deletes a file or URL shortener after the token has been verified
+func (h *Handler) deleteManagedResource(c echo.Context, filename string, meta model.FileMetadata) error {
+	if meta.IsURLShortener {
+		return h.handleURLShortenerDelete(c, filename, meta)
 	}
 
-	return c.String(http.StatusBadRequest, "No valid operation specified. Use 'delete' or 'expires'.")
+	filePath := meta.ResourcePath
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		log.Printf("Physical file %s not found, cleaning up metadata", filePath)
+		if err := h.db.DeleteMetadata(&meta); err != nil {
+			log.Printf("Warning: Failed to delete orphaned metadata for %s: %v", filename, err)
+		}
+		return c.String(http.StatusNotFound, "File not found")
+	}
+	return h.handleFileDelete(c, filePath, meta)
 }
 
-// parseRequestForm attempts to parse the request form
+// parseRequestForm attempts to parse the request form. A body over the size
+// limit is reported as *http.MaxBytesError.
 func (h *Handler) parseRequestForm(c echo.Context) error {
 	if err := c.Request().ParseMultipartForm(32 << 20); err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) {
+			return err
+		}
 		return c.Request().ParseForm()
 	}
 	return nil
@@ -85,7 +143,7 @@ func (h *Handler) parseRequestForm(c echo.Context) error {
 
 // handleFileDelete handles the file deletion operation
 func (h *Handler) handleFileDelete(c echo.Context, filePath string, meta model.FileMetadata) error {
-	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+	if err := removeStoredUpload(meta); err != nil && !os.IsNotExist(err) {
 		log.Printf("Error: Failed to delete file %s for user %s: %v", filePath, c.RealIP(), err)
 		return c.String(http.StatusInternalServerError, "Failed to delete file")
 	}
@@ -93,6 +151,8 @@ func (h *Handler) handleFileDelete(c echo.Context, filePath string, meta model.F
 	if err := h.db.DeleteMetadata(&meta); err != nil {
 		log.Printf("Warning: Failed to delete metadata for %s by user %s: %v", filePath, c.RealIP(), err)
 	}
+	h.deleteGroupMembers(meta)
+	h.webhooks.Notify(webhook.EventDelete, meta)
 
 	log.Printf("File deleted: %s by %s", filePath, c.RealIP())
 	return c.String(http.StatusOK, "File deleted successfully")
@@ -100,7 +160,7 @@ func (h *Handler) handleFileDelete(c echo.Context, filePath string, meta model.F
 
 // handleExpirationUpdate handles updating the file expiration time
 func (h *Handler) handleExpirationUpdate(c echo.Context, expiresStr string, meta model.FileMetadata) error {
-	expirationDate, err := utils.ParseExpirationTime(expiresStr)
+	expirationDate, err := utils.ParseExpirationTimeWithFloor(expiresStr, h.cfg.MinExpiration())
 	if err != nil {
 		log.Printf("Invalid expiration format for %s by %s: %v", meta.ResourcePath, c.RealIP(), err)
 		return c.String(http.StatusBadRequest, fmt.Sprintf("Invalid expiration format: %v", err))
@@ -125,6 +185,8 @@ func (h *Handler) handleURLShortenerDelete(c echo.Context, shortID string, meta
 		log.Printf("Warning: Failed to delete metadata for URL shortener %s by user %s: %v", shortID, c.RealIP(), err)
 		return c.String(http.StatusInternalServerError, "Failed to delete URL shortener")
 	}
+	h.deleteGroupMembers(meta)
+	h.webhooks.Notify(webhook.EventDelete, meta)
 
 	log.Printf("URL shortener deleted: %s by %s", shortID, c.RealIP())
 	return c.String(http.StatusOK, "URL shortener deleted successfully")
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/db"
+	"github.com/marianozunino/drop/internal/model"
+)
+
+// FileMetaResponse is the public description of a stored file served at /:filename/meta.json
+type FileMetaResponse struct {
+	URL         string     `json:"url"`
+	Name        string     `json:"name"`
+	Size        int64      `json:"size"`
+	ContentType string     `json:"content_type"`
+	MD5         string     `json:"md5,omitempty"`
+	UploadedAt  time.Time  `json:"uploaded_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+
+	// Downloads need the file's password
+	PasswordProtected bool `json:"password_protected,omitempty"`
+
+	// Only shown to the holder of the management token
+	OneTimeView  *bool  `json:"one_time_view,omitempty"`
+	AccessCount  *int   `json:"access_count,omitempty"`
+	BytesServed  *int64 `json:"bytes_served,omitempty"`
+	MaxDownloads *int   `json:"max_downloads,omitempty"`
+}
+
+// HandleFileMeta describes a file without downloading it. Viewing it never
+// consumes a one-time file. Password protected files are only described to
+// requests with the password or the management token, and expired ones not at all.
+func (h *Handler) HandleFileMeta(c echo.Context) error {
+	filename := c.Param("filename")
+	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+		return c.String(http.StatusBadRequest, "Invalid file path")
+	}
+
+	filePath, err := h.validateAndResolvePath(c)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "File not found"})
+	}
+	filename = filepath.Base(filePath)
+
+	meta, err := h.db.GetMetadataByID(filePath)
+	if errors.Is(err, db.ErrNotFound) {
+		meta = h.legacyFileMetadata(filePath)
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get metadata"})
+	}
+
+	if meta.ExpiresAt != nil && meta.ExpiresAt.Before(time.Now()) {
+		return c.JSON(http.StatusGone, map[string]string{"error": "File has expired"})
+	}
+
+	owner := h.hasManagementToken(c, filename)
+	if meta.HasPassword() && !owner {
+		c.Response().Header().Set("Cache-Control", "no-store")
+		wait, err := h.verifyFilePassword(c, meta)
+		if wait > 0 {
+			return passwordLockoutResponse(c, wait)
+		}
+		if err != nil {
+			message := "Password required"
+			if errors.Is(err, errPasswordWrong) {
+				message = "Wrong password"
+			}
+			return c.JSON(http.StatusUnauthorized, map[string]interface{}{
+				"error":              message,
+				"password_protected": true,
+			})
+		}
+	}
+
+	response := FileMetaResponse{
+		URL:         joinURL(h.cfg.BaseURL, filename),
+		Name:        meta.OriginalName,
+		Size:        meta.Size,
+		ContentType: meta.ContentType,
+		MD5:         meta.ContentHash,
+		UploadedAt:  meta.UploadDate,
+		ExpiresAt:   meta.ExpiresAt,
+
+		PasswordProtected: meta.HasPassword(),
+	}
+
+	if owner {
+		response.OneTimeView = &meta.OneTimeView
+		response.AccessCount = &meta.AccessCount
+		response.BytesServed = &meta.BytesServed
+		if meta.MaxDownloads > 0 {
+			response.MaxDownloads = &meta.MaxDownloads
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// setLinkHeaders advertises related resources of a file download. The
+// management and stats links are only added for requests carrying the file's
+// token: the file URL takes POST and DELETE, and meta.json includes the
+// download counts for the owner.
+func (h *Handler) setLinkHeaders(c echo.Context, filename string, meta model.FileMetadata) {
+	fileURL := joinURL(h.cfg.BaseURL, filename)
+	header := c.Response().Header()
+
+	header.Add("Link", fmt.Sprintf(`<%s/meta.json>; rel="describedby"; type="application/json"`, fileURL))
+
+	if hasThumbnail(meta) {
+		header.Add("Link", fmt.Sprintf(`<%s/thumb>; rel="preview"; type="image/jpeg"`, fileURL))
+	}
+
+	if h.hasManagementToken(c, filename) {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="edit management"`, fileURL))
+		header.Add("Link", fmt.Sprintf(`<%s/meta.json>; rel="stats"; type="application/json"`, fileURL))
+	}
+}
+
+// hasManagementToken reports whether the request carries a valid management token for filename
+func (h *Handler) hasManagementToken(c echo.Context, filename string) bool {
+	token := managementTokenFromRequest(c)
+	if token == "" {
+		return false
+	}
+	_, err := h.authorizeManagementToken(c, filename, token)
+	return err == nil
+}
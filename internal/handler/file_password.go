@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/model"
+	"github.com/marianozunino/drop/templates"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength is the longest password bcrypt can hash
+const maxPasswordLength = 72
+
+// requestPassword reads the password form field of an upload, the password
+// needed to download the file
+func requestPassword(c echo.Context) (string, error) {
+	password := c.Request().Form.Get("password")
+	if len(password) > maxPasswordLength {
+		return "", errors.New("password is too long, use at most 72 bytes")
+	}
+	return password, nil
+}
+
+// hashRequestPassword returns the bcrypt hash of the upload's password, or an
+// empty string when the upload has none
+func hashRequestPassword(c echo.Context) (string, error) {
+	password, err := requestPassword(c)
+	if err != nil || password == "" {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// providedPassword returns the password sent with a download, from Basic
+// authentication (any user name) or the password query or form value
+func providedPassword(c echo.Context) string {
+	if _, password, ok := c.Request().BasicAuth(); ok {
+		return password
+	}
+	return c.FormValue("password")
+}
+
+// Reasons verifyFilePassword turns a request away
+var (
+	errPasswordMissing = errors.New("password required")
+	errPasswordWrong   = errors.New("wrong password")
+)
+
+// verifyFilePassword checks the password sent for a protected file. A client
+// locked out by password_max_attempts gets the time left; wrong passwords count
+// towards the lockout and may start it.
+func (h *Handler) verifyFilePassword(c echo.Context, meta model.FileMetadata) (time.Duration, error) {
+	id, ip := meta.ID(), c.RealIP()
+	if wait := h.passwords.lockedFor(id, ip); wait > 0 {
+		return wait, nil
+	}
+
+	password := providedPassword(c)
+	if password == "" {
+		return 0, errPasswordMissing
+	}
+	if bcrypt.CompareHashAndPassword([]byte(meta.PasswordHash), []byte(password)) != nil {
+		if h.passwords.fail(id, ip) {
+			return h.passwords.window, nil
+		}
+		return 0, errPasswordWrong
+	}
+
+	h.passwords.succeed(id, ip)
+	return 0, nil
+}
+
+// checkFilePassword lets downloads with the file's password through and answers
+// all others, reporting whether the file may be served
+func (h *Handler) checkFilePassword(c echo.Context, meta model.FileMetadata) (bool, error) {
+	wait, err := h.verifyFilePassword(c, meta)
+	switch {
+	case wait > 0:
+		return false, passwordLockoutResponse(c, wait)
+	case err != nil:
+		return false, h.passwordRequired(c, errors.Is(err, errPasswordWrong))
+	}
+	return true, nil
+}
+
+// passwordRequired answers a download without the right password with 401.
+// Browsers get a page asking for the password, other clients are asked for
+// Basic authentication.
+func (h *Handler) passwordRequired(c echo.Context, failed bool) error {
+	header := c.Response().Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-Robots-Tag", "noindex, nofollow")
+	addVary(c, "Accept")
+
+	if !strings.Contains(strings.ToLower(c.Request().Header.Get("Accept")), "text/html") {
+		header.Set("WWW-Authenticate", `Basic realm="drop", charset="UTF-8"`)
+		if failed {
+			return c.String(http.StatusUnauthorized, "Wrong password")
+		}
+		return c.String(http.StatusUnauthorized, "Password required")
+	}
+
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	c.Response().WriteHeader(http.StatusUnauthorized)
+	action := joinURL(h.cfg.BaseURL, c.Param("filename"))
+	return templates.PasswordPrompt(action, failed).Render(c.Request().Context(), c.Response())
+}
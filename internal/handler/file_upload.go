@@ -1,11 +1,18 @@
 package handler
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
@@ -17,8 +24,12 @@ import (
 
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/expiration"
 	"github.com/marianozunino/drop/internal/model"
+	"github.com/marianozunino/drop/internal/qrcode"
 	"github.com/marianozunino/drop/internal/utils"
+	"github.com/marianozunino/drop/internal/webhook"
+	"github.com/marianozunino/drop/templates"
 )
 
 const (
@@ -32,13 +43,61 @@ const (
 var filenameSanitizer = regexp.MustCompile(`[^a-zA-Z0-9._-]`) // allow only safe chars
 
 func (h *Handler) HandleUpload(c echo.Context) error {
-	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, h.cfg.MaxSizeToBytes())
+	if h.MaintenanceMode() {
+		return h.maintenanceResponse(c, false)
+	}
+
+	policy, err := h.resolveUploadPolicy(c)
+	if err != nil {
+		log.Printf("[HandleUpload] Rejected upload from %s: %v", c.RealIP(), err)
+		return c.String(http.StatusUnauthorized, "Invalid API key")
+	}
+
+	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, policy.MaxSize)
 
 	if err := h.parseRequestForm(c); err != nil {
 		log.Printf("[HandleUpload] Failed to parse form: %v", err)
+		if errors.As(err, new(*http.MaxBytesError)) {
+			return c.String(http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("File too large (max %d bytes)", policy.MaxSize))
+		}
 		return c.String(http.StatusBadRequest, "Invalid request form.")
 	}
 
+	if err := h.checkProofOfWork(c); err != nil {
+		log.Printf("[HandleUpload] Rejected upload from %s: %v", c.RealIP(), err)
+		return c.String(http.StatusForbidden, err.Error())
+	}
+
+	if err := h.applyUploadOptions(c); err != nil {
+		log.Printf("[HandleUpload] Invalid upload options: %v", err)
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.resolveGroupID(c); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := requestMaxDownloads(c); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := requestSlug(c); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := requestOnConflict(c); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := h.requestContentEncoding(c); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := requestPassword(c); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
 	if c.FormValue("shorten") != "" {
 		if !h.cfg.URLShorteningEnabled {
 			return c.String(http.StatusBadRequest, "URL shortening feature is disabled")
@@ -46,29 +105,91 @@ func (h *Handler) HandleUpload(c echo.Context) error {
 		return h.HandleURLShortening(c)
 	}
 
-	fileInfo, err := h.extractFileContent(c)
+	if isFolderUpload(c) {
+		return h.handleFolderUpload(c, policy)
+	}
+
+	fileInfo, err := h.extractFileContent(c, policy)
+	if errors.Is(err, errSlugTaken) {
+		return c.String(http.StatusConflict, err.Error())
+	}
+	if errors.Is(err, errSlugNotOwned) {
+		return c.String(http.StatusForbidden, err.Error())
+	}
+	if errors.Is(err, errSlugReserved) {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, errUploadTooLarge) {
+		return h.uploadTooLarge(c, fileInfo, policy.MaxSize)
+	}
+	if errors.Is(err, errContentTypeNotAllowed) {
+		return c.String(http.StatusUnsupportedMediaType, err.Error())
+	}
 	if err != nil {
 		log.Printf("[HandleUpload] Failed to extract file content: %v", err)
 		return c.String(http.StatusBadRequest, "Failed to extract file from request.")
 	}
 
 	if fileInfo.Size == 0 {
+		if err := os.Remove(fileInfo.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("[HandleUpload] Failed to remove empty file: %v", err)
+		}
 		return c.String(http.StatusBadRequest, "Empty file")
 	}
 
-	if fileInfo.Size > h.cfg.MaxSizeToBytes() {
-		return c.String(http.StatusBadRequest,
-			fmt.Sprintf("File too large (max %d bytes)", h.cfg.MaxSizeToBytes()))
+	if err := h.applyContentEncoding(c, &fileInfo); err != nil {
+		if removeErr := os.Remove(fileInfo.FilePath); removeErr != nil && !os.IsNotExist(removeErr) {
+			log.Printf("[HandleUpload] Failed to remove rejected file: %v", removeErr)
+		}
+		if errors.Is(err, errContentTypeNotAllowed) {
+			return c.String(http.StatusUnsupportedMediaType, err.Error())
+		}
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	if err := h.appendDetectedExtension(&fileInfo); err != nil {
+		log.Printf("Warning: Failed to append detected extension to %s: %v", fileInfo.StoredFilename, err)
+	}
+
+	if fileInfo.Size > policy.MaxSize {
+		return h.uploadTooLarge(c, fileInfo, policy.MaxSize)
 	}
 
-	expirationDate, err := h.determineExpiration(c, fileInfo.Size)
+	expirationDate, err := h.determineExpiration(c, fileInfo.Size, policy.Limits)
 	if err != nil {
+		if removeErr := os.Remove(fileInfo.FilePath); removeErr != nil && !os.IsNotExist(removeErr) {
+			log.Printf("[HandleUpload] Failed to remove rejected file: %v", removeErr)
+		}
+		if errors.Is(err, errExpirationRequired) {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
 		log.Printf("[HandleUpload] Invalid expiration format: %v", err)
 		return c.String(http.StatusBadRequest, "Invalid expiration format.")
 	}
 
 	_, oneTimeView := c.Request().Form["one_time"]
 
+	if fileInfo.ContentHash == "" {
+		if fileInfo.ContentHash, err = utils.CalculateMD5(fileInfo.FilePath); err != nil {
+			log.Printf("Warning: Failed to calculate MD5 for %s: %v", fileInfo.StoredFilename, err)
+		}
+	}
+	if fileInfo.SHA256 == "" {
+		if fileInfo.SHA256, err = utils.CalculateSHA256(fileInfo.FilePath); err != nil {
+			log.Printf("Warning: Failed to calculate SHA-256 for %s: %v", fileInfo.StoredFilename, err)
+		}
+	}
+
+	if fileInfo.Overwrites != "" {
+		if err := h.replaceSlugFile(&fileInfo); err != nil {
+			log.Printf("[HandleUpload] Failed to overwrite %s: %v", fileInfo.Overwrites, err)
+			if removeErr := os.Remove(fileInfo.FilePath); removeErr != nil && !os.IsNotExist(removeErr) {
+				log.Printf("[HandleUpload] Failed to remove rejected file: %v", removeErr)
+			}
+			return c.String(http.StatusInternalServerError, "Server error")
+		}
+	}
+
 	managementToken, err := h.storeFileMetadata(fileInfo.FilePath, fileInfo.OriginalFilename, fileInfo, expirationDate, oneTimeView, c)
 	if err != nil {
 		log.Printf("[HandleUpload] Failed to store metadata: %v", err)
@@ -79,7 +200,16 @@ func (h *Handler) HandleUpload(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "Server error")
 	}
 
-	if err := h.sendUploadResponse(c, fileInfo.StoredFilename, fileInfo.Size, managementToken, expirationDate); err != nil {
+	scanStatus, err := h.scanUpload(fileInfo.FilePath)
+	if err != nil {
+		log.Printf("[HandleUpload] Rejected %s: %v", fileInfo.OriginalFilename, err)
+		return c.String(scanFailureResponse(err))
+	}
+	if scanStatus != ScanPending {
+		h.queueThumbnail(fileInfo.FilePath)
+	}
+
+	if err := h.sendUploadResponse(c, fileInfo, managementToken, expirationDate, scanStatus); err != nil {
 		log.Printf("[HandleUpload] Failed to send upload response: %v", err)
 		if removeErr := os.Remove(fileInfo.FilePath); removeErr != nil {
 			log.Printf("[HandleUpload] Failed to clean up file after response error: %v", removeErr)
@@ -96,15 +226,25 @@ func (h *Handler) HandleUpload(c echo.Context) error {
 // OriginalFilename: Name as uploaded by the user
 // Size: File size in bytes
 // ContentType: MIME type
+// ContentHash: MD5 hex digest of the stored content
+// SHA256: SHA-256 hex digest of the stored content
+// ContentEncoding: Encoding the stored content is served with, see content_encoding
+// Overwrites: Filename of the upload this one replaces once accepted, see on_conflict
 type FileInfo struct {
 	FilePath         string // Path where file was saved
 	StoredFilename   string // Final filename (with extension)
 	OriginalFilename string // Original filename from user
 	Size             int64
 	ContentType      string
+	ContentHash      string
+	SHA256           string
+	ContentEncoding  string
+	Overwrites       string
+	KeepOriginal     bool // Skips format conversions like heic_jpeg
+	PublicID         bool // Stored under a random, non-secret id
 }
 
-func (h *Handler) extractFileContent(c echo.Context) (FileInfo, error) {
+func (h *Handler) extractFileContent(c echo.Context, policy uploadPolicy) (FileInfo, error) {
 	if c.FormValue("shorten") != "" {
 		return FileInfo{}, fmt.Errorf("URL shortening request - handled separately")
 	}
@@ -112,27 +252,32 @@ func (h *Handler) extractFileContent(c echo.Context) (FileInfo, error) {
 	file, header, err := c.Request().FormFile("file")
 	if err == nil {
 		defer file.Close()
-		return h.saveFromFormFile(file, header)
+		_, useSecretId := c.Request().Form["secret"]
+		return h.saveFromFormFile(file, header, policy.MaxSize, requestSlugTarget(c), useSecretId, c.FormValue("keep_original") != "")
 	}
 
-	return h.downloadFromURL(c)
+	return h.downloadFromURL(c, policy.MaxSize)
 }
 
-func (h *Handler) saveFromFormFile(file io.Reader, header *multipart.FileHeader) (FileInfo, error) {
-	useSecretId := false
-	id, err := h.generateFileID(useSecretId)
+// saveFromFormFile stores an uploaded file under a random id, or under the
+// slug when one was requested. keepOriginal skips format conversions.
+func (h *Handler) saveFromFormFile(file io.Reader, header *multipart.FileHeader, maxSize int64, slug slugTarget, useSecretId, keepOriginal bool) (FileInfo, error) {
+	id, filename, overwrites, err := h.uploadFilename(slug, filepath.Ext(header.Filename), useSecretId)
 	if err != nil {
-		return FileInfo{}, fmt.Errorf("failed to generate ID: %w", err)
-	}
-
-	fileExt := filepath.Ext(header.Filename)
-	filename := id
-	if fileExt != "" {
-		filename += fileExt
+		return FileInfo{}, err
 	}
 
 	filePath := filepath.Join(h.cfg.UploadPath, filename)
 
+	fileInfo := FileInfo{
+		FilePath:         filePath,
+		StoredFilename:   filename,
+		OriginalFilename: header.Filename,
+		Overwrites:       overwrites,
+		KeepOriginal:     keepOriginal,
+		PublicID:         !useSecretId && slug.slug == "",
+	}
+
 	tmpFilePath := filePath + ".tmp"
 	dst, err := os.OpenFile(tmpFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
 	if err != nil {
@@ -142,8 +287,20 @@ func (h *Handler) saveFromFormFile(file io.Reader, header *multipart.FileHeader)
 	progressReader := NewSimpleProgressReader(file, header.Size, header.Filename)
 	log.Printf("Starting upload: %s (%s)", header.Filename, formatBytes(header.Size))
 
-	limitedReader := io.LimitReader(progressReader, h.cfg.MaxSizeToBytes())
-	size, err := io.Copy(dst, limitedReader)
+	// Read one byte past the limit to tell a file of exactly maxSize from a
+	// larger one that would otherwise be cut off silently
+	limitedReader := io.LimitReader(progressReader, maxSize+1)
+	head := &headBuffer{}
+	reader, release, err := h.applyTransformers(io.TeeReader(limitedReader, head), &fileInfo)
+	if err != nil {
+		dst.Close()
+		os.Remove(tmpFilePath)
+		return FileInfo{}, fmt.Errorf("failed to apply upload transformers: %w", err)
+	}
+	// Hash while writing, so the stored file isn't read a second time
+	hash, sha := md5.New(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, hash, sha), reader)
+	release()
 
 	closeErr := dst.Close()
 	if err != nil {
@@ -154,20 +311,26 @@ func (h *Handler) saveFromFormFile(file io.Reader, header *multipart.FileHeader)
 		os.Remove(tmpFilePath)
 		return FileInfo{}, fmt.Errorf("failed to close file: %w", closeErr)
 	}
+	if size > maxSize {
+		os.Remove(tmpFilePath)
+		return FileInfo{}, fmt.Errorf("%w (max %d bytes)", errUploadTooLarge, maxSize)
+	}
+	// Sniffed from the received bytes, transformers may store them compressed
+	if err := h.checkContentType(sniffBytes(head.buf), filepath.Ext(header.Filename)); err != nil {
+		os.Remove(tmpFilePath)
+		return FileInfo{}, err
+	}
 
-	if err := os.Rename(tmpFilePath, filePath); err != nil {
+	if err := os.Rename(tmpFilePath, fileInfo.FilePath); err != nil {
 		os.Remove(tmpFilePath)
 		return FileInfo{}, fmt.Errorf("failed to rename temp file: %w", err)
 	}
 
-	contentType := h.detectContentType(filePath)
-
-	fileInfo := FileInfo{
-		FilePath:         filePath,
-		StoredFilename:   filename,
-		OriginalFilename: header.Filename,
-		Size:             size,
-		ContentType:      contentType,
+	fileInfo.Size = size
+	fileInfo.ContentHash = hex.EncodeToString(hash.Sum(nil))
+	fileInfo.SHA256 = hex.EncodeToString(sha.Sum(nil))
+	if fileInfo.ContentType == "" {
+		fileInfo.ContentType = h.detectContentType(fileInfo.FilePath)
 	}
 
 	elapsed := time.Since(progressReader.startTime)
@@ -177,7 +340,7 @@ func (h *Handler) saveFromFormFile(file io.Reader, header *multipart.FileHeader)
 	return fileInfo, nil
 }
 
-func (h *Handler) downloadFromURL(c echo.Context) (FileInfo, error) {
+func (h *Handler) downloadFromURL(c echo.Context, maxSize int64) (FileInfo, error) {
 	var fileInfo FileInfo
 
 	url := c.FormValue("url")
@@ -185,41 +348,153 @@ func (h *Handler) downloadFromURL(c echo.Context) (FileInfo, error) {
 		return fileInfo, fmt.Errorf("No file or URL provided")
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(url)
+	originalName := h.extractFilenameFromURL(url)
+
+	// The stored name depends on the response headers, so the download goes
+	// to a temp file first
+	tmp, err := os.CreateTemp(h.cfg.UploadPath, "download-*.tmp")
 	if err != nil {
-		log.Printf("Error: Failed to download from URL: %v", err)
-		return fileInfo, fmt.Errorf("Failed to download from URL")
+		return fileInfo, fmt.Errorf("failed to create temp file: %w", err)
 	}
-	defer resp.Body.Close()
+	tmp.Close()
+	tmpFilePath := tmp.Name()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("Error: URL returned non-200 status: %d", resp.StatusCode)
-		return fileInfo, fmt.Errorf("URL returned status %d", resp.StatusCode)
+	ctx := c.Request().Context()
+	client := &http.Client{Timeout: 30 * time.Second}
+	attempts := h.cfg.URLDownloadAttemptLimit()
+
+	var size int64
+	var header http.Header
+	for attempt := 1; ; attempt++ {
+		size, header, err = h.fetchURLToFile(ctx, client, url, tmpFilePath, originalName, maxSize)
+		if err == nil {
+			break
+		}
+
+		var dlErr *downloadError
+		if !errors.As(err, &dlErr) || !dlErr.retryable || attempt >= attempts {
+			os.Remove(tmpFilePath)
+			log.Printf("Error: Failed to download %s after %d attempt(s): %v", url, attempt, downloadErrorDetail(err))
+			return fileInfo, fmt.Errorf("%w (attempts: %d)", err, attempt)
+		}
+
+		delay := urlDownloadRetryDelay << (attempt - 1)
+		log.Printf("Warning: Download of %s failed (attempt %d/%d), retrying in %v: %v", url, attempt, attempts, delay, downloadErrorDetail(err))
+		select {
+		case <-ctx.Done():
+			os.Remove(tmpFilePath)
+			return fileInfo, fmt.Errorf("%w (attempts: %d)", ctx.Err(), attempt)
+		case <-time.After(delay):
+		}
 	}
 
-	if err := h.checkContentLength(resp, h.cfg.MaxSizeToBytes()); err != nil {
+	contentType := header.Get("Content-Type")
+	originalName = remoteFilename(originalName, header)
+	fileExt := filepath.Ext(originalName)
+
+	if err := h.checkContentType(sniffContentType(tmpFilePath), fileExt); err != nil {
+		os.Remove(tmpFilePath)
 		return fileInfo, err
 	}
 
-	useSecretId := c.FormValue("secret") != ""
-	id, err := h.generateFileID(useSecretId)
+	_, useSecretId := c.Request().Form["secret"]
+	slug := requestSlugTarget(c)
+	id, filename, overwrites, err := h.uploadFilename(slug, fileExt, useSecretId)
 	if err != nil {
-		return fileInfo, fmt.Errorf("failed to generate ID: %w", err)
+		os.Remove(tmpFilePath)
+		return fileInfo, err
 	}
 
-	originalName := h.extractFilenameFromURL(url)
-	fileExt := filepath.Ext(originalName)
-	filename := id
-	if fileExt != "" {
-		filename += fileExt
+	filePath := filepath.Join(h.cfg.UploadPath, filename)
+	if err := os.Rename(tmpFilePath, filePath); err != nil {
+		os.Remove(tmpFilePath)
+		return fileInfo, fmt.Errorf("failed to rename temp file: %w", err)
 	}
 
-	filePath := filepath.Join(h.cfg.UploadPath, filename)
+	if contentType == "" {
+		contentType = h.detectContentType(filePath)
+	}
+
+	fileInfo = FileInfo{
+		FilePath:         filePath,
+		StoredFilename:   filename,
+		OriginalFilename: originalName,
+		Size:             size,
+		ContentType:      contentType,
+		Overwrites:       overwrites,
+		PublicID:         !useSecretId && slug.slug == "",
+	}
+
+	log.Printf("✓ Download completed: %s (%d bytes) with ID: %s", originalName, size, id)
+	return fileInfo, nil
+}
+
+// uploadTooLarge answers an upload over the size limit with 413, removing
+// whatever of it was already stored
+func (h *Handler) uploadTooLarge(c echo.Context, fileInfo FileInfo, maxSize int64) error {
+	if fileInfo.FilePath != "" {
+		if err := os.Remove(fileInfo.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("[HandleUpload] Failed to remove rejected file: %v", err)
+		}
+	}
+	return c.String(http.StatusRequestEntityTooLarge, fmt.Sprintf("File too large (max %d bytes)", maxSize))
+}
+
+// urlDownloadRetryDelay is the wait before the first retry of a failed URL
+// download. It doubles with every further attempt.
+var urlDownloadRetryDelay = time.Second
+
+// downloadError is a failed remote download. Timeouts, connection errors,
+// interrupted transfers and 5xx responses are retryable; 4xx responses are not.
+// Clients only get msg, the transport details in err are logged.
+type downloadError struct {
+	msg       string
+	err       error
+	retryable bool
+}
+
+func (e *downloadError) Error() string { return e.msg }
+func (e *downloadError) Unwrap() error { return e.err }
+
+// downloadErrorDetail returns the error to log for a failed download, with
+// the details a downloadError keeps from clients
+func downloadErrorDetail(err error) error {
+	var dlErr *downloadError
+	if errors.As(err, &dlErr) {
+		return fmt.Errorf("%s: %w", dlErr.msg, dlErr.err)
+	}
+	return err
+}
+
+// fetchURLToFile downloads url into filePath, truncating any content left by
+// an earlier attempt, and returns the size and the response headers
+func (h *Handler) fetchURLToFile(ctx context.Context, client *http.Client, url, filePath, originalName string, maxSize int64) (int64, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("Invalid URL: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, &downloadError{msg: "Failed to download from URL", err: err, retryable: ctx.Err() == nil}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, nil, &downloadError{
+			msg:       fmt.Sprintf("URL returned status %d", resp.StatusCode),
+			err:       errors.New(resp.Status),
+			retryable: resp.StatusCode >= 500,
+		}
+	}
+
+	if err := h.checkContentLength(resp, maxSize); err != nil {
+		return 0, nil, err
+	}
 
 	dst, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
 	if err != nil {
-		return fileInfo, fmt.Errorf("failed to create file: %w", err)
+		return 0, nil, fmt.Errorf("failed to create file: %w", err)
 	}
 	defer dst.Close()
 
@@ -228,32 +503,39 @@ func (h *Handler) downloadFromURL(c echo.Context) (FileInfo, error) {
 	progressReader := NewSimpleProgressReader(resp.Body, contentLength, originalName)
 	log.Printf("Starting download: %s (%s)", originalName, formatBytes(contentLength))
 
-	limitedReader := io.LimitReader(progressReader, h.cfg.MaxSizeToBytes())
+	limitedReader := io.LimitReader(progressReader, maxSize+1)
 	size, err := io.Copy(dst, limitedReader)
 	if err != nil {
 		os.Remove(filePath)
-		log.Printf("Error: Failed to save from URL: %v", err)
-		return fileInfo, fmt.Errorf("failed to save from URL")
-	}
-
-	contentType := resp.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = h.detectContentType(filePath)
+		return 0, nil, &downloadError{msg: "Failed to save from URL", err: err, retryable: ctx.Err() == nil}
 	}
-
-	fileInfo = FileInfo{
-		FilePath:         filePath,
-		StoredFilename:   filename,
-		OriginalFilename: originalName,
-		Size:             size,
-		ContentType:      contentType,
+	if size > maxSize {
+		os.Remove(filePath)
+		return 0, nil, fmt.Errorf("%w (max %d bytes)", errUploadTooLarge, maxSize)
 	}
 
-	log.Printf("✓ Download completed: %s (%d bytes) with ID: %s", originalName, size, id)
-	return fileInfo, nil
+	return size, resp.Header, nil
 }
 
+// detectContentType sniffs the type of a file and corrects it for its extension
 func (h *Handler) detectContentType(filePath string) string {
+	return h.correctContentType(sniffContentType(filePath), filepath.Ext(filePath))
+}
+
+// correctContentType replaces a detected type that is technically right but
+// unhelpful, like application/zip for a .docx file, according to the extension
+func (h *Handler) correctContentType(detected, ext string) string {
+	mediaType := strings.TrimSpace(strings.SplitN(detected, ";", 2)[0])
+	for _, correction := range h.cfg.ContentTypeCorrectionTable() {
+		if strings.EqualFold(correction.Extension, ext) && strings.EqualFold(correction.Detected, mediaType) {
+			return correction.Type
+		}
+	}
+	return detected
+}
+
+// sniffContentType detects the type of a file from its first bytes
+func sniffContentType(filePath string) string {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "application/octet-stream"
@@ -265,7 +547,12 @@ func (h *Handler) detectContentType(filePath string) string {
 	if err != nil && err != io.EOF {
 		return "application/octet-stream"
 	}
-	mtype := mimetype.Detect(buffer[:n])
+	return sniffBytes(buffer[:n])
+}
+
+// sniffBytes detects a content type from the first bytes of a file
+func sniffBytes(head []byte) string {
+	mtype := mimetype.Detect(head)
 
 	if mtype.String() == "" {
 		return "application/octet-stream"
@@ -274,6 +561,72 @@ func (h *Handler) detectContentType(filePath string) string {
 	return mtype.String()
 }
 
+// errContentTypeNotAllowed rejects uploads by allowed_content_types and
+// blocked_content_types
+var errContentTypeNotAllowed = errors.New("uploads of this content type are not allowed")
+
+// checkContentType rejects a type sniffed from the upload's bytes, corrected
+// for the extension like stored types are. The type sent by the client is
+// never trusted.
+func (h *Handler) checkContentType(sniffed, ext string) error {
+	contentType := h.correctContentType(sniffed, ext)
+	if !h.cfg.ContentTypeAllowed(contentType) {
+		return fmt.Errorf("%w: %s", errContentTypeNotAllowed, strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	}
+	return nil
+}
+
+// headBuffer keeps the first bytes written to it, for sniffing the type of
+// content that is stored transformed
+type headBuffer struct {
+	buf []byte
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if free := 512 - len(b.buf); free > 0 {
+		b.buf = append(b.buf, p[:min(free, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// appendDetectedExtension renames an upload stored without an extension so it carries
+// the canonical extension of its detected type. Explicit extensions are never
+// changed, and overwrites keep the name of the upload they replace.
+func (h *Handler) appendDetectedExtension(fileInfo *FileInfo) error {
+	if !h.cfg.AppendDetectedExtension || filepath.Ext(fileInfo.StoredFilename) != "" || fileInfo.ContentEncoding != "" || fileInfo.Overwrites != "" {
+		return nil
+	}
+
+	ext := canonicalExtension(h.detectContentType(fileInfo.FilePath))
+	if ext == "" {
+		return nil
+	}
+
+	newPath := fileInfo.FilePath + ext
+	if err := os.Rename(fileInfo.FilePath, newPath); err != nil {
+		return err
+	}
+
+	fileInfo.FilePath = newPath
+	fileInfo.StoredFilename += ext
+	return nil
+}
+
+// canonicalExtension returns the usual extension for a detected content type, or
+// an empty string when the type is too generic to trust
+func canonicalExtension(contentType string) string {
+	mediaType := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	if isAmbiguousContentType(mediaType) || mediaType == "text/plain" {
+		return ""
+	}
+
+	mtype := mimetype.Lookup(mediaType)
+	if mtype == nil {
+		return ""
+	}
+	return mtype.Extension()
+}
+
 func (h *Handler) checkContentLength(resp *http.Response, maxSize int64) error {
 	contentLength := resp.Header.Get("Content-Length")
 	if contentLength != "" {
@@ -281,14 +634,14 @@ func (h *Handler) checkContentLength(resp *http.Response, maxSize int64) error {
 		if err != nil {
 			log.Printf("Warning: Invalid Content-Length: %v", err)
 		} else if length > maxSize {
-			return fmt.Errorf("File too large (max %d bytes)", maxSize)
+			return fmt.Errorf("%w (max %d bytes)", errUploadTooLarge, maxSize)
 		}
 	}
 	return nil
 }
 
 func (h *Handler) extractFilenameFromURL(url string) string {
-	fileName := "download"
+	fileName := h.cfg.DefaultURLFilename()
 	urlPath := strings.Split(url, "/")
 
 	if len(urlPath) > 0 && urlPath[len(urlPath)-1] != "" {
@@ -301,20 +654,53 @@ func (h *Handler) extractFilenameFromURL(url string) string {
 	return fileName
 }
 
+// remoteFilename improves the name taken from a URL that has no extension:
+// the filename of a Content-Disposition header wins, else the extension of
+// the remote Content-Type is appended
+func remoteFilename(name string, header http.Header) string {
+	if filepath.Ext(name) != "" {
+		return name
+	}
+
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		disposed := filepath.Base(strings.ReplaceAll(params["filename"], "\\", "/"))
+		if disposed != "." && disposed != "/" && disposed != ".." {
+			return disposed
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || isAmbiguousContentType(mediaType) {
+		return name
+	}
+	ext := canonicalExtension(mediaType)
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return name + ext
+}
+
+// newPublicID returns a candidate id for an upload or short link. Secret ids are
+// always random, so they can't be guessed from neighbouring ids.
+func (h *Handler) newPublicID(useSecretId bool) (string, error) {
+	if useSecretId {
+		return generateID(SecretIDLength)
+	}
+	return h.ids.NewID(h.cfg.IdLength)
+}
+
 func (h *Handler) generateFileID(useSecretId bool) (string, error) {
 	maxRetries := 10
 	for i := 0; i < maxRetries; i++ {
-		var length int
-		if useSecretId {
-			length = 8
-		} else {
-			length = h.cfg.IdLength
-		}
-
-		id, err := generateID(length)
+		id, err := h.newPublicID(useSecretId)
 		if err != nil {
 			return "", err
 		}
+		if isReservedID(id) {
+			continue
+		}
 
 		// Check if ID already exists
 		_, err = h.db.GetMetadataByID(id)
@@ -330,15 +716,226 @@ func (h *Handler) generateFileID(useSecretId bool) (string, error) {
 	return "", fmt.Errorf("failed to generate unique ID after %d retries", maxRetries)
 }
 
-func (h *Handler) determineExpiration(c echo.Context, fileSize int64) (time.Time, error) {
-	expiresStr := c.FormValue("expires")
+// errUploadTooLarge is returned when an upload or download goes past the size
+// limit, the partial file is removed
+var errUploadTooLarge = errors.New("file too large")
+
+var (
+	errSlugReserved = errors.New("this slug is reserved, choose another one")
+	errSlugTaken    = errors.New("this slug is already taken, choose another one")
+	errSlugNotOwned = errors.New("overwriting this slug requires the management token of its upload")
+)
+
+// What an upload to a slug that is already taken does, chosen with on_conflict
+const (
+	conflictFail      = "fail"
+	conflictOverwrite = "overwrite"
+	conflictVersion   = "version"
+)
+
+// maxSlugVersions bounds the versions searched for a free name with
+// on_conflict=version
+const maxSlugVersions = 1000
+
+// maxSlugLength caps requested slugs, leaving room for the extension
+const maxSlugLength = 64
+
+// requestSlug reads the slug form field, the readable name to store an upload
+// under instead of a random id. Characters that aren't safe in a filename
+// become dashes.
+func requestSlug(c echo.Context) (string, error) {
+	value := strings.TrimSpace(c.Request().Form.Get("slug"))
+	if value == "" {
+		return "", nil
+	}
+	slug := strings.Trim(filenameSanitizer.ReplaceAllString(value, "-"), ".-")
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], ".-")
+	}
+	if slug == "" {
+		return "", fmt.Errorf("invalid slug %q, use letters, digits, dots, dashes and underscores", value)
+	}
+	if isReservedID(slug) {
+		return "", errSlugReserved
+	}
+	return slug, nil
+}
+
+// requestOnConflict reads the on_conflict form field, what an upload to a
+// taken slug does: fail (the default), overwrite or version
+func requestOnConflict(c echo.Context) (string, error) {
+	switch value := strings.ToLower(strings.TrimSpace(c.Request().Form.Get("on_conflict"))); value {
+	case "":
+		return conflictFail, nil
+	case conflictFail, conflictOverwrite, conflictVersion:
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid on_conflict %q, use fail, overwrite or version", value)
+	}
+}
+
+// slugTarget is the slug requested for an upload, what to do when it is taken
+// and the management token proving ownership of the upload it would overwrite
+type slugTarget struct {
+	slug       string
+	onConflict string
+	token      string
+}
+
+// requestSlugTarget collects the slug options of a validated request
+func requestSlugTarget(c echo.Context) slugTarget {
+	slug, _ := requestSlug(c)
+	onConflict, _ := requestOnConflict(c)
+	return slugTarget{slug: slug, onConflict: onConflict, token: managementTokenFromRequest(c)}
+}
+
+// uploadFilename picks the stored filename of an upload: the slug when one was
+// requested, else a new random id, followed by the extension. An upload that
+// overwrites a slug is stored under a random id until it is accepted, and the
+// filename it replaces is returned as well.
+func (h *Handler) uploadFilename(slug slugTarget, ext string, useSecretId bool) (id, filename, overwrites string, err error) {
+	if slug.slug != "" {
+		filename, err = h.slugFilename(slug.slug, ext)
+		switch {
+		case errors.Is(err, errSlugTaken) && slug.onConflict == conflictVersion:
+			filename, err = h.versionedSlugFilename(filename, ext)
+			return strings.TrimSuffix(filename, ext), filename, "", err
+		case errors.Is(err, errSlugTaken) && slug.onConflict == conflictOverwrite:
+			if err = h.authorizeSlugOverwrite(filename, slug.token); err != nil {
+				return "", "", "", err
+			}
+			overwrites = filename
+		default:
+			return slug.slug, filename, "", err
+		}
+	}
+	if id, err = h.generateFileID(useSecretId); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return id, id + ext, overwrites, nil
+}
+
+// slugFilename returns the stored filename for an upload named by slug,
+// appending the extension of the upload unless the slug already ends with it.
+// The filename is returned along with errSlugTaken when it is in use.
+func (h *Handler) slugFilename(slug, ext string) (string, error) {
+	filename := slug
+	if !strings.EqualFold(filepath.Ext(slug), ext) {
+		filename += ext
+	}
+	if isReservedID(filename) {
+		return "", errSlugReserved
+	}
+	if h.filenameTaken(filename) {
+		return filename, errSlugTaken
+	}
+	return filename, nil
+}
+
+// filenameTaken reports whether an upload is stored under filename. Files
+// without metadata and chunk directories count as well, they must not be
+// overwritten either.
+func (h *Handler) filenameTaken(filename string) bool {
+	filePath := filepath.Join(h.cfg.UploadPath, filename)
+	if _, err := h.db.GetMetadataByID(filePath); err == nil {
+		return true
+	}
+	_, err := os.Lstat(filePath)
+	return err == nil
+}
+
+// versionedSlugFilename returns the first free "<slug>-v<n><ext>" name, n
+// counting from 2, for an upload keeping the taken filename as its history
+func (h *Handler) versionedSlugFilename(filename, ext string) (string, error) {
+	base := filename
+	if ext != "" && strings.HasSuffix(strings.ToLower(filename), strings.ToLower(ext)) {
+		base = filename[:len(filename)-len(ext)]
+	}
+	for n := 2; n <= maxSlugVersions; n++ {
+		versioned := fmt.Sprintf("%s-v%d%s", base, n, ext)
+		if !h.filenameTaken(versioned) && !isReservedID(versioned) {
+			return versioned, nil
+		}
+	}
+	return "", errSlugTaken
+}
+
+// authorizeSlugOverwrite checks that token is the management token of the
+// upload stored under filename. Files without metadata have no owner and are
+// never overwritten.
+func (h *Handler) authorizeSlugOverwrite(filename, token string) error {
+	meta, err := h.db.GetMetadataByID(filepath.Join(h.cfg.UploadPath, filename))
+	if err != nil {
+		return errSlugTaken
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(meta.Token)) != 1 {
+		return errSlugNotOwned
+	}
+	return nil
+}
+
+// replaceSlugFile moves an accepted upload over the file it overwrites, whose
+// metadata is then replaced by the upload's. The old thumbnail goes with it.
+func (h *Handler) replaceSlugFile(fileInfo *FileInfo) error {
+	target := filepath.Join(h.cfg.UploadPath, fileInfo.Overwrites)
+	if err := os.Rename(fileInfo.FilePath, target); err != nil {
+		return err
+	}
+	if err := os.Remove(h.thumbnailFilePath(target)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: Failed to remove thumbnail of overwritten %s: %v", fileInfo.Overwrites, err)
+	}
+
+	log.Printf("Overwriting %s with %s", fileInfo.Overwrites, fileInfo.StoredFilename)
+	fileInfo.FilePath = target
+	fileInfo.StoredFilename = fileInfo.Overwrites
+	fileInfo.Overwrites = ""
+	return nil
+}
+
+// errExpirationRequired is returned for requests without expires when the server
+// requires an explicit expiration
+var errExpirationRequired = errors.New("this server requires an expiration: send expires as hours (e.g. expires=24) or a date (e.g. expires=2025-01-31)")
+
+func (h *Handler) determineExpiration(c echo.Context, fileSize int64, limits expiration.RetentionLimits) (time.Time, error) {
+	expiresStr, err := requestedExpiration(c)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return h.resolveExpiration(expiresStr, fileSize, limits)
+}
+
+// requestedExpiration returns the expires form field, or else the X-Expires
+// header holding an absolute time in Unix milliseconds
+func requestedExpiration(c echo.Context) (string, error) {
+	if expiresStr := c.FormValue("expires"); expiresStr != "" {
+		return expiresStr, nil
+	}
+
+	header := c.Request().Header.Get("X-Expires")
+	if header == "" {
+		return "", nil
+	}
+	ms, err := strconv.ParseInt(strings.TrimSpace(header), 10, 64)
+	if err != nil || ms <= 0 {
+		return "", fmt.Errorf("invalid X-Expires header %q, expected Unix milliseconds", header)
+	}
+	return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano), nil
+}
+
+// resolveExpiration turns the requested expiration into a date within the retention
+// policy. Without a request the policy's own date is used, unless the server
+// requires an explicit expiration.
+func (h *Handler) resolveExpiration(expiresStr string, fileSize int64, limits expiration.RetentionLimits) (time.Time, error) {
+	if expiresStr == "" && h.cfg.RequireExplicitExpiration {
+		return time.Time{}, errExpirationRequired
+	}
 	if expiresStr != "" {
 		expirationDate, err := utils.ParseExpirationTime(expiresStr)
 		if err != nil {
 			return expirationDate, err
 		}
 
-		maxExpiration := h.expManager.GetExpirationDate(fileSize)
+		maxExpiration := h.expManager.GetExpirationDateWithin(fileSize, limits)
 		log.Printf("Requested expiration date: %v", expirationDate)
 
 		if expirationDate.After(maxExpiration) {
@@ -348,13 +945,14 @@ func (h *Handler) determineExpiration(c echo.Context, fileSize int64) (time.Time
 			log.Printf("Warning: Expiration date is in the past, using max expiration set by retention policy")
 			return maxExpiration, nil
 		} else {
+			expirationDate = utils.ApplyExpirationFloor(expirationDate, h.cfg.MinExpiration())
 			log.Printf("Expiration date: %v", expirationDate)
 			return expirationDate, nil
 		}
 
 	}
 
-	expirationDate := h.expManager.GetExpirationDate(fileSize)
+	expirationDate := h.expManager.GetExpirationDateWithin(fileSize, limits)
 	return expirationDate, nil
 }
 
@@ -370,6 +968,20 @@ func (h *Handler) storeFileMetadata(filePath, fileName string, fileInfo FileInfo
 		ipAddress = c.RealIP()
 	}
 
+	_, noIndex := c.Request().Form["noindex"]
+	// The key was checked when the upload started
+	policy, _ := h.resolveUploadPolicy(c)
+	maxDownloads, _ := requestMaxDownloads(c)
+	maxDownloads = policy.downloadLimit(maxDownloads)
+	// Folders can't have a download limit, their files are never counted
+	if fileInfo.ContentType == model.FolderContentType {
+		maxDownloads = 0
+	}
+	passwordHash, err := hashRequestPassword(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
 	metadata := model.FileMetadata{
 		ResourcePath: filePath,
 		Token:        managementToken,
@@ -382,6 +994,14 @@ func (h *Handler) storeFileMetadata(filePath, fileName string, fileInfo FileInfo
 		IPAddress:    ipAddress,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
+		ContentHash:  fileInfo.ContentHash,
+		NoIndex:      noIndex,
+		GroupID:      requestGroupID(c),
+		MaxDownloads: maxDownloads,
+
+		ContentEncoding: fileInfo.ContentEncoding,
+		PasswordHash:    passwordHash,
+		PublicID:        fileInfo.PublicID,
 	}
 
 	if !expirationDate.IsZero() {
@@ -391,33 +1011,130 @@ func (h *Handler) storeFileMetadata(filePath, fileName string, fileInfo FileInfo
 	if err := h.db.StoreMetadata(&metadata); err != nil {
 		return "", err
 	}
+	h.webhooks.Notify(webhook.EventUpload, metadata)
 
 	return managementToken, nil
 }
 
-func (h *Handler) sendUploadResponse(c echo.Context, filename string, fileSize int64, token string, expirationDate time.Time) error {
+// requestMaxDownloads reads the max_downloads form field, the number of
+// downloads after which the file is deleted. 0 or a missing field means no limit.
+func requestMaxDownloads(c echo.Context) (int, error) {
+	value := strings.TrimSpace(c.Request().Form.Get("max_downloads"))
+	if value == "" {
+		return 0, nil
+	}
+	maxDownloads, err := strconv.Atoi(value)
+	if err != nil || maxDownloads < 0 {
+		return 0, fmt.Errorf("invalid max_downloads %q, send a positive number of downloads", value)
+	}
+	return maxDownloads, nil
+}
+
+// requestContentEncoding reads the content_encoding form field, the encoding an
+// already compressed upload is served with. Only gzip is supported, and only
+// when content_encoding_uploads is enabled.
+func (h *Handler) requestContentEncoding(c echo.Context) (string, error) {
+	value := strings.ToLower(strings.TrimSpace(c.Request().Form.Get("content_encoding")))
+	if value == "" {
+		return "", nil
+	}
+	if !h.cfg.ContentEncodingUploads {
+		return "", errors.New("content_encoding is not enabled on this server")
+	}
+	if value != "gzip" {
+		return "", fmt.Errorf("unsupported content_encoding %q, only gzip is supported", value)
+	}
+	return value, nil
+}
+
+// applyContentEncoding checks that an upload sent with content_encoding really
+// is gzip compressed. Its content type becomes that of the decompressed content,
+// taken from the name without .gz or else sniffed, and the .gz is dropped from
+// the original name since clients save the decoded file.
+func (h *Handler) applyContentEncoding(c echo.Context, fileInfo *FileInfo) error {
+	encoding, _ := h.requestContentEncoding(c)
+	if encoding == "" {
+		return nil
+	}
+
+	file, err := os.Open(fileInfo.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return errors.New("content_encoding is gzip but the file is not gzip compressed")
+	}
+	defer zr.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(zr, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("invalid gzip data: %w", err)
+	}
+
+	name := fileInfo.OriginalFilename
+	if ext := filepath.Ext(name); (strings.EqualFold(ext, ".gz") || strings.EqualFold(ext, ".gzip")) && len(name) > len(ext) {
+		name = strings.TrimSuffix(name, ext)
+	}
+	// Checked on the decoded content, the stored bytes are only gzip
+	if err := h.checkContentType(sniffBytes(head[:n]), filepath.Ext(name)); err != nil {
+		return err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = h.correctContentType(mimetype.Detect(head[:n]).String(), filepath.Ext(name))
+	}
+
+	fileInfo.OriginalFilename = name
+	fileInfo.ContentType = contentType
+	fileInfo.ContentEncoding = encoding
+	return nil
+}
+
+func (h *Handler) sendUploadResponse(c echo.Context, fileInfo FileInfo, token string, expirationDate time.Time, scanStatus string) error {
 	c.Response().Header().Set("X-Token", token)
-	fileURL := h.expManager.Config.BaseURL + filename
+	fileURL := joinURL(h.cfg.BaseURL, fileInfo.StoredFilename)
+	addVary(c, "Accept")
+
+	if scanStatus != "" {
+		c.Response().Header().Set("X-Scan-Status", scanStatus)
+	}
+
+	groupID := requestGroupID(c)
+	if groupID != "" {
+		c.Response().Header().Set("X-Group-Id", groupID)
+	}
 
 	if !expirationDate.IsZero() {
 		expiresMs := expirationDate.UnixNano() / int64(time.Millisecond)
 		c.Response().Header().Set("X-Expires", fmt.Sprintf("%d", expiresMs))
 	}
 
-	// Calculate MD5 hash
-	filePath := filepath.Join(h.cfg.UploadPath, filename)
-	md5Hash, err := utils.CalculateMD5(filePath)
-	if err != nil {
-		log.Printf("Warning: Failed to calculate MD5 for %s: %v", filename, err)
-		md5Hash = "" // Set empty string if calculation fails
+	// Trailers are announced before the body and filled in after it
+	trailer := h.cfg.MD5Trailers && acceptsTrailers(c.Request()) && fileInfo.ContentHash != ""
+	if trailer {
+		c.Response().Header().Set("Trailer", MD5TrailerHeader)
+		defer c.Response().Header().Set(MD5TrailerHeader, fileInfo.ContentHash)
 	}
 
 	if strings.Contains(c.Request().Header.Get("Accept"), "application/json") {
 		response := map[string]any{
 			"url":   fileURL,
-			"size":  fileSize,
+			"size":  fileInfo.Size,
 			"token": token,
-			"md5":   md5Hash,
+			"md5":   fileInfo.ContentHash,
+		}
+
+		if fileInfo.SHA256 != "" {
+			response["sha256"] = fileInfo.SHA256
+		}
+
+		if groupID != "" {
+			response["group_id"] = groupID
 		}
 
 		if !expirationDate.IsZero() {
@@ -426,13 +1143,62 @@ func (h *Handler) sendUploadResponse(c echo.Context, filename string, fileSize i
 			response["expires_in_days"] = days
 		}
 
+		if scanStatus != "" {
+			response["scan_status"] = scanStatus
+			response["scan_url"] = h.scanURL(fileInfo.StoredFilename)
+		}
+
 		return c.JSON(http.StatusOK, response)
 	}
 
+	// Browsers posting the upload form get a page instead of the bare URL
+	if strings.Contains(c.Request().Header.Get("Accept"), "text/html") {
+		return h.renderUploadSuccess(c, fileInfo, fileURL, token, expirationDate)
+	}
+
 	c.Response().Header().Set("Content-Type", "text/plain; charset=utf-8")
 	return c.String(http.StatusOK, fileURL+"\n")
 }
 
+// renderUploadSuccess shows the upload result with its management token. The
+// page is never cached since the token is only shown once.
+func (h *Handler) renderUploadSuccess(c echo.Context, fileInfo FileInfo, fileURL, token string, expirationDate time.Time) error {
+	_, oneTime := c.Request().Form["one_time"]
+	result := templates.UploadResult{
+		HomeURL:   h.cfg.BaseURL,
+		URL:       fileURL,
+		Name:      fileInfo.OriginalFilename,
+		Size:      fileInfo.Size,
+		Token:     token,
+		ExpiresAt: expirationDate,
+		OneTime:   oneTime,
+	}
+	if code, err := qrcode.Encode(fileURL); err == nil {
+		result.QRCode = code.SVG()
+	}
+
+	header := c.Response().Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Cache-Control", "no-store")
+	c.Response().WriteHeader(http.StatusOK)
+	return templates.UploadSuccess(result).Render(c.Request().Context(), c.Response())
+}
+
+// MD5TrailerHeader is the trailer carrying the MD5 of an upload for clients
+// sending "TE: trailers" when md5_trailers is enabled
+const MD5TrailerHeader = "X-MD5"
+
+// acceptsTrailers reports whether the client asked for trailers with "TE: trailers"
+func acceptsTrailers(req *http.Request) bool {
+	for _, value := range strings.Split(req.Header.Get("TE"), ",") {
+		token := strings.TrimSpace(strings.SplitN(value, ";", 2)[0])
+		if strings.EqualFold(token, "trailers") {
+			return true
+		}
+	}
+	return false
+}
+
 func generateID(length int) (string, error) {
 	bytes := make([]byte, length/2+1)
 	if _, err := rand.Read(bytes); err != nil {
@@ -0,0 +1,391 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/model"
+)
+
+// maxFolderFiles caps the number of files in one folder upload
+const maxFolderFiles = 1000
+
+// reservedFolderPaths are served by other routes under /:id/ and can't be
+// stored at the root of a folder
+var reservedFolderPaths = map[string]bool{
+	"meta.json": true,
+	"scan":      true,
+}
+
+var (
+	errInvalidFolderPath = errors.New("invalid path")
+	errFolderTooLarge    = errors.New("folder too large")
+)
+
+// isFolderUpload reports whether the request sends files with relative paths
+func isFolderUpload(c echo.Context) bool {
+	form := c.Request().MultipartForm
+	return form != nil && len(form.Value["path"]) > 0
+}
+
+// cleanFolderPath turns a client supplied relative path into a slash separated
+// path that stays inside the folder
+func cleanFolderPath(p string) (string, error) {
+	p = strings.ReplaceAll(p, "\\", "/")
+	if p == "" || strings.HasPrefix(p, "/") || strings.ContainsRune(p, 0) {
+		return "", fmt.Errorf("%w %q", errInvalidFolderPath, p)
+	}
+	cleaned := path.Clean(p)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w %q", errInvalidFolderPath, p)
+	}
+	return cleaned, nil
+}
+
+// folderFilePath resolves a cleaned relative path inside the folder directory,
+// refusing anything that would escape it
+func folderFilePath(dir, rel string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(rel))
+	if !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w %q", errInvalidFolderPath, rel)
+	}
+	return target, nil
+}
+
+// validateFolderPaths cleans every path and rejects duplicates, reserved names
+// and paths that are both a file and a directory
+func validateFolderPaths(paths []string) ([]string, error) {
+	cleaned := make([]string, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for i, p := range paths {
+		rel, err := cleanFolderPath(p)
+		if err != nil {
+			return nil, err
+		}
+		if reservedFolderPaths[rel] {
+			return nil, fmt.Errorf("%w %q: the name is reserved", errInvalidFolderPath, p)
+		}
+		if seen[rel] {
+			return nil, fmt.Errorf("%w %q: listed twice", errInvalidFolderPath, p)
+		}
+		seen[rel] = true
+		cleaned[i] = rel
+	}
+
+	for _, rel := range cleaned {
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if seen[dir] {
+				return nil, fmt.Errorf("%w %q: %q is also a file", errInvalidFolderPath, rel, dir)
+			}
+		}
+	}
+	return cleaned, nil
+}
+
+// folderName names the upload after the top-level directory all paths share
+func folderName(paths []string, fallback string) string {
+	top := strings.SplitN(paths[0], "/", 2)[0]
+	for _, rel := range paths {
+		if !strings.HasPrefix(rel, top+"/") {
+			return fallback
+		}
+	}
+	return top
+}
+
+// handleFolderUpload stores a batch of files with relative paths under one id,
+// recreating their directory tree in uploads/<id>/
+func (h *Handler) handleFolderUpload(c echo.Context, policy uploadPolicy) error {
+	if !h.cfg.FolderUploadsEnabled {
+		return c.String(http.StatusBadRequest, "Folder uploads are disabled on this server")
+	}
+	if h.scanner != nil {
+		return c.String(http.StatusBadRequest, "Folder uploads are not available while virus scanning is enabled")
+	}
+	if h.cfg.RestrictsContentTypes() {
+		return c.String(http.StatusBadRequest, "Folder uploads are not available while content types are restricted")
+	}
+	if _, oneTime := c.Request().Form["one_time"]; oneTime {
+		return c.String(http.StatusBadRequest, "Folder uploads can't be one-time downloads")
+	}
+	if maxDownloads, _ := requestMaxDownloads(c); maxDownloads > 0 {
+		return c.String(http.StatusBadRequest, "Folder uploads can't have a download limit")
+	}
+	if c.Request().Form.Get("slug") != "" {
+		return c.String(http.StatusBadRequest, "Folder uploads can't have a slug")
+	}
+	if c.Request().Form.Get("password") != "" {
+		return c.String(http.StatusBadRequest, "Folder uploads can't have a password")
+	}
+	if c.Request().Form.Get("content_encoding") != "" {
+		return c.String(http.StatusBadRequest, "Folder uploads can't have a content encoding")
+	}
+
+	form := c.Request().MultipartForm
+	files, paths := form.File["file"], form.Value["path"]
+	if len(files) != len(paths) {
+		return c.String(http.StatusBadRequest, "Send one path field per file")
+	}
+	if len(files) > maxFolderFiles {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Folder uploads are limited to %d files", maxFolderFiles))
+	}
+
+	relPaths, err := validateFolderPaths(paths)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	id, err := h.generateFileID(false)
+	if err != nil {
+		log.Printf("[HandleUpload] Failed to generate folder ID: %v", err)
+		return c.String(http.StatusInternalServerError, "Server error")
+	}
+	dir := filepath.Join(h.cfg.UploadPath, id)
+
+	size, err := saveFolderFiles(dir, files, relPaths, policy.MaxSize)
+	if err != nil {
+		os.RemoveAll(dir)
+		log.Printf("[HandleUpload] Failed to store folder upload: %v", err)
+		if errors.Is(err, errInvalidFolderPath) {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		if errors.Is(err, errFolderTooLarge) {
+			return c.String(http.StatusRequestEntityTooLarge, "Folder exceeds the upload size limit")
+		}
+		return c.String(http.StatusInternalServerError, "Server error")
+	}
+
+	expirationDate, err := h.determineExpiration(c, size, policy.Limits)
+	if err != nil {
+		os.RemoveAll(dir)
+		if errors.Is(err, errExpirationRequired) {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		return c.String(http.StatusBadRequest, "Invalid expiration format.")
+	}
+
+	fileInfo := FileInfo{
+		FilePath:         dir,
+		StoredFilename:   id,
+		OriginalFilename: folderName(relPaths, id),
+		Size:             size,
+		ContentType:      model.FolderContentType,
+	}
+	token, err := h.storeFileMetadata(dir, fileInfo.OriginalFilename, fileInfo, expirationDate, false, c)
+	if err != nil {
+		os.RemoveAll(dir)
+		log.Printf("[HandleUpload] Failed to store folder metadata: %v", err)
+		return c.String(http.StatusInternalServerError, "Server error")
+	}
+
+	log.Printf("Folder uploaded: %s (%d files, %s) with ID: %s", fileInfo.OriginalFilename, len(files), formatBytes(size), id)
+	return h.sendUploadResponse(c, fileInfo, token, expirationDate, "")
+}
+
+// saveFolderFiles writes the files below dir and returns their total size
+func saveFolderFiles(dir string, files []*multipart.FileHeader, relPaths []string, maxSize int64) (int64, error) {
+	var total int64
+	for i, header := range files {
+		total += header.Size
+		if total > maxSize {
+			return 0, errFolderTooLarge
+		}
+
+		target, err := folderFilePath(dir, relPaths[i])
+		if err != nil {
+			return 0, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return 0, err
+		}
+		if err := saveFolderFile(header, target); err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+func saveFolderFile(header *multipart.FileHeader, target string) error {
+	src, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// removeStoredUpload deletes the file, or the whole tree of a folder upload
+func removeStoredUpload(meta model.FileMetadata) error {
+	if meta.IsFolder() {
+		return os.RemoveAll(meta.ResourcePath)
+	}
+	return os.Remove(meta.ResourcePath)
+}
+
+// FolderEntry is one file in a folder listing
+type FolderEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	URL  string `json:"url"`
+}
+
+// HandleFolderFile serves a file of a folder upload at /:id/<path>. Paths
+// naming a directory list the files below it.
+func (h *Handler) HandleFolderFile(c echo.Context) error {
+	id := c.Param("filename")
+	if strings.ContainsAny(id, `/\`) || id == ".." {
+		return h.notFoundResponse(c)
+	}
+
+	meta, err := h.db.GetMetadataByID(filepath.Join(h.cfg.UploadPath, id))
+	if err != nil || !meta.IsFolder() {
+		return h.notFoundResponse(c)
+	}
+
+	// The folder's contents expire and wait for its scan with it
+	if meta.ExpiresAt != nil && meta.ExpiresAt.Before(time.Now()) {
+		return h.goneResponse(c)
+	}
+	if h.scanPending(meta.ResourcePath) {
+		c.Response().Header().Set("Retry-After", "5")
+		return c.String(http.StatusServiceUnavailable, "File is still being scanned")
+	}
+	if ok, err := h.checkTransferCap(c); !ok {
+		return err
+	}
+
+	rel := strings.Trim(c.Param("*"), "/")
+	target := meta.ResourcePath
+	if rel != "" {
+		if rel, err = cleanFolderPath(rel); err != nil {
+			return h.notFoundResponse(c)
+		}
+		if target, err = folderFilePath(meta.ResourcePath, rel); err != nil {
+			return h.notFoundResponse(c)
+		}
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return h.notFoundResponse(c)
+	}
+	if info.IsDir() {
+		return h.serveFolderListing(c, meta, rel)
+	}
+
+	file, err := os.Open(target)
+	if err != nil {
+		log.Printf("Error: Failed to open folder file %s: %v", target, err)
+		return c.String(http.StatusInternalServerError, "Failed to open file")
+	}
+	defer file.Close()
+
+	// Folder files count toward the folder's bytes_served and the monthly transfer
+	defer func() { h.recordTransfer(meta, c.Response().Size) }()
+
+	contentType := mime.TypeByExtension(filepath.Ext(target))
+	if contentType == "" {
+		contentType = h.detectContentType(target)
+	}
+	fileMeta := model.FileMetadata{OriginalName: filepath.Base(target), ContentType: contentType}
+
+	header := c.Response().Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", h.contentDisposition(fileMeta))
+	header.Set("Cache-Control", "public, max-age=3600, must-revalidate")
+	if meta.ExpiresAt != nil {
+		header.Set("X-Expires", fmt.Sprintf("%d", meta.ExpiresAt.UnixMilli()))
+	}
+	if !h.cfg.AllowIndexing || meta.NoIndex {
+		header.Set("X-Robots-Tag", "noindex, nofollow")
+	}
+
+	http.ServeContent(c.Response(), c.Request(), fileMeta.OriginalName, info.ModTime(), file)
+	if status := c.Response().Status; (status == http.StatusOK || status == http.StatusPartialContent) && !h.isLinkPreviewBot(c.Request()) {
+		h.recordAccess(meta)
+	}
+	return nil
+}
+
+// serveFolderListing lists the files below rel, as JSON for clients asking for
+// it and as one path per line otherwise
+func (h *Handler) serveFolderListing(c echo.Context, meta model.FileMetadata, rel string) error {
+	root := meta.ResourcePath
+	start := root
+	if rel != "" {
+		start = filepath.Join(root, filepath.FromSlash(rel))
+	}
+	id := filepath.Base(root)
+
+	var entries []FolderEntry
+	err := filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		entries = append(entries, FolderEntry{
+			Path: relPath,
+			Size: info.Size(),
+			URL:  joinURL(h.cfg.BaseURL, id+"/"+relPath),
+		})
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error: Failed to list folder %s: %v", start, err)
+		return c.String(http.StatusInternalServerError, "Failed to list folder")
+	}
+
+	addVary(c, "Accept")
+	c.Response().Header().Set("X-Robots-Tag", "noindex, nofollow")
+	if meta.ExpiresAt != nil {
+		c.Response().Header().Set("X-Expires", fmt.Sprintf("%d", meta.ExpiresAt.UnixMilli()))
+	}
+
+	if strings.Contains(c.Request().Header.Get("Accept"), "application/json") {
+		response := map[string]any{
+			"name":  meta.OriginalName,
+			"size":  meta.Size,
+			"files": entries,
+		}
+		if meta.ExpiresAt != nil {
+			response["expires_at"] = meta.ExpiresAt.Format(time.RFC3339)
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+
+	var listing strings.Builder
+	for _, entry := range entries {
+		listing.WriteString(entry.Path + "\n")
+	}
+	c.Response().Header().Set("Content-Type", "text/plain; charset=utf-8")
+	return c.String(http.StatusOK, listing.String())
+}
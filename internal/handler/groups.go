@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/expiration"
+	"github.com/marianozunino/drop/internal/model"
+)
+
+// GroupIDLength is the length of the group ids handed out by the server
+const GroupIDLength = 32
+
+// newGroupID is the group_id value that starts a new group
+const newGroupID = "new"
+
+var groupIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// resolveGroupID checks the group_id form field and replaces "new" with a fresh
+// id, which the response returns so it can be sent with the other members.
+// Group ids are only generated by the server: knowing one is what allows adding
+// resources to a group, and deleting any of them can delete the whole group.
+func (h *Handler) resolveGroupID(c echo.Context) error {
+	form := c.Request().Form
+	switch groupID := form.Get("group_id"); {
+	case groupID == "":
+		return nil
+	case groupID == newGroupID:
+		id, err := generateID(GroupIDLength)
+		if err != nil {
+			return fmt.Errorf("failed to generate group id: %w", err)
+		}
+		form.Set("group_id", id)
+		return nil
+	case !groupIDPattern.MatchString(groupID):
+		return fmt.Errorf("invalid group_id, send %q to start a group and then the id it returns", newGroupID)
+	}
+	return nil
+}
+
+// requestGroupID is the group the resource being uploaded joins
+func requestGroupID(c echo.Context) string {
+	return c.Request().Form.Get("group_id")
+}
+
+// deleteGroupMembers removes the rest of the group of a deleted or consumed
+// resource when cascade_group_deletes is enabled
+func (h *Handler) deleteGroupMembers(meta model.FileMetadata) {
+	expiration.DeleteGroupMembers(h.cfg, h.db, meta)
+}
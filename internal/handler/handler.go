@@ -1,37 +1,250 @@
 package handler
 
 import (
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/marianozunino/drop/internal/config"
 	"github.com/marianozunino/drop/internal/db"
 	"github.com/marianozunino/drop/internal/expiration"
+	"github.com/marianozunino/drop/internal/model"
+	"github.com/marianozunino/drop/internal/webhook"
 )
 
+// Version is the server version, set at build time with
+// -ldflags "-X github.com/marianozunino/drop/internal/handler.Version=..."
+var Version = "dev"
+
 // Handler handles HTTP requests
 type Handler struct {
 	expManager     *expiration.ExpirationManager
-	db             *db.DB
+	db             db.Store
 	cfg            *config.Config
 	chunkedManager *ChunkedUploadManager
+	transformers   []UploadTransformer
+	maintenance    atomic.Bool
+	reindexMu      sync.Mutex
+	streamBuffers  sync.Pool
+	ids            IDGenerator
+	access         *db.AccessCounter
+	scanner        Scanner
+	scans          *scanTracker
+	passwords      *passwordAttempts
+	pow            *powIssuer
+	thumbnailQueue chan string
+	adminSessions  *adminSessions
+	webhooks       *webhook.Notifier
+	transfer       transferMeter
 }
 
 // NewHandler creates a new handler
-func NewHandler(expManager *expiration.ExpirationManager, cfg *config.Config, db *db.DB) *Handler {
-	return &Handler{
+func NewHandler(expManager *expiration.ExpirationManager, cfg *config.Config, db db.Store) *Handler {
+	h := &Handler{
 		expManager:     expManager,
 		db:             db,
 		cfg:            cfg,
-		chunkedManager: NewChunkedUploadManager(cfg),
+		chunkedManager: NewChunkedUploadManager(cfg, db),
+		ids:            newIDGenerator(cfg.IDStrategy),
+		passwords:      newPasswordAttempts(cfg.PasswordAttemptLimit(), cfg.PasswordLockout()),
+		adminSessions:  newAdminSessions(cfg.AdminSessionSecret, adminSessionTTL),
+	}
+	h.transformers = h.buildUploadTransformers(cfg.UploadTransformers)
+	if cfg.ScanEnabled {
+		h.scanner = newClamdScanner(cfg.ClamdAddress)
+		h.scans = newScanTracker()
+	}
+	if cfg.PoWDifficulty > 0 {
+		h.pow = newPoWIssuer(cfg.PoWDifficulty)
+	}
+	if cfg.PregenerateThumbnails {
+		h.startThumbnailWorker()
+	}
+	h.maintenance.Store(cfg.MaintenanceMode)
+	return h
+}
+
+// ChunkedUploads returns the manager of the chunked upload sessions, whose
+// reaper runs alongside the expiration manager
+func (h *Handler) ChunkedUploads() *ChunkedUploadManager {
+	return h.chunkedManager
+}
+
+// SetAccessCounter batches download counts through the counter instead of
+// writing each access directly
+func (h *Handler) SetAccessCounter(counter *db.AccessCounter) {
+	h.access = counter
+}
+
+// SetWebhooks reports uploads and deletions through the notifier. A nil
+// notifier reports nothing.
+func (h *Handler) SetWebhooks(notifier *webhook.Notifier) {
+	h.webhooks = notifier
+}
+
+// recordAccess counts one download or redirect of the resource
+func (h *Handler) recordAccess(meta model.FileMetadata) {
+	if h.access != nil {
+		h.access.Record(meta.ID())
+		return
+	}
+	delta := map[string]db.AccessDelta{meta.ID(): {Count: 1, Last: time.Now()}}
+	if err := h.db.AddAccessCounts(delta); err != nil {
+		log.Printf("Warning: Failed to record access to %s: %v", meta.ID(), err)
 	}
 }
 
+// TypeStats is the number and total size of the stored files of a media type
+// like "image" in the upload statistics
+type TypeStats struct {
+	Files int   `json:"files"`
+	Size  int64 `json:"size"`
+}
+
 // HandleUploadStats returns upload statistics
 func (h *Handler) HandleUploadStats(c echo.Context) error {
+	usage, err := h.db.UsageByContentType()
+	if err != nil {
+		log.Printf("Error: Failed to sum up stored files: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get stats"})
+	}
+
+	// Content types are grouped by their top-level type, "image/png" and
+	// "image/jpeg" both count as "image"
+	var totalFiles int
+	var totalSize int64
+	types := make(map[string]TypeStats)
+	for _, u := range usage {
+		mediaType, _, _ := strings.Cut(u.ContentType, "/")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "" {
+			mediaType = "unknown"
+		}
+		t := types[mediaType]
+		t.Files += u.Files
+		t.Size += u.Size
+		types[mediaType] = t
+		totalFiles += u.Files
+		totalSize += u.Size
+	}
+
+	period, served := h.transferUsage(time.Now())
 	stats := map[string]interface{}{
-		"active_uploads": len(h.chunkedManager.uploads),
+		"active_uploads":        len(h.chunkedManager.uploads),
+		"maintenance_mode":      h.MaintenanceMode(),
+		"total_files":           totalFiles,
+		"total_size":            totalSize,
+		"types":                 types,
+		"transfer_period":       period,
+		"transfer_bytes_served": served,
+	}
+	if limit := h.cfg.MonthlyTransferCapToBytes(); limit > 0 {
+		stats["transfer_cap_bytes"] = limit
 	}
 
 	return c.JSON(http.StatusOK, stats)
 }
+
+// LimitsResponse describes the upload limits enforced by the server
+type LimitsResponse struct {
+	MaxSize           int64    `json:"max_size"`
+	ChunkSize         int64    `json:"chunk_size"`
+	AllowedTypes      []string `json:"allowed_types"`
+	BlockedTypes      []string `json:"blocked_types"`
+	BlockedExtensions []string `json:"blocked_extensions"`
+	RequireExpiration bool     `json:"require_expiration"`
+	PoWDifficulty     int      `json:"pow_difficulty,omitempty"`
+	MaxDownloads      int      `json:"max_downloads,omitempty"`
+}
+
+// HandleLimits returns the upload limits so clients can validate before
+// uploading. Limits follow the tier of the X-API-Key header when one is sent.
+func (h *Handler) HandleLimits(c echo.Context) error {
+	policy, err := h.resolveUploadPolicy(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid API key"})
+	}
+	addVary(c, APIKeyHeader)
+	return c.JSON(http.StatusOK, h.uploadLimits(policy))
+}
+
+// uploadLimits collects the limits of an upload policy exposed to clients
+func (h *Handler) uploadLimits(policy uploadPolicy) LimitsResponse {
+	return LimitsResponse{
+		MaxSize:           policy.MaxSize,
+		MaxDownloads:      policy.MaxDownloads,
+		ChunkSize:         h.cfg.ChunkSizeToBytes(),
+		AllowedTypes:      append([]string{}, h.cfg.AllowedContentTypes...),
+		BlockedTypes:      append([]string{}, h.cfg.BlockedContentTypes...),
+		BlockedExtensions: []string{},
+		RequireExpiration: h.cfg.RequireExplicitExpiration,
+		PoWDifficulty:     h.cfg.PoWDifficulty,
+	}
+}
+
+// HandleCapabilities answers HEAD and OPTIONS on / with the upload limits as
+// headers, a cheap probe for clients that don't want the /api/limits JSON.
+// Limits follow the tier of the X-API-Key header when one is sent.
+func (h *Handler) HandleCapabilities(c echo.Context) error {
+	policy, err := h.resolveUploadPolicy(c)
+	if err != nil {
+		return c.NoContent(http.StatusUnauthorized)
+	}
+
+	header := c.Response().Header()
+	header.Set("X-Max-Upload-Size", strconv.FormatInt(policy.MaxSize, 10))
+	header.Set("X-Chunk-Size", strconv.FormatInt(h.cfg.ChunkSizeToBytes(), 10))
+	header.Set("X-URL-Shortening-Enabled", strconv.FormatBool(h.cfg.URLShorteningEnabled))
+	header.Set("X-Require-Expiration", strconv.FormatBool(h.cfg.RequireExplicitExpiration))
+	header.Set("Accept-Ranges", "bytes")
+	addVary(c, APIKeyHeader)
+
+	if c.Request().Method == http.MethodOptions {
+		header.Set("Allow", "GET, HEAD, POST, OPTIONS")
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// appPath returns an absolute path under the configured path prefix
+func (h *Handler) appPath(path string) string {
+	return h.cfg.PathPrefix + path
+}
+
+// joinURL appends a path to the base URL with exactly one slash between them,
+// whether or not base_url ends with one
+func joinURL(base, path string) string {
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// addVary appends request headers to the Vary response header so shared caches
+// keep one representation per value, skipping headers that are already listed
+func addVary(c echo.Context, headers ...string) {
+	header := c.Response().Header()
+	existing := strings.Split(strings.Join(header.Values("Vary"), ","), ",")
+	for _, name := range headers {
+		found := false
+		for _, v := range existing {
+			if strings.EqualFold(strings.TrimSpace(v), name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			existing = append(existing, name)
+		}
+	}
+
+	var values []string
+	for _, v := range existing {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	header.Set("Vary", strings.Join(values, ", "))
+}
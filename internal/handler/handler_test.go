@@ -1,13 +1,39 @@
 package handler
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/marianozunino/drop/internal/config"
@@ -15,11 +41,14 @@ import (
 	"github.com/marianozunino/drop/internal/expiration"
 	"github.com/marianozunino/drop/internal/model"
 	"github.com/marianozunino/drop/internal/testutil"
+	"github.com/marianozunino/drop/internal/webhook"
+	"github.com/marianozunino/drop/templates"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
-func setupTestEnvironment(t *testing.T) (string, *Handler, *db.DB, func()) {
+func setupTestEnvironment(t *testing.T) (string, *Handler, db.Store, func()) {
 	tempDir, err := os.MkdirTemp("", "drop-test")
 	require.NoError(t, err)
 
@@ -27,6 +56,7 @@ func setupTestEnvironment(t *testing.T) (string, *Handler, *db.DB, func()) {
 
 	cfg := &config.Config{
 		UploadPath:               tempDir,
+		ThumbnailPath:            filepath.Join(tempDir, "thumbnails"),
 		MinAge:                   1,
 		MaxAge:                   30,
 		MaxSize:                  250.0,
@@ -43,7 +73,7 @@ func setupTestEnvironment(t *testing.T) (string, *Handler, *db.DB, func()) {
 		},
 	}
 
-	testDB, err := db.NewDB(cfg)
+	testDB, err := db.NewStore(cfg)
 	require.NoError(t, err)
 
 	// Run migrations for tests
@@ -63,7 +93,7 @@ func setupTestEnvironment(t *testing.T) (string, *Handler, *db.DB, func()) {
 	return tempDir, h, testDB, cleanup
 }
 
-func createTestFile(t *testing.T, tempDir string, db *db.DB, filename, content string, oneTimeView bool) string {
+func createTestFile(t *testing.T, tempDir string, db db.Store, filename, content string, oneTimeView bool) string {
 	filePath := filepath.Join(tempDir, filename)
 	err := os.WriteFile(filePath, []byte(content), 0o644)
 	require.NoError(t, err)
@@ -349,3 +379,5256 @@ func TestCustomUserAgentDetection(t *testing.T) {
 		})
 	}
 }
+
+// buildTestJPEG returns a minimal JPEG-framed stream with an EXIF APP1 segment
+func buildTestJPEG(exif bool) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xD8})
+	if exif {
+		payload := []byte("Exif\x00\x00GPS-SECRET")
+		buf.Write([]byte{0xFF, 0xE1, 0x00, byte(len(payload) + 2)})
+		buf.Write(payload)
+	}
+	quant := []byte{0x00, 0x01, 0x02, 0x03}
+	buf.Write([]byte{0xFF, 0xDB, 0x00, byte(len(quant) + 2)})
+	buf.Write(quant)
+	buf.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0x11, 0x22, 0x33})
+	buf.Write([]byte{0xFF, 0xD9})
+	return buf.Bytes()
+}
+
+func TestUploadTransformersCompose(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	h.transformers = h.buildUploadTransformers([]string{"exif_strip", "gzip"})
+	require.Len(t, h.transformers, 2)
+
+	content := buildTestJPEG(true)
+	header := &multipart.FileHeader{Filename: "photo.jpg", Size: int64(len(content))}
+
+	info, err := h.saveFromFormFile(bytes.NewReader(content), header, h.cfg.MaxSizeToBytes(), slugTarget{}, false, false)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasSuffix(info.StoredFilename, ".jpg.gz"))
+	assert.Equal(t, "photo.jpg.gz", info.OriginalFilename)
+	assert.Equal(t, "application/gzip", info.ContentType)
+
+	stored, err := os.ReadFile(info.FilePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(stored)), info.Size)
+
+	gz, err := gzip.NewReader(bytes.NewReader(stored))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+
+	assert.Equal(t, buildTestJPEG(false), decoded)
+	assert.NotContains(t, string(decoded), "GPS-SECRET")
+
+	_, err = os.Stat(info.FilePath + ".tmp")
+	assert.True(t, os.IsNotExist(err), "temp file should not linger")
+}
+
+func TestExifStripPassesThroughNonJPEG(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	h.transformers = h.buildUploadTransformers([]string{"exif_strip", "unknown"})
+	require.Len(t, h.transformers, 1)
+
+	content := "plain text, not an image"
+	header := &multipart.FileHeader{Filename: "notes.txt", Size: int64(len(content))}
+
+	info, err := h.saveFromFormFile(strings.NewReader(content), header, h.cfg.MaxSizeToBytes(), slugTarget{}, false, false)
+	require.NoError(t, err)
+
+	stored, err := os.ReadFile(info.FilePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(stored))
+	assert.Equal(t, int64(len(content)), info.Size)
+}
+
+func TestHeicJPEGTransformer(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	// A stand-in for heif-convert that writes a prepared JPEG
+	jpegPath := filepath.Join(t.TempDir(), "converted.jpg")
+	converted := buildTestJPEG(false)
+	require.NoError(t, os.WriteFile(jpegPath, converted, 0644))
+	converter := filepath.Join(t.TempDir(), "fake-heif-convert")
+	require.NoError(t, os.WriteFile(converter, []byte("#!/bin/sh\ncp "+jpegPath+" \"$2\"\n"), 0755))
+
+	h.cfg.HeicConverter = converter + " {input} {output}"
+	h.transformers = h.buildUploadTransformers([]string{"heic_jpeg"})
+	require.Len(t, h.transformers, 1)
+
+	heic := append([]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), bytes.Repeat([]byte{0x42}, 64)...)
+	upload := func(keepOriginal bool) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "IMG_0001.HEIC")
+		require.NoError(t, err)
+		part.Write(heic)
+		if keepOriginal {
+			writer.WriteField("keep_original", "true")
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		return rec
+	}
+
+	stored := path.Base(strings.TrimSpace(upload(false).Body.String()))
+	assert.Equal(t, ".jpg", filepath.Ext(stored))
+	rec := requestFile(t, h, stored, "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+	assert.Equal(t, converted, rec.Body.Bytes())
+
+	kept := path.Base(strings.TrimSpace(upload(true).Body.String()))
+	assert.Equal(t, ".HEIC", filepath.Ext(kept), "keep_original skips the conversion")
+	content, err := os.ReadFile(filepath.Join(tempDir, kept))
+	require.NoError(t, err)
+	assert.Equal(t, heic, content)
+
+	// A converter that fails leaves the photo as it was uploaded
+	h.cfg.HeicConverter = "false {input} {output}"
+	h.transformers = h.buildUploadTransformers([]string{"heic_jpeg"})
+	original := path.Base(strings.TrimSpace(upload(false).Body.String()))
+	assert.Equal(t, ".HEIC", filepath.Ext(original))
+	content, err = os.ReadFile(filepath.Join(tempDir, original))
+	require.NoError(t, err)
+	assert.Equal(t, heic, content)
+
+	// So does a missing converter
+	h.cfg.HeicConverter = "drop-missing-heic-converter {input} {output}"
+	h.transformers = h.buildUploadTransformers([]string{"heic_jpeg"})
+	original = path.Base(strings.TrimSpace(upload(false).Body.String()))
+	assert.Equal(t, ".HEIC", filepath.Ext(original))
+
+	leftovers, err := filepath.Glob(filepath.Join(os.TempDir(), "drop-heic-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers, "temp files are removed")
+}
+
+func TestHandleDeleteWithTokenHeader(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	testFilename := "deleteme.txt"
+	filePath := createTestFile(t, tempDir, db, testFilename, "bye", false)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodDelete, "/"+testFilename, nil)
+	req.Header.Set("X-Token", "wrong-token")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues(testFilename)
+
+	err := h.HandleDelete(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	_, err = os.Stat(filePath)
+	assert.NoError(t, err, "The file should still exist")
+
+	req = httptest.NewRequest(http.MethodDelete, "/"+testFilename, nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues(testFilename)
+
+	err = h.HandleDelete(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "The file should have been deleted")
+
+	_, err = db.GetMetadataByID(filePath)
+	assert.Error(t, err)
+}
+
+func TestHandleDeleteURLShortenerWithQueryToken(t *testing.T) {
+	_, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	meta := model.FileMetadata{
+		ResourcePath:   "short1",
+		Token:          "short-token",
+		OriginalURL:    "https://example.com",
+		IsURLShortener: true,
+	}
+	require.NoError(t, db.StoreMetadata(&meta))
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodDelete, "/short1", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues("short1")
+
+	err := h.HandleDelete(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/short1?token=short-token", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues("short1")
+
+	err = h.HandleDelete(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	_, err = db.GetMetadataByID("short1")
+	assert.Error(t, err)
+}
+
+func TestAdminDashboardRejectsInvalidCursor(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	e := echo.New()
+	for _, query := range []string{"sort=uploadDate&cursor=garbage", "sort=size&cursor=ten"} {
+		req := httptest.NewRequest(http.MethodGet, "/admin?"+query, nil)
+		req.AddCookie(adminCookie(t, h))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		err := h.HandleAdminDashboard(c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestParsePageLimit(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	assert.Equal(t, 10, h.parsePageLimit(""))
+	assert.Equal(t, 10, h.parsePageLimit("-5"))
+	assert.Equal(t, 50, h.parsePageLimit("50"))
+	assert.Equal(t, 200, h.parsePageLimit("10000"))
+
+	h.cfg.MaxPageSize = 25
+	assert.Equal(t, 25, h.parsePageLimit("50"))
+}
+
+func TestFinalizeChunkedUploadIsAtomic(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	newUpload := func(id string) *ChunkedUpload {
+		uploadDir := filepath.Join(tempDir, id)
+		require.NoError(t, os.MkdirAll(uploadDir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(uploadDir, "chunk_0"), []byte("hello "), 0o644))
+		return &ChunkedUpload{
+			UploadID:       id,
+			Filename:       "greeting.txt",
+			TotalSize:      11,
+			TotalChunks:    2,
+			UploadedChunks: map[int]bool{0: true, 1: true},
+		}
+	}
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/upload/chunk", nil), httptest.NewRecorder())
+
+	// A missing chunk must not leave a partial file at the final path
+	broken := newUpload("brkn")
+	_, err := h.finalizeChunkedUpload(broken, c)
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(tempDir, "brkn.txt"))
+	assert.True(t, os.IsNotExist(err), "Partial upload must not be visible")
+
+	upload := newUpload("good")
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "good", "chunk_1"), []byte("world"), 0o644))
+	token, err := h.finalizeChunkedUpload(upload, c)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	finalPath := filepath.Join(tempDir, "good.txt")
+	content, err := os.ReadFile(finalPath)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	_, err = os.Stat(filepath.Join(tempDir, "good"))
+	assert.True(t, os.IsNotExist(err), "Chunk directory should be removed")
+
+	meta, err := db.GetMetadataByID(finalPath)
+	require.NoError(t, err)
+	assert.Equal(t, token, meta.Token)
+}
+
+func TestHandleLimits(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/limits", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := h.HandleLimits(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var limits LimitsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &limits))
+	assert.Equal(t, int64(250*1024*1024), limits.MaxSize)
+	assert.Equal(t, []string{}, limits.AllowedTypes)
+	assert.Equal(t, []string{}, limits.BlockedTypes)
+	assert.NotNil(t, limits.BlockedExtensions)
+
+	// Content type restrictions are reported as configured
+	h.cfg.AllowedContentTypes = []string{"image/*", "application/pdf"}
+	h.cfg.BlockedContentTypes = []string{"image/svg+xml"}
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.HandleLimits(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/limits", nil), rec)))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &limits))
+	assert.Equal(t, []string{"image/*", "application/pdf"}, limits.AllowedTypes)
+	assert.Equal(t, []string{"image/svg+xml"}, limits.BlockedTypes)
+
+	// API keys get the limits of their tier
+	h.cfg.UploadTiers = map[string]config.UploadTier{"pro": {MaxSize: 1024, MaxDownloads: 5}}
+	h.cfg.APIKeys = []config.APIKey{{Key: "pro-key", Tier: "pro"}}
+	limitsFor := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/limits", nil)
+		req.Header.Set(APIKeyHeader, apiKey)
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleLimits(e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec = limitsFor("pro-key")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &limits))
+	assert.Equal(t, int64(1024*1024*1024), limits.MaxSize)
+	assert.Equal(t, 5, limits.MaxDownloads)
+	assert.Contains(t, rec.Header().Get("Vary"), APIKeyHeader)
+
+	assert.Equal(t, http.StatusUnauthorized, limitsFor("wrong-key").Code)
+}
+
+func initChunkedUpload(t *testing.T, h *Handler, fields map[string]string) map[string]interface{} {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range fields {
+		require.NoError(t, writer.WriteField(key, value))
+	}
+	require.NoError(t, writer.Close())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/upload/init", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	require.NoError(t, h.InitiateChunkedUpload(c))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response
+}
+
+// uploadTestChunk sends a chunk with the upload token of the session
+func uploadTestChunk(t *testing.T, h *Handler, uploadID string, index int, data string) *httptest.ResponseRecorder {
+	return uploadTestChunkWithToken(t, h, uploadID, index, data, sessionToken(h, uploadID))
+}
+
+// sessionToken returns the upload token of a session, empty when there is none
+func sessionToken(h *Handler, uploadID string) string {
+	h.chunkedManager.mu.RLock()
+	defer h.chunkedManager.mu.RUnlock()
+	if upload, ok := h.chunkedManager.uploads[uploadID]; ok {
+		return upload.UploadToken
+	}
+	return ""
+}
+
+func uploadTestChunkWithToken(t *testing.T, h *Handler, uploadID string, index int, data, token string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("chunk", "chunk")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/upload/chunk", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set(UploadTokenHeader, token)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("upload_id", "chunk")
+	c.SetParamValues(uploadID, fmt.Sprintf("%d", index))
+
+	require.NoError(t, h.UploadChunk(c))
+	return rec
+}
+
+func TestChunkedUploadResumeAndDedupByContentHash(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := "hello world"
+	sum := md5.Sum([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	fields := map[string]string{
+		"filename":     "greeting.txt",
+		"size":         fmt.Sprintf("%d", len(content)),
+		"chunk_size":   "6",
+		"content_hash": hash,
+	}
+
+	first := initChunkedUpload(t, h, fields)
+	uploadID := first["upload_id"].(string)
+	assert.Nil(t, first["already_exists"])
+	require.NotEmpty(t, first["upload_token"])
+
+	rec := uploadTestChunk(t, h, uploadID, 0, content[:6])
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Initiating again with the same hash and the token resumes the session
+	fields["upload_token"] = first["upload_token"].(string)
+	resumed := initChunkedUpload(t, h, fields)
+	assert.Equal(t, uploadID, resumed["upload_id"])
+	assert.Equal(t, []interface{}{float64(0)}, resumed["uploaded_chunks"])
+
+	rec = uploadTestChunk(t, h, uploadID, 1, content[6:])
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var complete map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &complete))
+	assert.Equal(t, hash, complete["md5"])
+
+	// Once stored, the same content is reported as already existing
+	delete(fields, "upload_token")
+	existing := initChunkedUpload(t, h, fields)
+	assert.Equal(t, true, existing["already_exists"])
+	assert.Equal(t, complete["file_url"], existing["file_url"])
+	assert.Nil(t, existing["token"])
+}
+
+func TestChunkedUploadRejectsContentHashMismatch(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	sum := md5.Sum([]byte("something else"))
+	response := initChunkedUpload(t, h, map[string]string{
+		"filename":     "data.bin",
+		"size":         "4",
+		"chunk_size":   "4",
+		"content_hash": hex.EncodeToString(sum[:]),
+	})
+	uploadID := response["upload_id"].(string)
+
+	rec := uploadTestChunk(t, h, uploadID, 0, "data")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	_, err := os.Stat(filepath.Join(tempDir, uploadID+".bin"))
+	assert.True(t, os.IsNotExist(err), "Corrupt upload must not be stored")
+	_, err = os.Stat(filepath.Join(tempDir, uploadID))
+	assert.True(t, os.IsNotExist(err), "Corrupt session should be discarded")
+}
+
+func TestMaintenanceModeRefusesUploadsButServesFiles(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	createTestFile(t, tempDir, db, "existing.txt", "still here", false)
+
+	e := echo.New()
+	adminReq := httptest.NewRequest(http.MethodPost, "/admin/maintenance", strings.NewReader("enabled=true"))
+	adminReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	adminReq.AddCookie(adminCookie(t, h))
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleAdminMaintenance(e.NewContext(adminReq, rec)))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.True(t, h.MaintenanceMode())
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "new.txt")
+	require.NoError(t, err)
+	part.Write([]byte("new content"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.HandleUpload(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	req = httptest.NewRequest(http.MethodPost, "/upload/init", strings.NewReader("filename=a.txt&size=10"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.InitiateChunkedUpload(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/existing.txt", nil)
+	rec = httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues("existing.txt")
+	require.NoError(t, h.HandleFileAccess(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "still here", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.HandleHealth(e.NewContext(httptest.NewRequest(http.MethodGet, "/health", nil), rec)))
+	assert.Contains(t, rec.Body.String(), `"maintenance_mode":true`)
+}
+
+func TestHandleVersion(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	previous := Version
+	defer func() { Version = previous }()
+	Version = "1.2.3"
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleVersion(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/version", nil), rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"version":"1.2.3"}`, rec.Body.String())
+}
+
+func TestVaryHeaderOnNegotiatedResponses(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	e := echo.New()
+	for _, accept := range []string{"application/json", "text/plain"} {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "vary.txt")
+		require.NoError(t, err)
+		part.Write([]byte("negotiated"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Accept", rec.Header().Get("Vary"), accept)
+	}
+
+	createTestFile(t, tempDir, db, "once.txt", "secret", true)
+	req := httptest.NewRequest(http.MethodGet, "/once.txt", nil)
+	req.Header.Set("User-Agent", "Slackbot 1.0")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues("once.txt")
+	require.NoError(t, h.HandleFileAccess(c))
+	assert.Contains(t, rec.Header().Get("Vary"), "User-Agent")
+	assert.Contains(t, rec.Header().Get("Vary"), "Accept")
+}
+
+func TestAddVaryMergesExistingValues(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	c.Response().Header().Add("Vary", "Origin")
+	addVary(c, "Accept", "origin")
+	addVary(c, "Accept")
+	assert.Equal(t, []string{"Origin, Accept"}, rec.Header().Values("Vary"))
+}
+
+func TestDefaultContentDispositionForAmbiguousTypes(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := "opaque binary content"
+	filename := "blob.bin"
+	filePath := filepath.Join(tempDir, filename)
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0o644))
+
+	meta := model.FileMetadata{
+		ResourcePath: filePath,
+		Token:        "test-token",
+		OriginalName: "blob.bin",
+		Size:         int64(len(content)),
+		ContentType:  "application/octet-stream",
+	}
+	require.NoError(t, db.StoreMetadata(&meta))
+
+	request := func(rangeHeader string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/"+filename, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(filename)
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	testCases := []struct {
+		setting  string
+		expected string
+	}{
+		{setting: "", expected: "attachment"},
+		{setting: "attachment", expected: "attachment"},
+		{setting: "inline", expected: "inline"},
+	}
+
+	for _, tc := range testCases {
+		t.Run("default="+tc.setting, func(t *testing.T) {
+			h.cfg.DefaultContentDisposition = tc.setting
+			expected := tc.expected + `; filename="blob.bin"`
+
+			rec := request("")
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, expected, rec.Header().Get("Content-Disposition"))
+
+			rec = request("bytes=0-4")
+			assert.Equal(t, http.StatusPartialContent, rec.Code)
+			assert.Equal(t, expected, rec.Header().Get("Content-Disposition"))
+		})
+	}
+
+	// Known types keep their explicit rules regardless of the default
+	h.cfg.DefaultContentDisposition = "inline"
+	assert.Contains(t, h.contentDisposition(model.FileMetadata{ContentType: "application/zip", OriginalName: "a.zip"}), "attachment")
+	h.cfg.DefaultContentDisposition = "attachment"
+	assert.Contains(t, h.contentDisposition(model.FileMetadata{ContentType: "image/png", OriginalName: "a.png"}), "inline")
+}
+
+func TestAdminReindexRepairsMissingMetadata(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	old := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	writeOld := func(name, content string) string {
+		path := filepath.Join(tempDir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		require.NoError(t, os.Chtimes(path, old, old))
+		return path
+	}
+
+	knownPath := createTestFile(t, tempDir, db, "known.txt", "already indexed", false)
+	knownMeta, err := db.GetMetadataByID(knownPath)
+	require.NoError(t, err)
+
+	orphanContent := "hello from a restored backup"
+	orphanPath := writeOld("orphan.txt", orphanContent)
+	for i := 0; i < 10; i++ {
+		writeOld(fmt.Sprintf("orphan%d.bin", i), fmt.Sprintf("content %d", i))
+	}
+	writeOld("assembling.txt.tmp", "partial")
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "fresh.txt"), []byte("still uploading"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "upload-session"), 0o755))
+
+	reindex := func(authenticated bool) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/admin/reindex", nil)
+		if authenticated {
+			req.AddCookie(adminCookie(t, h))
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleAdminReindex(e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := reindex(false)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = reindex(true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var result ReindexResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, ReindexResult{Scanned: 13, Repaired: 11, Skipped: 2}, result)
+
+	meta, err := db.GetMetadataByID(orphanPath)
+	require.NoError(t, err)
+	sum := md5.Sum([]byte(orphanContent))
+	assert.Equal(t, hex.EncodeToString(sum[:]), meta.ContentHash)
+	assert.Equal(t, int64(len(orphanContent)), meta.Size)
+	assert.Contains(t, meta.ContentType, "text/plain")
+	assert.True(t, meta.UploadDate.Equal(old), "upload date should come from the file mtime")
+	assert.NotEmpty(t, meta.Token)
+
+	_, err = db.GetMetadataByID(filepath.Join(tempDir, "fresh.txt"))
+	assert.Error(t, err, "recently modified files should be left alone")
+
+	unchanged, err := db.GetMetadataByID(knownPath)
+	require.NoError(t, err)
+	assert.Equal(t, knownMeta.Token, unchanged.Token)
+
+	// A second run finds nothing left to repair
+	rec = reindex(true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, ReindexResult{Scanned: 13, Skipped: 13}, result)
+
+	again, err := db.GetMetadataByID(orphanPath)
+	require.NoError(t, err)
+	assert.Equal(t, meta.Token, again.Token)
+
+	// The repaired file is now served
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/orphan.txt", nil)
+	rec = httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues("orphan.txt")
+	require.NoError(t, h.HandleFileAccess(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, orphanContent, rec.Body.String())
+}
+
+func TestHandleFileAccessWithoutMetadata(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := "copied into the upload directory by hand"
+	filename := "imported.txt"
+	filePath := filepath.Join(tempDir, filename)
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0o644))
+	modTime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(filePath, modTime, modTime))
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/"+filename, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(filename)
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	rec := serve(nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, content, rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Equal(t, `attachment; filename="imported.txt"`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, modTime.UTC().Format(http.TimeFormat), rec.Header().Get("Last-Modified"))
+	assert.NotEmpty(t, rec.Header().Get("ETag"))
+
+	rec = serve(map[string]string{"If-Modified-Since": modTime.UTC().Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+
+	rec = serve(map[string]string{"Range": "bytes=0-5"})
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, content[:6], rec.Body.String())
+	assert.Equal(t, `attachment; filename="imported.txt"`, rec.Header().Get("Content-Disposition"))
+
+	_, err := os.Stat(filePath)
+	assert.NoError(t, err, "Legacy files must not be deleted when served")
+}
+
+func TestLegacyFallbackSkipsNonUploads(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "abcd.txt.tmp"), []byte("upload in progress"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "test.db-wal"), []byte("wal"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "session"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "session", "chunk_0"), []byte("chunk"), 0o644))
+
+	for _, name := range []string{"abcd.txt.tmp", "test.db", "test.db-wal", "session"} {
+		for method, handle := range map[string]echo.HandlerFunc{
+			http.MethodGet:  h.HandleFileAccess,
+			http.MethodHead: h.HandleFileHead,
+		} {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(method, "/"+name, nil), rec)
+			c.SetParamNames("filename")
+			c.SetParamValues(name)
+			require.NoError(t, handle(c))
+			assert.Equal(t, http.StatusNotFound, rec.Code, method+" "+name)
+		}
+
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/"+name+"/meta.json", nil), rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(name)
+		require.NoError(t, h.HandleFileMeta(c))
+		assert.Equal(t, http.StatusNotFound, rec.Code, "meta of "+name)
+	}
+
+	_, err := os.Stat(filepath.Join(tempDir, "abcd.txt.tmp"))
+	assert.NoError(t, err, "hidden files are left alone")
+}
+
+// cancelingWriter cancels the request context after the first write, simulating a client
+// that disconnects mid-download
+type cancelingWriter struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+	writes int
+}
+
+func (w *cancelingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	w.cancel()
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestStreamFileStopsWhenContextCanceled(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.StreamingBufferSize = config.MinStreamingBufferKB
+
+	content := bytes.Repeat([]byte("x"), 8*config.MinStreamingBufferKB*1024)
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &cancelingWriter{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+
+	written, err := h.streamFileOptimized(ctx, w, bytes.NewReader(content))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int64(config.MinStreamingBufferKB*1024), written)
+	assert.Equal(t, 1, w.writes)
+}
+
+func TestCanceledDownloadKeepsOneTimeFile(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.StreamingBufferSize = config.MinStreamingBufferKB
+
+	filename := "once.bin"
+	filePath := createTestFile(t, tempDir, db, filename, strings.Repeat("y", 4*config.MinStreamingBufferKB*1024), true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/"+filename, nil).WithContext(ctx)
+	w := &cancelingWriter{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	c := e.NewContext(req, w)
+	c.SetParamNames("filename")
+	c.SetParamValues(filename)
+
+	err := h.HandleFileAccess(c)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, w.writes)
+
+	_, err = os.Stat(filePath)
+	assert.NoError(t, err, "An interrupted one-time download must not delete the file")
+	_, err = db.GetMetadataByID(filePath)
+	assert.NoError(t, err)
+}
+
+func TestAppendDetectedExtension(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 32)...)
+
+	upload := func(filename string, content []byte) string {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		part.Write(content)
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		storedName := filepath.Base(strings.TrimSpace(rec.Body.String()))
+		_, err = os.Stat(filepath.Join(tempDir, storedName))
+		require.NoError(t, err, "the returned URL must match the stored file")
+		return storedName
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		h.cfg.AppendDetectedExtension = false
+		assert.Empty(t, filepath.Ext(upload("photo", png)))
+	})
+
+	h.cfg.AppendDetectedExtension = true
+
+	t.Run("extension-less", func(t *testing.T) {
+		assert.Equal(t, ".png", filepath.Ext(upload("photo", png)))
+	})
+
+	t.Run("explicit extension is kept", func(t *testing.T) {
+		assert.Equal(t, ".jpg", filepath.Ext(upload("photo.jpg", png)))
+	})
+
+	t.Run("generic types get no extension", func(t *testing.T) {
+		assert.Empty(t, filepath.Ext(upload("notes", []byte("just some text"))))
+		assert.Empty(t, filepath.Ext(upload("blob", []byte{0x00, 0x01, 0x02, 0x03, 0xfe, 0xff})))
+	})
+}
+
+func TestParseUploadOptions(t *testing.T) {
+	opts, err := parseUploadOptions([]byte(`{"version":1,"one_time":true,"expires":24,"max_downloads":3,"tags":["a"]}`), false)
+	require.NoError(t, err)
+	require.NotNil(t, opts.OneTime)
+	assert.True(t, *opts.OneTime)
+	require.NotNil(t, opts.Expires)
+	assert.Equal(t, "24", string(*opts.Expires))
+	require.NotNil(t, opts.MaxDownloads)
+	assert.Equal(t, 3, *opts.MaxDownloads)
+	assert.Nil(t, opts.Secret)
+
+	opts, err = parseUploadOptions([]byte(`{"expires":"2030-01-02"}`), false)
+	require.NoError(t, err)
+	assert.Equal(t, "2030-01-02", string(*opts.Expires))
+
+	_, err = parseUploadOptions([]byte(`{"tags":["a"]}`), true)
+	assert.ErrorContains(t, err, "unknown field")
+
+	for _, invalid := range []string{`{"one_time":`, `{"version":2}`, `{"expires":true}`, `{"max_downloads":-1}`, `{} {}`} {
+		_, err = parseUploadOptions([]byte(invalid), false)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestHandleUploadWithJSONOptions(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	upload := func(fields map[string]string, optionsFile string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for k, v := range fields {
+			require.NoError(t, writer.WriteField(k, v))
+		}
+		if optionsFile != "" {
+			part, err := writer.CreateFormFile("options", "options.json")
+			require.NoError(t, err)
+			part.Write([]byte(optionsFile))
+		}
+		part, err := writer.CreateFormFile("file", "options.txt")
+		require.NoError(t, err)
+		part.Write([]byte("uploaded with options"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+	storedMeta := func(rec *httptest.ResponseRecorder) model.FileMetadata {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		name := filepath.Base(strings.TrimSpace(rec.Body.String()))
+		meta, err := db.GetMetadataByID(filepath.Join(tempDir, name))
+		require.NoError(t, err)
+		return meta
+	}
+
+	// The JSON part overrides the individual fields
+	meta := storedMeta(upload(map[string]string{
+		"one_time": "",
+		"expires":  "1",
+		"options":  `{"version":1,"one_time":false,"expires":48}`,
+	}, ""))
+	assert.False(t, meta.OneTimeView)
+	require.NotNil(t, meta.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), *meta.ExpiresAt, time.Minute)
+
+	// Sent as a file part, merged with fields it doesn't mention
+	meta = storedMeta(upload(map[string]string{"expires": "12"}, `{"one_time":true}`))
+	assert.True(t, meta.OneTimeView)
+	require.NotNil(t, meta.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(12*time.Hour), *meta.ExpiresAt, time.Minute)
+
+	rec := upload(map[string]string{"options": `{"one_time":"yes"}`}, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid options JSON")
+
+	h.cfg.StrictUploadOptions = true
+	rec = upload(map[string]string{"options": `{"tags":["x"]}`}, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unknown field")
+}
+
+func TestRobotsHeaderOnFileResponses(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	createTestFile(t, tempDir, db, "public.txt", "public", false)
+	privatePath := createTestFile(t, tempDir, db, "private.txt", "private", false)
+	meta, err := db.GetMetadataByID(privatePath)
+	require.NoError(t, err)
+	meta.NoIndex = true
+	require.NoError(t, db.StoreMetadata(&meta))
+
+	robotsTag := func(filename string) string {
+		req := httptest.NewRequest(http.MethodGet, "/"+filename, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(filename)
+		require.NoError(t, h.HandleFileAccess(c))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Header().Get("X-Robots-Tag")
+	}
+
+	assert.Equal(t, "noindex, nofollow", robotsTag("public.txt"))
+	assert.Equal(t, "noindex, nofollow", robotsTag("private.txt"))
+
+	h.cfg.AllowIndexing = true
+	assert.Empty(t, robotsTag("public.txt"))
+	assert.Equal(t, "noindex, nofollow", robotsTag("private.txt"), "per-file noindex applies even when indexing is allowed")
+}
+
+func TestUploadWithNoIndexOption(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	require.NoError(t, writer.WriteField("noindex", ""))
+	part, err := writer.CreateFormFile("file", "hidden.txt")
+	require.NoError(t, err)
+	part.Write([]byte("keep me out of search results"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	meta, err := db.GetMetadataByID(filepath.Join(tempDir, filepath.Base(strings.TrimSpace(rec.Body.String()))))
+	require.NoError(t, err)
+	assert.True(t, meta.NoIndex)
+}
+
+func TestHandleRobots(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	robots := func() string {
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleRobots(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/robots.txt", nil), rec)))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, "User-agent: *\nDisallow: /\n", robots())
+
+	h.cfg.AllowIndexing = true
+	assert.Equal(t, "User-agent: *\nDisallow:\n", robots())
+
+	h.cfg.RobotsTxt = "User-agent: *\nDisallow: /admin\n"
+	assert.Equal(t, "User-agent: *\nDisallow: /admin\n", robots())
+}
+
+func TestEmptyUploadLeavesNoFile(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_, err := writer.CreateFormFile("file", "empty.txt")
+	require.NoError(t, err)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.True(t, strings.HasPrefix(entry.Name(), "test.db"), "unexpected file %s", entry.Name())
+	}
+}
+
+func TestLinkHeadersOnFileResponses(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filename := "linked.txt"
+	createTestFile(t, tempDir, db, filename, "linked content", false)
+	describedBy := `<http://localhost:8080/linked.txt/meta.json>; rel="describedby"; type="application/json"`
+	management := `<http://localhost:8080/linked.txt>; rel="edit management"`
+	stats := `<http://localhost:8080/linked.txt/meta.json>; rel="stats"; type="application/json"`
+
+	links := func(token string) []string {
+		req := httptest.NewRequest(http.MethodGet, "/"+filename, nil)
+		if token != "" {
+			req.Header.Set("X-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(filename)
+		require.NoError(t, h.HandleFileAccess(c))
+		require.Equal(t, http.StatusOK, rec.Code)
+		return rec.Header().Values("Link")
+	}
+
+	assert.Equal(t, []string{describedBy}, links(""))
+	assert.Equal(t, []string{describedBy}, links("wrong-token"))
+	assert.Equal(t, []string{describedBy, management, stats}, links("test-token"))
+}
+
+func TestHandleFileMeta(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filename := "described.txt"
+	filePath := createTestFile(t, tempDir, db, filename, "described content", true)
+
+	fetch := func(name, token string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodGet, "/"+name+"/meta.json", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(name)
+		require.NoError(t, h.HandleFileMeta(c))
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+
+	code, body := fetch(filename, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "http://localhost:8080/described.txt", body["url"])
+	assert.Equal(t, float64(len("described content")), body["size"])
+	assert.NotContains(t, body, "token")
+	assert.NotContains(t, body, "access_count")
+
+	code, body = fetch(filename, "test-token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, body["one_time_view"])
+	assert.Contains(t, body, "access_count")
+
+	_, err := os.Stat(filePath)
+	assert.NoError(t, err, "Describing a one-time file must not consume it")
+
+	code, _ = fetch("missing.txt", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	expired := time.Now().Add(-time.Hour)
+	expiredPath := createTestFile(t, tempDir, db, "expired.txt", "gone", false)
+	require.NoError(t, db.StoreMetadata(&model.FileMetadata{ResourcePath: expiredPath, Token: "test-token", ExpiresAt: &expired}))
+	code, body = fetch("expired.txt", "")
+	assert.Equal(t, http.StatusGone, code)
+	assert.NotContains(t, body, "name")
+}
+
+func TestHandleFileMetaNeedsPassword(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	filePath := filepath.Join(tempDir, "private.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("private"), 0o644))
+	require.NoError(t, store.StoreMetadata(&model.FileMetadata{
+		ResourcePath: filePath,
+		Token:        "test-token",
+		OriginalName: "payroll.txt",
+		Size:         7,
+		ContentHash:  "5f4dcc3b5aa765d61d8327deb882cf99",
+		PasswordHash: string(hash),
+	}))
+
+	fetch := func(query, token string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodGet, "/private.txt/meta.json"+query, nil)
+		if token != "" {
+			req.Header.Set("X-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("private.txt")
+		require.NoError(t, h.HandleFileMeta(c))
+
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+
+	for _, query := range []string{"", "?password=wrong"} {
+		code, body := fetch(query, "")
+		assert.Equal(t, http.StatusUnauthorized, code, query)
+		assert.Equal(t, true, body["password_protected"])
+		assert.NotContains(t, body, "name")
+		assert.NotContains(t, body, "md5")
+		assert.NotContains(t, body, "size")
+	}
+
+	code, body := fetch("?password=s3cret", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "payroll.txt", body["name"])
+	assert.NotContains(t, body, "access_count")
+
+	code, body = fetch("", "test-token")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "payroll.txt", body["name"])
+	assert.Contains(t, body, "access_count")
+}
+
+func TestExpirationFloorOnUploadAndUpdate(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.MinExpirationMinutes = 10
+	floor := 10 * time.Minute
+
+	// A requested expiration a few seconds away is bumped to the floor
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	require.NoError(t, writer.WriteField("expires", time.Now().Add(5*time.Second).UTC().Format(time.RFC3339)))
+	part, err := writer.CreateFormFile("file", "brief.txt")
+	require.NoError(t, err)
+	part.Write([]byte("short lived"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	meta, err := db.GetMetadataByID(filepath.Join(tempDir, filepath.Base(strings.TrimSpace(rec.Body.String()))))
+	require.NoError(t, err)
+	require.NotNil(t, meta.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(floor), *meta.ExpiresAt, 5*time.Second)
+
+	// Updating the expiration to zero hours is bumped as well
+	filename := "update.txt"
+	filePath := createTestFile(t, tempDir, db, filename, "update me", false)
+	req = httptest.NewRequest(http.MethodPost, "/"+filename, strings.NewReader("token=test-token&expires=0"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues(filename)
+	require.NoError(t, h.HandleFileManagement(c))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	meta, err = db.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	require.NotNil(t, meta.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(floor), *meta.ExpiresAt, 5*time.Second)
+}
+
+func TestHandleRetention(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	request := func(query string, authenticated bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/retention"+query, nil)
+		if authenticated {
+			req.AddCookie(adminCookie(t, h))
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleRetention(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request("?sizes=1", false).Code)
+
+	rec := request("?sizes=1,100,250,500", true)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response RetentionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, 1, response.MinAgeDays)
+	assert.Equal(t, 30, response.MaxAgeDays)
+	assert.Equal(t, 250.0, response.MaxSizeMiB)
+	assert.NotEmpty(t, response.Formula)
+
+	// Same values as the expiration manager's formula tests
+	expected := map[float64]float64{1: 29, 100: 7, 250: 1, 500: 1}
+	require.Len(t, response.Points, len(expected))
+	for _, point := range response.Points {
+		assert.InDelta(t, expected[point.SizeMiB], point.RetentionDays, 0.01, "size %v MiB", point.SizeMiB)
+	}
+
+	rec = request("", true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.Points, len(defaultRetentionSizes))
+
+	for _, invalid := range []string{"?sizes=abc", "?sizes=-1", "?sizes=1,,2", "?sizes=" + strings.Repeat("1,", maxRetentionSizes) + "1"} {
+		assert.Equal(t, http.StatusBadRequest, request(invalid, true).Code, invalid)
+	}
+}
+
+func shortenURL(t *testing.T, h *Handler, rawURL string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	e := echo.New()
+	form := "url=" + url.QueryEscape(rawURL)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	require.NoError(t, h.HandleURLShortening(c))
+	return rec
+}
+
+func TestURLShorteningRejectsUnsafeSchemes(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	for _, rawURL := range []string{
+		"javascript:alert(1)",
+		"JavaScript://example.com/%0Aalert(1)",
+		"data:text/html,<script>alert(1)</script>",
+		"file:///etc/passwd",
+		"ftp://example.com/file",
+	} {
+		rec := shortenURL(t, h, rawURL)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, rawURL)
+	}
+}
+
+func TestURLShorteningRejectsLongURLs(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.MaxShortenedURLLength = 64
+
+	rec := shortenURL(t, h, "https://example.com/"+strings.Repeat("a", 64))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "too long")
+
+	rec = shortenURL(t, h, "https://example.com/ok")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestURLShorteningNormalizesURL(t *testing.T) {
+	_, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	tests := map[string]string{
+		"HTTP://Example.COM:80/Path?q=1": "http://example.com/Path?q=1",
+		"https://EXAMPLE.com:443/":       "https://example.com/",
+		"https://example.com:8443/x":     "https://example.com:8443/x",
+		"http://[::1]:80/":               "http://[::1]/",
+	}
+	for rawURL, expected := range tests {
+		rec := shortenURL(t, h, rawURL)
+		require.Equal(t, http.StatusOK, rec.Code, rawURL)
+
+		id := strings.TrimPrefix(strings.TrimSpace(rec.Body.String()), h.cfg.BaseURL)
+		meta, err := db.GetMetadataByID(id)
+		require.NoError(t, err)
+		assert.Equal(t, expected, meta.OriginalURL, rawURL)
+	}
+}
+
+func TestStreamBuffersArePooled(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.StreamingBufferSize = config.MinStreamingBufferKB
+
+	content := bytes.Repeat([]byte("z"), 3*config.MinStreamingBufferKB*1024+7)
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		written, err := h.streamFileOptimized(context.Background(), rec, bytes.NewReader(content))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), written)
+		assert.Equal(t, content, rec.Body.Bytes())
+	}
+
+	buffer := h.getStreamBuffer()
+	assert.Len(t, *buffer, config.MinStreamingBufferKB*1024)
+}
+
+func TestDownloadFromURLRetries(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	defaultDelay := urlDownloadRetryDelay
+	urlDownloadRetryDelay = time.Millisecond
+	defer func() { urlDownloadRetryDelay = defaultDelay }()
+
+	download := func(rawURL string) (FileInfo, error) {
+		e := echo.New()
+		form := "url=" + url.QueryEscape(rawURL)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		return h.downloadFromURL(e.NewContext(req, httptest.NewRecorder()), h.cfg.MaxSizeToBytes())
+	}
+
+	t.Run("succeeds on second attempt", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("remote content"))
+		}))
+		defer server.Close()
+
+		info, err := download(server.URL + "/file.txt")
+		require.NoError(t, err)
+		assert.Equal(t, 2, requests)
+		content, err := os.ReadFile(info.FilePath)
+		require.NoError(t, err)
+		assert.Equal(t, "remote content", string(content))
+	})
+
+	t.Run("restarts interrupted transfers", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				w.Header().Set("Content-Length", "100")
+				w.Write([]byte("partial"))
+				return
+			}
+			w.Write([]byte("complete content"))
+		}))
+		defer server.Close()
+
+		info, err := download(server.URL + "/data.bin")
+		require.NoError(t, err)
+		assert.Equal(t, 2, requests)
+		assert.Equal(t, int64(len("complete content")), info.Size)
+		content, err := os.ReadFile(info.FilePath)
+		require.NoError(t, err)
+		assert.Equal(t, "complete content", string(content))
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			http.NotFound(w, r)
+		}))
+		defer server.Close()
+
+		_, err := download(server.URL + "/missing.txt")
+		assert.Error(t, err)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("gives up after the configured attempts", func(t *testing.T) {
+		h.cfg.URLDownloadAttempts = 2
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		_, err := download(server.URL + "/flaky.txt")
+		require.Error(t, err)
+		assert.Equal(t, 2, requests)
+		assert.Contains(t, err.Error(), "status 502")
+		assert.Contains(t, err.Error(), "attempts: 2")
+	})
+
+	t.Run("keeps transport errors from the client", func(t *testing.T) {
+		h.cfg.URLDownloadAttempts = 1
+		server := httptest.NewServer(http.NotFoundHandler())
+		closedURL := server.URL
+		server.Close()
+
+		_, err := download(closedURL + "/file.txt")
+		require.Error(t, err)
+		assert.Equal(t, "Failed to download from URL (attempts: 1)", err.Error())
+	})
+}
+
+func TestDownloadFromURLNamesFromResponse(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 4, 4))))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/typed/":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(encoded.Bytes())
+		case "/disposed":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="../report.csv"`)
+			w.Write([]byte("a,b\n1,2\n"))
+		case "/untyped":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0x00, 0x01, 0x02})
+		}
+	}))
+	defer server.Close()
+
+	download := func(path string) FileInfo {
+		form := "url=" + url.QueryEscape(server.URL+path)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		info, err := h.downloadFromURL(echo.New().NewContext(req, httptest.NewRecorder()), h.cfg.MaxSizeToBytes())
+		require.NoError(t, err)
+		return info
+	}
+
+	info := download("/typed/")
+	assert.Equal(t, "download.png", info.OriginalFilename, "content type only")
+	assert.Equal(t, ".png", filepath.Ext(info.StoredFilename))
+
+	info = download("/disposed")
+	assert.Equal(t, "report.csv", info.OriginalFilename, "content disposition wins")
+	assert.Equal(t, ".csv", filepath.Ext(info.StoredFilename))
+
+	info = download("/untyped")
+	assert.Equal(t, "untyped", info.OriginalFilename)
+	assert.Empty(t, filepath.Ext(info.StoredFilename))
+
+	tmpFiles, err := filepath.Glob(filepath.Join(tempDir, "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmpFiles)
+}
+
+func TestUploadTierLimits(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	h.cfg.MaxSize = 0.001 // about 1KB for anonymous uploads
+	h.cfg.UploadTiers = map[string]config.UploadTier{
+		"pro": {MaxSize: 1, MaxAge: 90},
+	}
+	h.cfg.APIKeys = []config.APIKey{{Key: "pro-key", Tier: "pro"}}
+
+	upload := func(apiKey string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "data.bin")
+		require.NoError(t, err)
+		part.Write(content)
+		writer.Close()
+
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(e.NewContext(req, rec)))
+		return rec
+	}
+
+	content := bytes.Repeat([]byte("a"), 4*1024)
+
+	rec := upload("", content)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "anonymous uploads are capped at the global max size")
+
+	rec = upload("wrong-key", content)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = upload("pro-key", content)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	expiresAt, err := time.Parse(time.RFC3339, resp["expires_at"].(string))
+	require.NoError(t, err)
+	assert.True(t, expiresAt.After(time.Now().Add(time.Duration(h.cfg.MaxAge)*24*time.Hour)),
+		"pro uploads use the tier's max age")
+}
+
+func TestUploadWithSecretID(t *testing.T) {
+	_, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	upload := func(fields map[string]string) string {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "secret.txt")
+		require.NoError(t, err)
+		part.Write([]byte("hidden"))
+		for key, value := range fields {
+			writer.WriteField(key, value)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		return filepath.Base(strings.TrimSpace(rec.Body.String()))
+	}
+
+	// The home page checkbox sends "on", curl examples an empty value
+	for _, value := range []string{"on", ""} {
+		filename := upload(map[string]string{"secret": value})
+		assert.Len(t, strings.TrimSuffix(filename, ".txt"), SecretIDLength, "secret=%q", value)
+		meta, err := store.GetMetadataByID(filepath.Join(h.cfg.UploadPath, filename))
+		require.NoError(t, err)
+		assert.False(t, meta.PublicID)
+	}
+
+	filename := upload(nil)
+	assert.Len(t, strings.TrimSuffix(filename, ".txt"), h.cfg.IdLength)
+}
+
+func TestUploadOverSizeLimit(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	h.cfg.MaxSize = 0.001 // about 1KB
+	maxSize := h.cfg.MaxSizeToBytes()
+
+	storedFiles := func() []string {
+		entries, err := os.ReadDir(tempDir)
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), "test.db") {
+				names = append(names, entry.Name())
+			}
+		}
+		return names
+	}
+
+	t.Run("request body over the limit", func(t *testing.T) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "big.bin")
+		require.NoError(t, err)
+		part.Write(bytes.Repeat([]byte("a"), int(maxSize)+1))
+		writer.Close()
+
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(e.NewContext(req, rec)))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Empty(t, storedFiles())
+	})
+
+	t.Run("file content over the limit", func(t *testing.T) {
+		header := &multipart.FileHeader{Filename: "big.bin", Size: maxSize + 10}
+		content := bytes.NewReader(bytes.Repeat([]byte("a"), int(maxSize)+10))
+
+		_, err := h.saveFromFormFile(content, header, maxSize, slugTarget{}, false, false)
+		assert.ErrorIs(t, err, errUploadTooLarge)
+		assert.Empty(t, storedFiles(), "the partial file is removed")
+	})
+
+	t.Run("file content at the limit", func(t *testing.T) {
+		header := &multipart.FileHeader{Filename: "exact.bin", Size: maxSize}
+		content := bytes.NewReader(bytes.Repeat([]byte("a"), int(maxSize)))
+
+		info, err := h.saveFromFormFile(content, header, maxSize, slugTarget{}, false, false)
+		require.NoError(t, err)
+		assert.Equal(t, maxSize, info.Size)
+		require.NoError(t, os.Remove(info.FilePath))
+	})
+
+	t.Run("endless content is not buffered", func(t *testing.T) {
+		header := &multipart.FileHeader{Filename: "endless.bin"}
+		content := &countingReader{}
+
+		_, err := h.saveFromFormFile(content, header, maxSize, slugTarget{}, false, false)
+		assert.ErrorIs(t, err, errUploadTooLarge)
+		assert.Equal(t, maxSize+1, content.read, "reading stops one byte past the limit")
+		assert.Empty(t, storedFiles())
+	})
+
+	t.Run("URL download without Content-Length", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.(http.Flusher).Flush() // respond chunked
+			w.Write(bytes.Repeat([]byte("a"), int(maxSize)+1))
+		}))
+		defer server.Close()
+
+		e := echo.New()
+		form := "url=" + url.QueryEscape(server.URL+"/big.bin")
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(e.NewContext(req, rec)))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Empty(t, storedFiles())
+	})
+
+	t.Run("stored file over the limit", func(t *testing.T) {
+		filePath := filepath.Join(tempDir, "stored.bin")
+		require.NoError(t, os.WriteFile(filePath, bytes.Repeat([]byte("a"), int(maxSize)+1), 0o644))
+		fileInfo := FileInfo{FilePath: filePath, StoredFilename: "stored.bin", Size: maxSize + 1}
+
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		require.NoError(t, h.uploadTooLarge(c, fileInfo, maxSize))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.Empty(t, storedFiles(), "the stored file is removed")
+	})
+}
+
+// countingReader is an endless stream of bytes that counts how many were read
+type countingReader struct {
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestAnonymousMaxAge(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	h.cfg.AnonymousMaxAgeHours = 2
+	h.cfg.UploadTiers = map[string]config.UploadTier{"pro": {}}
+	h.cfg.APIKeys = []config.APIKey{{Key: "pro-key", Tier: "pro"}}
+
+	upload := func(apiKey, expires string) time.Time {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "data.bin")
+		require.NoError(t, err)
+		part.Write(bytes.Repeat([]byte("a"), 1024))
+		if expires != "" {
+			writer.WriteField("expires", expires)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		expiresAt, err := time.Parse(time.RFC3339, resp["expires_at"].(string))
+		require.NoError(t, err)
+		return expiresAt
+	}
+
+	anonymous := upload("", "")
+	authenticated := upload("pro-key", "")
+	assert.False(t, anonymous.After(time.Now().Add(2*time.Hour)), "anonymous uploads are capped")
+	assert.True(t, authenticated.After(time.Now().Add(24*time.Hour)), "uploads with a key follow max_age_days")
+
+	assert.False(t, upload("", "48").After(time.Now().Add(2*time.Hour)), "requested expirations are capped too")
+	assert.True(t, upload("pro-key", "48").After(time.Now().Add(47*time.Hour)))
+}
+
+func TestCanRenderInline(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	for contentType, expected := range map[string]bool{
+		"image/png":                 true,
+		"video/mp4":                 true,
+		"audio/mpeg":                true,
+		"application/pdf":           true,
+		"text/plain; charset=utf-8": true,
+		"TEXT/CSV":                  true,
+		"text/html":                 false,
+		"text/html; charset=utf-8":  false,
+		"image/svg+xml":             false,
+		"application/xhtml+xml":     false,
+		"text/xml":                  false,
+		"application/javascript":    false,
+		"application/zip":           false,
+		"":                          false,
+	} {
+		assert.Equal(t, expected, h.canRenderInline(contentType), contentType)
+	}
+
+	h.cfg.InlineContentTypes = []string{"image/png", "application/json", "image/*"}
+	assert.True(t, h.canRenderInline("application/json"))
+	assert.False(t, h.canRenderInline("text/plain"))
+	assert.False(t, h.canRenderInline("image/svg+xml"), "unsafe types stay blocked when allowlisted by wildcard")
+
+	h.cfg.InlineContentTypes = []string{"text/html"}
+	assert.False(t, h.canRenderInline("text/html"), "unsafe types stay blocked when listed explicitly")
+}
+
+func TestUnsafeTypesAreDownloadedOnBothPaths(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filename := "page.html"
+	filePath := createTestFile(t, tempDir, db, filename, "<script>alert(1)</script>", false)
+	meta, err := db.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	meta.ContentType = "text/html; charset=utf-8"
+	require.NoError(t, db.StoreMetadata(&meta))
+
+	e := echo.New()
+	for _, rangeHeader := range []string{"", "bytes=0-7"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+filename, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(filename)
+
+		require.NoError(t, h.HandleFileAccess(c))
+		assert.Contains(t, []int{http.StatusOK, http.StatusPartialContent}, rec.Code)
+		assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment"), rangeHeader)
+		assert.NotEmpty(t, rec.Body.String(), "the file can still be downloaded")
+	}
+}
+
+func TestChunkedUploadWithoutExtensionNaming(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	finalize := func(id string, content []byte) model.FileMetadata {
+		uploadDir := filepath.Join(tempDir, id)
+		require.NoError(t, os.MkdirAll(uploadDir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(uploadDir, "chunk_0"), content, 0o644))
+		upload := &ChunkedUpload{
+			UploadID:       id,
+			Filename:       "screenshot",
+			TotalSize:      int64(len(content)),
+			TotalChunks:    1,
+			UploadedChunks: map[int]bool{0: true},
+		}
+
+		e := echo.New()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/upload/chunk", nil), httptest.NewRecorder())
+		token, err := h.finalizeChunkedUpload(upload, c)
+		require.NoError(t, err)
+
+		meta, err := db.GetMetadataByToken(token)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Base(meta.ResourcePath), upload.StoredFilename)
+		return meta
+	}
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 32)...)
+	meta := finalize("detc", png)
+	assert.Equal(t, filepath.Join(tempDir, "detc.png"), meta.ResourcePath)
+	assert.Equal(t, "image/png", meta.ContentType)
+
+	meta = finalize("blob", []byte{0x00, 0x01, 0x02, 0xfe, 0xff})
+	assert.Equal(t, filepath.Join(tempDir, "blob_file"), meta.ResourcePath, "unknown types keep the suffix")
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/blob", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues("blob")
+	require.NoError(t, h.HandleFileAccess(c))
+	assert.Equal(t, http.StatusOK, rec.Code, "the bare id resolves to the suffixed file")
+	assert.Equal(t, meta.ContentType, rec.Header().Get("Content-Type"))
+}
+
+func TestChunkedFileSuffixLookup(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filePath := createTestFile(t, tempDir, db, "old1_file", "%PDF-1.4 legacy", false)
+	meta, err := db.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	meta.ContentType = "application/pdf"
+	require.NoError(t, db.StoreMetadata(&meta))
+
+	e := echo.New()
+	for _, name := range []string{"old1_file", "old1"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+name, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(name)
+
+		require.NoError(t, h.HandleFileAccess(c))
+		assert.Equal(t, http.StatusOK, rec.Code, name)
+		assert.Equal(t, "application/pdf", rec.Header().Get("Content-Type"), name)
+		assert.Equal(t, "%PDF-1.4 legacy", rec.Body.String(), name)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/old1/meta.json", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues("old1")
+	require.NoError(t, h.HandleFileMeta(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "old1_file")
+
+	req = httptest.NewRequest(http.MethodGet, "/old2", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues("old2")
+	require.NoError(t, h.HandleFileAccess(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRequireExplicitExpiration(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.RequireExplicitExpiration = true
+
+	upload := func(expires string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		if expires != "" {
+			require.NoError(t, writer.WriteField("expires", expires))
+		}
+		part, err := writer.CreateFormFile("file", "notes.txt")
+		require.NoError(t, err)
+		part.Write([]byte("keep this for a day"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := upload("")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "expires")
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotEqual(t, ".txt", filepath.Ext(entry.Name()), "rejected uploads leave no file")
+	}
+
+	rec = upload("24")
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	form := url.Values{"url": {"https://example.com/page"}, "shorten": {"true"}}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.HandleURLShortening(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "shortened URLs need an expiration too")
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("filename", "big.bin")
+	writer.WriteField("size", "1024")
+	writer.Close()
+	req = httptest.NewRequest(http.MethodPost, "/upload/init", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.InitiateChunkedUpload(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "chunked uploads are checked when they start")
+
+	response := initChunkedUpload(t, h, map[string]string{"filename": "big.bin", "size": "5", "chunk_size": "5", "expires": "2"})
+	uploadID := response["upload_id"].(string)
+	rec = uploadTestChunk(t, h, uploadID, 0, "hello")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var complete map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &complete))
+	expiresAt, err := time.Parse(time.RFC3339, complete["expires_at"].(string))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), expiresAt, time.Minute)
+
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.HandleLimits(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/limits", nil), rec)))
+	var limits LimitsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &limits))
+	assert.True(t, limits.RequireExpiration)
+}
+
+func TestNotFoundImageForEmbeds(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	request := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/gone.png", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("gone.png")
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	rec := request("image/png")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Vary"), "Accept")
+	_, err := png.Decode(rec.Body)
+	assert.NoError(t, err, "the generated placeholder is a valid PNG")
+
+	// Browsers navigating to the link list image types next to HTML
+	rec = request("text/html,application/xhtml+xml,image/avif,image/webp,*/*;q=0.8")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "File not found", rec.Body.String())
+
+	custom := append([]byte("GIF89a"), bytes.Repeat([]byte{0}, 16)...)
+	h.cfg.NotFoundImagePath = filepath.Join(tempDir, "missing.gif")
+	require.NoError(t, os.WriteFile(h.cfg.NotFoundImagePath, custom, 0o644))
+	rec = request("image/avif,image/webp,image/*,*/*;q=0.8")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "image/gif", rec.Header().Get("Content-Type"))
+	assert.Equal(t, custom, rec.Body.Bytes())
+}
+
+func TestExpiredFileImageEmbedGetsPlaceholder(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filePath := createTestFile(t, tempDir, store, "old.png", "not really a png", false)
+	require.NoError(t, store.ExpireBy(filePath, time.Now().Add(-time.Second)))
+
+	rec := requestFile(t, h, "old.png", "", "image/*")
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	_, err := png.Decode(rec.Body)
+	assert.NoError(t, err, "expired embeds get the placeholder too")
+
+	rec = requestFile(t, h, "old.png", "", "")
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Equal(t, "File has expired", rec.Body.String())
+}
+
+func TestMaxDownloadsAreReservedBeforeStreaming(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filePath := createTestFile(t, tempDir, store, "limited.txt", "two downloads", false)
+	meta, err := store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	meta.MaxDownloads = 2
+	require.NoError(t, store.StoreMetadata(&meta))
+
+	// An aborted download gives its reservation back
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/limited.txt", nil).WithContext(ctx)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	c.SetParamNames("filename")
+	c.SetParamValues("limited.txt")
+	assert.Error(t, h.HandleFileAccess(c))
+	meta, err = store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	assert.Zero(t, meta.AccessCount)
+
+	// Concurrent downloads can't serve more than the limit
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- requestFile(t, h, "limited.txt", "", "").Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	// The rest get 410 while the file is deleted and 404 after
+	served := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			served++
+		} else {
+			assert.Contains(t, []int{http.StatusGone, http.StatusNotFound}, code)
+		}
+	}
+	assert.Equal(t, 2, served)
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "the last allowed download deletes the file")
+}
+
+func TestULIDsSortInCreationOrder(t *testing.T) {
+	clock := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	gen := &ulidIDGenerator{now: func() time.Time { return clock }}
+
+	var ids []string
+	for i := 0; i < 500; i++ {
+		// Several ids per millisecond, and the clock briefly going back
+		switch {
+		case i%100 == 99:
+			clock = clock.Add(-time.Second)
+		case i%3 == 0:
+			clock = clock.Add(time.Millisecond)
+		}
+		id, err := gen.NewID(4)
+		require.NoError(t, err)
+		require.Len(t, id, ulidLength)
+		ids = append(ids, id)
+	}
+
+	for i := 1; i < len(ids); i++ {
+		assert.Less(t, ids[i-1], ids[i], "id %d sorts before the one created after it", i-1)
+	}
+
+	// The timestamp is the leading part of the id
+	early, err := (&ulidIDGenerator{now: func() time.Time { return time.UnixMilli(1) }}).NewID(0)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(early, "0000000001"), early)
+}
+
+func TestIDStrategies(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	for strategy, pattern := range map[string]string{
+		config.IDStrategyHex:    `^[0-9a-f]{4}$`,
+		config.IDStrategyBase62: `^[0-9A-Za-z]{4}$`,
+		config.IDStrategyULID:   `^[0-9a-hjkmnp-tv-z]{26}$`,
+	} {
+		h.ids = newIDGenerator(strategy)
+		id, err := h.generateFileID(false)
+		require.NoError(t, err)
+		assert.Regexp(t, pattern, id, strategy)
+
+		secret, err := h.generateFileID(true)
+		require.NoError(t, err)
+		assert.Regexp(t, `^[0-9a-f]{8}$`, secret, "secret ids stay random with %s", strategy)
+	}
+
+	h.ids = &fixedIDs{"stats", "admin", "abcd"}
+	id, err := h.generateUniqueID(false)
+	require.NoError(t, err)
+	assert.Equal(t, "abcd", id, "ids shadowing routes are skipped")
+}
+
+// fixedIDs hands out the listed ids in order
+type fixedIDs []string
+
+func (f *fixedIDs) NewID(int) (string, error) {
+	id := (*f)[0]
+	*f = (*f)[1:]
+	return id, nil
+}
+
+func TestChunkedUploadDetectsCorruptedChunk(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	response := initChunkedUpload(t, h, map[string]string{
+		"filename":   "data.bin",
+		"size":       "8",
+		"chunk_size": "4",
+	})
+	uploadID := response["upload_id"].(string)
+
+	rec := uploadTestChunk(t, h, uploadID, 0, "good")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// The stored chunk changes between being received and the upload finishing
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, uploadID, "chunk_0"), []byte("evil"), 0o644))
+
+	rec = uploadTestChunk(t, h, uploadID, 1, "data")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "assembly corruption")
+
+	_, err := os.Stat(filepath.Join(tempDir, uploadID+".bin"))
+	assert.True(t, os.IsNotExist(err), "corrupt upload must not be stored")
+	_, err = os.Stat(filepath.Join(tempDir, uploadID))
+	assert.True(t, os.IsNotExist(err), "corrupt session is discarded")
+	_, err = db.GetMetadataByID(filepath.Join(tempDir, uploadID+".bin"))
+	assert.Error(t, err)
+
+	// Re-hashing the assembled file catches corruption after it was written
+	path := filepath.Join(tempDir, "assembled.tmp")
+	require.NoError(t, os.WriteFile(path, []byte("gooddata"), 0o644))
+	sum := md5.Sum([]byte("gooddata"))
+	assert.NoError(t, verifyAssembledFile(path, hex.EncodeToString(sum[:])))
+	sum = md5.Sum([]byte("datagood"))
+	assert.ErrorIs(t, verifyAssembledFile(path, hex.EncodeToString(sum[:])), errAssemblyCorrupted)
+}
+
+func TestHandleCapabilities(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.ChunkSize = 4
+	h.cfg.URLShorteningEnabled = true
+	h.cfg.UploadTiers = map[string]config.UploadTier{"pro": {MaxSize: 1024}}
+	h.cfg.APIKeys = []config.APIKey{{Key: "pro-key", Tier: "pro"}}
+
+	probe := func(method, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", nil)
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleCapabilities(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := probe(http.MethodHead, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, strconv.FormatInt(h.cfg.MaxSizeToBytes(), 10), rec.Header().Get("X-Max-Upload-Size"))
+	assert.Equal(t, strconv.FormatInt(h.cfg.ChunkSizeToBytes(), 10), rec.Header().Get("X-Chunk-Size"))
+	assert.Equal(t, "true", rec.Header().Get("X-URL-Shortening-Enabled"))
+	assert.Equal(t, "false", rec.Header().Get("X-Require-Expiration"))
+	assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+
+	rec = probe(http.MethodOptions, "pro-key")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, strconv.Itoa(1024*1024*1024), rec.Header().Get("X-Max-Upload-Size"))
+	assert.Contains(t, rec.Header().Get("Allow"), "POST")
+
+	rec = probe(http.MethodHead, "wrong-key")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+// officeZip builds a zip like office documents: a large first entry pushes the
+// entries that identify the format past the bytes used for detection
+func officeZip(t *testing.T, entries ...string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i, name := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		require.NoError(t, err)
+		if i == 0 {
+			w.Write(bytes.Repeat([]byte("<Types/>"), 128))
+		}
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestContentTypeCorrections(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	tests := []struct {
+		name     string
+		entries  []string
+		expected string
+	}{
+		{"report.docx", []string{"[Content_Types].xml", "word/document.xml"}, "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"budget.XLSX", []string{"[Content_Types].xml", "xl/workbook.xml"}, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		{"slides.pptx", []string{"[Content_Types].xml", "ppt/presentation.xml"}, "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+		{"letter.odt", []string{"META-INF/manifest.xml", "content.xml"}, "application/vnd.oasis.opendocument.text"},
+		{"archive.zip", []string{"[Content_Types].xml", "word/document.xml"}, "application/zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, tt.name)
+			require.NoError(t, os.WriteFile(path, officeZip(t, tt.entries...), 0o644))
+			require.Equal(t, "application/zip", sniffContentType(path), "sniffing alone reports a zip")
+			assert.Equal(t, tt.expected, h.detectContentType(path))
+		})
+	}
+
+	// Configured corrections extend and override the defaults
+	h.cfg.ContentTypeCorrections = []config.ContentTypeCorrection{
+		{Extension: ".sketch", Detected: "application/zip", Type: "application/x-sketch"},
+		{Extension: ".jar", Detected: "application/zip", Type: "application/x-java-archive"},
+	}
+	assert.Equal(t, "application/x-sketch", h.correctContentType("application/zip", ".sketch"))
+	assert.Equal(t, "application/x-java-archive", h.correctContentType("application/zip", ".jar"))
+	assert.Equal(t, "application/vnd.oasis.opendocument.text", h.correctContentType("application/zip", ".odt"))
+	assert.Equal(t, "text/plain; charset=utf-8", h.correctContentType("text/plain; charset=utf-8", ".docx"),
+		"only the listed detected type is corrected")
+}
+
+func TestUploadExpiresHeader(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	upload := func(header, field string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		if field != "" {
+			require.NoError(t, writer.WriteField("expires", field))
+		}
+		part, err := writer.CreateFormFile("file", "notes.txt")
+		require.NoError(t, err)
+		part.Write([]byte("expiring notes"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
+		if header != "" {
+			req.Header.Set("X-Expires", header)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+	expiresAt := func(rec *httptest.ResponseRecorder) time.Time {
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		at, err := time.Parse(time.RFC3339, resp["expires_at"].(string))
+		require.NoError(t, err)
+		return at
+	}
+	unixMs := func(t time.Time) string { return strconv.FormatInt(t.UnixMilli(), 10) }
+
+	inTwoHours := time.Now().Add(2 * time.Hour)
+	assert.WithinDuration(t, inTwoHours, expiresAt(upload(unixMs(inTwoHours), "")), 2*time.Second)
+
+	maxExpiration := h.expManager.GetExpirationDate(int64(len("expiring notes")))
+	farFuture := time.Now().AddDate(10, 0, 0)
+	assert.WithinDuration(t, maxExpiration, expiresAt(upload(unixMs(farFuture), "")), time.Minute,
+		"the header is clamped to the retention policy")
+
+	assert.WithinDuration(t, time.Now().Add(5*time.Hour), expiresAt(upload(unixMs(inTwoHours), "5")), 2*time.Second,
+		"the form field wins over the header")
+
+	rec := upload("tomorrow", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestDownloadsAreCountedInBatches(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filePath := createTestFile(t, tempDir, store, "counted.txt", "counted", false)
+	counter := db.NewAccessCounter(store, time.Hour)
+	h.SetAccessCounter(counter)
+
+	e := echo.New()
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/counted.txt", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("counted.txt")
+		require.NoError(t, h.HandleFileAccess(c))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	meta, err := store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, 0, meta.AccessCount, "counts wait for the flush")
+
+	require.NoError(t, counter.Flush())
+	meta, err = store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, 3, meta.AccessCount)
+	assert.NotNil(t, meta.LastAccessedAt)
+}
+
+// fakeScanner flags files containing "EICAR" and, when gate is set, waits for
+// it before answering
+type fakeScanner struct {
+	gate chan struct{}
+	err  error
+}
+
+func (s *fakeScanner) Scan(path string) (ScanVerdict, error) {
+	if s.gate != nil {
+		<-s.gate
+	}
+	if s.err != nil {
+		return ScanVerdict{}, s.err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ScanVerdict{}, err
+	}
+	if strings.Contains(string(data), "EICAR") {
+		return ScanVerdict{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return ScanVerdict{}, nil
+}
+
+func uploadForScan(t *testing.T, h *Handler, content string) (*httptest.ResponseRecorder, map[string]any) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "artifact.txt")
+	require.NoError(t, err)
+	part.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+
+	var resp map[string]any
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	}
+	return rec, resp
+}
+
+func scanStatus(t *testing.T, h *Handler, filename string) ScanStatusResponse {
+	req := httptest.NewRequest(http.MethodGet, "/"+filename+"/scan", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues(filename)
+	require.NoError(t, h.HandleScanStatus(c))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var status ScanStatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	return status
+}
+
+func TestSynchronousVirusScan(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.scanner = &fakeScanner{}
+	h.scans = newScanTracker()
+
+	rec, resp := uploadForScan(t, h, "clean build output")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, ScanClean, resp["scan_status"])
+	assert.Equal(t, ScanClean, rec.Header().Get("X-Scan-Status"))
+
+	rec, _ = uploadForScan(t, h, "EICAR test payload")
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Eicar-Test-Signature")
+
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	stored := 0
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) == ".txt" {
+			stored++
+		}
+	}
+	assert.Equal(t, 1, stored, "the infected upload is deleted")
+
+	h.scanner = &fakeScanner{err: errors.New("clamd down")}
+	rec, _ = uploadForScan(t, h, "unscannable")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestAsynchronousVirusScan(t *testing.T) {
+	_, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	scanner := &fakeScanner{gate: make(chan struct{})}
+	h.scanner = scanner
+	h.scans = newScanTracker()
+	h.cfg.ScanAsync = true
+
+	rec, resp := uploadForScan(t, h, "EICAR in a release archive")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, ScanPending, resp["scan_status"])
+	fileURL := resp["url"].(string)
+	filename := strings.TrimPrefix(fileURL, h.cfg.BaseURL)
+	assert.Equal(t, fileURL+"/scan", resp["scan_url"])
+	assert.Equal(t, ScanPending, scanStatus(t, h, filename).Status)
+
+	// Pending files are not served yet
+	req := httptest.NewRequest(http.MethodGet, "/"+filename, nil)
+	getRec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, getRec)
+	c.SetParamNames("filename")
+	c.SetParamValues(filename)
+	require.NoError(t, h.HandleFileAccess(c))
+	assert.Equal(t, http.StatusServiceUnavailable, getRec.Code)
+	assert.Equal(t, "5", getRec.Header().Get("Retry-After"))
+
+	close(scanner.gate)
+	require.Eventually(t, func() bool {
+		return scanStatus(t, h, filename).Status != ScanPending
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := scanStatus(t, h, filename)
+	assert.Equal(t, ScanInfected, status.Status)
+	assert.Equal(t, "Eicar-Test-Signature", status.Signature)
+	_, err := os.Stat(filepath.Join(h.cfg.UploadPath, filename))
+	assert.True(t, os.IsNotExist(err), "the infected file is deleted")
+	_, err = db.GetMetadataByID(filepath.Join(h.cfg.UploadPath, filename))
+	assert.Error(t, err)
+}
+
+func TestClamdScanner(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// A minimal clamd speaking INSTREAM
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+					return
+				}
+				var data bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+						return
+					}
+				}
+				if strings.Contains(data.String(), "EICAR") {
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+				} else {
+					io.WriteString(conn, "stream: OK\x00")
+				}
+			}(conn)
+		}
+	}()
+
+	scanner := newClamdScanner("tcp://" + listener.Addr().String())
+	dir := t.TempDir()
+
+	clean := filepath.Join(dir, "clean.bin")
+	require.NoError(t, os.WriteFile(clean, bytes.Repeat([]byte("x"), 200<<10), 0o644))
+	verdict, err := scanner.Scan(clean)
+	require.NoError(t, err)
+	assert.False(t, verdict.Infected)
+
+	infected := filepath.Join(dir, "infected.txt")
+	require.NoError(t, os.WriteFile(infected, []byte("X5O!P%@AP EICAR"), 0o644))
+	verdict, err = scanner.Scan(infected)
+	require.NoError(t, err)
+	assert.True(t, verdict.Infected)
+	assert.Equal(t, "Eicar-Test-Signature", verdict.Signature)
+
+	_, err = parseClamdReply("INSTREAM size limit exceeded. ERROR")
+	assert.Error(t, err)
+}
+
+func TestJoinURL(t *testing.T) {
+	for _, base := range []string{"https://drop.example.com", "https://drop.example.com/"} {
+		assert.Equal(t, "https://drop.example.com/abc123.png", joinURL(base, "abc123.png"))
+		assert.Equal(t, "https://drop.example.com/abc123.png", joinURL(base, "/abc123.png"))
+	}
+	for _, base := range []string{"https://host/drop", "https://host/drop/"} {
+		assert.Equal(t, "https://host/drop/abc123.png/scan", joinURL(base, "abc123.png/scan"))
+	}
+}
+
+func TestUploadURLsWithoutTrailingSlash(t *testing.T) {
+	for _, base := range []string{"https://drop.example.com", "https://host/drop/"} {
+		_, h, _, cleanup := setupTestEnvironment(t)
+		h.cfg.BaseURL = base
+		want := strings.TrimSuffix(base, "/") + "/"
+
+		rec, resp := uploadForScan(t, h, "base url")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Regexp(t, "^"+regexp.QuoteMeta(want)+"[0-9a-f]+\\.txt$", resp["url"])
+
+		rec = shortenURL(t, h, "https://example.com/page")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Regexp(t, "^"+regexp.QuoteMeta(want)+"[0-9a-f]+$", strings.TrimSpace(rec.Body.String()))
+
+		initResp := initChunkedUpload(t, h, map[string]string{"filename": "big.bin", "size": "4", "chunk_size": "4"})
+		chunkRec := uploadTestChunk(t, h, initResp["upload_id"].(string), 0, "data")
+		require.Equal(t, http.StatusOK, chunkRec.Code, chunkRec.Body.String())
+		var done map[string]any
+		require.NoError(t, json.Unmarshal(chunkRec.Body.Bytes(), &done))
+		assert.Equal(t, want+initResp["upload_id"].(string)+".bin", done["file_url"])
+		cleanup()
+	}
+}
+
+func uploadFolder(t *testing.T, h *Handler, files map[string]string, accept string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for path, content := range files {
+		require.NoError(t, writer.WriteField("path", path))
+		part, err := writer.CreateFormFile("file", filepath.Base(path))
+		require.NoError(t, err)
+		part.Write([]byte(content))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Accept", accept)
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+func getFolderPath(t *testing.T, h *Handler, id, rel, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/"+id+"/"+rel, nil)
+	req.Header.Set("Accept", accept)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if rel == "" {
+		c.SetParamNames("filename")
+		c.SetParamValues(id)
+		require.NoError(t, h.HandleFileAccess(c))
+	} else {
+		c.SetParamNames("filename", "*")
+		c.SetParamValues(id, rel)
+		require.NoError(t, h.HandleFolderFile(c))
+	}
+	return rec
+}
+
+func TestFolderUploads(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	files := map[string]string{
+		"site/index.html":      "<h1>hello</h1>",
+		"site/css/style.css":   "body{}",
+		"site/docs/readme.txt": "read me",
+	}
+
+	rec := uploadFolder(t, h, files, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "folder uploads are off by default")
+
+	h.cfg.FolderUploadsEnabled = true
+	rec = uploadFolder(t, h, files, "application/json")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp["url"].(string), h.cfg.BaseURL)
+	assert.EqualValues(t, len("<h1>hello</h1>")+len("body{}")+len("read me"), resp["size"])
+
+	meta, err := db.GetMetadataByID(filepath.Join(tempDir, id))
+	require.NoError(t, err)
+	assert.True(t, meta.IsFolder())
+	assert.Equal(t, "site", meta.OriginalName)
+
+	// The id root lists the tree
+	rec = getFolderPath(t, h, id, "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "site/css/style.css\nsite/docs/readme.txt\nsite/index.html\n", rec.Body.String())
+
+	rec = getFolderPath(t, h, id, "site/docs", "application/json")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var listing struct {
+		Files []FolderEntry `json:"files"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listing))
+	require.Len(t, listing.Files, 1)
+	assert.Equal(t, "site/docs/readme.txt", listing.Files[0].Path)
+	assert.Equal(t, h.cfg.BaseURL+id+"/site/docs/readme.txt", listing.Files[0].URL)
+
+	// Individual files are served from their path
+	rec = getFolderPath(t, h, id, "site/css/style.css", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "body{}", rec.Body.String())
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/css")
+
+	rec = getFolderPath(t, h, id, "site/index.html", "")
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "attachment", "HTML is never rendered inline")
+
+	assert.Equal(t, http.StatusNotFound, getFolderPath(t, h, id, "site/missing.txt", "").Code)
+	assert.Equal(t, http.StatusNotFound, getFolderPath(t, h, id, "../test.db", "").Code)
+
+	// Deleting the upload removes the whole tree
+	req := httptest.NewRequest(http.MethodDelete, "/"+id, nil)
+	req.Header.Set("X-Token", resp["token"].(string))
+	delRec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, delRec)
+	c.SetParamNames("filename")
+	c.SetParamValues(id)
+	require.NoError(t, h.HandleDelete(c))
+	assert.Equal(t, http.StatusOK, delRec.Code, delRec.Body.String())
+	_, err = os.Stat(filepath.Join(tempDir, id))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFolderFilesFollowTheFolder(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.FolderUploadsEnabled = true
+
+	rec := uploadFolder(t, h, map[string]string{"site/index.txt": "hello"}, "application/json")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp["url"].(string), h.cfg.BaseURL)
+	require.Equal(t, http.StatusOK, getFolderPath(t, h, id, "site/index.txt", "").Code)
+
+	h.scans = newScanTracker()
+	h.scans.set(id, scanState{Status: ScanPending})
+	rec = getFolderPath(t, h, id, "site/index.txt", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, "files wait for the folder's scan")
+	h.scans = nil
+
+	require.NoError(t, store.ExpireBy(filepath.Join(tempDir, id), time.Now().Add(-time.Second)))
+	assert.Equal(t, http.StatusGone, getFolderPath(t, h, id, "site/index.txt", "").Code)
+	assert.Equal(t, http.StatusGone, getFolderPath(t, h, id, "site", "").Code)
+}
+
+func TestFolderUploadIgnoresTierDownloadLimit(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.FolderUploadsEnabled = true
+	h.cfg.UploadTiers = map[string]config.UploadTier{config.AnonymousTier: {MaxDownloads: 1}}
+
+	rec := uploadFolder(t, h, map[string]string{"site/index.txt": "hello"}, "application/json")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp["url"].(string), h.cfg.BaseURL)
+
+	meta, err := store.GetMetadataByID(filepath.Join(tempDir, id))
+	require.NoError(t, err)
+	assert.Zero(t, meta.MaxDownloads, "folders have no download limit")
+}
+
+func TestFolderUploadRejectsUnsafePaths(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.FolderUploadsEnabled = true
+
+	for _, path := range []string{"../escape.txt", "/etc/passwd", "a/../../escape.txt", `..\escape.txt`, "meta.json"} {
+		rec := uploadFolder(t, h, map[string]string{path: "x"}, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, path)
+	}
+
+	rec := uploadFolder(t, h, map[string]string{"a": "file", "a/b.txt": "nested"}, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "a path can't be both a file and a directory")
+
+	_, err := os.Stat(filepath.Join(filepath.Dir(tempDir), "escape.txt"))
+	assert.True(t, os.IsNotExist(err))
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.False(t, entry.IsDir(), "rejected folders leave nothing behind: %s", entry.Name())
+	}
+}
+
+func requestFile(t *testing.T, h *Handler, filename, query, accept string) *httptest.ResponseRecorder {
+	target := "/" + filename
+	if query != "" {
+		target += "?" + query
+	}
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues(filename)
+	require.NoError(t, h.HandleFileAccess(c))
+	return rec
+}
+
+func TestMarkdownViewer(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	source := "# Notes\n\nSome *text* and <script>alert(1)</script>\n"
+	createTestFile(t, tempDir, db, "notes.md", source, false)
+	const browser = "text/html,application/xhtml+xml,*/*;q=0.8"
+
+	rec := requestFile(t, h, "notes.md", "", browser)
+	assert.Equal(t, source, rec.Body.String(), "viewers are off unless render_viewers lists the type")
+
+	h.cfg.RenderViewers = []string{"text/markdown"}
+	rec = requestFile(t, h, "notes.md", "", browser)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, viewerCSP, rec.Header().Get("Content-Security-Policy"))
+	assert.Contains(t, rec.Header().Get("Vary"), "Accept")
+	assert.Contains(t, rec.Body.String(), "<h1>Notes</h1>")
+	assert.Contains(t, rec.Body.String(), "<em>text</em>")
+	assert.Contains(t, rec.Body.String(), "&lt;script&gt;alert(1)&lt;/script&gt;")
+	assert.NotContains(t, rec.Body.String(), "<script>")
+	assert.Contains(t, rec.Body.String(), `href="http://localhost:8080/notes.md?raw=1"`)
+
+	rec = requestFile(t, h, "notes.md", "raw=1", browser)
+	assert.Equal(t, source, rec.Body.String(), "?raw=1 bypasses the viewer")
+	assert.Contains(t, rec.Header().Get("Vary"), "Accept")
+
+	rec = requestFile(t, h, "notes.md", "", "*/*")
+	assert.Equal(t, source, rec.Body.String(), "clients not asking for HTML get the raw file")
+}
+
+func TestTableAndCodeViewers(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.RenderViewers = []string{"text/csv", "application/json"}
+
+	createTestFile(t, tempDir, db, "data.csv", "name,size\n<b>a</b>,1\n", false)
+	rec := requestFile(t, h, "data.csv", "", "text/html")
+	assert.Contains(t, rec.Body.String(), "<th>name</th><th>size</th>")
+	assert.Contains(t, rec.Body.String(), "<td>&lt;b&gt;a&lt;/b&gt;</td><td>1</td>")
+
+	createTestFile(t, tempDir, db, "data.json", `{"ok":true,"n":-1.5}`, false)
+	rec = requestFile(t, h, "data.json", "", "text/html")
+	assert.Contains(t, rec.Body.String(), `<span class="tok-key">&#34;ok&#34;</span>: <span class="tok-literal">true</span>`)
+	assert.Contains(t, rec.Body.String(), `<span class="tok-number">-1.5</span>`)
+
+	// Types render_viewers doesn't list are served raw
+	createTestFile(t, tempDir, db, "notes.md", "# Notes", false)
+	rec = requestFile(t, h, "notes.md", "", "text/html")
+	assert.Equal(t, "# Notes", rec.Body.String())
+}
+
+func TestHighlightCode(t *testing.T) {
+	lines := highlightCode([]byte("x := \"a\\\"b\" // note\n/* multi\nline */ n = 42\n"), ".go")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []templates.CodeToken{
+		{Text: "x := "},
+		{Kind: "string", Text: `"a\"b"`},
+		{Text: " "},
+		{Kind: "comment", Text: "// note"},
+	}, lines[0])
+	assert.Equal(t, []templates.CodeToken{{Kind: "comment", Text: "/* multi"}}, lines[1])
+	assert.Equal(t, []templates.CodeToken{
+		{Kind: "comment", Text: "line */"},
+		{Text: " n = "},
+		{Kind: "number", Text: "42"},
+	}, lines[2])
+
+	plain := highlightCode([]byte("don't \"quote\" me"), ".txt")
+	assert.Equal(t, [][]templates.CodeToken{{{Text: "don't \"quote\" me"}}}, plain)
+}
+
+func TestPasswordAttemptsLockout(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	attempts := newPasswordAttempts(3, 15*time.Minute)
+	attempts.now = func() time.Time { return now }
+
+	assert.False(t, attempts.fail("abc1", "10.0.0.1"))
+	assert.False(t, attempts.fail("abc1", "10.0.0.1"))
+	assert.Zero(t, attempts.lockedFor("abc1", "10.0.0.1"))
+	assert.True(t, attempts.fail("abc1", "10.0.0.1"), "the third wrong password locks the client out")
+	assert.Equal(t, 15*time.Minute, attempts.lockedFor("abc1", "10.0.0.1"))
+
+	assert.Zero(t, attempts.lockedFor("abc1", "10.0.0.2"), "other clients can still try")
+	assert.Zero(t, attempts.lockedFor("def2", "10.0.0.1"), "other files are not locked")
+
+	now = now.Add(10 * time.Minute)
+	assert.Equal(t, 5*time.Minute, attempts.lockedFor("abc1", "10.0.0.1"))
+
+	now = now.Add(5 * time.Minute)
+	assert.Zero(t, attempts.lockedFor("abc1", "10.0.0.1"), "the lockout ends after the window")
+	assert.False(t, attempts.fail("abc1", "10.0.0.1"), "failures start over after a lockout")
+
+	// Failures spread wider than the window never add up to a lockout
+	for i := 0; i < 5; i++ {
+		now = now.Add(16 * time.Minute)
+		assert.False(t, attempts.fail("def2", "10.0.0.1"))
+	}
+
+	// The right password clears earlier failures
+	attempts.fail("ghi3", "10.0.0.1")
+	attempts.fail("ghi3", "10.0.0.1")
+	attempts.succeed("ghi3", "10.0.0.1")
+	assert.False(t, attempts.fail("ghi3", "10.0.0.1"))
+	assert.False(t, attempts.fail("ghi3", "10.0.0.1"))
+
+	// Finished entries are pruned
+	now = now.Add(time.Hour)
+	attempts.fail("jkl4", "10.0.0.1")
+	assert.Len(t, attempts.entries, 1)
+}
+
+func TestPasswordLockoutResponse(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/abc1", nil), rec)
+	require.NoError(t, passwordLockoutResponse(c, 90*time.Second+time.Millisecond))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "91", rec.Header().Get("Retry-After"))
+}
+
+func TestUploadMD5Trailer(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	e := echo.New()
+	e.POST("/", h.HandleUpload)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	content := "hashed while streaming"
+	sum := md5.Sum([]byte(content))
+	expected := hex.EncodeToString(sum[:])
+
+	upload := func(accept, te string) *http.Response {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "trailer.txt")
+		require.NoError(t, err)
+		part.Write([]byte(content))
+		writer.Close()
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/", &body)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", accept)
+		if te != "" {
+			req.Header.Set("TE", te)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp
+	}
+
+	resp := upload("text/plain", "trailers")
+	assert.Empty(t, resp.Trailer.Get(MD5TrailerHeader), "trailers are off unless md5_trailers is set")
+
+	h.cfg.MD5Trailers = true
+	resp = upload("text/plain", "")
+	assert.Empty(t, resp.Trailer.Get(MD5TrailerHeader), "clients must opt in with TE: trailers")
+
+	for _, accept := range []string{"text/plain", "application/json"} {
+		resp = upload(accept, "trailers")
+		assert.Equal(t, expected, resp.Trailer.Get(MD5TrailerHeader), accept)
+	}
+}
+
+func TestAcceptsTrailers(t *testing.T) {
+	for te, want := range map[string]bool{
+		"":                   false,
+		"trailers":           true,
+		"Trailers":           true,
+		"gzip, trailers":     true,
+		"trailers;q=1, gzip": true,
+		"gzip":               false,
+		"trailersx":          false,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("TE", te)
+		assert.Equal(t, want, acceptsTrailers(req), te)
+	}
+}
+
+func TestChunkedUploadRollsBackWhenAChunkGoesMissing(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := "hello world"
+	response := initChunkedUpload(t, h, map[string]string{
+		"filename":   "greeting.txt",
+		"size":       fmt.Sprintf("%d", len(content)),
+		"chunk_size": "6",
+	})
+	uploadID := response["upload_id"].(string)
+	uploadDir := filepath.Join(tempDir, uploadID)
+
+	rec := uploadTestChunk(t, h, uploadID, 0, content[:6])
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// The first chunk disappears before the last one triggers finalization
+	require.NoError(t, os.Remove(filepath.Join(uploadDir, "chunk_0")))
+	rec = uploadTestChunk(t, h, uploadID, 1, content[6:])
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, rec.Body.String())
+
+	var failed map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &failed))
+	assert.Equal(t, []interface{}{float64(1)}, failed["uploaded_chunks"])
+
+	// Nothing partial is left behind and the session can be resumed
+	_, err := os.Stat(filepath.Join(tempDir, uploadID+".txt"))
+	assert.True(t, os.IsNotExist(err), "Partial upload must not be visible")
+	_, err = os.Stat(filepath.Join(uploadDir, uploadID+".tmp"))
+	assert.True(t, os.IsNotExist(err), "Partial assembly must be removed")
+	_, err = os.Stat(filepath.Join(uploadDir, "chunk_1"))
+	assert.NoError(t, err, "Received chunks must be kept")
+
+	h.chunkedManager.mu.RLock()
+	upload, exists := h.chunkedManager.uploads[uploadID]
+	h.chunkedManager.mu.RUnlock()
+	require.True(t, exists, "Session must be kept for a retry")
+	assert.Equal(t, []int{1}, upload.uploadedChunkList())
+
+	rec = uploadTestChunk(t, h, uploadID, 0, content[:6])
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var complete map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &complete))
+	assert.Equal(t, "Upload completed", complete["message"])
+
+	stored, err := os.ReadFile(filepath.Join(tempDir, uploadID+".txt"))
+	require.NoError(t, err)
+	assert.Equal(t, content, string(stored))
+}
+
+func TestFinalizeChunkedUploadRetriesWithAllChunksPresent(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := "hello world"
+	response := initChunkedUpload(t, h, map[string]string{
+		"filename":   "greeting.txt",
+		"size":       fmt.Sprintf("%d", len(content)),
+		"chunk_size": "6",
+	})
+	uploadID := response["upload_id"].(string)
+
+	// A directory in the way of the assembly file makes finalization fail
+	// without losing any chunk
+	tmpPath := filepath.Join(tempDir, uploadID, uploadID+".tmp")
+	require.NoError(t, os.Mkdir(tmpPath, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpPath, "blocker"), nil, 0o644))
+	require.Equal(t, http.StatusOK, uploadTestChunk(t, h, uploadID, 0, content[:6]).Code)
+	rec := uploadTestChunk(t, h, uploadID, 1, content[6:])
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code, rec.Body.String())
+
+	// Resending any chunk of the complete session finalizes it
+	require.NoError(t, os.RemoveAll(tmpPath))
+	rec = uploadTestChunk(t, h, uploadID, 1, content[6:])
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "Upload completed")
+}
+
+func TestUploadResponseIncludesSHA256(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	rec, resp := uploadForScan(t, h, "hello")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", resp["sha256"])
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", resp["md5"])
+
+	// URL uploads are hashed after the download
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer remote.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"url": {remote.URL + "/hello.txt"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", resp["sha256"])
+}
+
+func TestChunkedUploadResponseIncludesSHA256(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := "hello world"
+	response := initChunkedUpload(t, h, map[string]string{
+		"filename":   "greeting.txt",
+		"size":       fmt.Sprintf("%d", len(content)),
+		"chunk_size": "6",
+	})
+	uploadID := response["upload_id"].(string)
+
+	require.Equal(t, http.StatusOK, uploadTestChunk(t, h, uploadID, 0, content[:6]).Code)
+	rec := uploadTestChunk(t, h, uploadID, 1, content[6:])
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var complete map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &complete))
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", complete["sha256"])
+}
+
+func TestURLRedirectCachingAndEncoding(t *testing.T) {
+	_, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	future := time.Now().Add(time.Hour)
+	for _, meta := range []model.FileMetadata{
+		{ResourcePath: "plain", Token: "t1", OriginalURL: "https://example.com/page", IsURLShortener: true},
+		{ResourcePath: "once", Token: "t2", OriginalURL: "https://example.com/page", IsURLShortener: true, OneTimeView: true},
+		{ResourcePath: "soon", Token: "t3", OriginalURL: "https://example.com/page", IsURLShortener: true, ExpiresAt: &future},
+		{ResourcePath: "spaces", Token: "t4", OriginalURL: "https://example.com/a file/ü?q=a b&x=ü#top ü", IsURLShortener: true},
+		{ResourcePath: "script", Token: "t5", OriginalURL: "javascript:alert(1)", IsURLShortener: true},
+	} {
+		require.NoError(t, db.StoreMetadata(&meta))
+	}
+
+	redirect := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(id)
+		require.NoError(t, h.HandleURLRedirect(c))
+		return rec
+	}
+
+	rec := redirect("plain")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "private, max-age=300", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "https://example.com/page", rec.Header().Get("Location"))
+
+	for _, id := range []string{"once", "soon"} {
+		rec = redirect(id)
+		assert.Equal(t, http.StatusFound, rec.Code, id)
+		assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"), id)
+	}
+
+	rec = redirect("spaces")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://example.com/a%20file/%C3%BC?q=a%20b&x=%C3%BC#top%20%C3%BC", rec.Header().Get("Location"))
+
+	rec = redirect("script")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get("Location"))
+}
+
+func TestFileAccessGzip(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := strings.Repeat("compressible text ", 200)
+	createTestFile(t, tempDir, db, "notes.txt", content, false)
+
+	download := func(encoding, rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/notes.txt", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("notes.txt")
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	rec := download("gzip, deflate", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Empty(t, rec.Header().Get("Content-Length"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Accept-Encoding")
+	assert.Less(t, rec.Body.Len(), len(content))
+	gz, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(decoded))
+
+	for _, encoding := range []string{"identity", "", "gzip;q=0, *"} {
+		rec = download(encoding, "")
+		require.Equal(t, http.StatusOK, rec.Code, encoding)
+		assert.Empty(t, rec.Header().Get("Content-Encoding"), encoding)
+		assert.Equal(t, content, rec.Body.String(), encoding)
+	}
+
+	// Byte ranges refer to the stored file, so they are never compressed
+	rec = download("gzip", "bytes=0-9")
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "10", rec.Header().Get("Content-Length"))
+	assert.Equal(t, content[:10], rec.Body.String())
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                  false,
+		"gzip":              true,
+		"GZIP":              true,
+		"deflate, gzip":     true,
+		"gzip;q=0.5":        true,
+		"gzip;q=0":          false,
+		"x-gzip":            true,
+		"*":                 true,
+		"*;q=0":             false,
+		"gzip;q=0, *":       false,
+		"identity, deflate": false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", header)
+		assert.Equal(t, want, acceptsGzip(req), header)
+	}
+}
+
+func TestGroupedResourcesAreDeletedTogether(t *testing.T) {
+	_, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.URLShorteningEnabled = true
+	h.cfg.CascadeGroupDeletes = true
+
+	upload := func(fields map[string]string) (*httptest.ResponseRecorder, map[string]any) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for key, value := range fields {
+			writer.WriteField(key, value)
+		}
+		if fields["shorten"] == "" {
+			part, err := writer.CreateFormFile("file", "secret.txt")
+			require.NoError(t, err)
+			part.Write([]byte("read me once"))
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+
+		var resp map[string]any
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec, resp
+	}
+
+	rec, _ := upload(map[string]string{"group_id": "mine"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "clients can't pick their own group ids")
+
+	rec, file := upload(map[string]string{"group_id": "new", "one_time": "true"})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	group, _ := file["group_id"].(string)
+	assert.Regexp(t, "^[0-9a-f]{32}$", group)
+	assert.Equal(t, group, rec.Header().Get("X-Group-Id"))
+
+	fileURL := file["url"].(string)
+	rec, short := upload(map[string]string{"group_id": group, "shorten": "true", "url": fileURL})
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, group, short["group_id"])
+	shortID := strings.TrimPrefix(short["url"].(string), h.cfg.BaseURL)
+
+	members, err := db.ListMetadataByGroup(group)
+	require.NoError(t, err)
+	assert.Len(t, members, 2)
+
+	// Consuming the one-time file removes the short link to it
+	filename := strings.TrimPrefix(fileURL, h.cfg.BaseURL)
+	rec = requestFile(t, h, filename, "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "read me once", rec.Body.String())
+
+	_, err = db.GetMetadataByID(shortID)
+	assert.Error(t, err, "The grouped short link should be deleted with the file")
+	members, err = db.ListMetadataByGroup(group)
+	require.NoError(t, err)
+	assert.Empty(t, members)
+}
+
+func TestMaxDownloadsDeletesFileAfterLastDownload(t *testing.T) {
+	_, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	// Limited downloads are counted right away, not by the batched counter
+	h.SetAccessCounter(db.NewAccessCounter(store, time.Hour))
+
+	upload := func(maxDownloads string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "limited.txt")
+		require.NoError(t, err)
+		part.Write([]byte("three downloads"))
+		writer.WriteField("max_downloads", maxDownloads)
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	for _, invalid := range []string{"many", "-1"} {
+		assert.Equal(t, http.StatusBadRequest, upload(invalid).Code, invalid)
+	}
+
+	rec := upload("3")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	filename := filepath.Base(strings.TrimSpace(rec.Body.String()))
+	filePath := filepath.Join(h.cfg.UploadPath, filename)
+
+	meta, err := store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, 3, meta.MaxDownloads)
+
+	download := func(userAgent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+filename, nil)
+		req.Header.Set("User-Agent", userAgent)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(filename)
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	// Preview bots get the placeholder without using up a download
+	rec = download("Slackbot-LinkExpanding 1.0")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "three downloads")
+
+	for i := 1; i <= 3; i++ {
+		rec = download("curl/8.0")
+		require.Equal(t, http.StatusOK, rec.Code, "download %d", i)
+		assert.Equal(t, "three downloads", rec.Body.String())
+		assert.Contains(t, rec.Header().Get("Cache-Control"), "no-store")
+
+		if i < 3 {
+			meta, err := store.GetMetadataByID(filePath)
+			require.NoError(t, err)
+			assert.Equal(t, i, meta.AccessCount)
+		}
+	}
+
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err), "the last allowed download deletes the file")
+	_, err = store.GetMetadataByID(filePath)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	assert.Equal(t, http.StatusNotFound, download("curl/8.0").Code)
+}
+
+func TestHomePageUploadHints(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.AllowedContentTypes = []string{"image/*", "application/pdf"}
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleHome(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	page := rec.Body.String()
+	assert.Contains(t, page, `data-max-size="`+strconv.FormatInt(h.cfg.MaxSizeToBytes(), 10)+`"`)
+	assert.Contains(t, page, `data-allowed-types="image/*,application/pdf"`)
+	assert.Contains(t, page, fmt.Sprintf("<small>Max %.1f MiB</small>", h.cfg.MaxSize))
+	assert.Contains(t, page, "setCustomValidity")
+}
+
+func TestUploadSuccessPageForBrowsers(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	upload := func(accept string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "report <final>.txt")
+		require.NoError(t, err)
+		part.Write([]byte("quarterly numbers"))
+		writer.WriteField("one_time", "on")
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		return rec
+	}
+
+	rec := upload("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	page := rec.Body.String()
+	token := rec.Header().Get("X-Token")
+	require.NotEmpty(t, token)
+	assert.Contains(t, page, `value="`+token+`"`)
+	assert.Contains(t, page, "Save this token")
+	assert.Contains(t, page, "report &lt;final&gt;.txt")
+	assert.Contains(t, page, "deleted after its first download")
+	assert.Contains(t, page, `data-copy="upload-url"`)
+	assert.Regexp(t, `value="http://localhost:8080/[^"]+"`, page)
+	assert.Contains(t, page, `<div class="qr"><svg xmlns="http://www.w3.org/2000/svg"`)
+
+	// API and CLI clients keep their responses
+	rec = upload("*/*")
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(rec.Body.String(), "http://localhost:8080/"))
+
+	rec = upload("application/json, text/html")
+	assert.Contains(t, rec.Header().Get("Content-Type"), "application/json")
+}
+
+func TestAbortChunkedUpload(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	abort := func(uploadID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/upload/"+uploadID, nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("upload_id")
+		c.SetParamValues(uploadID)
+		req.Header.Set(UploadTokenHeader, sessionToken(h, uploadID))
+		require.NoError(t, h.AbortChunkedUpload(c))
+		return rec
+	}
+
+	init := initChunkedUpload(t, h, map[string]string{"filename": "big.bin", "size": "8", "chunk_size": "4"})
+	uploadID := init["upload_id"].(string)
+	require.Equal(t, http.StatusOK, uploadTestChunk(t, h, uploadID, 0, "abcd").Code)
+
+	uploadDir := filepath.Join(h.cfg.UploadPath, uploadID)
+	_, err := os.Stat(uploadDir)
+	require.NoError(t, err)
+
+	rec := abort(uploadID)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Upload aborted")
+
+	_, err = os.Stat(uploadDir)
+	assert.True(t, os.IsNotExist(err), "the chunks are removed")
+	assert.Equal(t, http.StatusNotFound, uploadTestChunk(t, h, uploadID, 1, "efgh").Code)
+	assert.Equal(t, http.StatusNotFound, abort(uploadID).Code)
+}
+
+func TestFormatDisposition(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"report.pdf", `attachment; filename="report.pdf"`},
+		{"naïve café.txt", `attachment; filename="na_ve caf_.txt"; filename*=UTF-8''na%C3%AFve%20caf%C3%A9.txt`},
+		{`say "hi".txt`, `attachment; filename="say _hi_.txt"; filename*=UTF-8''say%20%22hi%22.txt`},
+		{"evil\r\nSet-Cookie: x=1.txt", `attachment; filename="evilSet-Cookie: x=1.txt"`},
+		{"写真.png", `attachment; filename="__.png"; filename*=UTF-8''%E5%86%99%E7%9C%9F.png`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, formatDisposition("attachment", tt.name), tt.name)
+	}
+}
+
+func TestDownloadDispositionKeepsUnicodeAndQuotedNames(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	for _, name := range []string{"résumé “final”.bin", `quote"d.bin`} {
+		filePath := filepath.Join(tempDir, "named.bin")
+		require.NoError(t, os.WriteFile(filePath, []byte("0123456789"), 0o644))
+		require.NoError(t, store.StoreMetadata(&model.FileMetadata{
+			ResourcePath: filePath,
+			Token:        "test-token",
+			OriginalName: name,
+			Size:         10,
+			ContentType:  "application/octet-stream",
+		}))
+
+		for _, rangeHeader := range []string{"", "bytes=0-3"} {
+			req := httptest.NewRequest(http.MethodGet, "/named.bin", nil)
+			if rangeHeader != "" {
+				req.Header.Set("Range", rangeHeader)
+			}
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("filename")
+			c.SetParamValues("named.bin")
+			require.NoError(t, h.HandleFileAccess(c))
+
+			header := rec.Header().Get("Content-Disposition")
+			_, params, err := mime.ParseMediaType(header)
+			require.NoError(t, err, header)
+			assert.Equal(t, name, params["filename"], "range %q", rangeHeader)
+		}
+	}
+}
+
+// solvePoW finds a nonce for the challenge, the way clients do
+func solvePoW(t *testing.T, challenge string, difficulty int) string {
+	for nonce := 0; ; nonce++ {
+		solution := challenge + ":" + strconv.Itoa(nonce)
+		sum := sha256.Sum256([]byte(solution))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return solution
+		}
+		require.Less(t, nonce, 1<<24, "no solution found")
+	}
+}
+
+func TestPoWIssuerVerify(t *testing.T) {
+	pow := newPoWIssuer(8)
+	now := time.Now()
+
+	challenge, expires, err := pow.issue(now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(powChallengeTTL), expires)
+	solution := solvePoW(t, challenge, 8)
+
+	// Wrong nonces, tampered or foreign challenges and garbage are invalid
+	for _, invalid := range []string{
+		"", challenge, challenge + ":", "not-a-challenge:1",
+		strings.Replace(solution, ".", "0.", 1),
+		solvePoW(t, "1.ab.cd", 8),
+	} {
+		assert.ErrorIs(t, pow.verify(invalid, now), errPoWInvalid, invalid)
+	}
+
+	// Solutions expire with their challenge and are accepted once
+	assert.ErrorIs(t, pow.verify(solution, now.Add(powChallengeTTL+time.Second)), errPoWExpired)
+	assert.NoError(t, pow.verify(solution, now))
+	assert.ErrorIs(t, pow.verify(solution, now), errPoWReused)
+
+	// Another process can't accept our challenges
+	assert.ErrorIs(t, newPoWIssuer(8).verify(solvePoW(t, challenge, 8), now), errPoWInvalid)
+
+	assert.Equal(t, 0, leadingZeroBits([]byte{0x80}))
+	assert.Equal(t, 12, leadingZeroBits([]byte{0x00, 0x08, 0xff}))
+}
+
+func TestUploadRequiresProofOfWork(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.PoWDifficulty = 8
+	h.pow = newPoWIssuer(8)
+	h.cfg.UploadTiers = map[string]config.UploadTier{"pro": {}}
+	h.cfg.APIKeys = []config.APIKey{{Key: "pro-key", Tier: "pro"}}
+
+	upload := func(header, value string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "work.txt")
+		require.NoError(t, err)
+		part.Write([]byte("worth the work"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	challenge := func() PoWChallengeResponse {
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandlePoWChallenge(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/pow", nil), rec)))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		var resp PoWChallengeResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, 8, resp.Difficulty)
+		return resp
+	}
+
+	rec := upload("", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/api/pow")
+
+	assert.Equal(t, http.StatusForbidden, upload(PoWHeader, challenge().Challenge+":0x").Code)
+
+	solution := solvePoW(t, challenge().Challenge, 8)
+	assert.Equal(t, http.StatusOK, upload(PoWHeader, solution).Code)
+	assert.Equal(t, http.StatusForbidden, upload(PoWHeader, solution).Code, "solutions are single use")
+
+	// API key uploads skip the challenge, unknown keys don't
+	assert.Equal(t, http.StatusOK, upload(APIKeyHeader, "pro-key").Code)
+	assert.Equal(t, http.StatusUnauthorized, upload(APIKeyHeader, "nope").Code)
+
+	// Chunked uploads need a solution to start
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("filename", "big.bin")
+	writer.WriteField("size", "8")
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload/init", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.InitiateChunkedUpload(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	h.pow = nil
+	rec = httptest.NewRecorder()
+	require.NoError(t, h.HandlePoWChallenge(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/pow", nil), rec)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestChunkedUploadReaper(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	expiredID := initChunkedUpload(t, h, map[string]string{"filename": "old.bin", "size": "8", "chunk_size": "4"})["upload_id"].(string)
+	require.Equal(t, http.StatusOK, uploadTestChunk(t, h, expiredID, 0, "abcd").Code)
+	activeID := initChunkedUpload(t, h, map[string]string{"filename": "new.bin", "size": "8", "chunk_size": "4"})["upload_id"].(string)
+
+	h.chunkedManager.mu.Lock()
+	h.chunkedManager.uploads[expiredID].ExpiresAt = time.Now().Add(-time.Minute)
+	h.chunkedManager.mu.Unlock()
+
+	old := time.Now().Add(-2 * time.Hour)
+	mkdir := func(name string, modTime time.Time) string {
+		dir := filepath.Join(tempDir, name)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "chunk_0"), []byte("data"), 0o644))
+		require.NoError(t, os.Chtimes(dir, modTime, modTime))
+		return dir
+	}
+	orphan := mkdir("lostsession", old)
+	fresh := mkdir("justcreated", time.Now())
+	folder := mkdir("folderupload", old)
+	require.NoError(t, store.StoreMetadata(&model.FileMetadata{ResourcePath: folder, Token: "t", ContentType: model.FolderContentType}))
+
+	sessions, orphans := h.chunkedManager.reap(time.Now())
+	assert.Equal(t, 1, sessions)
+	assert.Equal(t, 1, orphans)
+
+	h.chunkedManager.mu.RLock()
+	_, expiredExists := h.chunkedManager.uploads[expiredID]
+	_, activeExists := h.chunkedManager.uploads[activeID]
+	h.chunkedManager.mu.RUnlock()
+	assert.False(t, expiredExists, "the expired session is forgotten")
+	assert.True(t, activeExists)
+
+	for dir, kept := range map[string]bool{
+		filepath.Join(tempDir, expiredID): false,
+		orphan:                            false,
+		filepath.Join(tempDir, activeID):  true,
+		fresh:                             true,
+		folder:                            true,
+	} {
+		_, err := os.Stat(dir)
+		assert.Equal(t, kept, err == nil, dir)
+	}
+
+	// The periodic reaper stops cleanly
+	h.chunkedManager.Start()
+	h.chunkedManager.Stop()
+}
+
+func TestRequestSlug(t *testing.T) {
+	tests := []struct {
+		value   string
+		slug    string
+		wantErr error
+	}{
+		{"", "", nil},
+		{"q3-report", "q3-report", nil},
+		{"  Q3 Report (final) ", "Q3-Report--final", nil},
+		{"../../etc/passwd", "etc-passwd", nil},
+		{".hidden", "hidden", nil},
+		{strings.Repeat("a", 100), strings.Repeat("a", maxSlugLength), nil},
+		{"Admin", "", errSlugReserved},
+		{"stats", "", errSlugReserved},
+		{"favicon.ico", "", errSlugReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"slug": {tt.value}}.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+			require.NoError(t, req.ParseForm())
+
+			slug, err := requestSlug(c)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.slug, slug)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("slug=%2F%2F%2F"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	require.NoError(t, req.ParseForm())
+	_, err := requestSlug(echo.New().NewContext(req, httptest.NewRecorder()))
+	assert.Error(t, err, "slugs without safe characters are rejected")
+}
+
+func TestUploadWithSlug(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	upload := func(filename, slug string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("slug", slug)
+		part, err := writer.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		part.Write([]byte("quarterly numbers"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := upload("report.pdf", "Q3 report")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "/Q3-report.pdf")
+	_, err := os.Stat(filepath.Join(tempDir, "Q3-report.pdf"))
+	assert.NoError(t, err)
+
+	rec = upload("other.pdf", "Q3-report")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	content, err := os.ReadFile(filepath.Join(tempDir, "Q3-report.pdf"))
+	require.NoError(t, err)
+	assert.Equal(t, "quarterly numbers", string(content))
+
+	rec = upload("report.txt", "Q3-report.txt")
+	require.Equal(t, http.StatusOK, rec.Code, "the same slug with another extension is free")
+	assert.Contains(t, rec.Body.String(), "/Q3-report.txt", "the extension isn't doubled")
+
+	rec = upload("data.bin", "admin")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = upload("icon.ico", "favicon")
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "slugs can't shadow routes with their extension")
+}
+
+func TestUploadSlugConflicts(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	upload := func(content, onConflict, token string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("slug", "notes")
+		if onConflict != "" {
+			writer.WriteField("on_conflict", onConflict)
+		}
+		part, err := writer.CreateFormFile("file", "notes.txt")
+		require.NoError(t, err)
+		part.Write([]byte(content))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if token != "" {
+			req.Header.Set("X-Token", token)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+	stored := func(filename string) string {
+		content, err := os.ReadFile(filepath.Join(tempDir, filename))
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	rec := upload("first", "", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	token := rec.Header().Get("X-Token")
+	require.NotEmpty(t, token)
+
+	t.Run("fail", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, upload("second", "", "").Code)
+		assert.Equal(t, http.StatusConflict, upload("second", "fail", "").Code)
+		assert.Equal(t, "first", stored("notes.txt"))
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, upload("second", "replace", token).Code)
+		assert.Equal(t, "first", stored("notes.txt"))
+	})
+
+	t.Run("overwrite without the owner's token", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, upload("hijacked", "overwrite", "").Code)
+		assert.Equal(t, http.StatusForbidden, upload("hijacked", "overwrite", "not-the-token").Code)
+		assert.Equal(t, "first", stored("notes.txt"))
+
+		entries, err := os.ReadDir(tempDir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			if !entry.IsDir() && entry.Name() != "notes.txt" && !strings.HasPrefix(entry.Name(), "test.db") {
+				t.Errorf("rejected overwrite left %s behind", entry.Name())
+			}
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		rec := upload("second version", "overwrite", token)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), "/notes.txt")
+		assert.Equal(t, "second version", stored("notes.txt"))
+
+		meta, err := store.GetMetadataByID(filepath.Join(tempDir, "notes.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len("second version")), meta.Size)
+		assert.Equal(t, rec.Header().Get("X-Token"), meta.Token, "the overwrite gets a new management token")
+		assert.NotEqual(t, token, meta.Token)
+
+		all, err := store.ListAllMetadata()
+		require.NoError(t, err)
+		assert.Len(t, all, 1, "the overwrite replaces the metadata")
+	})
+
+	t.Run("version", func(t *testing.T) {
+		for i, want := range []string{"notes-v2.txt", "notes-v3.txt"} {
+			rec := upload(fmt.Sprintf("version %d", i+2), "version", "")
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			assert.Contains(t, rec.Body.String(), "/"+want)
+			assert.Equal(t, fmt.Sprintf("version %d", i+2), stored(want))
+		}
+		assert.Equal(t, "second version", stored("notes.txt"), "earlier versions are kept")
+	})
+}
+
+func TestPrecompressedUploadsAreServedByAcceptEncoding(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	const source = "console.log('hello from a pre-compressed asset');\n"
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(source))
+	zw.Close()
+
+	upload := func(filename string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("content_encoding", "gzip")
+		part, err := writer.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		part.Write(content)
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := upload("app.js.gz", compressed.Bytes())
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "content_encoding is off by default")
+
+	h.cfg.ContentEncodingUploads = true
+	rec = upload("plain.js.gz", []byte(source))
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "uploads that aren't gzip are rejected")
+
+	rec = upload("app.js.gz", compressed.Bytes())
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	filename := path.Base(resp["url"].(string))
+
+	download := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+filename, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(filename)
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	t.Run("client accepting gzip", func(t *testing.T) {
+		rec := download("gzip, deflate")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+		assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+		assert.Contains(t, rec.Header().Get("Vary"), "Accept-Encoding")
+		assert.Contains(t, rec.Header().Get("Content-Disposition"), "app.js")
+		assert.NotContains(t, rec.Header().Get("Content-Disposition"), ".gz")
+		assert.Equal(t, compressed.Bytes(), rec.Body.Bytes(), "the stored file is sent as is")
+	})
+
+	t.Run("client without gzip support", func(t *testing.T) {
+		rec := download("")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, "none", rec.Header().Get("Accept-Ranges"))
+		assert.Equal(t, source, rec.Body.String(), "the file is decompressed on the fly")
+
+		rec = download("gzip;q=0, identity")
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, source, rec.Body.String())
+	})
+}
+
+func TestPasswordProtectedDownloads(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.passwords = newPasswordAttempts(3, 15*time.Minute)
+
+	const content = "quarterly numbers"
+	filePath := createTestFile(t, tempDir, store, "report.txt", content, false)
+	meta, err := store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	meta.PasswordHash = string(hash)
+	require.NoError(t, store.StoreMetadata(&meta))
+
+	get := func(query string, headers map[string]string) *httptest.ResponseRecorder {
+		target := "/report.txt"
+		if query != "" {
+			target += "?" + query
+		}
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("report.txt")
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	t.Run("no password", func(t *testing.T) {
+		rec := get("", nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+		assert.NotContains(t, rec.Body.String(), content)
+
+		rec = get("", map[string]string{"Accept": "text/html"})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), `type="password"`)
+		assert.Contains(t, rec.Body.String(), `action="http://localhost:8080/report.txt"`)
+		assert.Empty(t, rec.Header().Get("WWW-Authenticate"), "browsers get the page instead of a login dialog")
+	})
+
+	t.Run("correct password", func(t *testing.T) {
+		rec := get("password=s3cret", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, content, rec.Body.String())
+		assert.Contains(t, rec.Header().Get("Cache-Control"), "no-store")
+
+		req := httptest.NewRequest(http.MethodGet, "/report.txt", nil)
+		req.SetBasicAuth("", "s3cret")
+		req.Header.Set("Range", "bytes=0-8")
+		rec = httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("report.txt")
+		require.NoError(t, h.HandleFileAccess(c))
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "quarterly", rec.Body.String())
+
+		form := url.Values{"password": {"s3cret"}}
+		req = httptest.NewRequest(http.MethodPost, "/report.txt", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec = httptest.NewRecorder()
+		c = echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("report.txt")
+		require.NoError(t, h.HandleFileManagement(c))
+		assert.Equal(t, http.StatusOK, rec.Code, "the password page posts back to the file")
+		assert.Equal(t, content, rec.Body.String())
+	})
+
+	t.Run("range requests and preview bots need the password", func(t *testing.T) {
+		rec := get("", map[string]string{"Range": "bytes=0-8"})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		rec = get("", map[string]string{"User-Agent": "Slackbot-LinkExpanding 1.0"})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.NotContains(t, rec.Body.String(), content)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		rec := get("password=wrong", map[string]string{"Accept": "text/html"})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Wrong password")
+
+		rec = get("password=wrong", nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		rec = get("password=wrong", nil)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code, "wrong passwords lock the client out")
+		rec = get("password=s3cret", nil)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+}
+
+func TestPasswordProtectedUpload(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	upload := func(password string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		if password != "" {
+			writer.WriteField("password", password)
+		}
+		part, err := writer.CreateFormFile("file", "notes.txt")
+		require.NoError(t, err)
+		part.Write([]byte("private notes"))
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := upload(strings.Repeat("x", 73))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	for _, password := range []string{"open sesame", ""} {
+		rec = upload(password)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		filename := path.Base(resp["url"].(string))
+
+		meta, err := store.GetMetadataByID(filepath.Join(tempDir, filename))
+		require.NoError(t, err)
+		if password == "" {
+			assert.False(t, meta.HasPassword())
+			assert.Equal(t, "private notes", requestFile(t, h, filename, "", "").Body.String(), "files without a password are served as before")
+			continue
+		}
+		assert.NotContains(t, meta.PasswordHash, password, "only a hash is stored")
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(meta.PasswordHash), []byte(password)))
+		assert.Equal(t, http.StatusUnauthorized, requestFile(t, h, filename, "", "").Code)
+		assert.Equal(t, "private notes", requestFile(t, h, filename, "password=open+sesame", "").Body.String())
+	}
+}
+
+func headFile(t *testing.T, h *Handler, filename string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodHead, "/"+filename, nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues(filename)
+	require.NoError(t, h.HandleFileHead(c))
+	return rec
+}
+
+func TestHeadFileMatchesGet(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := "headers without a body"
+	filePath := createTestFile(t, tempDir, store, "head.txt", content, false)
+	meta, err := store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	expires := time.Now().Add(time.Hour)
+	meta.ExpiresAt = &expires
+	require.NoError(t, store.StoreMetadata(&meta))
+
+	head := headFile(t, h, "head.txt")
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Empty(t, head.Body.String())
+	assert.NotEmpty(t, head.Header().Get("Last-Modified"))
+
+	updated, err := store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, meta.AccessCount, updated.AccessCount)
+
+	get := requestFile(t, h, "head.txt", "", "")
+	assert.Equal(t, content, get.Body.String())
+	for _, name := range []string{"Content-Type", "Content-Length", "Accept-Ranges", "ETag", "X-Expires", "Content-Disposition"} {
+		assert.NotEmpty(t, head.Header().Get(name), name)
+		assert.Equal(t, get.Header().Get(name), head.Header().Get(name), name)
+	}
+	assert.Equal(t, strconv.Itoa(len(content)), head.Header().Get("Content-Length"))
+
+	t.Run("missing file", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, headFile(t, h, "missing.txt").Code)
+	})
+
+	t.Run("expired file", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		meta.ExpiresAt = &past
+		require.NoError(t, store.StoreMetadata(&meta))
+		assert.Equal(t, http.StatusGone, headFile(t, h, "head.txt").Code)
+	})
+}
+
+func TestHeadKeepsOneTimeFile(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filePath := createTestFile(t, tempDir, store, "once.txt", "only once", true)
+
+	head := headFile(t, h, "once.txt")
+	assert.Equal(t, http.StatusOK, head.Code)
+	assert.Equal(t, "true", head.Header().Get("X-One-Time-View"))
+
+	time.Sleep(200 * time.Millisecond)
+	assert.FileExists(t, filePath)
+	_, err := store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+
+	get := requestFile(t, h, "once.txt", "", "")
+	assert.Equal(t, "only once", get.Body.String())
+	assert.NoFileExists(t, filePath)
+}
+
+func TestPregeneratedThumbnails(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	h.cfg.PregenerateThumbnails = true
+	h.startThumbnailWorker()
+
+	img := image.NewRGBA(image.Rect(0, 0, 600, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 600; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, img))
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "photo.png")
+	require.NoError(t, err)
+	part.Write(encoded.Bytes())
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	filename := path.Base(strings.TrimSpace(rec.Body.String()))
+	filePath := filepath.Join(tempDir, filename)
+	thumbPath := filepath.Join(h.cfg.ThumbnailPath, filename+".jpg")
+	require.Eventually(t, func() bool {
+		meta, err := store.GetMetadataByID(filePath)
+		return err == nil && meta.ThumbnailPath == thumbPath
+	}, 2*time.Second, 10*time.Millisecond)
+	require.FileExists(t, thumbPath)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+filename+"/thumb", nil)
+	rec = httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("filename")
+	c.SetParamValues(filename)
+	require.NoError(t, h.HandleThumbnail(c))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+
+	thumb, err := jpeg.Decode(rec.Body)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 256, 128), thumb.Bounds())
+
+	download := requestFile(t, h, filename, "", "")
+	assert.Contains(t, download.Header().Values("Link"), `<http://localhost:8080/`+filename+`/thumb>; rel="preview"; type="image/jpeg"`)
+}
+
+func TestThumbnailsAreGeneratedOnRequest(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 40, 80))))
+	filePath := filepath.Join(tempDir, "small.png")
+	require.NoError(t, os.WriteFile(filePath, encoded.Bytes(), 0o644))
+	meta := model.FileMetadata{ResourcePath: filePath, Token: "t", OriginalName: "small.png", ContentType: "image/png"}
+	require.NoError(t, store.StoreMetadata(&meta))
+
+	thumbnail := func(filename string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+filename+"/thumb", nil)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(filename)
+		require.NoError(t, h.HandleThumbnail(c))
+		return rec
+	}
+
+	rec := thumbnail("small.png")
+	require.Equal(t, http.StatusOK, rec.Code)
+	thumb, err := jpeg.Decode(rec.Body)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 40, 80), thumb.Bounds())
+
+	stored, err := store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	assert.FileExists(t, stored.ThumbnailPath)
+
+	t.Run("one-time files have none", func(t *testing.T) {
+		createTestFile(t, tempDir, store, "once.png", encoded.String(), true)
+		assert.Equal(t, http.StatusNotFound, thumbnail("once.png").Code)
+	})
+
+	t.Run("other types have none", func(t *testing.T) {
+		createTestFile(t, tempDir, store, "notes.txt", "text", false)
+		assert.Equal(t, http.StatusNotFound, thumbnail("notes.txt").Code)
+	})
+}
+
+func TestLastModifiedConditionalRequests(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filePath := createTestFile(t, tempDir, store, "cached.txt", "cache me", false)
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+	require.NoError(t, os.Chtimes(filePath, modTime, modTime))
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/cached.txt", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("cached.txt")
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	rec := serve(nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+	lastModified := rec.Header().Get("Last-Modified")
+	assert.Equal(t, "Fri, 01 Mar 2024 12:00:00 GMT", lastModified)
+
+	// The validator sent back as is, without the ETag, is enough for a 304
+	rec = serve(map[string]string{"If-Modified-Since": lastModified})
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	rec = serve(map[string]string{"If-Modified-Since": modTime.Add(-time.Minute).Format(http.TimeFormat)})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "cache me", rec.Body.String())
+
+	t.Run("if-unmodified-since", func(t *testing.T) {
+		rec := serve(map[string]string{"If-Unmodified-Since": lastModified})
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "cache me", rec.Body.String())
+
+		rec = serve(map[string]string{"If-Unmodified-Since": modTime.Add(-time.Hour).Format(http.TimeFormat), "Range": "bytes=0-4"})
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+}
+
+func TestMultiRangeRequests(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := "0123456789abcdefghij"
+	createTestFile(t, tempDir, store, "ranges.txt", content, false)
+
+	request := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ranges.txt", nil)
+		req.Header.Set("Range", rangeHeader)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("ranges.txt")
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	readParts := func(rec *httptest.ResponseRecorder) map[string]string {
+		mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+		require.NoError(t, err)
+		require.Equal(t, "multipart/byteranges", mediaType)
+		assert.Empty(t, rec.Header().Get("Content-Range"))
+
+		parts := map[string]string{}
+		reader := multipart.NewReader(rec.Body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return parts
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "text/plain", part.Header.Get("Content-Type"))
+			data, err := io.ReadAll(part)
+			require.NoError(t, err)
+			parts[part.Header.Get("Content-Range")] = string(data)
+		}
+	}
+
+	t.Run("disjoint ranges", func(t *testing.T) {
+		rec := request("bytes=0-3, 10-12,-2")
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, map[string]string{
+			"bytes 0-3/20":   "0123",
+			"bytes 10-12/20": "abc",
+			"bytes 18-19/20": "ij",
+		}, readParts(rec))
+	})
+
+	t.Run("unsatisfiable ranges are left out", func(t *testing.T) {
+		rec := request("bytes=2-4,30-40,15-")
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, map[string]string{
+			"bytes 2-4/20":   "234",
+			"bytes 15-19/20": "fghij",
+		}, readParts(rec))
+
+		rec = request("bytes=30-40,5-6")
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "bytes 5-6/20", rec.Header().Get("Content-Range"))
+		assert.Equal(t, "56", rec.Body.String())
+
+		rec = request("bytes=30-40,50-")
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+		assert.Equal(t, "bytes */20", rec.Header().Get("Content-Range"))
+	})
+
+	t.Run("malformed range", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request("bytes=0-1,x-2").Code)
+	})
+}
+
+func TestZeroLengthFile(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	createTestFile(t, tempDir, store, "empty.txt", "", false)
+
+	t.Run("full download", func(t *testing.T) {
+		rec := requestFile(t, h, "empty.txt", "", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "0", rec.Header().Get("Content-Length"))
+		assert.Empty(t, rec.Body.String())
+	})
+
+	for _, rangeHeader := range []string{"bytes=0-", "bytes=0-0", "bytes=-1", "bytes=0-0,-1"} {
+		t.Run(rangeHeader, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/empty.txt", nil)
+			req.Header.Set("Range", rangeHeader)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("filename")
+			c.SetParamValues("empty.txt")
+			require.NoError(t, h.HandleFileAccess(c))
+
+			assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+			assert.Equal(t, "bytes */0", rec.Header().Get("Content-Range"))
+		})
+	}
+}
+
+func TestPreviewBotsAreNotCounted(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	filePath := createTestFile(t, tempDir, store, "counted.txt", "counted", false)
+	download := func(userAgent string) {
+		req := httptest.NewRequest(http.MethodGet, "/counted.txt", nil)
+		req.Header.Set("User-Agent", userAgent)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("counted.txt")
+		require.NoError(t, h.HandleFileAccess(c))
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+	accessCount := func() int {
+		meta, err := store.GetMetadataByID(filePath)
+		require.NoError(t, err)
+		return meta.AccessCount
+	}
+
+	download("curl/8.0")
+	assert.Equal(t, 1, accessCount())
+
+	download("Slackbot-LinkExpanding 1.0")
+	assert.Equal(t, 1, accessCount(), "link previews aren't downloads")
+
+	download("curl/8.0")
+	assert.Equal(t, 2, accessCount())
+}
+
+// adminCookie logs in an admin session and returns its cookie
+func adminCookie(t *testing.T, h *Handler) *http.Cookie {
+	t.Helper()
+	session, err := h.adminSessions.create()
+	require.NoError(t, err)
+	return &http.Cookie{Name: adminSessionCookie, Value: session}
+}
+
+func TestAdminSessions(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.AdminPasswordHash = "admin:$apr1$droptest$6Ln1OYE9/EJGXI2fLgi9W0"
+
+	e := echo.New()
+	dashboard := func(cookie *http.Cookie) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleAdminDashboard(e.NewContext(req, rec)))
+		return rec.Code
+	}
+	login := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"admin"}, "password": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleAdminLogin(e.NewContext(req, rec)))
+		return rec
+	}
+
+	for _, value := range []string{"true", "abc.def", "abc." + h.adminSessions.sign("abc")} {
+		assert.NotEqual(t, http.StatusOK, dashboard(&http.Cookie{Name: adminSessionCookie, Value: value}),
+			"forged cookie %q", value)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+
+	rec := login("secret")
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	session := cookies[0]
+	assert.True(t, session.HttpOnly)
+	assert.Equal(t, http.StatusOK, dashboard(session))
+
+	tampered := *session
+	tampered.Value = session.Value[:len(session.Value)-1] + "0"
+	if tampered.Value == session.Value {
+		tampered.Value = session.Value[:len(session.Value)-1] + "1"
+	}
+	assert.NotEqual(t, http.StatusOK, dashboard(&tampered))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/logout", nil)
+	req.AddCookie(session)
+	require.NoError(t, h.HandleAdminLogout(e.NewContext(req, httptest.NewRecorder())))
+	assert.NotEqual(t, http.StatusOK, dashboard(session), "logging out ends the session")
+}
+
+func TestAdminSessionsExpire(t *testing.T) {
+	sessions := newAdminSessions("secret", time.Hour)
+	now := time.Now()
+	sessions.now = func() time.Time { return now }
+
+	session, err := sessions.create()
+	require.NoError(t, err)
+	assert.True(t, sessions.valid(session))
+
+	other := newAdminSessions("other secret", time.Hour)
+	assert.False(t, other.valid(session), "cookies signed with another secret are rejected")
+
+	now = now.Add(2 * time.Hour)
+	assert.False(t, sessions.valid(session))
+}
+
+func TestOneTimeGracePeriod(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.OneTimeGraceSeconds = 1
+
+	filePath := createTestFile(t, tempDir, store, "grace.txt", "fetched twice", true)
+
+	rec := requestFile(t, h, "grace.txt", "", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	meta, err := store.GetMetadataByID(filePath)
+	require.NoError(t, err, "the file outlives its download")
+	require.NotNil(t, meta.ExpiresAt)
+	expiresAt := *meta.ExpiresAt
+	assert.WithinDuration(t, time.Now().Add(time.Second), expiresAt, time.Second)
+
+	rec = requestFile(t, h, "grace.txt", "", "")
+	require.Equal(t, http.StatusOK, rec.Code, "re-fetches within the grace period are served")
+	assert.Equal(t, "fetched twice", rec.Body.String())
+	meta, err = store.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	assert.True(t, meta.ExpiresAt.Equal(expiresAt), "re-fetches don't extend the grace period")
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filePath)
+		return os.IsNotExist(err)
+	}, 5*time.Second, 50*time.Millisecond, "the file is deleted after the grace period")
+	_, err = store.GetMetadataByID(filePath)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func TestOneTimeFileIsGoneAfterGracePeriod(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.OneTimeGraceSeconds = 3600
+
+	filePath := createTestFile(t, tempDir, store, "gone.txt", "once", true)
+	require.Equal(t, http.StatusOK, requestFile(t, h, "gone.txt", "", "").Code)
+
+	// The grace period is over, but the file hasn't been cleaned up yet
+	require.NoError(t, store.ExpireBy(filePath, time.Now().Add(-time.Second)))
+	assert.Equal(t, http.StatusGone, requestFile(t, h, "gone.txt", "", "").Code)
+	assert.Equal(t, http.StatusGone, headFile(t, h, "gone.txt").Code)
+}
+
+func TestAdminBulkDelete(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.AdminPanelEnabled = true
+
+	var files []string
+	for i, name := range []string{"spam1.txt", "spam2.txt"} {
+		path := createTestFile(t, tempDir, store, name, "spam", false)
+		meta, err := store.GetMetadataByID(path)
+		require.NoError(t, err)
+		meta.Token = fmt.Sprintf("file-token-%d", i)
+		require.NoError(t, store.StoreMetadata(&meta))
+		files = append(files, path)
+	}
+	short := model.FileMetadata{
+		ResourcePath:   "spam-link",
+		Token:          "short-token",
+		OriginalURL:    "https://example.com",
+		IsURLShortener: true,
+		UploadDate:     time.Now(),
+	}
+	require.NoError(t, store.StoreMetadata(&short))
+	kept := createTestFile(t, tempDir, store, "kept.txt", "kept", false)
+
+	form := url.Values{"token": {"file-token-0", "short-token", "not-a-token", "file-token-1", "short-token"}}
+	bulkDelete := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/bulk-delete", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleAdminBulkDelete(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, bulkDelete(nil).Code)
+
+	rec := bulkDelete(adminCookie(t, h))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var result BulkDeleteResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, 3, result.Deleted)
+	assert.Equal(t, 2, result.Failed)
+	require.Len(t, result.Failures, 2)
+	assert.Equal(t, 2, result.Failures[0].Entry, "the bad entry doesn't stop the rest")
+	assert.Equal(t, 4, result.Failures[1].Entry)
+	assert.NotContains(t, rec.Body.String(), "token-", "tokens aren't echoed back")
+
+	for _, path := range files {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), path)
+		_, err = store.GetMetadataByID(path)
+		assert.ErrorIs(t, err, db.ErrNotFound)
+	}
+	_, err := store.GetMetadataByID("spam-link")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = store.GetMetadataByID(kept)
+	assert.NoError(t, err)
+}
+
+func TestAdminAPIFiles(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.AdminPanelEnabled = true
+
+	for i, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := createTestFile(t, tempDir, store, name, "content", false)
+		meta, err := store.GetMetadataByID(path)
+		require.NoError(t, err)
+		meta.Token = fmt.Sprintf("file-token-%d", i)
+		require.NoError(t, store.StoreMetadata(&meta))
+	}
+
+	list := func(query string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/api/files?"+query, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleAdminAPIFiles(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := list("", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+
+	cookie := adminCookie(t, h)
+	rec = list("sort=filename&dir=asc&limit=2", cookie)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var raw map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &raw))
+	for _, key := range []string{"files", "next_cursor", "total_files", "matching_files", "total_size"} {
+		assert.Contains(t, raw, key)
+	}
+
+	var page AdminFileList
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Files, 2)
+	assert.Equal(t, "a.txt", filepath.Base(page.Files[0].ResourcePath))
+	assert.Equal(t, "b.txt", filepath.Base(page.Files[1].ResourcePath))
+	assert.Equal(t, 3, page.TotalFiles)
+	assert.Equal(t, 3, page.MatchingFiles)
+	assert.Equal(t, int64(3*len("content")), page.TotalSize)
+	require.NotEmpty(t, page.NextCursor)
+
+	rec = list("sort=filename&dir=asc&limit=2&cursor="+url.QueryEscape(page.NextCursor), cookie)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	page = AdminFileList{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Len(t, page.Files, 1)
+	assert.Equal(t, "c.txt", filepath.Base(page.Files[0].ResourcePath))
+	assert.Empty(t, page.NextCursor)
+
+	rec = list("search=nothing-matches", cookie)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"files":[]`)
+
+	rec = list("sort=size&cursor=ten", cookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	h.cfg.AdminPanelEnabled = false
+	assert.Equal(t, http.StatusNotFound, list("", cookie).Code)
+}
+
+func TestMissingFileMetadataIsCleanedUp(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.CleanupMissingFiles = true
+
+	path := createTestFile(t, tempDir, store, "removed.txt", "content", false)
+	require.NoError(t, os.Remove(path))
+
+	rec := requestFile(t, h, "removed.txt", "", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Eventually(t, func() bool {
+		_, err := store.GetMetadataByID(path)
+		return errors.Is(err, db.ErrNotFound)
+	}, time.Second, 10*time.Millisecond, "the orphaned metadata is deleted")
+
+	t.Run("kept when disabled", func(t *testing.T) {
+		h.cfg.CleanupMissingFiles = false
+		path := createTestFile(t, tempDir, store, "kept.txt", "content", false)
+		require.NoError(t, os.Remove(path))
+
+		assert.Equal(t, http.StatusNotFound, headFile(t, h, "kept.txt").Code)
+		time.Sleep(50 * time.Millisecond)
+		_, err := store.GetMetadataByID(path)
+		assert.NoError(t, err)
+	})
+}
+
+func TestChunkedSessionsPerIPLimit(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.MaxChunkedSessionsPerIP = 3
+
+	initFrom := func(ip string) *httptest.ResponseRecorder {
+		form := url.Values{"filename": {"big.bin"}, "size": {"100"}, "chunk_size": {"10"}}
+		req := httptest.NewRequest(http.MethodPost, "/upload/init", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.InitiateChunkedUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	var uploadIDs []string
+	for i := 0; i < 3; i++ {
+		rec := initFrom("203.0.113.1")
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		uploadIDs = append(uploadIDs, resp["upload_id"].(string))
+	}
+
+	rec := initFrom("203.0.113.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Len(t, h.chunkedManager.uploads, 3, "the rejected session isn't kept")
+
+	assert.Equal(t, http.StatusOK, initFrom("203.0.113.2").Code, "other IPs have their own limit")
+
+	h.cleanupChunkedUpload(uploadIDs[0])
+	assert.Equal(t, http.StatusOK, initFrom("203.0.113.1").Code, "ending a session frees its slot")
+
+	h.chunkedManager.uploads[uploadIDs[1]].ExpiresAt = time.Now().Add(-time.Minute)
+	assert.Equal(t, http.StatusOK, initFrom("203.0.113.1").Code, "expired sessions don't count")
+}
+
+func TestListAndCancelUploadSessions(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.AdminPanelEnabled = true
+
+	initFrom := func(ip, filename string) string {
+		form := url.Values{"filename": {filename}, "size": {"100"}, "chunk_size": {"10"}}
+		req := httptest.NewRequest(http.MethodPost, "/upload/init", strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.InitiateChunkedUpload(echo.New().NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp["upload_id"].(string)
+	}
+	list := func(ip string, cookie *http.Cookie) []UploadSession {
+		req := httptest.NewRequest(http.MethodGet, "/upload/sessions", nil)
+		req.RemoteAddr = ip + ":1234"
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.ListUploadSessions(echo.New().NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var resp struct {
+			Sessions []UploadSession `json:"sessions"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp.Sessions
+	}
+
+	first := initFrom("203.0.113.1", "first.bin")
+	second := initFrom("203.0.113.1", "second.bin")
+	other := initFrom("203.0.113.2", "other.bin")
+	h.chunkedManager.uploads[first].UploadedChunks[0] = true
+	h.chunkedManager.uploads[first].CreatedAt = time.Now().Add(-time.Minute)
+
+	sessions := list("203.0.113.1", nil)
+	require.Len(t, sessions, 2, "clients only see their own sessions")
+	assert.Equal(t, first, sessions[0].UploadID, "oldest first")
+	assert.Equal(t, "first.bin", sessions[0].Filename)
+	assert.Equal(t, 1, sessions[0].UploadedChunks)
+	assert.Equal(t, 10, sessions[0].TotalChunks)
+	assert.Equal(t, 10, sessions[0].Progress)
+	assert.Empty(t, sessions[0].ClientIP)
+	assert.Equal(t, second, sessions[1].UploadID)
+
+	sessions = list("198.51.100.1", adminCookie(t, h))
+	require.Len(t, sessions, 3, "admins see every session")
+	assert.Equal(t, "203.0.113.2", sessions[2].ClientIP)
+
+	h.chunkedManager.uploads[other].ExpiresAt = time.Now().Add(-time.Minute)
+	assert.Empty(t, list("203.0.113.2", nil), "expired sessions aren't listed")
+
+	// Admins can abort any session without its upload token
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodDelete, "/upload/"+first, nil)
+	req.AddCookie(adminCookie(t, h))
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("upload_id")
+	c.SetParamValues(first)
+	require.NoError(t, h.AbortChunkedUpload(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	assert.NoDirExists(t, filepath.Join(tempDir, first), "the chunks are removed")
+	sessions = list("203.0.113.1", nil)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, second, sessions[0].UploadID)
+}
+
+func TestUploadContentTypeRestrictions(t *testing.T) {
+	tempDir, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.AllowedContentTypes = []string{"image/*"}
+
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	var photo bytes.Buffer
+	require.NoError(t, jpeg.Encode(&photo, img, nil))
+
+	upload := func(filename, partType string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+		header.Set("Content-Type", partType)
+		part, err := writer.CreatePart(header)
+		require.NoError(t, err)
+		part.Write(content)
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+	storedFiles := func() []string {
+		entries, err := os.ReadDir(tempDir)
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), "test.db") {
+				names = append(names, entry.Name())
+			}
+		}
+		return names
+	}
+
+	rec := upload("photo.jpg", "image/jpeg", photo.Bytes())
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.Len(t, storedFiles(), 1)
+	stored := storedFiles()[0]
+
+	rec = upload("notes.txt", "text/plain", []byte("just some text"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.Contains(t, rec.Body.String(), "text/plain")
+
+	rec = upload("spoofed.jpg", "image/jpeg", []byte("just some text"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code, "the client's content type isn't trusted")
+	assert.Equal(t, []string{stored}, storedFiles(), "rejected uploads aren't stored")
+
+	t.Run("URL downloads", func(t *testing.T) {
+		remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("not an image"))
+		}))
+		defer remote.Close()
+
+		e := echo.New()
+		form := "url=" + url.QueryEscape(remote.URL+"/image.png")
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		assert.Equal(t, []string{stored}, storedFiles())
+	})
+
+	t.Run("blocked types", func(t *testing.T) {
+		h.cfg.AllowedContentTypes = nil
+		h.cfg.BlockedContentTypes = []string{"image/*"}
+		assert.Equal(t, http.StatusUnsupportedMediaType, upload("photo.jpg", "image/jpeg", photo.Bytes()).Code)
+		assert.Equal(t, http.StatusOK, upload("notes.txt", "text/plain", []byte("just some text")).Code)
+	})
+}
+
+func TestAdminFilePagesKeepTokensOutOfURLs(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.AdminPanelEnabled = true
+
+	path := createTestFile(t, tempDir, store, "report.txt", "content", false)
+	short := model.FileMetadata{
+		ResourcePath:   "link",
+		Token:          "short-token",
+		OriginalURL:    "https://example.com",
+		IsURLShortener: true,
+		UploadDate:     time.Now(),
+	}
+	require.NoError(t, store.StoreMetadata(&short))
+
+	cookie := adminCookie(t, h)
+	serve := func(method, target string, form url.Values, handler echo.HandlerFunc, filename string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues(filename)
+		require.NoError(t, handler(c))
+		return rec
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleAdminDashboard(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "token=", "dashboard links carry no tokens")
+
+	rec = serve(http.MethodGet, "/admin/file/report.txt", nil, h.HandleAdminFileView, "report.txt")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.NotContains(t, rec.Body.String(), "token=")
+
+	rec = serve(http.MethodGet, "/admin/file/link", nil, h.HandleAdminFileView, "link")
+	assert.Equal(t, http.StatusOK, rec.Code, "URL shorteners are found by their id")
+
+	rec = serve(http.MethodGet, "/admin/file/missing.txt", nil, h.HandleAdminFileView, "missing.txt")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(http.MethodPost, "/admin/file/report.txt", url.Values{"original_name": {"renamed.txt"}}, h.HandleAdminFileUpdate, "report.txt")
+	require.Equal(t, http.StatusSeeOther, rec.Code, rec.Body.String())
+	assert.Equal(t, "/admin/file/report.txt", rec.Header().Get("Location"))
+	meta, err := store.GetMetadataByID(path)
+	require.NoError(t, err)
+	assert.Equal(t, "renamed.txt", meta.OriginalName)
+
+	rec = serve(http.MethodPost, "/admin/file/report.txt/delete?sort=size", nil, h.HandleAdminFileDelete, "report.txt")
+	require.Equal(t, http.StatusSeeOther, rec.Code, rec.Body.String())
+	assert.Equal(t, "/admin?sort=size", rec.Header().Get("Location"))
+	_, err = store.GetMetadataByID(path)
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUploadSendsWebhook(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	type delivery struct {
+		body      []byte
+		signature string
+	}
+	deliveries := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{body: body, signature: r.Header.Get(webhook.SignatureHeader)}
+	}))
+	defer receiver.Close()
+
+	h.cfg.WebhookURL = receiver.URL
+	h.cfg.WebhookEvents = []string{config.WebhookEventUpload}
+	h.cfg.WebhookSecret = "webhook-secret"
+	notifier := webhook.NewNotifier(h.cfg)
+	defer notifier.Stop()
+	h.SetWebhooks(notifier)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "hooked.txt")
+	require.NoError(t, err)
+	part.Write([]byte("notify me"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var d delivery
+	select {
+	case d = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload webhook was not delivered")
+	}
+	assert.NoError(t, webhook.Verify([]byte("webhook-secret"), d.body, d.signature, time.Now()))
+
+	var event webhook.Event
+	require.NoError(t, json.Unmarshal(d.body, &event))
+	assert.Equal(t, webhook.EventUpload, event.Type)
+	assert.True(t, strings.HasSuffix(event.FileID, ".txt"), event.FileID)
+	assert.Contains(t, rec.Body.String(), event.FileID)
+	assert.Equal(t, int64(len("notify me")), event.Size)
+	assert.Contains(t, event.ContentType, "text/plain")
+}
+
+func TestMonthlyTransferCap(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := strings.Repeat("x", 60)
+	filePath := createTestFile(t, tempDir, db, "metered.txt", content, false)
+	h.cfg.MonthlyTransferCap = 150.0 / (1 << 30)
+
+	download := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metered.txt", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("filename")
+		c.SetParamValues("metered.txt")
+		require.NoError(t, h.HandleFileAccess(c))
+		return rec
+	}
+
+	// 60 + 60 + 40 bytes cross the 150 byte cap with the range
+	require.Equal(t, http.StatusOK, download("").Code)
+	require.Equal(t, http.StatusOK, download("").Code)
+	require.Equal(t, http.StatusPartialContent, download("bytes=0-39").Code)
+
+	rec := download("")
+	assert.Equal(t, statusBandwidthLimitExceeded, rec.Code)
+	retryAfter, err := http.ParseTime(rec.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, retryAfter.Day(), "the cap resets with the month")
+	assert.True(t, retryAfter.After(time.Now()))
+
+	meta, err := db.GetMetadataByID(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(160), meta.BytesServed)
+
+	// A restarted server reads the month's usage back
+	h.transfer = transferMeter{}
+	statsRec := httptest.NewRecorder()
+	require.NoError(t, h.HandleUploadStats(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/stats", nil), statsRec)))
+	var stats map[string]interface{}
+	require.NoError(t, json.Unmarshal(statsRec.Body.Bytes(), &stats))
+	assert.Equal(t, float64(160), stats["transfer_bytes_served"])
+	assert.Equal(t, float64(150), stats["transfer_cap_bytes"])
+	assert.Equal(t, time.Now().UTC().Format("2006-01"), stats["transfer_period"])
+	assert.Equal(t, statusBandwidthLimitExceeded, download("").Code)
+
+	// Without a cap downloads go on and are still counted
+	h.cfg.MonthlyTransferCap = 0
+	assert.Equal(t, http.StatusOK, download("").Code)
+	_, served := h.transferUsage(time.Now())
+	assert.Equal(t, int64(220), served)
+}
+
+func TestMonthlyTransferCapCoversFolderFiles(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.FolderUploadsEnabled = true
+
+	rec := uploadFolder(t, h, map[string]string{"site/data.txt": strings.Repeat("x", 60)}, "application/json")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	id := strings.TrimPrefix(resp["url"].(string), h.cfg.BaseURL)
+
+	h.cfg.MonthlyTransferCap = 100.0 / (1 << 30)
+	require.Equal(t, http.StatusOK, getFolderPath(t, h, id, "site/data.txt", "").Code)
+	require.Equal(t, http.StatusOK, getFolderPath(t, h, id, "site/data.txt", "").Code)
+	assert.Equal(t, statusBandwidthLimitExceeded, getFolderPath(t, h, id, "site/data.txt", "").Code)
+
+	meta, err := store.GetMetadataByID(filepath.Join(tempDir, id))
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), meta.BytesServed)
+}
+
+func TestUploadStats(t *testing.T) {
+	tempDir, h, db, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	createTestFile(t, tempDir, db, "a.txt", "hello", false)
+	for _, meta := range []model.FileMetadata{
+		{ResourcePath: filepath.Join(tempDir, "b.png"), Token: "b", Size: 100, ContentType: "image/png"},
+		{ResourcePath: filepath.Join(tempDir, "c.jpg"), Token: "c", Size: 50, ContentType: "image/jpeg"},
+		{ResourcePath: filepath.Join(tempDir, "d.bin"), Token: "d", Size: 7},
+		{ResourcePath: "short", Token: "e", OriginalURL: "https://example.com", IsURLShortener: true},
+	} {
+		require.NoError(t, db.StoreMetadata(&meta))
+	}
+
+	rec := httptest.NewRecorder()
+	require.NoError(t, h.HandleUploadStats(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/stats", nil), rec)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var stats struct {
+		TotalFiles int                  `json:"total_files"`
+		TotalSize  int64                `json:"total_size"`
+		Types      map[string]TypeStats `json:"types"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	assert.Equal(t, 4, stats.TotalFiles, "shortened URLs aren't files")
+	assert.Equal(t, int64(162), stats.TotalSize)
+	assert.Equal(t, map[string]TypeStats{
+		"image":   {Files: 2, Size: 150},
+		"text":    {Files: 1, Size: 5},
+		"unknown": {Files: 1, Size: 7},
+	}, stats.Types)
+}
+
+func TestChunkedUploadSessionNeedsUploadToken(t *testing.T) {
+	_, h, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	content := "hello world"
+	sum := md5.Sum([]byte(content))
+	fields := map[string]string{
+		"filename":     "greeting.txt",
+		"size":         fmt.Sprintf("%d", len(content)),
+		"chunk_size":   "6",
+		"content_hash": hex.EncodeToString(sum[:]),
+	}
+
+	owner := initChunkedUpload(t, h, fields)
+	uploadID := owner["upload_id"].(string)
+	require.Equal(t, http.StatusOK, uploadTestChunk(t, h, uploadID, 0, content[:6]).Code)
+
+	// Knowing the content hash isn't enough to take over the session
+	other := initChunkedUpload(t, h, fields)
+	assert.NotEqual(t, uploadID, other["upload_id"], "a new session is started")
+	assert.NotEqual(t, owner["upload_token"], other["upload_token"])
+	assert.Equal(t, []interface{}{}, other["uploaded_chunks"])
+
+	fields["upload_token"] = "wrong"
+	assert.NotEqual(t, uploadID, initChunkedUpload(t, h, fields)["upload_id"])
+
+	assert.Equal(t, http.StatusForbidden, uploadTestChunkWithToken(t, h, uploadID, 1, "forged", "").Code)
+	assert.Equal(t, http.StatusForbidden, uploadTestChunkWithToken(t, h, uploadID, 1, "forged", other["upload_token"].(string)).Code)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/upload/"+uploadID, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("upload_id")
+	c.SetParamValues(uploadID)
+	require.NoError(t, h.GetUploadStatus(c))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req = httptest.NewRequest(http.MethodDelete, "/upload/"+uploadID, nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("upload_id")
+	c.SetParamValues(uploadID)
+	require.NoError(t, h.AbortChunkedUpload(c))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = uploadTestChunk(t, h, uploadID, 1, content[6:])
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), "Upload completed")
+}
+
+func TestChunkedUploadDedupSkipsPrivateFiles(t *testing.T) {
+	tempDir, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		modify func(*model.FileMetadata)
+	}{
+		{"secret id", func(m *model.FileMetadata) { m.PublicID = false }},
+		{"password", func(m *model.FileMetadata) { m.PasswordHash = "$2a$10$hash" }},
+		{"download limit", func(m *model.FileMetadata) { m.MaxDownloads = 3 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "private " + tt.name
+			sum := md5.Sum([]byte(content))
+			hash := hex.EncodeToString(sum[:])
+
+			path := filepath.Join(tempDir, strings.ReplaceAll(tt.name, " ", "-")+".txt")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+			meta := model.FileMetadata{
+				ResourcePath: path,
+				Token:        "token",
+				UploadDate:   time.Now(),
+				Size:         int64(len(content)),
+				ContentHash:  hash,
+				PublicID:     true,
+			}
+			tt.modify(&meta)
+			require.NoError(t, store.StoreMetadata(&meta))
+
+			response := initChunkedUpload(t, h, map[string]string{
+				"filename":     "copy.txt",
+				"size":         fmt.Sprintf("%d", len(content)),
+				"chunk_size":   "4",
+				"content_hash": hash,
+			})
+			assert.Nil(t, response["already_exists"])
+			assert.NotEmpty(t, response["upload_id"])
+		})
+	}
+}
+
+func TestChunkedUploadUsesTierLimits(t *testing.T) {
+	_, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	h.cfg.MaxSize = 0.001 // about 1KB for anonymous uploads
+	h.cfg.UploadTiers = map[string]config.UploadTier{
+		"pro": {MaxSize: 1, MaxAge: 90, MaxDownloads: 5},
+	}
+	h.cfg.APIKeys = []config.APIKey{{Key: "pro-key", Tier: "pro"}}
+
+	initUpload := func(apiKey string, size int) *httptest.ResponseRecorder {
+		form := fmt.Sprintf("filename=big.bin&size=%d&chunk_size=%d", size, size)
+		req := httptest.NewRequest(http.MethodPost, "/upload/init", strings.NewReader(form))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.InitiateChunkedUpload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	size := 4 * 1024
+	assert.Equal(t, http.StatusBadRequest, initUpload("", size).Code, "anonymous uploads are capped at the global max size")
+	assert.Equal(t, http.StatusUnauthorized, initUpload("wrong-key", size).Code)
+
+	rec := initUpload("pro-key", size)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var init map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &init))
+	uploadID := init["upload_id"].(string)
+
+	rec = uploadTestChunk(t, h, uploadID, 0, strings.Repeat("a", size))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var complete map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &complete))
+	expiresAt, err := time.Parse(time.RFC3339, complete["expires_at"].(string))
+	require.NoError(t, err)
+	assert.True(t, expiresAt.After(time.Now().Add(time.Duration(h.cfg.MaxAge)*24*time.Hour)),
+		"pro uploads use the tier's max age")
+
+	meta, err := store.GetMetadataByID(filepath.Join(h.cfg.UploadPath, uploadID+".bin"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, meta.MaxDownloads, "the tier caps downloads")
+}
+
+func TestChunkedUploadEnforcesDeclaredSize(t *testing.T) {
+	_, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	h.cfg.ChunkSize = 0.001 // 1048 bytes
+
+	init := initChunkedUpload(t, h, map[string]string{"filename": "tiny.txt", "size": "1", "chunk_size": "10485760"})
+	assert.Equal(t, float64(1048), init["chunk_size"], "chunk_size can't exceed chunk_size_mib")
+	uploadID := init["upload_id"].(string)
+
+	rec := uploadTestChunk(t, h, uploadID, 0, strings.Repeat("a", 2000))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, "chunks can't be longer than the declared size")
+	_, err := os.Stat(filepath.Join(h.cfg.UploadPath, uploadID, "chunk_0"))
+	assert.True(t, os.IsNotExist(err))
+
+	rec = uploadTestChunk(t, h, uploadID, 0, "a")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	meta, err := store.GetMetadataByID(filepath.Join(h.cfg.UploadPath, uploadID+".txt"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), meta.Size)
+
+	// Short chunks only show once the file is assembled
+	init = initChunkedUpload(t, h, map[string]string{"filename": "short.txt", "size": "10"})
+	uploadID = init["upload_id"].(string)
+	rec = uploadTestChunk(t, h, uploadID, 0, "abc")
+	assert.Equal(t, http.StatusBadRequest, rec.Code, rec.Body.String())
+	assert.Empty(t, sessionToken(h, uploadID), "the session is discarded")
+	_, err = store.GetMetadataByID(filepath.Join(h.cfg.UploadPath, uploadID+".txt"))
+	assert.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func TestUploadTierCapsMaxDownloads(t *testing.T) {
+	_, h, store, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	h.cfg.UploadTiers = map[string]config.UploadTier{
+		config.AnonymousTier: {MaxDownloads: 3},
+	}
+
+	for _, tt := range []struct {
+		requested string
+		expected  int
+	}{
+		{"", 3},
+		{"2", 2},
+		{"10", 3},
+	} {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "data.txt")
+		require.NoError(t, err)
+		part.Write([]byte("limited " + tt.requested))
+		if tt.requested != "" {
+			writer.WriteField("max_downloads", tt.requested)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		require.NoError(t, h.HandleUpload(echo.New().NewContext(req, rec)))
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+		fileURL := strings.TrimSpace(rec.Body.String())
+		meta, err := store.GetMetadataByID(filepath.Join(h.cfg.UploadPath, path.Base(fileURL)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, meta.MaxDownloads, "max_downloads=%q", tt.requested)
+	}
+}
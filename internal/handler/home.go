@@ -38,3 +38,18 @@ func (h *Handler) HandleChunkedUpload(c echo.Context) error {
 
 	return nil
 }
+
+// defaultRobotsTxt keeps crawlers away from uploaded files
+const defaultRobotsTxt = "User-agent: *\nDisallow: /\n"
+
+// HandleRobots serves robots.txt, using the configured content when set
+func (h *Handler) HandleRobots(c echo.Context) error {
+	robots := h.cfg.RobotsTxt
+	if robots == "" {
+		robots = defaultRobotsTxt
+		if h.cfg.AllowIndexing {
+			robots = "User-agent: *\nDisallow:\n"
+		}
+	}
+	return c.String(http.StatusOK, robots)
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marianozunino/drop/internal/config"
+)
+
+// IDGenerator creates the public ids of uploads and short links
+type IDGenerator interface {
+	NewID(length int) (string, error)
+}
+
+// newIDGenerator returns the generator for the configured id_strategy
+func newIDGenerator(strategy string) IDGenerator {
+	switch strings.ToLower(strategy) {
+	case config.IDStrategyBase62:
+		return base62IDGenerator{}
+	case config.IDStrategyULID:
+		return &ulidIDGenerator{now: time.Now}
+	default:
+		return hexIDGenerator{}
+	}
+}
+
+// reservedIDs are top-level routes an extension-less id or a slug must never
+// shadow
+var reservedIDs = map[string]bool{
+	"admin":       true,
+	"api":         true,
+	"binaries":    true,
+	"chunked":     true,
+	"download":    true,
+	"favicon.ico": true,
+	"health":      true,
+	"robots.txt":  true,
+	"stats":       true,
+	"upload":      true,
+	"version":     true,
+}
+
+func isReservedID(id string) bool {
+	return reservedIDs[strings.ToLower(id)]
+}
+
+// hexIDGenerator creates random lowercase hex ids
+type hexIDGenerator struct{}
+
+func (hexIDGenerator) NewID(length int) (string, error) {
+	return generateID(length)
+}
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// base62IDGenerator creates random ids from digits and both letter cases, which
+// fit more combinations into short ids than hex
+type base62IDGenerator struct{}
+
+func (base62IDGenerator) NewID(length int) (string, error) {
+	max := big.NewInt(int64(len(base62Alphabet)))
+	id := make([]byte, length)
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random bytes: %w", err)
+		}
+		id[i] = base62Alphabet[n.Int64()]
+	}
+	return string(id), nil
+}
+
+// ulidAlphabet is Crockford's base32 in lowercase, which sorts in the same
+// order as the values it encodes
+const ulidAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// ulidLength is the length of every ULID, whatever id_length is set to
+const ulidLength = 26
+
+// ulidIDGenerator creates ULIDs: a millisecond timestamp followed by 80 random
+// bits. Ids sort in creation order, including ids created in the same
+// millisecond, whose random part is incremented instead of redrawn.
+type ulidIDGenerator struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	lastTime uint64
+	lastRand [10]byte
+}
+
+var errULIDOverflow = errors.New("too many ids in one millisecond")
+
+func (g *ulidIDGenerator) NewID(int) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(g.now().UnixMilli())
+	if ms <= g.lastTime {
+		// Same millisecond, or the clock went back: keep counting from the last id
+		if !incrementBytes(g.lastRand[:]) {
+			return "", errULIDOverflow
+		}
+	} else {
+		if _, err := rand.Read(g.lastRand[:]); err != nil {
+			return "", fmt.Errorf("failed to generate random bytes: %w", err)
+		}
+		g.lastTime = ms
+	}
+
+	var raw [16]byte
+	binary.BigEndian.PutUint64(raw[:8], g.lastTime<<16)
+	copy(raw[6:], g.lastRand[:])
+	return encodeULID(raw), nil
+}
+
+// incrementBytes adds one to a big-endian number, reporting false on overflow
+func incrementBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID writes the 128 bits as 26 base32 characters, most significant first
+func encodeULID(raw [16]byte) string {
+	hi := binary.BigEndian.Uint64(raw[:8])
+	lo := binary.BigEndian.Uint64(raw[8:])
+
+	var out [ulidLength]byte
+	for i := ulidLength - 1; i >= 0; i-- {
+		out[i] = ulidAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
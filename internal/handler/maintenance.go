@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MaintenanceRetryAfterSeconds is the Retry-After hint sent while uploads are disabled
+const MaintenanceRetryAfterSeconds = 300
+
+const maintenanceMessage = "Server is in maintenance mode. Uploads are temporarily disabled, existing files remain available."
+
+// MaintenanceMode reports whether new uploads are currently refused
+func (h *Handler) MaintenanceMode() bool {
+	return h.maintenance.Load()
+}
+
+// SetMaintenanceMode enables or disables maintenance mode at runtime
+func (h *Handler) SetMaintenanceMode(enabled bool) {
+	h.maintenance.Store(enabled)
+}
+
+// maintenanceResponse refuses a write request while in maintenance mode
+func (h *Handler) maintenanceResponse(c echo.Context, asJSON bool) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(MaintenanceRetryAfterSeconds))
+	if asJSON {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": maintenanceMessage})
+	}
+	return c.String(http.StatusServiceUnavailable, maintenanceMessage)
+}
+
+// HandleAdminMaintenance toggles maintenance mode from the admin panel
+func (h *Handler) HandleAdminMaintenance(c echo.Context) error {
+	if !h.isAdminAuthenticated(c) {
+		return c.String(http.StatusUnauthorized, "Unauthorized")
+	}
+
+	enabled, err := strconv.ParseBool(c.FormValue("enabled"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid value for enabled, use true or false")
+	}
+
+	h.SetMaintenanceMode(enabled)
+	log.Printf("Maintenance mode set to %t by %s", enabled, c.RealIP())
+
+	return c.Redirect(http.StatusSeeOther, h.appPath("/admin"))
+}
+
+// HandleVersion reports the server version, so clients can tell which release
+// they are talking to
+func (h *Handler) HandleVersion(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"version": Version})
+}
+
+// HandleHealth reports that the server is up and whether it accepts uploads
+func (h *Handler) HandleHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status":           "ok",
+		"maintenance_mode": h.MaintenanceMode(),
+	})
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// notFoundResponse answers a request for a missing file. Image embeds get a
+// placeholder image instead of a text body, so pages show it rather than a
+// broken image icon.
+func (h *Handler) notFoundResponse(c echo.Context) error {
+	return h.missingFileResponse(c, http.StatusNotFound, "File not found")
+}
+
+// goneResponse answers a request for an expired file like notFoundResponse,
+// but with 410 Gone
+func (h *Handler) goneResponse(c echo.Context) error {
+	return h.missingFileResponse(c, http.StatusGone, "File has expired")
+}
+
+func (h *Handler) missingFileResponse(c echo.Context, status int, message string) error {
+	addVary(c, "Accept")
+	if !wantsImage(c.Request()) {
+		return c.String(status, message)
+	}
+
+	data := h.notFoundImage()
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Blob(status, http.DetectContentType(data), data)
+}
+
+// wantsImage reports whether the request comes from an image embed. Browsers
+// also list image types when navigating to a page, so requests accepting HTML
+// are not treated as embeds.
+func wantsImage(req *http.Request) bool {
+	accept := strings.ToLower(req.Header.Get("Accept"))
+	return strings.Contains(accept, "image/") && !strings.Contains(accept, "text/html")
+}
+
+// notFoundImage returns the configured placeholder, falling back to the
+// generated one when it is unset or unreadable
+func (h *Handler) notFoundImage() []byte {
+	if path := h.cfg.NotFoundImagePath; path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return data
+		}
+		log.Printf("Warning: Failed to read not found image %s: %v", path, err)
+	}
+	return generatedNotFoundImage()
+}
+
+// generatedNotFoundImage is a plain grey card with a crossed-out frame
+var generatedNotFoundImage = sync.OnceValue(func() []byte {
+	const width, height = 320, 180
+	background := color.RGBA{0xee, 0xee, 0xee, 0xff}
+	stroke := color.RGBA{0xbb, 0xbb, 0xbb, 0xff}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, background)
+		}
+	}
+
+	// Frame and diagonals of a centered square
+	const size, thickness = 80, 3
+	left, top := (width-size)/2, (height-size)/2
+	for i := 0; i < size; i++ {
+		for t := 0; t < thickness; t++ {
+			img.Set(left+i, top+t, stroke)
+			img.Set(left+i, top+size-1-t, stroke)
+			img.Set(left+t, top+i, stroke)
+			img.Set(left+size-1-t, top+i, stroke)
+			img.Set(left+i, top+min(i+t, size-1), stroke)
+			img.Set(left+i, top+max(size-1-i-t, 0), stroke)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		log.Printf("Error: Failed to encode not found image: %v", err)
+	}
+	return buf.Bytes()
+})
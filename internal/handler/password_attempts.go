@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// passwordAttempts counts wrong download passwords per file and client IP. A
+// client reaching the limit is locked out of that file for the window, which
+// keeps weak passwords from being guessed. Counts are kept in memory only.
+type passwordAttempts struct {
+	maxAttempts int
+	window      time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*attemptEntry
+	lastPrune time.Time
+}
+
+type attemptEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func newPasswordAttempts(maxAttempts int, window time.Duration) *passwordAttempts {
+	return &passwordAttempts{
+		maxAttempts: maxAttempts,
+		window:      window,
+		now:         time.Now,
+		entries:     make(map[string]*attemptEntry),
+	}
+}
+
+func attemptKey(id, ip string) string {
+	return id + "|" + ip
+}
+
+// lockedFor returns how long the client stays locked out of the file, zero
+// when it may try a password
+func (p *passwordAttempts) lockedFor(id, ip string) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.entries[attemptKey(id, ip)]
+	if !ok {
+		return 0
+	}
+	return max(entry.lockedUntil.Sub(p.now()), 0)
+}
+
+// fail records a wrong password and reports whether it locked the client out.
+// Failures older than the window are forgotten.
+func (p *passwordAttempts) fail(id, ip string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	p.prune(now)
+
+	key := attemptKey(id, ip)
+	entry, ok := p.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > p.window {
+		entry = &attemptEntry{}
+		p.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+
+	if entry.failures < p.maxAttempts {
+		return false
+	}
+	entry.failures = 0
+	entry.lockedUntil = now.Add(p.window)
+	return true
+}
+
+// succeed clears the failures of a client that sent the right password
+func (p *passwordAttempts) succeed(id, ip string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.entries, attemptKey(id, ip))
+}
+
+// prune drops entries whose failures and lockout are over, at most once per window
+func (p *passwordAttempts) prune(now time.Time) {
+	if now.Sub(p.lastPrune) < p.window {
+		return
+	}
+	p.lastPrune = now
+	for key, entry := range p.entries {
+		if now.Sub(entry.lastFailure) > p.window && !now.Before(entry.lockedUntil) {
+			delete(p.entries, key)
+		}
+	}
+}
+
+// passwordLockoutResponse answers a client locked out of a file with 429 and
+// the seconds left in Retry-After
+func passwordLockoutResponse(c echo.Context, wait time.Duration) error {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+	return c.String(http.StatusTooManyRequests, "Too many wrong passwords, try again later")
+}
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PoWHeader carries a solved proof-of-work challenge as "challenge:nonce". The
+// pow form field is accepted too, for uploads from browsers.
+const PoWHeader = "X-PoW"
+
+// powChallengeTTL is how long a challenge can be solved and used
+const powChallengeTTL = 5 * time.Minute
+
+var (
+	errPoWRequired = errors.New("proof of work required, solve a challenge from /api/pow")
+	errPoWInvalid  = errors.New("invalid proof of work")
+	errPoWExpired  = errors.New("proof of work challenge expired")
+	errPoWReused   = errors.New("proof of work challenge already used")
+)
+
+// powIssuer hands out signed challenges and accepts each solution once.
+// Challenges are "<expiry>.<random>.<signature>" so nothing is stored until
+// one is used; the signing key is random per process, so a restart invalidates
+// the challenges handed out before it.
+type powIssuer struct {
+	key        []byte
+	difficulty int
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func newPoWIssuer(difficulty int) *powIssuer {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &powIssuer{key: key, difficulty: difficulty, used: make(map[string]time.Time)}
+}
+
+func (p *powIssuer) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// issue returns a new challenge and the time it expires
+func (p *powIssuer) issue(now time.Time) (string, time.Time, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", time.Time{}, err
+	}
+	expires := now.Add(powChallengeTTL)
+	payload := strconv.FormatInt(expires.Unix(), 10) + "." + hex.EncodeToString(random)
+	return payload + "." + p.sign(payload), expires, nil
+}
+
+// verify checks a "challenge:nonce" solution: the challenge must be one of
+// ours, unexpired and unused, and SHA-256("challenge:nonce") must start with
+// difficulty zero bits
+func (p *powIssuer) verify(solution string, now time.Time) error {
+	challenge, nonce, ok := strings.Cut(strings.TrimSpace(solution), ":")
+	if !ok || nonce == "" {
+		return errPoWInvalid
+	}
+
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 3 || !hmac.Equal([]byte(parts[2]), []byte(p.sign(parts[0]+"."+parts[1]))) {
+		return errPoWInvalid
+	}
+	expiresUnix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return errPoWInvalid
+	}
+	expires := time.Unix(expiresUnix, 0)
+	if now.After(expires) {
+		return errPoWExpired
+	}
+
+	sum := sha256.Sum256([]byte(challenge + ":" + nonce))
+	if leadingZeroBits(sum[:]) < p.difficulty {
+		return errPoWInvalid
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for used, expiry := range p.used {
+		if now.After(expiry) {
+			delete(p.used, used)
+		}
+	}
+	if _, ok := p.used[challenge]; ok {
+		return errPoWReused
+	}
+	p.used[challenge] = expires
+	return nil
+}
+
+// leadingZeroBits counts the zero bits before the first set bit
+func leadingZeroBits(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		n += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// PoWChallengeResponse is returned by GET /api/pow
+type PoWChallengeResponse struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// HandlePoWChallenge issues a proof-of-work challenge for an anonymous upload
+func (h *Handler) HandlePoWChallenge(c echo.Context) error {
+	if h.pow == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Proof of work is not enabled"})
+	}
+
+	challenge, expires, err := h.pow.issue(time.Now())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to issue challenge"})
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.JSON(http.StatusOK, PoWChallengeResponse{
+		Challenge:  challenge,
+		Difficulty: h.pow.difficulty,
+		ExpiresAt:  expires.UTC(),
+	})
+}
+
+// checkProofOfWork requires a solved challenge from anonymous uploads when
+// pow_difficulty is set. Requests with a valid API key skip it.
+func (h *Handler) checkProofOfWork(c echo.Context) error {
+	if h.pow == nil {
+		return nil
+	}
+	if key := c.Request().Header.Get(APIKeyHeader); key != "" {
+		if _, ok := h.cfg.TierForAPIKey(key); ok {
+			return nil
+		}
+	}
+
+	solution := c.Request().Header.Get(PoWHeader)
+	if solution == "" {
+		solution = c.FormValue("pow")
+	}
+	if solution == "" {
+		return errPoWRequired
+	}
+	return h.pow.verify(solution, time.Now())
+}
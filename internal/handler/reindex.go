@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/model"
+	"github.com/marianozunino/drop/internal/utils"
+)
+
+// reindexWorkers bounds how many files are hashed concurrently during a reindex
+const reindexWorkers = 4
+
+// reindexMinAge skips files modified this recently, as they may belong to an upload
+// whose metadata has not been written yet
+const reindexMinAge = time.Minute
+
+// ReindexResult reports what a reindex run did
+type ReindexResult struct {
+	Scanned  int `json:"scanned"`
+	Repaired int `json:"repaired"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// HandleAdminReindex recreates missing metadata for files found in the upload directory
+func (h *Handler) HandleAdminReindex(c echo.Context) error {
+	if !h.isAdminAuthenticated(c) {
+		return c.String(http.StatusUnauthorized, "Unauthorized")
+	}
+
+	if !h.reindexMu.TryLock() {
+		return c.String(http.StatusConflict, "A reindex is already running")
+	}
+	defer h.reindexMu.Unlock()
+
+	result, err := h.reindexUploads()
+	if err != nil {
+		log.Printf("Error: Reindex failed: %v", err)
+		return c.String(http.StatusInternalServerError, "Failed to reindex uploads")
+	}
+
+	log.Printf("Reindex by %s: scanned %d, repaired %d, skipped %d, failed %d",
+		c.RealIP(), result.Scanned, result.Repaired, result.Skipped, result.Failed)
+	return c.JSON(http.StatusOK, result)
+}
+
+// reindexUploads scans the upload directory and stores metadata for files that have none.
+// Files that already have metadata are left untouched, so running it again is a no-op.
+func (h *Handler) reindexUploads() (ReindexResult, error) {
+	var result ReindexResult
+
+	entries, err := os.ReadDir(h.cfg.UploadPath)
+	if err != nil {
+		return result, err
+	}
+
+	var mu sync.Mutex
+	record := func(outcome *int) {
+		mu.Lock()
+		*outcome++
+		mu.Unlock()
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < reindexWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for filePath := range jobs {
+				repaired, err := h.reindexFile(filePath)
+				switch {
+				case err != nil:
+					log.Printf("Warning: Failed to reindex %s: %v", filePath, err)
+					record(&result.Failed)
+				case repaired:
+					record(&result.Repaired)
+				default:
+					record(&result.Skipped)
+				}
+			}
+		}()
+	}
+
+	for _, entry := range entries {
+		// Chunked upload sessions live in directories, assembly happens in .tmp files
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+		filePath := filepath.Join(h.cfg.UploadPath, entry.Name())
+		if h.isDatabaseFile(filePath) {
+			continue
+		}
+		result.Scanned++
+		jobs <- filePath
+	}
+	close(jobs)
+	wg.Wait()
+
+	return result, nil
+}
+
+// isDatabaseFile reports whether the path is the SQLite database or one of its WAL/journal files
+func (h *Handler) isDatabaseFile(filePath string) bool {
+	if h.cfg.SQLitePath == "" {
+		return false
+	}
+	dbPath := filepath.Clean(h.cfg.SQLitePath)
+	return filePath == dbPath || strings.HasPrefix(filePath, dbPath+"-")
+}
+
+// reindexFile stores metadata for a single file if it is missing
+func (h *Handler) reindexFile(filePath string) (bool, error) {
+	exists, err := h.db.HasMetadata(filePath)
+	if err != nil || exists {
+		return false, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() || time.Since(info.ModTime()) < reindexMinAge {
+		return false, nil
+	}
+
+	contentHash, err := utils.CalculateMD5(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	token, err := generateID(16)
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	meta := model.FileMetadata{
+		ResourcePath: filePath,
+		Token:        token,
+		OriginalName: filepath.Base(filePath),
+		UploadDate:   info.ModTime(),
+		Size:         info.Size(),
+		ContentType:  h.detectContentType(filePath),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		ContentHash:  contentHash,
+	}
+
+	if err := h.db.StoreMetadata(&meta); err != nil {
+		return false, err
+	}
+
+	log.Printf("Reindexed %s (%s, %d bytes)", filePath, meta.ContentType, meta.Size)
+	return true, nil
+}
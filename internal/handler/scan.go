@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/model"
+)
+
+// Scan statuses reported in upload responses and by the scan status endpoint
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanError    = "error"
+)
+
+var (
+	errFileInfected = errors.New("file is infected")
+	errScanFailed   = errors.New("virus scan failed")
+)
+
+// ScanVerdict is the outcome of scanning one file
+type ScanVerdict struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner checks stored uploads for malware
+type Scanner interface {
+	Scan(path string) (ScanVerdict, error)
+}
+
+// clamdScanner streams files to a clamd daemon with the INSTREAM command
+type clamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// newClamdScanner parses a clamd address: "unix:/path/to/clamd.sock",
+// "tcp://host:port" or a plain "host:port"
+func newClamdScanner(address string) *clamdScanner {
+	s := &clamdScanner{network: "tcp", address: address, timeout: 5 * time.Minute}
+	switch {
+	case strings.HasPrefix(address, "unix:"):
+		s.network, s.address = "unix", strings.TrimPrefix(strings.TrimPrefix(address, "unix:"), "//")
+	case strings.HasPrefix(address, "tcp://"):
+		s.address = strings.TrimPrefix(address, "tcp://")
+	}
+	return s
+}
+
+func (s *clamdScanner) Scan(path string) (ScanVerdict, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ScanVerdict{}, err
+	}
+	defer file.Close()
+
+	conn, err := net.DialTimeout(s.network, s.address, 10*time.Second)
+	if err != nil {
+		return ScanVerdict{}, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return ScanVerdict{}, err
+	}
+
+	// The stream is sent as chunks prefixed with their big-endian length and
+	// ended by a zero-length chunk
+	buf := make([]byte, 4+64*1024)
+	for {
+		n, readErr := file.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return ScanVerdict{}, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return ScanVerdict{}, readErr
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return ScanVerdict{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return ScanVerdict{}, err
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply reads "stream: OK" or "stream: <signature> FOUND"
+func parseClamdReply(reply string) (ScanVerdict, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return ScanVerdict{}, nil
+	case strings.HasSuffix(result, " FOUND"):
+		return ScanVerdict{Infected: true, Signature: strings.TrimSuffix(result, " FOUND")}, nil
+	default:
+		return ScanVerdict{}, fmt.Errorf("unexpected clamd reply: %q", reply)
+	}
+}
+
+// scanStateTTL is how long finished scan results stay available for polling
+const scanStateTTL = time.Hour
+
+// scanState is the scan result of one upload
+type scanState struct {
+	Status    string
+	Signature string
+	updated   time.Time
+}
+
+// scanTracker keeps scan results in memory, keyed by stored filename
+type scanTracker struct {
+	mu     sync.Mutex
+	states map[string]scanState
+}
+
+func newScanTracker() *scanTracker {
+	return &scanTracker{states: make(map[string]scanState)}
+}
+
+func (t *scanTracker) set(id string, state scanState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for key, existing := range t.states {
+		if existing.Status != ScanPending && now.Sub(existing.updated) > scanStateTTL {
+			delete(t.states, key)
+		}
+	}
+	state.updated = now
+	t.states[id] = state
+}
+
+func (t *scanTracker) get(id string) (scanState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.states[id]
+	return state, ok
+}
+
+// scanUpload scans a stored upload and deletes it when it is infected or
+// can't be scanned. With scan_async the scan runs in the background and
+// ScanPending is returned right away. An empty status means scanning is off.
+func (h *Handler) scanUpload(path string) (string, error) {
+	if h.scanner == nil {
+		return "", nil
+	}
+
+	if h.cfg.ScanAsync {
+		h.scans.set(filepath.Base(path), scanState{Status: ScanPending})
+		go h.runScan(path)
+		return ScanPending, nil
+	}
+
+	state := h.runScan(path)
+	switch state.Status {
+	case ScanInfected:
+		return state.Status, fmt.Errorf("%w with %s", errFileInfected, state.Signature)
+	case ScanError:
+		return state.Status, errScanFailed
+	}
+	return state.Status, nil
+}
+
+// runScan scans the file, removes it unless it is clean and records the result
+func (h *Handler) runScan(path string) scanState {
+	state := scanState{Status: ScanClean}
+
+	verdict, err := h.scanner.Scan(path)
+	switch {
+	case err != nil:
+		log.Printf("Error: Failed to scan %s: %v", path, err)
+		state.Status = ScanError
+	case verdict.Infected:
+		log.Printf("Warning: Deleting infected upload %s: %s", path, verdict.Signature)
+		state = scanState{Status: ScanInfected, Signature: verdict.Signature}
+	}
+
+	if state.Status != ScanClean {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error: Failed to delete unscanned upload %s: %v", path, err)
+		}
+		if err := h.db.DeleteMetadata(&model.FileMetadata{ResourcePath: path}); err != nil {
+			log.Printf("Warning: Failed to delete metadata for %s: %v", path, err)
+		}
+	}
+
+	h.scans.set(filepath.Base(path), state)
+	return state
+}
+
+// scanPending reports whether the stored file is still waiting for its scan
+func (h *Handler) scanPending(path string) bool {
+	if h.scans == nil {
+		return false
+	}
+	state, ok := h.scans.get(filepath.Base(path))
+	return ok && state.Status == ScanPending
+}
+
+// scanURL is where the scan result of a stored file can be polled
+func (h *Handler) scanURL(storedFilename string) string {
+	return joinURL(h.cfg.BaseURL, storedFilename+"/scan")
+}
+
+// scanFailureResponse answers an upload that was deleted by its scan
+func scanFailureResponse(err error) (int, string) {
+	if errors.Is(err, errFileInfected) {
+		return http.StatusUnprocessableEntity, "File rejected: " + err.Error()
+	}
+	return http.StatusServiceUnavailable, "Virus scan unavailable, please try again later"
+}
+
+// ScanStatusResponse is returned by GET /:filename/scan
+type ScanStatusResponse struct {
+	Status    string `json:"status"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// HandleScanStatus reports the scan result of an upload. Results are kept in
+// memory for an hour; files still stored after that have passed their scan.
+func (h *Handler) HandleScanStatus(c echo.Context) error {
+	if h.scanner == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Virus scanning is not enabled"})
+	}
+
+	if state, ok := h.scans.get(c.Param("filename")); ok {
+		return c.JSON(http.StatusOK, ScanStatusResponse{Status: state.Status, Signature: state.Signature})
+	}
+
+	if _, err := h.validateAndResolvePath(c); err == nil {
+		return c.JSON(http.StatusOK, ScanStatusResponse{Status: ScanClean})
+	}
+	return c.JSON(http.StatusNotFound, map[string]string{"error": "File not found"})
+}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/model"
+)
+
+const (
+	// thumbnailSize is the longest side of a thumbnail in pixels
+	thumbnailSize = 256
+
+	// maxThumbnailPixels caps the images decoded for a thumbnail, decoding
+	// holds the whole image in memory
+	maxThumbnailPixels = 50_000_000
+
+	// thumbnailQueueSize is how many uploads can wait for their thumbnail.
+	// Uploads that don't fit get theirs on the first request.
+	thumbnailQueueSize = 64
+)
+
+// thumbnailTypes are the image types thumbnails can be decoded from
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+var errNoThumbnail = errors.New("file has no thumbnail")
+
+// hasThumbnail reports whether a thumbnail can be served for the file. Files
+// consumed by downloads or protected by a password never get a preview.
+func hasThumbnail(meta model.FileMetadata) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(meta.ContentType, ";", 2)[0]))
+	return thumbnailTypes[mediaType] && meta.ContentEncoding == "" &&
+		!meta.LimitsDownloads() && !meta.HasPassword()
+}
+
+// thumbnailFilePath is where the thumbnail of a stored file is written
+func (h *Handler) thumbnailFilePath(filePath string) string {
+	return filepath.Join(h.cfg.ThumbnailPath, filepath.Base(filePath)+".jpg")
+}
+
+// startThumbnailWorker generates the thumbnails of queued uploads in the
+// background, one at a time
+func (h *Handler) startThumbnailWorker() {
+	h.thumbnailQueue = make(chan string, thumbnailQueueSize)
+	go func() {
+		for path := range h.thumbnailQueue {
+			meta, err := h.db.GetMetadataByID(path)
+			if err != nil || !hasThumbnail(meta) {
+				continue
+			}
+			if _, err := h.generateThumbnail(meta); err != nil {
+				log.Printf("Warning: Failed to generate thumbnail of %s: %v", path, err)
+			}
+		}
+	}()
+}
+
+// queueThumbnail schedules the thumbnail of a new upload when
+// pregenerate_thumbnails is set
+func (h *Handler) queueThumbnail(path string) {
+	if h.thumbnailQueue == nil {
+		return
+	}
+	select {
+	case h.thumbnailQueue <- path:
+	default:
+		log.Printf("Warning: Thumbnail queue full, %s gets its thumbnail on request", filepath.Base(path))
+	}
+}
+
+// generateThumbnail scales the image down to fit thumbnailSize, stores it as
+// a JPEG and records its path in the metadata
+func (h *Handler) generateThumbnail(meta model.FileMetadata) (string, error) {
+	file, err := os.Open(meta.ResourcePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return "", err
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return "", fmt.Errorf("%w: image of %dx%d is too large", errNoThumbnail, config.Width, config.Height)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(h.cfg.ThumbnailPath, 0o755); err != nil {
+		return "", err
+	}
+	path := h.thumbnailFilePath(meta.ResourcePath)
+	tmp, err := os.CreateTemp(h.cfg.ThumbnailPath, ".thumb-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = jpeg.Encode(tmp, scaleDown(img, thumbnailSize), &jpeg.Options{Quality: 80})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	if err := h.db.SetThumbnailPath(meta.ID(), path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// scaleDown averages the source pixels covered by each pixel of a copy whose
+// longest side is at most size. Smaller images keep their size. Transparent
+// areas are flattened on white since JPEG has no alpha.
+func scaleDown(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, bounds.Dy()*size/bounds.Dx())
+		} else {
+			width, height = max(1, bounds.Dx()*size/bounds.Dy()), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					white := 0xffff - uint64(pa)
+					r += uint64(pr) + white
+					g += uint64(pg) + white
+					b += uint64(pb) + white
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: 0xffff})
+		}
+	}
+	return dst
+}
+
+// HandleThumbnail serves the thumbnail of an image, generating it on the first
+// request unless it was made at upload time
+func (h *Handler) HandleThumbnail(c echo.Context) error {
+	filePath, err := h.validateAndResolvePath(c)
+	if err != nil {
+		return h.notFoundResponse(c)
+	}
+	if h.scanPending(filePath) {
+		c.Response().Header().Set("Retry-After", "5")
+		return c.String(http.StatusServiceUnavailable, "File is still being scanned")
+	}
+
+	meta, err := h.db.GetMetadataByID(filePath)
+	if err != nil || !hasThumbnail(meta) {
+		return h.notFoundResponse(c)
+	}
+
+	path := meta.ThumbnailPath
+	if _, err := os.Stat(path); path == "" || err != nil {
+		if path, err = h.generateThumbnail(meta); err != nil {
+			log.Printf("Warning: Failed to generate thumbnail of %s: %v", filePath, err)
+			return h.notFoundResponse(c)
+		}
+	}
+
+	header := c.Response().Header()
+	header.Set("Content-Type", "image/jpeg")
+	header.Set("Cache-Control", "public, max-age=3600, must-revalidate")
+	if !h.cfg.AllowIndexing || meta.NoIndex {
+		header.Set("X-Robots-Tag", "noindex, nofollow")
+	}
+	return c.File(path)
+}
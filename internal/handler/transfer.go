@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/db"
+	"github.com/marianozunino/drop/internal/model"
+)
+
+// statusBandwidthLimitExceeded is the unofficial 509 answered to downloads
+// once monthly_transfer_cap_gib is used up
+const statusBandwidthLimitExceeded = 509
+
+// transferMeter keeps the bytes served in the current month in memory, so
+// downloads are checked against the cap without a query. It starts from the
+// stored total of each month and adds what is served after that.
+type transferMeter struct {
+	mu     sync.Mutex
+	period string
+	bytes  int64
+}
+
+// transferUsage returns the current period and the bytes served in it
+func (h *Handler) transferUsage(now time.Time) (string, int64) {
+	h.transfer.mu.Lock()
+	defer h.transfer.mu.Unlock()
+	h.syncTransferPeriod(now)
+	return db.TransferPeriod(now), h.transfer.bytes
+}
+
+// syncTransferPeriod loads the stored total when a new period starts. The
+// caller holds h.transfer.mu.
+func (h *Handler) syncTransferPeriod(now time.Time) {
+	period := db.TransferPeriod(now)
+	if h.transfer.period == period {
+		return
+	}
+	bytes, err := h.db.BytesServedIn(period)
+	if err != nil {
+		// Counted from zero and read again next time
+		log.Printf("Warning: Failed to read transfer usage of %s: %v", period, err)
+		h.transfer.period, h.transfer.bytes = "", 0
+		return
+	}
+	h.transfer.period = period
+	h.transfer.bytes = bytes
+}
+
+// recordTransfer counts n bytes sent for a download of the file, toward its
+// bytes_served and the monthly total
+func (h *Handler) recordTransfer(meta model.FileMetadata, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	now := time.Now()
+	h.transfer.mu.Lock()
+	h.syncTransferPeriod(now)
+	h.transfer.bytes += n
+	h.transfer.mu.Unlock()
+
+	if h.access != nil {
+		h.access.RecordBytes(meta.ID(), n)
+		return
+	}
+	delta := map[string]db.AccessDelta{meta.ID(): {Bytes: n, Last: now}}
+	if err := h.db.AddAccessCounts(delta); err != nil {
+		log.Printf("Warning: Failed to record transfer of %s: %v", meta.ID(), err)
+	}
+}
+
+// checkTransferCap answers with 509 and returns false when the downloads of
+// this month used up monthly_transfer_cap_gib. Retry-After is the start of the
+// next month, when the cap resets.
+func (h *Handler) checkTransferCap(c echo.Context) (bool, error) {
+	limit := h.cfg.MonthlyTransferCapToBytes()
+	if limit <= 0 {
+		return true, nil
+	}
+
+	now := time.Now()
+	if _, served := h.transferUsage(now); served < limit {
+		return true, nil
+	}
+
+	year, month, _ := now.UTC().Date()
+	reset := time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+	c.Response().Header().Set("Retry-After", reset.Format(http.TimeFormat))
+	return false, c.String(statusBandwidthLimitExceeded, "Monthly transfer limit exceeded, try again after "+reset.Format("January 2"))
+}
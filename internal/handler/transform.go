@@ -0,0 +1,318 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// UploadTransformer rewrites the content of an upload while it is streamed to disk.
+// Transformers may also adjust the file info (stored filename, content type) to
+// describe the bytes they produce.
+type UploadTransformer interface {
+	Transform(r io.Reader, meta *FileInfo) (io.Reader, error)
+}
+
+// uploadTransformerFactories maps config names to built-in transformers
+var uploadTransformerFactories = map[string]func(h *Handler) UploadTransformer{
+	"exif_strip": func(h *Handler) UploadTransformer { return &ExifStripTransformer{} },
+	"gzip": func(h *Handler) UploadTransformer {
+		return &GzipTransformer{Level: h.cfg.GzipCompressionLevel()}
+	},
+	"heic_jpeg": func(h *Handler) UploadTransformer {
+		command := strings.Fields(h.cfg.HeicConverter)
+		if len(command) == 0 {
+			log.Printf("Warning: heic_converter is empty, HEIC uploads are stored as they are")
+			return &HeicJPEGTransformer{}
+		}
+		if _, err := exec.LookPath(command[0]); err != nil {
+			log.Printf("Warning: HEIC converter %q not found, HEIC uploads are stored as they are: %v", command[0], err)
+			return &HeicJPEGTransformer{}
+		}
+		return &HeicJPEGTransformer{Command: command}
+	},
+}
+
+// buildUploadTransformers resolves the configured transformer names in order
+func (h *Handler) buildUploadTransformers(names []string) []UploadTransformer {
+	var transformers []UploadTransformer
+	for _, name := range names {
+		factory, ok := uploadTransformerFactories[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			log.Printf("Warning: Unknown upload transformer %q, skipping", name)
+			continue
+		}
+		transformers = append(transformers, factory(h))
+	}
+	return transformers
+}
+
+// applyTransformers chains all configured transformers over the upload stream.
+// The returned release func unblocks any transformer goroutines still writing
+// when the caller stops reading early, and must always be called.
+func (h *Handler) applyTransformers(r io.Reader, meta *FileInfo) (io.Reader, func(), error) {
+	var closers []io.Closer
+	release := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+
+	for _, t := range h.transformers {
+		var err error
+		r, err = t.Transform(r, meta)
+		if err != nil {
+			release()
+			return nil, func() {}, err
+		}
+		if c, ok := r.(io.Closer); ok {
+			closers = append(closers, c)
+		}
+	}
+	return r, release, nil
+}
+
+// ExifStripTransformer removes APP1 (EXIF/XMP) segments from JPEG uploads.
+// Non-JPEG content is passed through untouched.
+type ExifStripTransformer struct{}
+
+// Transform implements UploadTransformer
+func (t *ExifStripTransformer) Transform(r io.Reader, meta *FileInfo) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil || !isJPEG(magic) {
+		return br, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(stripJPEGMetadata(br, pw))
+	}()
+	return pr, nil
+}
+
+// stripJPEGMetadata copies a JPEG stream, dropping APP1 segments before the image data
+func stripJPEGMetadata(r *bufio.Reader, w io.Writer) error {
+	soi := make([]byte, 2)
+	if _, err := io.ReadFull(r, soi); err != nil {
+		return err
+	}
+	if _, err := w.Write(soi); err != nil {
+		return err
+	}
+
+	for {
+		marker := make([]byte, 2)
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return fmt.Errorf("invalid JPEG segment: %w", err)
+		}
+		if marker[0] != 0xFF {
+			return fmt.Errorf("invalid JPEG marker 0x%02x%02x", marker[0], marker[1])
+		}
+
+		// Standalone markers carry no length
+		if marker[1] == 0xD8 || marker[1] == 0x01 || (marker[1] >= 0xD0 && marker[1] <= 0xD7) {
+			if _, err := w.Write(marker); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// End of image or start of scan: the rest is copied verbatim
+		if marker[1] == 0xD9 || marker[1] == 0xDA {
+			if _, err := w.Write(marker); err != nil {
+				return err
+			}
+			_, err := io.Copy(w, r)
+			return err
+		}
+
+		lengthBytes := make([]byte, 2)
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return fmt.Errorf("invalid JPEG segment length: %w", err)
+		}
+		length := int(binary.BigEndian.Uint16(lengthBytes))
+		if length < 2 {
+			return fmt.Errorf("invalid JPEG segment length %d", length)
+		}
+
+		if marker[1] == 0xE1 {
+			if _, err := r.Discard(length - 2); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := w.Write(marker); err != nil {
+			return err
+		}
+		if _, err := w.Write(lengthBytes); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, r, int64(length-2)); err != nil {
+			return err
+		}
+	}
+}
+
+// GzipTransformer stores uploads gzip-compressed and appends ".gz" to the stored name
+type GzipTransformer struct {
+	Level int
+}
+
+// Transform implements UploadTransformer
+func (t *GzipTransformer) Transform(r io.Reader, meta *FileInfo) (io.Reader, error) {
+	if _, err := gzip.NewWriterLevel(io.Discard, t.Level); err != nil {
+		return nil, fmt.Errorf("invalid gzip level %d: %w", t.Level, err)
+	}
+
+	meta.StoredFilename += ".gz"
+	meta.FilePath += ".gz"
+	meta.OriginalFilename += ".gz"
+	meta.ContentType = "application/gzip"
+
+	pr, pw := io.Pipe()
+	go func() {
+		gz, _ := gzip.NewWriterLevel(pw, t.Level)
+		if _, err := io.Copy(gz, r); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(gz.Close())
+	}()
+	return pr, nil
+}
+
+// heicConvertTimeout bounds how long the converter may take for one photo
+const heicConvertTimeout = 2 * time.Minute
+
+// HeicJPEGTransformer converts HEIC and HEIF photos to JPEG with an external
+// converter, so shared links preview in every browser, and renames them to
+// .jpg. Other content, uploads sent with keep_original, and photos the
+// converter fails on are stored untouched. Without a Command nothing is
+// converted.
+type HeicJPEGTransformer struct {
+	// Command runs the converter, with {input} and {output} standing for the
+	// HEIC file and the JPEG file to write
+	Command []string
+}
+
+// Transform implements UploadTransformer. The photo is spooled to a temp file
+// for the converter, which needs the whole image.
+func (t *HeicJPEGTransformer) Transform(r io.Reader, meta *FileInfo) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(12)
+	if len(t.Command) == 0 || meta.KeepOriginal || !isHEIC(head) {
+		return br, nil
+	}
+
+	input, err := os.CreateTemp("", "drop-heic-*.heic")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	_, err = io.Copy(input, br)
+	if closeErr := input.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(input.Name())
+		return nil, err
+	}
+
+	output := strings.TrimSuffix(input.Name(), ".heic") + ".jpg"
+	newPath := replaceExt(meta.FilePath, ".jpg")
+	if _, err := os.Stat(newPath); err == nil {
+		log.Printf("Warning: Not converting %s, %s already exists", meta.OriginalFilename, filepath.Base(newPath))
+		return openTempReader(input.Name())
+	}
+	if err := t.convert(input.Name(), output); err != nil {
+		log.Printf("Warning: Failed to convert %s to JPEG, storing the original: %v", meta.OriginalFilename, err)
+		os.Remove(output)
+		return openTempReader(input.Name())
+	}
+	os.Remove(input.Name())
+
+	meta.FilePath = newPath
+	meta.StoredFilename = replaceExt(meta.StoredFilename, ".jpg")
+	meta.OriginalFilename = replaceExt(meta.OriginalFilename, ".jpg")
+	meta.ContentType = "image/jpeg"
+	return openTempReader(output)
+}
+
+// convert runs the converter and checks that it wrote a JPEG
+func (t *HeicJPEGTransformer) convert(input, output string) error {
+	args := make([]string, len(t.Command)-1)
+	for i, arg := range t.Command[1:] {
+		arg = strings.ReplaceAll(arg, "{input}", input)
+		args[i] = strings.ReplaceAll(arg, "{output}", output)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), heicConvertTimeout)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, t.Command[0], args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(file, magic); err != nil || !isJPEG(magic) {
+		return fmt.Errorf("converter didn't write a JPEG")
+	}
+	return nil
+}
+
+// tempReader reads a temp file and removes it when closed
+type tempReader struct {
+	*os.File
+}
+
+func openTempReader(path string) (io.Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return &tempReader{file}, nil
+}
+
+// Close implements io.Closer
+func (r *tempReader) Close() error {
+	err := r.File.Close()
+	os.Remove(r.Name())
+	return err
+}
+
+// replaceExt swaps the extension of a file name, or appends ext when it has none
+func replaceExt(name, ext string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ext
+}
+
+// heicBrands are the ftyp brands of HEIC and HEIF images
+var heicBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true,
+	"hevc": true, "hevx": true, "mif1": true, "msf1": true,
+}
+
+// isHEIC reports whether the data starts with the ftyp box of a HEIC or HEIF image
+func isHEIC(data []byte) bool {
+	return len(data) >= 12 && string(data[4:8]) == "ftyp" && heicBrands[string(data[8:12])]
+}
+
+// isJPEG reports whether the data starts with a JPEG SOI marker
+func isJPEG(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0xFF, 0xD8})
+}
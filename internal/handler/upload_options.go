@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// UploadOptionsVersion is the newest schema accepted in the JSON options part
+const UploadOptionsVersion = 1
+
+// UploadOptions are upload settings sent as a JSON object in the "options" form part.
+// Fields that are set override the individual form fields of the same name.
+type UploadOptions struct {
+	Version      int          `json:"version,omitempty"`
+	Secret       *bool        `json:"secret,omitempty"`
+	OneTime      *bool        `json:"one_time,omitempty"`
+	Expires      *optionValue `json:"expires,omitempty"`
+	Shorten      *bool        `json:"shorten,omitempty"`
+	URL          string       `json:"url,omitempty"`
+	NoIndex      *bool        `json:"noindex,omitempty"`
+	KeepOriginal *bool        `json:"keep_original,omitempty"`
+	GroupID      string       `json:"group_id,omitempty"`
+	Slug         string       `json:"slug,omitempty"`
+
+	OnConflict      string `json:"on_conflict,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	Password        string `json:"password,omitempty"`
+
+	// Accepted so clients can send them, stored by servers that support them
+	MaxDownloads  *int   `json:"max_downloads,omitempty"`
+	InactivityTTL string `json:"inactivity_ttl,omitempty"`
+}
+
+// optionValue accepts a JSON string or number, e.g. "expires": 24 or "expires": "2025-01-01"
+type optionValue string
+
+// UnmarshalJSON implements json.Unmarshaler
+func (v *optionValue) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = optionValue(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("expected a string or number, got %s", data)
+	}
+	*v = optionValue(n.String())
+	return nil
+}
+
+// parseUploadOptions decodes the JSON options object. Unknown fields are rejected
+// when strict is set.
+func parseUploadOptions(data []byte, strict bool) (UploadOptions, error) {
+	var opts UploadOptions
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&opts); err != nil {
+		return opts, fmt.Errorf("invalid options JSON: %w", err)
+	}
+	if decoder.More() {
+		return opts, fmt.Errorf("invalid options JSON: unexpected data after the object")
+	}
+
+	if opts.Version < 0 || opts.Version > UploadOptionsVersion {
+		return opts, fmt.Errorf("unsupported options version %d", opts.Version)
+	}
+	if opts.MaxDownloads != nil && *opts.MaxDownloads < 0 {
+		return opts, fmt.Errorf("max_downloads must not be negative")
+	}
+
+	return opts, nil
+}
+
+// applyUploadOptions merges the JSON "options" part, sent either as a plain field
+// or as a file part, into the request form
+func (h *Handler) applyUploadOptions(c echo.Context) error {
+	req := c.Request()
+
+	var data []byte
+	if value := req.FormValue("options"); value != "" {
+		data = []byte(value)
+	} else if req.MultipartForm != nil && len(req.MultipartForm.File["options"]) > 0 {
+		part, err := req.MultipartForm.File["options"][0].Open()
+		if err != nil {
+			return fmt.Errorf("failed to read options part: %w", err)
+		}
+		defer part.Close()
+
+		if data, err = io.ReadAll(part); err != nil {
+			return fmt.Errorf("failed to read options part: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	opts, err := parseUploadOptions(data, h.cfg.StrictUploadOptions)
+	if err != nil {
+		return err
+	}
+
+	setFlag := func(key string, value *bool) {
+		if value == nil {
+			return
+		}
+		if *value {
+			req.Form.Set(key, "true")
+		} else {
+			// Flags are enabled by their presence, so false removes them
+			req.Form.Del(key)
+		}
+	}
+	setFlag("secret", opts.Secret)
+	setFlag("one_time", opts.OneTime)
+	setFlag("shorten", opts.Shorten)
+	setFlag("noindex", opts.NoIndex)
+	setFlag("keep_original", opts.KeepOriginal)
+
+	if opts.Expires != nil {
+		req.Form.Set("expires", string(*opts.Expires))
+	}
+	if opts.URL != "" {
+		req.Form.Set("url", opts.URL)
+	}
+	if opts.GroupID != "" {
+		req.Form.Set("group_id", opts.GroupID)
+	}
+	if opts.Slug != "" {
+		req.Form.Set("slug", opts.Slug)
+	}
+	if opts.OnConflict != "" {
+		req.Form.Set("on_conflict", opts.OnConflict)
+	}
+	if opts.ContentEncoding != "" {
+		req.Form.Set("content_encoding", opts.ContentEncoding)
+	}
+	if opts.Password != "" {
+		req.Form.Set("password", opts.Password)
+	}
+	if opts.MaxDownloads != nil {
+		req.Form.Set("max_downloads", strconv.Itoa(*opts.MaxDownloads))
+	}
+	if opts.InactivityTTL != "" {
+		req.Form.Set("inactivity_ttl", opts.InactivityTTL)
+	}
+
+	return nil
+}
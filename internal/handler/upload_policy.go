@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/config"
+	"github.com/marianozunino/drop/internal/expiration"
+)
+
+// APIKeyHeader carries the API key that selects an upload tier
+const APIKeyHeader = "X-API-Key"
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+// uploadPolicy holds the limits that apply to a single upload request
+type uploadPolicy struct {
+	Tier    string
+	MaxSize int64
+	Limits  expiration.RetentionLimits
+
+	// MaxDownloads caps the download limit of the upload, 0 for no cap
+	MaxDownloads int
+}
+
+// downloadLimit applies the policy's cap to a requested download limit, where
+// 0 asks for unlimited downloads
+func (p uploadPolicy) downloadLimit(requested int) int {
+	if p.MaxDownloads > 0 && (requested == 0 || requested > p.MaxDownloads) {
+		return p.MaxDownloads
+	}
+	return requested
+}
+
+// defaultUploadPolicy returns the global limits
+func (h *Handler) defaultUploadPolicy() uploadPolicy {
+	return uploadPolicy{Tier: config.AnonymousTier, MaxSize: h.cfg.MaxSizeToBytes()}
+}
+
+// resolveUploadPolicy picks the limits for the request from its API key.
+// Requests without a key get the anonymous tier; unknown keys are rejected.
+func (h *Handler) resolveUploadPolicy(c echo.Context) (uploadPolicy, error) {
+	tierName := config.AnonymousTier
+	if key := c.Request().Header.Get(APIKeyHeader); key != "" {
+		name, ok := h.cfg.TierForAPIKey(key)
+		if !ok {
+			return uploadPolicy{}, errInvalidAPIKey
+		}
+		tierName = name
+	}
+
+	policy := h.defaultUploadPolicy()
+	policy.Tier = tierName
+	policy.Limits.MaxRetention = h.anonymousRetentionCap(c)
+
+	tier, ok := h.cfg.UploadTiers[tierName]
+	if !ok {
+		return policy, nil
+	}
+	if tier.MaxSize > 0 {
+		policy.MaxSize = int64(tier.MaxSize * 1024 * 1024)
+	}
+	policy.Limits.MaxSize = tier.MaxSize
+	policy.Limits.MaxAge = tier.MaxAge
+	policy.MaxDownloads = tier.MaxDownloads
+	return policy, nil
+}
+
+// anonymousRetentionCap returns anonymous_max_age_hours for requests without a
+// valid API key and 0, no cap, for the rest
+func (h *Handler) anonymousRetentionCap(c echo.Context) time.Duration {
+	if key := c.Request().Header.Get(APIKeyHeader); key != "" {
+		if _, ok := h.cfg.TierForAPIKey(key); ok {
+			return 0
+		}
+	}
+	return h.cfg.AnonymousMaxAge()
+}
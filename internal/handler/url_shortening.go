@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,10 +10,15 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/expiration"
 	"github.com/marianozunino/drop/internal/model"
 )
 
 func (h *Handler) HandleURLShortening(c echo.Context) error {
+	if h.MaintenanceMode() {
+		return h.maintenanceResponse(c, false)
+	}
+
 	c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, h.cfg.MaxSizeToBytes())
 
 	if err := h.parseRequestForm(c); err != nil {
@@ -20,13 +26,19 @@ func (h *Handler) HandleURLShortening(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Invalid request form.")
 	}
 
+	if err := h.resolveGroupID(c); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
 	originalURL := c.FormValue("url")
 	if originalURL == "" {
 		return c.String(http.StatusBadRequest, "No URL provided")
 	}
 
-	if !h.isValidURL(originalURL) {
-		return c.String(http.StatusBadRequest, "Invalid URL format")
+	originalURL, err := h.normalizeShortenURL(originalURL)
+	if err != nil {
+		log.Printf("[HandleURLShortening] Rejected URL from %s: %v", c.RealIP(), err)
+		return c.String(http.StatusBadRequest, err.Error())
 	}
 
 	useSecretId := c.FormValue("secret") != ""
@@ -36,7 +48,10 @@ func (h *Handler) HandleURLShortening(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "Failed to generate short URL")
 	}
 
-	expirationDate, err := h.determineExpiration(c, 0)
+	expirationDate, err := h.determineExpiration(c, 0, expiration.RetentionLimits{MaxRetention: h.anonymousRetentionCap(c)})
+	if errors.Is(err, errExpirationRequired) {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
 	if err != nil {
 		log.Printf("[HandleURLShortening] Invalid expiration format: %v", err)
 		return c.String(http.StatusBadRequest, "Invalid expiration format.")
@@ -58,12 +73,41 @@ func (h *Handler) HandleURLShortening(c echo.Context) error {
 	return nil
 }
 
-func (h *Handler) isValidURL(urlStr string) bool {
+// normalizeShortenURL validates a URL for the shortener and returns it with a
+// lowercase scheme and host and without default ports. Only http and https are
+// accepted, so a short link can't redirect to javascript:, data: or file: URLs.
+func (h *Handler) normalizeShortenURL(urlStr string) (string, error) {
+	if limit := h.cfg.ShortenedURLLengthLimit(); len(urlStr) > limit {
+		return "", fmt.Errorf("URL too long (max %d characters)", limit)
+	}
+
 	u, err := url.Parse(urlStr)
 	if err != nil {
-		return false
+		return "", fmt.Errorf("Invalid URL format")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("Unsupported URL scheme, only http and https are allowed")
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("Invalid URL format")
 	}
-	return u.Scheme != "" && u.Host != ""
+
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	return u.String(), nil
 }
 
 func (h *Handler) storeURLMetadata(shortPath, originalURL string, expirationDate time.Time, oneTimeView bool, c echo.Context) (string, error) {
@@ -92,6 +136,7 @@ func (h *Handler) storeURLMetadata(shortPath, originalURL string, expirationDate
 		IPAddress:      ipAddress,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
+		GroupID:        requestGroupID(c),
 	}
 
 	if !expirationDate.IsZero() {
@@ -107,7 +152,13 @@ func (h *Handler) storeURLMetadata(shortPath, originalURL string, expirationDate
 
 func (h *Handler) sendURLShorteningResponse(c echo.Context, shortID, token string, expirationDate time.Time) error {
 	c.Response().Header().Set("X-Token", token)
-	shortURL := h.expManager.Config.BaseURL + shortID
+	shortURL := joinURL(h.cfg.BaseURL, shortID)
+	addVary(c, "Accept")
+
+	groupID := requestGroupID(c)
+	if groupID != "" {
+		c.Response().Header().Set("X-Group-Id", groupID)
+	}
 
 	if !expirationDate.IsZero() {
 		expiresMs := expirationDate.UnixNano() / int64(time.Millisecond)
@@ -122,6 +173,10 @@ func (h *Handler) sendURLShorteningResponse(c echo.Context, shortID, token strin
 			"md5":   "",
 		}
 
+		if groupID != "" {
+			response["group_id"] = groupID
+		}
+
 		if !expirationDate.IsZero() {
 			response["expires_at"] = expirationDate.Format(time.RFC3339)
 			days := int(time.Until(expirationDate).Hours() / 24)
@@ -152,31 +207,80 @@ func (h *Handler) HandleURLRedirect(c echo.Context) error {
 		return c.String(http.StatusGone, "Short URL has expired")
 	}
 
+	location, err := redirectLocation(metadata.OriginalURL)
+	if err != nil {
+		log.Printf("[HandleURLRedirect] Refusing to redirect %s: %v", filename, err)
+		return c.String(http.StatusNotFound, "Short URL not found")
+	}
+
+	// Clients may reuse a permanent redirect for a while; one that can stop
+	// working must be requested again every time
+	if metadata.OneTimeView || metadata.ExpiresAt != nil {
+		c.Response().Header().Set("Cache-Control", "no-store")
+	} else {
+		c.Response().Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(shortURLCacheMaxAge.Seconds())))
+	}
+
 	if metadata.OneTimeView {
 		go func() {
 			if err := h.db.DeleteMetadata(&metadata); err != nil {
 				log.Printf("[HandleURLRedirect] Failed to delete one-time URL %s: %v", filename, err)
 			}
+			h.deleteGroupMembers(metadata)
 		}()
+	} else if !h.isLinkPreviewBot(c.Request()) {
+		h.recordAccess(metadata)
+	}
+
+	return c.Redirect(http.StatusFound, location)
+}
+
+// shortURLCacheMaxAge is how long clients may cache the redirect of a short URL
+// without an expiration
+const shortURLCacheMaxAge = 5 * time.Minute
+
+// redirectLocation validates a stored short URL again and encodes it for the
+// Location header. URLs stored before they were normalized may contain spaces
+// or non-ASCII characters, which aren't valid in a header.
+func redirectLocation(stored string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(stored))
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("unsupported redirect target %q", stored)
 	}
 
-	return c.Redirect(http.StatusFound, metadata.OriginalURL)
+	// The path and fragment are escaped by String, the raw query is kept as is
+	u.RawQuery = escapeInvalidURLBytes(u.RawQuery)
+	return u.String(), nil
+}
+
+// escapeInvalidURLBytes percent-encodes the bytes that can't appear in a URL,
+// leaving existing escapes and reserved characters alone
+func escapeInvalidURLBytes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch <= ' ' || ch >= 0x7f || strings.IndexByte("\"<>\\^`{|}", ch) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", ch)
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
 }
 
 func (h *Handler) generateUniqueID(useSecretId bool) (string, error) {
 	maxRetries := 10
 	for i := 0; i < maxRetries; i++ {
-		var length int
-		if useSecretId {
-			length = 8
-		} else {
-			length = h.cfg.IdLength
-		}
-
-		id, err := generateID(length)
+		id, err := h.newPublicID(useSecretId)
 		if err != nil {
 			return "", err
 		}
+		if isReservedID(id) {
+			continue
+		}
 
 		// Check if ID already exists
 		_, err = h.db.GetMetadataByID(id)
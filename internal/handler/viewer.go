@@ -0,0 +1,320 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/a-h/templ"
+	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/markdown"
+	"github.com/marianozunino/drop/internal/model"
+	"github.com/marianozunino/drop/templates"
+)
+
+const (
+	// maxViewerSize is the largest file rendered through a viewer, bigger
+	// files are always served raw
+	maxViewerSize = 2 << 20
+
+	// maxViewerRows caps the rows of a table view
+	maxViewerRows = 1000
+)
+
+// viewerCSP keeps rendered user content from loading or running anything
+const viewerCSP = "default-src 'none'; style-src 'unsafe-inline'"
+
+// viewerExtensionTypes name the formats content sniffing reports as text/plain
+var viewerExtensionTypes = map[string]string{
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".csv":      "text/csv",
+	".tsv":      "text/tab-separated-values",
+	".json":     "application/json",
+}
+
+// viewerType is the type used to pick a viewer, refined by the extension when
+// the stored type is plain text
+func viewerType(meta model.FileMetadata) string {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(meta.ContentType, ";", 2)[0]))
+	if mediaType == "text/plain" {
+		if refined, ok := viewerExtensionTypes[strings.ToLower(filepath.Ext(meta.OriginalName))]; ok {
+			return refined
+		}
+	}
+	return mediaType
+}
+
+// hasViewer reports whether render_viewers covers the file
+func (h *Handler) hasViewer(meta model.FileMetadata) bool {
+	return len(h.cfg.RenderViewers) > 0 && matchesContentType(h.cfg.RenderViewers, viewerType(meta))
+}
+
+// wantsViewer reports whether the request for a file with a viewer should get
+// the rendered page instead of the raw file, which is what browsers navigating
+// to it do. ?raw=1, range requests, files consumed by downloads and protected
+// files always get the raw file.
+func (h *Handler) wantsViewer(c echo.Context, meta model.FileMetadata) bool {
+	req := c.Request()
+	return !meta.LimitsDownloads() && !meta.HasPassword() &&
+		meta.Size <= maxViewerSize &&
+		c.QueryParam("raw") == "" &&
+		req.Header.Get("Range") == "" &&
+		strings.Contains(strings.ToLower(req.Header.Get("Accept")), "text/html")
+}
+
+// viewerBody renders the file as markdown, a table or highlighted code. Files
+// that are too big or aren't valid UTF-8 text can't be rendered.
+func viewerBody(filePath string, meta model.FileMetadata) (templ.Component, bool) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		log.Printf("Error: Failed to open file for viewer: %v", err)
+		return nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxViewerSize+1))
+	if err != nil || len(data) > maxViewerSize || !utf8.Valid(data) {
+		return nil, false
+	}
+
+	switch viewerType(meta) {
+	case "text/markdown", "text/x-markdown":
+		return templates.MarkdownView(markdown.Render(string(data))), true
+	case "text/csv", "text/tab-separated-values":
+		if rows, truncated, err := parseTable(data, viewerType(meta) == "text/tab-separated-values"); err == nil {
+			return templates.TableView(rows, truncated), true
+		}
+	case "application/json":
+		return templates.CodeView(highlightJSON(data)), true
+	}
+	return templates.CodeView(highlightCode(data, filepath.Ext(meta.OriginalName))), true
+}
+
+// serveViewer sends the rendered file in the viewer page
+func (h *Handler) serveViewer(c echo.Context, filePath string, meta model.FileMetadata, body templ.Component) error {
+	header := c.Response().Header()
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	header.Set("Content-Security-Policy", viewerCSP)
+	header.Set("Cache-Control", "no-cache")
+	if !h.cfg.AllowIndexing || meta.NoIndex {
+		header.Set("X-Robots-Tag", "noindex, nofollow")
+	}
+
+	rawURL := joinURL(h.cfg.BaseURL, filepath.Base(filePath)) + "?raw=1"
+	c.Response().WriteHeader(http.StatusOK)
+	page := templates.Viewer(meta.OriginalName, rawURL)
+	if err := page.Render(templ.WithChildren(c.Request().Context(), body), c.Response()); err != nil {
+		return err
+	}
+
+	if !h.isLinkPreviewBot(c.Request()) {
+		h.recordAccess(meta)
+	}
+	return nil
+}
+
+// parseTable reads CSV or TSV rows, keeping at most maxViewerRows
+func parseTable(data []byte, tabs bool) ([][]string, bool, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if tabs {
+		reader.Comma = '\t'
+	}
+
+	var rows [][]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if len(rows) == maxViewerRows {
+			return rows, true, nil
+		}
+		rows = append(rows, row)
+	}
+}
+
+// highlightJSON pretty prints valid JSON before highlighting it
+func highlightJSON(data []byte) [][]templates.CodeToken {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err == nil {
+		data = indented.Bytes()
+	}
+	return splitTokenLines(lexCode(string(data), codeSyntax{json: true}))
+}
+
+// codeSyntax is what the highlighter needs to know about a language
+type codeSyntax struct {
+	lineComments []string
+	blockComment bool
+	json         bool
+}
+
+// codeSyntaxes maps the extensions of highlighted languages to their comment styles
+var codeSyntaxes = map[string]codeSyntax{}
+
+func init() {
+	slashes := codeSyntax{lineComments: []string{"//"}, blockComment: true}
+	for _, ext := range []string{".go", ".c", ".h", ".cc", ".cpp", ".hpp", ".cs", ".java", ".kt", ".js", ".mjs", ".ts", ".tsx", ".jsx", ".rs", ".swift", ".scala", ".php", ".css", ".scss"} {
+		codeSyntaxes[ext] = slashes
+	}
+	hashes := codeSyntax{lineComments: []string{"#"}}
+	for _, ext := range []string{".py", ".rb", ".sh", ".bash", ".zsh", ".pl", ".r", ".yaml", ".yml", ".toml", ".ini", ".conf", ".cfg", ".dockerfile", ".mk"} {
+		codeSyntaxes[ext] = hashes
+	}
+	codeSyntaxes[".sql"] = codeSyntax{lineComments: []string{"--"}, blockComment: true}
+	codeSyntaxes[".lua"] = codeSyntax{lineComments: []string{"--"}}
+}
+
+// highlightCode highlights strings, numbers and comments of languages known by
+// extension. Other text is shown as is, quotes in prose aren't strings.
+func highlightCode(data []byte, ext string) [][]templates.CodeToken {
+	syntax, ok := codeSyntaxes[strings.ToLower(ext)]
+	if !ok {
+		return splitTokenLines([]templates.CodeToken{{Text: string(data)}})
+	}
+	return splitTokenLines(lexCode(string(data), syntax))
+}
+
+// lexCode splits source into highlighted tokens. It only knows enough syntax
+// to color strings, numbers and comments, and JSON keys and literals.
+func lexCode(src string, syntax codeSyntax) []templates.CodeToken {
+	var tokens []templates.CodeToken
+	plain := 0
+	emit := func(start, end int, kind string) {
+		if plain < start {
+			tokens = append(tokens, templates.CodeToken{Text: src[plain:start]})
+		}
+		tokens = append(tokens, templates.CodeToken{Kind: kind, Text: src[start:end]})
+		plain = end
+	}
+
+	for i := 0; i < len(src); {
+		rest := src[i:]
+
+		if lineComment(rest, syntax) {
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			emit(i, i+end, "comment")
+			i += end
+			continue
+		}
+		if syntax.blockComment && strings.HasPrefix(rest, "/*") {
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += 4
+			}
+			emit(i, i+end, "comment")
+			i += end
+			continue
+		}
+
+		switch ch := rest[0]; {
+		case ch == '"' || ch == '\'' && !syntax.json || ch == '`' && !syntax.json:
+			end := stringEnd(rest)
+			kind := "string"
+			if syntax.json && strings.HasPrefix(strings.TrimLeft(rest[end:], " \t\r\n"), ":") {
+				kind = "key"
+			}
+			emit(i, i+end, kind)
+			i += end
+
+		case isDigit(ch) && (i == 0 || !isWordByte(src[i-1])), ch == '-' && syntax.json && len(rest) > 1 && isDigit(rest[1]):
+			end := 1
+			for end < len(rest) && (isWordByte(rest[end]) || rest[end] == '.' ||
+				(rest[end] == '-' || rest[end] == '+') && (rest[end-1] == 'e' || rest[end-1] == 'E')) {
+				end++
+			}
+			emit(i, i+end, "number")
+			i += end
+
+		case syntax.json && (strings.HasPrefix(rest, "true") || strings.HasPrefix(rest, "false") || strings.HasPrefix(rest, "null")):
+			end := strings.IndexFunc(rest, func(r rune) bool { return !isWordByte(byte(r)) })
+			if end < 0 {
+				end = len(rest)
+			}
+			emit(i, i+end, "literal")
+			i += end
+
+		default:
+			i++
+		}
+	}
+	if plain < len(src) {
+		tokens = append(tokens, templates.CodeToken{Text: src[plain:]})
+	}
+	return tokens
+}
+
+// lineComment reports whether a line comment of the language starts here
+func lineComment(rest string, syntax codeSyntax) bool {
+	for _, prefix := range syntax.lineComments {
+		if strings.HasPrefix(rest, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringEnd returns the length of the quoted string at the start of s. Only
+// backtick strings span lines; an unterminated string ends with its line.
+func stringEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote != '`':
+			i++
+		case s[i] == quote:
+			return i + 1
+		case s[i] == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(s)
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isWordByte(b byte) bool {
+	return isDigit(b) || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b == '_'
+}
+
+// splitTokenLines breaks tokens spanning lines so each line renders as a row
+func splitTokenLines(tokens []templates.CodeToken) [][]templates.CodeToken {
+	lines := [][]templates.CodeToken{nil}
+	for _, token := range tokens {
+		parts := strings.Split(strings.ReplaceAll(token.Text, "\r\n", "\n"), "\n")
+		for i, part := range parts {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			if part != "" {
+				last := len(lines) - 1
+				lines[last] = append(lines[last], templates.CodeToken{Kind: token.Kind, Text: part})
+			}
+		}
+	}
+	// A trailing newline doesn't start another line
+	if len(lines) > 1 && lines[len(lines)-1] == nil {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
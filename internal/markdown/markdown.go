@@ -0,0 +1,385 @@
+// Package markdown renders the common subset of Markdown used in notes and
+// READMEs to HTML: headings, paragraphs, lists, block quotes, code blocks,
+// rules, emphasis, code spans and links. Raw HTML in the source is escaped,
+// never passed through, so the output is safe to embed in a page.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingPattern = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	rulePattern    = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fencePattern   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	bulletPattern  = regexp.MustCompile(`^( {0,3})([-*+])[ \t]+(.*)$`)
+	orderedPattern = regexp.MustCompile(`^( {0,3})(\d{1,9})[.)][ \t]+(.*)$`)
+	quotePattern   = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+)
+
+// Render converts Markdown source to HTML
+func Render(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	var out strings.Builder
+	renderBlocks(&out, strings.Split(source, "\n"))
+	return out.String()
+}
+
+// renderBlocks writes the block elements found in lines
+func renderBlocks(out *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case fencePattern.MatchString(line):
+			i = renderFence(out, lines, i)
+
+		case headingPattern.MatchString(line):
+			m := headingPattern.FindStringSubmatch(line)
+			level := string(rune('0' + len(m[1])))
+			out.WriteString("<h" + level + ">" + renderInline(m[2]) + "</h" + level + ">\n")
+			i++
+
+		case rulePattern.MatchString(line):
+			out.WriteString("<hr>\n")
+			i++
+
+		case quotePattern.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				if m := quotePattern.FindStringSubmatch(lines[i]); m != nil {
+					quoted = append(quoted, m[1])
+				} else {
+					quoted = append(quoted, lines[i])
+				}
+			}
+			out.WriteString("<blockquote>\n")
+			renderBlocks(out, quoted)
+			out.WriteString("</blockquote>\n")
+
+		case bulletPattern.MatchString(line) || orderedPattern.MatchString(line):
+			i = renderList(out, lines, i)
+
+		case isIndentedCode(line):
+			var code []string
+			for ; i < len(lines) && (isIndentedCode(lines[i]) || strings.TrimSpace(lines[i]) == ""); i++ {
+				code = append(code, dedent(lines[i], 4))
+			}
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			out.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "\n</code></pre>\n")
+
+		default:
+			var paragraph []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && (len(paragraph) == 0 || !startsBlock(lines[i])); i++ {
+				paragraph = append(paragraph, strings.TrimLeft(lines[i], " \t"))
+			}
+			out.WriteString("<p>" + renderInline(strings.Join(paragraph, "\n")) + "</p>\n")
+		}
+	}
+}
+
+// startsBlock reports whether the line interrupts a paragraph
+func startsBlock(line string) bool {
+	return fencePattern.MatchString(line) || headingPattern.MatchString(line) ||
+		rulePattern.MatchString(line) || quotePattern.MatchString(line) ||
+		bulletPattern.MatchString(line) || orderedPattern.MatchString(line)
+}
+
+func isIndentedCode(line string) bool {
+	return (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")) && strings.TrimSpace(line) != ""
+}
+
+// dedent removes up to n columns of leading whitespace, counting a tab as a full indent
+func dedent(line string, n int) string {
+	for removed := 0; removed < n && line != ""; {
+		switch line[0] {
+		case ' ':
+			line, removed = line[1:], removed+1
+		case '\t':
+			line, removed = line[1:], n
+		default:
+			return line
+		}
+	}
+	return line
+}
+
+// renderFence writes a fenced code block starting at lines[start] and returns
+// the index of the first line after it. An unclosed fence runs to the end.
+func renderFence(out *strings.Builder, lines []string, start int) int {
+	m := fencePattern.FindStringSubmatch(lines[start])
+	fence, language := m[1], m[2]
+
+	i := start + 1
+	var code []string
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+
+	out.WriteString("<pre><code")
+	if language != "" {
+		out.WriteString(` class="language-` + html.EscapeString(language) + `"`)
+	}
+	out.WriteString(">")
+	if len(code) > 0 {
+		out.WriteString(html.EscapeString(strings.Join(code, "\n")) + "\n")
+	}
+	out.WriteString("</code></pre>\n")
+	return i
+}
+
+// renderList writes a bulleted or numbered list starting at lines[start] and
+// returns the index of the first line after it. Lines indented past the marker
+// belong to the item above them, which is how lists nest.
+func renderList(out *strings.Builder, lines []string, start int) int {
+	ordered := orderedPattern.MatchString(lines[start])
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+
+	out.WriteString("<" + tag)
+	if m := orderedPattern.FindStringSubmatch(lines[start]); ordered && strings.TrimLeft(m[2], "0") != "1" {
+		out.WriteString(` start="` + strings.TrimLeft(m[2], "0") + `"`)
+	}
+	out.WriteString(">\n")
+
+	i := start
+	for i < len(lines) {
+		indent, text, ok := listItem(lines[i], ordered)
+		if !ok {
+			break
+		}
+
+		item := []string{text}
+		loose := false
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// A blank line continues the item only when indented content follows
+				if i+1 < len(lines) && leadingSpaces(lines[i+1]) > indent {
+					item = append(item, "")
+					loose = true
+					continue
+				}
+				break
+			}
+			if leadingSpaces(line) <= indent && startsBlock(line) {
+				break
+			}
+			item = append(item, dedent(line, indent+2))
+		}
+
+		var body strings.Builder
+		renderBlocks(&body, item)
+		content := body.String()
+		if !loose {
+			content = unwrapParagraphs(content)
+		}
+		out.WriteString("<li>" + strings.TrimSuffix(content, "\n") + "</li>\n")
+
+		// Items of the same list may be separated by a blank line
+		if i+1 < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			if _, _, next := listItem(lines[i+1], ordered); next {
+				i++
+			}
+		}
+	}
+
+	out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// listItem matches a list marker of the given kind, returning its indent and text
+func listItem(line string, ordered bool) (int, string, bool) {
+	pattern := bulletPattern
+	if ordered {
+		pattern = orderedPattern
+	}
+	m := pattern.FindStringSubmatch(line)
+	if m == nil {
+		return 0, "", false
+	}
+	return len(m[1]), m[3], true
+}
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// unwrapParagraphs drops the paragraph tags of tight list items
+func unwrapParagraphs(content string) string {
+	content = strings.ReplaceAll(content, "<p>", "")
+	return strings.ReplaceAll(content, "</p>", "")
+}
+
+// renderInline converts emphasis, code spans and links, escaping everything else
+func renderInline(text string) string {
+	var out strings.Builder
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_{}[]()#+-.!<>|~", rune(rest[1])):
+			out.WriteString(html.EscapeString(rest[1:2]))
+			i += 2
+			continue
+
+		case rest[0] == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if end := strings.Index(rest[ticks:], rest[:ticks]); end >= 0 {
+				code := strings.TrimSpace(strings.ReplaceAll(rest[ticks:ticks+end], "\n", " "))
+				out.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i += 2*ticks + end
+				continue
+			}
+			out.WriteString(html.EscapeString(rest[:ticks]))
+			i += ticks
+			continue
+
+		case rest[0] == '!' && strings.HasPrefix(rest, "!["):
+			// Images are shown as links, the page never loads remote content.
+			// The alt text is plain text.
+			if label, target, n, ok := parseLink(rest[1:]); ok {
+				out.WriteString(link(target, html.EscapeString(label)))
+				i += 1 + n
+				continue
+			}
+
+		case rest[0] == '[':
+			if label, target, n, ok := parseLink(rest); ok {
+				out.WriteString(link(target, renderInline(label)))
+				i += n
+				continue
+			}
+
+		case rest[0] == '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 {
+				target := rest[1:end]
+				if !strings.ContainsAny(target, " <") && (strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")) {
+					out.WriteString(link(target, html.EscapeString(target)))
+					i += end + 1
+					continue
+				}
+			}
+
+		case rest[0] == '*' || rest[0] == '_' && (i == 0 || !isWordByte(text[i-1])):
+			if n, ok := renderEmphasis(&out, rest); ok {
+				i += n
+				continue
+			}
+
+		case rest[0] == '\n':
+			if strings.HasSuffix(out.String(), "  ") {
+				trimmed := strings.TrimRight(out.String(), " ")
+				out.Reset()
+				out.WriteString(trimmed + "<br>")
+			}
+		}
+
+		out.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return out.String()
+}
+
+// renderEmphasis writes **strong** or *emphasis* (or the underscore forms) at
+// the start of text, returning how much of text it consumed
+func renderEmphasis(out *strings.Builder, text string) (int, bool) {
+	for _, delim := range []string{text[:1] + text[:1], text[:1]} {
+		if !strings.HasPrefix(text, delim) || len(text) <= len(delim) || text[len(delim)] == ' ' {
+			continue
+		}
+		end := strings.Index(text[len(delim)+1:], delim)
+		if end < 0 {
+			continue
+		}
+		end += len(delim) + 1
+		inner := text[len(delim):end]
+		if strings.HasSuffix(inner, " ") {
+			continue
+		}
+		tag := "em"
+		if len(delim) == 2 {
+			tag = "strong"
+		}
+		out.WriteString("<" + tag + ">" + renderInline(inner) + "</" + tag + ">")
+		return end + len(delim), true
+	}
+	return 0, false
+}
+
+// isWordByte reports whether an underscore after b is inside a word like
+// snake_case, where it never starts emphasis
+func isWordByte(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// parseLink reads "[label](target)" at the start of text
+func parseLink(text string) (label, target string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				if !strings.HasPrefix(text[i+1:], "(") {
+					return "", "", 0, false
+				}
+				end := strings.IndexByte(text[i+2:], ')')
+				if end < 0 {
+					return "", "", 0, false
+				}
+				target = strings.TrimSpace(text[i+2 : i+2+end])
+				// Drop an optional "title"
+				if space := strings.IndexAny(target, " \t"); space >= 0 {
+					target = target[:space]
+				}
+				return text[1:i], strings.Trim(target, "<>"), i + 3 + end, true
+			}
+		case '\n':
+			if depth == 0 {
+				return "", "", 0, false
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// link renders an anchor, or just its label when the target isn't a safe URL.
+// The label is written as is, callers escape or render it first.
+func link(target, label string) string {
+	if !safeURL(target) {
+		return label
+	}
+	return `<a href="` + html.EscapeString(target) + `" rel="nofollow noopener noreferrer">` + label + "</a>"
+}
+
+// safeURL allows http, https and mailto links and relative ones, which keeps
+// javascript: and data: URLs out of rendered documents
+func safeURL(target string) bool {
+	if target == "" {
+		return false
+	}
+	colon := strings.IndexByte(target, ':')
+	if colon < 0 || strings.ContainsAny(target[:colon], "/?#") {
+		return true
+	}
+	switch strings.ToLower(target[:colon]) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
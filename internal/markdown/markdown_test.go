@@ -0,0 +1,60 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"heading", "# Title\n## Sub *one* ##", "<h1>Title</h1>\n<h2>Sub <em>one</em></h2>\n"},
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		{"emphasis", "**bold** and _it_ but snake_case_name", "<p><strong>bold</strong> and <em>it</em> but snake_case_name</p>\n"},
+		{"code span", "run `rm -rf <dir>`", "<p>run <code>rm -rf &lt;dir&gt;</code></p>\n"},
+		{"fenced code", "```go\nfmt.Println(\"<hi>\")\n```", "<pre><code class=\"language-go\">fmt.Println(&#34;&lt;hi&gt;&#34;)\n</code></pre>\n"},
+		{"indented code", "    x := 1\n    y := 2", "<pre><code>x := 1\ny := 2\n</code></pre>\n"},
+		{"rule", "a\n\n---\n\nb", "<p>a</p>\n<hr>\n<p>b</p>\n"},
+		{"quote", "> quoted\n> text", "<blockquote>\n<p>quoted\ntext</p>\n</blockquote>\n"},
+		{"bullets", "- one\n- two\n  - nested", "<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul></li>\n</ul>\n"},
+		{"ordered", "3. three\n4. four", "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>\n"},
+		{"link", "[docs](https://example.com/a?b=1&c=2)", "<p><a href=\"https://example.com/a?b=1&amp;c=2\" rel=\"nofollow noopener noreferrer\">docs</a></p>\n"},
+		{"autolink", "<https://example.com>", "<p><a href=\"https://example.com\" rel=\"nofollow noopener noreferrer\">https://example.com</a></p>\n"},
+		{"image as link", "![logo](logo.png)", "<p><a href=\"logo.png\" rel=\"nofollow noopener noreferrer\">logo</a></p>\n"},
+		{"escapes", `\*not emphasis\*`, "<p>*not emphasis*</p>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Render(tt.source))
+		})
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"raw html", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"javascript link", "[click](javascript:alert(1))", "<p>click)</p>\n"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>x</p>\n"},
+		{"attribute breakout", `[x](https://a.com/"onmouseover="alert(1))`, "<p><a href=\"https://a.com/&#34;onmouseover=&#34;alert(1\" rel=\"nofollow noopener noreferrer\">x</a>)</p>\n"},
+		{"image alt html", "![<img src=x onerror=alert(1)>](https://x)", "<p><a href=\"https://x\" rel=\"nofollow noopener noreferrer\">&lt;img src=x onerror=alert(1)&gt;</a></p>\n"},
+		{"image alt with unsafe url", "![<form action=//evil>](javascript:x)", "<p>&lt;form action=//evil&gt;</p>\n"},
+		{"image alt meta refresh", `![<meta http-equiv="refresh" content="0;url=//evil">](data:x)`, "<p>&lt;meta http-equiv=&#34;refresh&#34; content=&#34;0;url=//evil&#34;&gt;</p>\n"},
+		{"link label html with unsafe url", "[<form action=//evil>](javascript:x)", "<p>&lt;form action=//evil&gt;</p>\n"},
+		{"fence language", "```\"><script>\nx\n```", "<pre><code class=\"language-&#34;&gt;&lt;script&gt;\">x\n</code></pre>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Render(tt.source))
+		})
+	}
+}
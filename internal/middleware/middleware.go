@@ -1,17 +1,38 @@
 package middleware
 
 import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
 	"github.com/labstack/echo/v4"
+	"github.com/marianozunino/drop/internal/config"
 )
 
+// hstsPreloadMinAge is the shortest max-age preload lists accept
+const hstsPreloadMinAge = 31536000
+
 // SecurityHeaders adds security-related HTTP headers to responses
 func SecurityHeaders() echo.MiddlewareFunc {
+	return SecurityHeadersWithHSTS(config.DefaultHSTSMaxAgeSeconds)
+}
+
+// SecurityHeadersWithHSTS adds the security headers with a Strict-Transport-Security
+// max-age in seconds. Only max-ages of a year or more ask for preloading.
+func SecurityHeadersWithHSTS(maxAge int) echo.MiddlewareFunc {
+	hsts := "max-age=" + strconv.Itoa(maxAge) + "; includeSubDomains"
+	if maxAge >= hstsPreloadMinAge {
+		hsts += "; preload"
+	}
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			c.Response().Header().Set("Access-Control-Allow-Origin", "*")
 			c.Response().Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 			c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			c.Response().Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
+			c.Response().Header().Set("Strict-Transport-Security", hsts)
 			c.Response().Header().Set("X-Frame-Options", "sameorigin")
 			c.Response().Header().Set("X-Content-Type-Options", "nosniff")
 			c.Response().Header().Set("X-XSS-Protection", "1; mode=block")
@@ -23,3 +44,59 @@ func SecurityHeaders() echo.MiddlewareFunc {
 		}
 	}
 }
+
+// ForceHTTPS redirects plain HTTP requests to the same URL over HTTPS. Behind a
+// proxy the original scheme is read from X-Forwarded-Proto. GET and HEAD get a
+// 301, other methods a 308 so uploads keep their method and body. Requests for
+// the skipped paths, like health checks, are served over either scheme.
+func ForceHTTPS(skipPaths ...string) echo.MiddlewareFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if c.Scheme() == "https" || skip[req.URL.Path] {
+				return next(c)
+			}
+
+			status := http.StatusPermanentRedirect
+			if req.Method == http.MethodGet || req.Method == http.MethodHead {
+				status = http.StatusMovedPermanently
+			}
+			return c.Redirect(status, "https://"+req.Host+req.URL.RequestURI())
+		}
+	}
+}
+
+// SlowRequests logs the details of requests that take longer than threshold.
+// Only the path is logged, query strings can carry tokens.
+func SlowRequests(threshold time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			elapsed := time.Since(start)
+			if elapsed < threshold {
+				return err
+			}
+
+			req := c.Request()
+			res := c.Response()
+			status := res.Status
+			var httpErr *echo.HTTPError
+			if errors.As(err, &httpErr) {
+				status = httpErr.Code
+			} else if err != nil && !res.Committed {
+				status = http.StatusInternalServerError
+			}
+
+			log.Printf("Slow request (%s): %s %s | status %d | in %d bytes | out %d bytes | ip %s | range %q | user agent %q",
+				elapsed.Round(time.Millisecond), req.Method, req.URL.Path, status,
+				req.ContentLength, res.Size, c.RealIP(), req.Header.Get("Range"), req.UserAgent())
+			return err
+		}
+	}
+}
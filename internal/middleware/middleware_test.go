@@ -1,9 +1,14 @@
 package middleware
 
 import (
+	"bytes"
+	"crypto/tls"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -159,3 +164,152 @@ func TestSecurityHeadersWithOPTIONSRequest(t *testing.T) {
 	assert.Equal(t, "nosniff", headers.Get("X-Content-Type-Options"))
 	assert.Empty(t, headers.Get("Server"))
 }
+
+func TestSecurityHeadersWithHSTS(t *testing.T) {
+	for maxAge, expected := range map[int]string{
+		31536000: "max-age=31536000; includeSubDomains; preload",
+		86400:    "max-age=86400; includeSubDomains",
+	} {
+		e := echo.New()
+		e.Use(SecurityHeadersWithHSTS(maxAge))
+		e.GET("/test", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+		assert.Equal(t, expected, rec.Header().Get("Strict-Transport-Security"))
+	}
+}
+
+func TestForceHTTPS(t *testing.T) {
+	e := echo.New()
+	e.Use(SecurityHeaders())
+	e.Use(ForceHTTPS("/health"))
+	ok := func(c echo.Context) error { return c.String(http.StatusOK, "served") }
+	e.GET("/file.txt", ok)
+	e.POST("/", ok)
+	e.GET("/health", ok)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		headers  map[string]string
+		status   int
+		location string
+	}{
+		{"plain http get", http.MethodGet, "http://drop.example.com/file.txt?raw=1", nil, http.StatusMovedPermanently, "https://drop.example.com/file.txt?raw=1"},
+		{"plain http post keeps the method", http.MethodPost, "http://drop.example.com/", nil, http.StatusPermanentRedirect, "https://drop.example.com/"},
+		{"https behind a proxy", http.MethodGet, "http://drop.example.com/file.txt", map[string]string{"X-Forwarded-Proto": "https"}, http.StatusOK, ""},
+		{"http behind a proxy", http.MethodGet, "http://drop.example.com/file.txt", map[string]string{"X-Forwarded-Proto": "http"}, http.StatusMovedPermanently, "https://drop.example.com/file.txt"},
+		{"health checks are not redirected", http.MethodGet, "http://drop.example.com/health", nil, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.location, rec.Header().Get("Location"))
+			assert.Equal(t, "max-age=63072000; includeSubDomains; preload", rec.Header().Get("Strict-Transport-Security"))
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://drop.example.com/file.txt", nil)
+	req.TLS = &tls.ConnectionState{}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, "TLS connections are served")
+}
+
+func TestSlowRequests(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	e := echo.New()
+	e.Use(SlowRequests(20 * time.Millisecond))
+	e.GET("/fast", func(c echo.Context) error {
+		return c.String(http.StatusOK, "fast")
+	})
+	e.GET("/slow", func(c echo.Context) error {
+		time.Sleep(30 * time.Millisecond)
+		return c.String(http.StatusOK, "slow")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Empty(t, logs.String(), "fast requests are not logged")
+
+	req := httptest.NewRequest(http.MethodGet, "/slow?token=secret", nil)
+	req.Header.Set("User-Agent", "curl/8.0")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	entry := logs.String()
+	assert.Contains(t, entry, "Slow request")
+	assert.Contains(t, entry, "GET /slow")
+	assert.Contains(t, entry, "status 200")
+	assert.Contains(t, entry, "out 4 bytes")
+	assert.Contains(t, entry, `"curl/8.0"`)
+	assert.NotContains(t, entry, "secret", "query strings are not logged")
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(3, []string{"192.0.2.10", "198.51.100.0/24", "bogus"})
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	e := echo.New()
+	e.Use(limiter.Middleware())
+	e.POST("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+
+	upload := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("limits each IP", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, upload("203.0.113.1").Code, i)
+		}
+		rec := upload("203.0.113.1")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "20", rec.Header().Get("Retry-After"))
+
+		assert.Equal(t, http.StatusOK, upload("203.0.113.2").Code, "other IPs have their own bucket")
+	})
+
+	t.Run("refills over time", func(t *testing.T) {
+		now = now.Add(10 * time.Second)
+		rec := upload("203.0.113.1")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "10", rec.Header().Get("Retry-After"))
+
+		now = now.Add(10 * time.Second)
+		assert.Equal(t, http.StatusOK, upload("203.0.113.1").Code)
+		assert.Equal(t, http.StatusTooManyRequests, upload("203.0.113.1").Code)
+
+		now = now.Add(time.Hour)
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, upload("203.0.113.1").Code, "the bucket holds at most a minute of requests")
+		}
+		assert.Equal(t, http.StatusTooManyRequests, upload("203.0.113.1").Code)
+	})
+
+	t.Run("allowlist bypasses the limit", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, http.StatusOK, upload("192.0.2.10").Code)
+			assert.Equal(t, http.StatusOK, upload("198.51.100.7").Code)
+		}
+	})
+}
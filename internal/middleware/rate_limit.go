@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimiter keeps a token bucket per client IP. A bucket holds up to a
+// minute's worth of requests and refills continuously, so a client can burst
+// its whole allowance and then gets one request every 60/perMinute seconds.
+type RateLimiter struct {
+	perSecond float64
+	burst     float64
+	allowIPs  map[string]bool
+	allowNets []*net.IPNet
+	now       func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter allows perMinute requests per minute for each IP. Clients
+// whose IP is in the allowlist, given as IPs or CIDR ranges, are never limited.
+func NewRateLimiter(perMinute int, allowlist []string) *RateLimiter {
+	l := &RateLimiter{
+		perSecond: float64(perMinute) / 60,
+		burst:     float64(perMinute),
+		allowIPs:  make(map[string]bool),
+		now:       time.Now,
+		buckets:   make(map[string]*bucket),
+	}
+	for _, entry := range allowlist {
+		entry = strings.TrimSpace(entry)
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			l.allowNets = append(l.allowNets, ipNet)
+		} else if ip := net.ParseIP(entry); ip != nil {
+			l.allowIPs[ip.String()] = true
+		} else if entry != "" {
+			log.Printf("Warning: Ignoring invalid rate limit allowlist entry %q", entry)
+		}
+	}
+	return l
+}
+
+// Middleware answers requests over the limit with 429 Too Many Requests and a
+// Retry-After header. Clients are told apart by c.RealIP().
+func (l *RateLimiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := c.RealIP()
+			if l.allowed(ip) {
+				return next(c)
+			}
+			ok, wait := l.take(ip)
+			if ok {
+				return next(c)
+			}
+
+			seconds := int(math.Ceil(wait.Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+			return c.String(http.StatusTooManyRequests, "Too many requests, try again later")
+		}
+	}
+}
+
+// allowed reports whether ip is on the allowlist
+func (l *RateLimiter) allowed(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	if l.allowIPs[parsed.String()] {
+		return true
+	}
+	for _, ipNet := range l.allowNets {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// take spends a token of the bucket of ip, or returns how long until the next
+// one is available
+func (l *RateLimiter) take(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.perSecond)
+	b.updated = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.perSecond * float64(time.Second))
+}
+
+// sweep forgets buckets that have refilled completely, they are the same as a
+// new one. It runs at most once a minute.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for ip, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.perSecond >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+}
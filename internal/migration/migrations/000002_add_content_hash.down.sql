@@ -0,0 +1,3 @@
+-- Rollback for content hash column
+DROP INDEX IF EXISTS idx_metadata_content_hash;
+ALTER TABLE metadata DROP COLUMN content_hash;
@@ -0,0 +1,4 @@
+-- Content hash (MD5 hex) of stored files, used for deduplication
+ALTER TABLE metadata ADD COLUMN content_hash TEXT DEFAULT '';
+
+CREATE INDEX idx_metadata_content_hash ON metadata(content_hash);
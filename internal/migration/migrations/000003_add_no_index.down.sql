@@ -0,0 +1,2 @@
+-- Rollback for no_index column
+ALTER TABLE metadata DROP COLUMN no_index;
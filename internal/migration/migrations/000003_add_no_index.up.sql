@@ -0,0 +1,2 @@
+-- Per-file opt-out from search engine indexing
+ALTER TABLE metadata ADD COLUMN no_index BOOLEAN DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Rollback for last_accessed_at column
+ALTER TABLE metadata DROP COLUMN last_accessed_at;
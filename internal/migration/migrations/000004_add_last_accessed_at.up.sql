@@ -0,0 +1,2 @@
+-- Time of the most recent download or redirect
+ALTER TABLE metadata ADD COLUMN last_accessed_at DATETIME;
@@ -0,0 +1,3 @@
+-- Rollback for group_id column
+DROP INDEX IF EXISTS idx_metadata_group_id;
+ALTER TABLE metadata DROP COLUMN group_id;
@@ -0,0 +1,4 @@
+-- Resources uploaded together, deleted together when cascade_group_deletes is on
+ALTER TABLE metadata ADD COLUMN group_id TEXT DEFAULT '';
+
+CREATE INDEX idx_metadata_group_id ON metadata(group_id);
@@ -0,0 +1,2 @@
+-- Rollback for max_downloads column
+ALTER TABLE metadata DROP COLUMN max_downloads;
@@ -0,0 +1,2 @@
+-- Number of downloads after which a file is deleted, 0 for no limit
+ALTER TABLE metadata ADD COLUMN max_downloads INTEGER DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Rollback for content_encoding column
+ALTER TABLE metadata DROP COLUMN content_encoding;
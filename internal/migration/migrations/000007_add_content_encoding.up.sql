@@ -0,0 +1,2 @@
+-- Encoding the stored file is served with, e.g. gzip for pre-compressed assets
+ALTER TABLE metadata ADD COLUMN content_encoding TEXT DEFAULT '';
@@ -0,0 +1,2 @@
+-- Rollback for password_hash column
+ALTER TABLE metadata DROP COLUMN password_hash;
@@ -0,0 +1,2 @@
+-- bcrypt hash of the password protecting a file, empty for none
+ALTER TABLE metadata ADD COLUMN password_hash TEXT DEFAULT '';
@@ -0,0 +1,2 @@
+-- Rollback for thumbnail_path column
+ALTER TABLE metadata DROP COLUMN thumbnail_path;
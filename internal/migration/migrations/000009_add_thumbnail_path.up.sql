@@ -0,0 +1,2 @@
+-- Path of the generated thumbnail of an image, empty until one exists
+ALTER TABLE metadata ADD COLUMN thumbnail_path TEXT DEFAULT '';
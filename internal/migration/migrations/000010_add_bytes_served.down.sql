@@ -0,0 +1,3 @@
+-- Rollback for bytes_served and transfer_usage
+DROP TABLE IF EXISTS transfer_usage;
+ALTER TABLE metadata DROP COLUMN bytes_served;
@@ -0,0 +1,34 @@
+//go:build postgres
+
+package migration
+
+import (
+	"embed"
+	"errors"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed postgres/*.sql
+var postgresMigrations embed.FS
+
+// UpPostgres applies all pending migrations to the Postgres database at dsn
+func UpPostgres(dsn string) error {
+	source, err := iofs.New(postgresMigrations, "postgres")
+	if err != nil {
+		return err
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, dsn)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,2 @@
+-- Rollback for the Postgres schema
+DROP TABLE IF EXISTS metadata;
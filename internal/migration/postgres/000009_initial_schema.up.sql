@@ -0,0 +1,38 @@
+-- Schema of the Postgres metadata backend, matching version 9 of the SQLite
+-- migrations. Later migrations must be added for both backends.
+CREATE TABLE metadata (
+    id TEXT PRIMARY KEY,
+    resource_path TEXT NOT NULL,
+    token TEXT NOT NULL,
+    original_name TEXT,
+    upload_date TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ,
+    size BIGINT NOT NULL DEFAULT 0,
+    content_type TEXT,
+    one_time_view BOOLEAN DEFAULT FALSE,
+    original_url TEXT DEFAULT '',
+    is_url_shortener BOOLEAN DEFAULT FALSE,
+    access_count INTEGER DEFAULT 0,
+    ip_address TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    content_hash TEXT DEFAULT '',
+    no_index BOOLEAN DEFAULT FALSE,
+    last_accessed_at TIMESTAMPTZ,
+    group_id TEXT DEFAULT '',
+    max_downloads INTEGER DEFAULT 0,
+    content_encoding TEXT DEFAULT '',
+    password_hash TEXT DEFAULT '',
+    thumbnail_path TEXT DEFAULT ''
+);
+
+CREATE INDEX idx_metadata_resource_path ON metadata(resource_path);
+CREATE INDEX idx_metadata_token ON metadata(token);
+CREATE INDEX idx_metadata_upload_date ON metadata(upload_date);
+CREATE INDEX idx_metadata_expires_at ON metadata(expires_at);
+CREATE INDEX idx_metadata_is_url_shortener ON metadata(is_url_shortener);
+CREATE INDEX idx_metadata_access_count ON metadata(access_count);
+CREATE INDEX idx_metadata_created_at ON metadata(created_at);
+CREATE INDEX idx_metadata_ip_address ON metadata(ip_address);
+CREATE INDEX idx_metadata_content_hash ON metadata(content_hash);
+CREATE INDEX idx_metadata_group_id ON metadata(group_id);
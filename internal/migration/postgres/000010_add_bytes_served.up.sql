@@ -0,0 +1,8 @@
+-- Bytes served of each file, and of the whole server per month for
+-- monthly_transfer_cap_gib
+ALTER TABLE metadata ADD COLUMN bytes_served BIGINT DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS transfer_usage (
+    period TEXT PRIMARY KEY,
+    bytes_served BIGINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,2 @@
+-- Rollback for public_id column
+ALTER TABLE metadata DROP COLUMN public_id;
@@ -0,0 +1,3 @@
+-- Whether the file is stored under a public, non-secret id. Only those are
+-- offered to other uploaders by content hash deduplication.
+ALTER TABLE metadata ADD COLUMN public_id BOOLEAN DEFAULT FALSE;
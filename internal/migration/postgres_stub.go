@@ -0,0 +1,10 @@
+//go:build !postgres
+
+package migration
+
+import "errors"
+
+// UpPostgres needs a build with the postgres tag
+func UpPostgres(dsn string) error {
+	return errors.New("postgres migrations are not compiled in, build with -tags postgres")
+}
@@ -18,12 +18,59 @@ type FileMetadata struct {
 	IPAddress      string     `json:"ip_address,omitempty"`
 	CreatedAt      time.Time  `json:"created_at,omitempty"`
 	UpdatedAt      time.Time  `json:"updated_at,omitempty"`
+	ContentHash    string     `json:"content_hash,omitempty"`
+	NoIndex        bool       `json:"no_index,omitempty"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+
+	// GroupID links resources uploaded together, see cascade_group_deletes
+	GroupID string `json:"group_id,omitempty"`
+
+	// MaxDownloads deletes the file after this many downloads, 0 for no limit
+	MaxDownloads int `json:"max_downloads,omitempty"`
+
+	// ContentEncoding is the encoding the file is stored in, e.g. gzip for a
+	// pre-compressed asset. ContentType is the type of the decoded content.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+
+	// PasswordHash is the bcrypt hash of the password needed to download the
+	// file, empty when it isn't protected. It is never serialized.
+	PasswordHash string `json:"-"`
+
+	// ThumbnailPath is the generated thumbnail of an image, empty until the
+	// first one is made
+	ThumbnailPath string `json:"thumbnail_path,omitempty"`
+
+	// BytesServed is the total of the bytes sent by downloads of the file
+	BytesServed int64 `json:"bytes_served,omitempty"`
+
+	// PublicID is set when the file is stored under a random, non-secret id.
+	// Secret ids and slugs are not handed out to other uploaders by deduplication.
+	PublicID bool `json:"public_id,omitempty"`
 }
 
 func (m *FileMetadata) ID() string {
 	return m.ResourcePath
 }
 
+// LimitsDownloads reports whether downloads consume the file, either as a
+// one-time file or one with a download limit
+func (m *FileMetadata) LimitsDownloads() bool {
+	return m.OneTimeView || m.MaxDownloads > 0
+}
+
+// HasPassword reports whether downloading the file needs a password
+func (m *FileMetadata) HasPassword() bool {
+	return m.PasswordHash != ""
+}
+
+// FolderContentType is the content type of folder uploads, stored as a directory
+const FolderContentType = "inode/directory"
+
+// IsFolder returns true if this metadata represents a folder upload
+func (m *FileMetadata) IsFolder() bool {
+	return m.ContentType == FolderContentType
+}
+
 // IsFile returns true if this metadata represents a regular file (not a URL shortener)
 func (m *FileMetadata) IsFile() bool {
 	return !m.IsURLShortener
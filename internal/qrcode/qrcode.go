@@ -0,0 +1,439 @@
+// Package qrcode encodes short strings, such as file URLs, as QR codes. It
+// only implements what the upload pages need: byte mode at error correction
+// level M in versions 1 to 10, which holds up to 213 bytes.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrTooLong is returned for text that doesn't fit in a version 10 code
+var ErrTooLong = errors.New("text too long for a QR code")
+
+// Code is an encoded QR code. Modules are indexed [y][x] and true is dark.
+type Code struct {
+	Size    int
+	modules [][]bool
+}
+
+// Dark reports whether the module at column x and row y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// block layout of a version at level M: ecLen error correction codewords for
+// each block, and the data codewords of each block
+type versionInfo struct {
+	ecLen      int
+	blocks     []int
+	alignments []int
+}
+
+var versions = [...]versionInfo{
+	1:  {10, []int{16}, nil},
+	2:  {16, []int{28}, []int{6, 18}},
+	3:  {26, []int{44}, []int{6, 22}},
+	4:  {18, []int{32, 32}, []int{6, 26}},
+	5:  {24, []int{43, 43}, []int{6, 30}},
+	6:  {16, []int{27, 27, 27, 27}, []int{6, 34}},
+	7:  {18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	8:  {22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	9:  {22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	10: {26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+func (v versionInfo) dataCodewords() int {
+	n := 0
+	for _, b := range v.blocks {
+		n += b
+	}
+	return n
+}
+
+// Encode encodes text in the smallest version that holds it
+func Encode(text string) (*Code, error) {
+	for version := 1; version < len(versions); version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		capacity := versions[version].dataCodewords() * 8
+		if 4+countBits+8*len(text) > capacity {
+			continue
+		}
+
+		var bits bitBuffer
+		bits.append(0b0100, 4)
+		bits.append(len(text), countBits)
+		for i := 0; i < len(text); i++ {
+			bits.append(int(text[i]), 8)
+		}
+		bits.append(0, min(4, capacity-len(bits)))
+		bits.append(0, (8-len(bits)%8)%8)
+		for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+			bits.append(pad, 8)
+		}
+
+		return newCode(version, interleave(versions[version], bits.bytes())), nil
+	}
+	return nil, fmt.Errorf("%w: %d bytes", ErrTooLong, len(text))
+}
+
+// SVG renders the code with a four module quiet zone, one unit per module
+func (c *Code) SVG() string {
+	size := c.Size + 8
+	var path strings.Builder
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+4, y+4)
+			}
+		}
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="%d" height="%d" fill="#fff"/><path d="%s" fill="#000"/></svg>`,
+		size, size, size, size, path.String())
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, value>>i&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
+
+// interleave splits data into the version's blocks, adds error correction to
+// each and interleaves the result codeword by codeword
+func interleave(v versionInfo, data []byte) []byte {
+	divisor := rsDivisor(v.ecLen)
+	dataBlocks := make([][]byte, len(v.blocks))
+	ecBlocks := make([][]byte, len(v.blocks))
+	for i, n := range v.blocks {
+		dataBlocks[i], data = data[:n], data[n:]
+		ecBlocks[i] = rsRemainder(dataBlocks[i], divisor)
+	}
+
+	var out []byte
+	for i := 0; i < v.blocks[len(v.blocks)-1]; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecLen; i++ {
+		for _, block := range ecBlocks {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
+
+// gfMul multiplies in GF(256) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given degree,
+// highest power first and without its leading 1
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords of data
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+type builder struct {
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+func newCode(version int, codewords []byte) *Code {
+	size := 17 + 4*version
+	b := &builder{size: size, modules: grid(size), isFunction: grid(size)}
+	b.drawFunctionPatterns(version)
+	b.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		b.applyMask(mask)
+		b.drawFormatBits(mask)
+		if penalty := b.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		b.applyMask(mask)
+	}
+	b.applyMask(best)
+	b.drawFormatBits(best)
+
+	return &Code{Size: size, modules: b.modules}
+}
+
+func grid(size int) [][]bool {
+	g := make([][]bool, size)
+	for i := range g {
+		g[i] = make([]bool, size)
+	}
+	return g
+}
+
+func (b *builder) set(x, y int, dark bool) {
+	b.modules[y][x] = dark
+	b.isFunction[y][x] = true
+}
+
+func (b *builder) drawFunctionPatterns(version int) {
+	for i := range b.size {
+		b.set(6, i, i%2 == 0)
+		b.set(i, 6, i%2 == 0)
+	}
+
+	b.drawFinder(3, 3)
+	b.drawFinder(b.size-4, 3)
+	b.drawFinder(3, b.size-4)
+
+	positions := versions[version].alignments
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// The corners taken by finder patterns have no alignment pattern
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					b.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once the mask is chosen
+	b.drawFormatBits(0)
+
+	if version >= 7 {
+		rem := version
+		for range 12 {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := version<<12 | rem
+		for i := range 18 {
+			dark := bits>>i&1 == 1
+			a, c := b.size-11+i%3, i/3
+			b.set(a, c, dark)
+			b.set(c, a, dark)
+		}
+	}
+}
+
+// drawFinder draws a finder pattern and its separator around the center x, y
+func (b *builder) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= b.size || yy < 0 || yy >= b.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			b.set(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for level M
+func (b *builder) drawFormatBits(mask int) {
+	data := mask // level M is 0b00
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		b.set(8, i, bit(i))
+	}
+	b.set(8, 7, bit(6))
+	b.set(8, 8, bit(7))
+	b.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		b.set(14-i, 8, bit(i))
+	}
+
+	for i := range 8 {
+		b.set(b.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		b.set(8, b.size-15+i, bit(i))
+	}
+	b.set(8, b.size-8, true)
+}
+
+// drawCodewords places the codewords in the zigzag order of the standard,
+// leaving the remainder modules light
+func (b *builder) drawCodewords(codewords []byte) {
+	i := 0
+	for right := b.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range b.size {
+			y := vert
+			if upward {
+				y = b.size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if b.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				b.modules[y][x] = codewords[i/8]>>(7-i%8)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by mask. Applying it twice
+// restores the modules.
+func (b *builder) applyMask(mask int) {
+	for y := range b.size {
+		for x := range b.size {
+			if !b.isFunction[y][x] && maskBit(mask, x, y) {
+				b.modules[y][x] = !b.modules[y][x]
+			}
+		}
+	}
+}
+
+func maskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+var finderLike = []bool{true, false, true, true, true, false, true, false, false, false, false}
+
+// penalty scores the current modules with the four rules of the standard;
+// the mask with the lowest score is used
+func (b *builder) penalty() int {
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return b.modules[x][y]
+		}
+		return b.modules[y][x]
+	}
+
+	score, dark := 0, 0
+	for _, transpose := range []bool{false, true} {
+		for y := range b.size {
+			run := 1
+			for x := 1; x <= b.size; x++ {
+				if x < b.size && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			for x := 0; x+len(finderLike) <= b.size; x++ {
+				forward, backward := true, true
+				for i, want := range finderLike {
+					forward = forward && at(x+i, y, transpose) == want
+					backward = backward && at(x+len(finderLike)-1-i, y, transpose) == want
+				}
+				if forward {
+					score += 40
+				}
+				if backward {
+					score += 40
+				}
+			}
+		}
+	}
+
+	for y := range b.size {
+		for x := range b.size {
+			if b.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := b.modules[y][x]
+				if b.modules[y-1][x] == c && b.modules[y][x-1] == c && b.modules[y-1][x-1] == c {
+					score += 3
+				}
+			}
+		}
+	}
+
+	total := b.size * b.size
+	score += abs(dark*20-total*10) / total * 10
+	return score
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
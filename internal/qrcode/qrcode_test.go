@@ -0,0 +1,156 @@
+package qrcode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" as a 1-M symbol, from the worked example of the standard
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	assert.Equal(t, want, rsRemainder(data, rsDivisor(10)))
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	code, err := Encode(strings.Repeat("a", 115))
+	require.NoError(t, err)
+	require.Equal(t, 45, code.Size, "115 bytes need version 7")
+
+	// Format bits are read from the copy next to the top left finder
+	var format int
+	for i := 14; i >= 9; i-- {
+		format = format<<1 | bit(code.Dark(14-i, 8))
+	}
+	format = format<<1 | bit(code.Dark(7, 8))
+	format = format<<1 | bit(code.Dark(8, 8))
+	format = format<<1 | bit(code.Dark(8, 7))
+	for i := 5; i >= 0; i-- {
+		format = format<<1 | bit(code.Dark(8, i))
+	}
+	mask := (format ^ 0x5412) >> 10
+	assert.Equal(t, 0, mask>>3, "level M")
+	formats := []int{0x5412, 0x5125, 0x5E7C, 0x5B4B, 0x45F9, 0x40CE, 0x4F97, 0x4AA0}
+	assert.Equal(t, formats[mask&7], format)
+
+	var version int
+	for i := 17; i >= 0; i-- {
+		version = version<<1 | bit(code.Dark(i/3, code.Size-11+i%3))
+	}
+	assert.Equal(t, 0b000111110010010100, version)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"https://drop.example.com/Ab3x.png",
+		"https://drop.example.com/" + strings.Repeat("x", 60) + ".tar.gz",
+		strings.Repeat("é", 106),
+	} {
+		code, err := Encode(text)
+		require.NoError(t, err)
+		assert.Equal(t, text, decode(t, code))
+	}
+
+	_, err := Encode(strings.Repeat("x", 214))
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestSVG(t *testing.T) {
+	code, err := Encode("https://drop.example.com/A")
+	require.NoError(t, err)
+	svg := code.SVG()
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 33 33"`))
+	assert.Contains(t, svg, `d="M4 4h1v1h-1z`, "top left finder corner is dark")
+}
+
+func bit(dark bool) int {
+	if dark {
+		return 1
+	}
+	return 0
+}
+
+// decode reads the text back from code, using the mask from its format bits
+func decode(t *testing.T, code *Code) string {
+	t.Helper()
+	version := (code.Size - 17) / 4
+	b := &builder{size: code.Size, modules: grid(code.Size), isFunction: grid(code.Size)}
+	b.drawFunctionPatterns(version)
+
+	// Format bits are read from the copy next to the other two finders
+	var format int
+	for i := 14; i >= 8; i-- {
+		format = format<<1 | bit(code.Dark(8, code.Size-15+i))
+	}
+	for i := 7; i >= 0; i-- {
+		format = format<<1 | bit(code.Dark(code.Size-1-i, 8))
+	}
+	mask := (format ^ 0x5412) >> 10 & 7
+
+	var bits bitBuffer
+	for right := code.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range code.Size {
+			y := vert
+			if upward {
+				y = code.Size - 1 - vert
+			}
+			for j := range 2 {
+				x := right - j
+				if !b.isFunction[y][x] {
+					bits = append(bits, code.Dark(x, y) != maskBit(mask, x, y))
+				}
+			}
+		}
+	}
+	codewords := bitBuffer(bits[:len(bits)/8*8]).bytes()
+
+	v := versions[version]
+	blocks := make([][]byte, len(v.blocks))
+	k := 0
+	for i := 0; i < v.blocks[len(v.blocks)-1]; i++ {
+		for j, n := range v.blocks {
+			if i < n {
+				blocks[j] = append(blocks[j], codewords[k])
+				k++
+			}
+		}
+	}
+	var data bitBuffer
+	for j, block := range blocks {
+		var ec []byte
+		for i := range v.ecLen {
+			ec = append(ec, codewords[k+i*len(blocks)+j])
+		}
+		require.Equal(t, rsRemainder(block, rsDivisor(v.ecLen)), ec, "block %d", j)
+		for _, c := range block {
+			data.append(int(c), 8)
+		}
+	}
+
+	read := func(n int) int {
+		value := 0
+		for _, b := range data[:n] {
+			value = value<<1 | bit(b)
+		}
+		data = data[n:]
+		return value
+	}
+	require.Equal(t, 0b0100, read(4), "byte mode")
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	text := make([]byte, read(countBits))
+	for i := range text {
+		text[i] = byte(read(8))
+	}
+	return string(text)
+}
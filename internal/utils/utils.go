@@ -2,8 +2,11 @@ package utils
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -26,8 +29,10 @@ func FormatFileSize(size int64) string {
 
 // ParseExpirationTime parses a string representing an expiration time and returns a time.Time object.
 // It accepts the following formats:
-//   - Integer number of hours to add to current time
+//   - Integer number of hours to add to current time. A bare number is always
+//     hours, "24" is a day from now; numbers of 10000 and up are timestamps.
 //   - Unix timestamp in milliseconds
+//   - Duration from now with unit suffixes, see ParseDuration (e.g., "90m", "7d", "2w3d")
 //   - RFC3339 formatted date-time string (e.g., "2006-01-02T15:04:05Z07:00")
 //   - ISO date format (e.g., "2006-01-02")
 //   - ISO datetime without timezone (e.g., "2006-01-02T15:04:05")
@@ -43,6 +48,10 @@ func ParseExpirationTime(expiresStr string) (time.Time, error) {
 		return time.UnixMilli(ms).UTC(), nil
 	}
 
+	if d, err := ParseDuration(expiresStr); err == nil {
+		return time.Now().Add(d), nil
+	}
+
 	formats := []string{
 		time.RFC3339,
 		"2006-01-02",
@@ -59,15 +68,84 @@ func ParseExpirationTime(expiresStr string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("unrecognized date/time format")
 }
 
+// durationUnits are the suffixes accepted by ParseDuration
+var durationUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ParseDuration parses a duration made of whole numbers with a unit suffix, s,
+// m, h, d (24 hours) or w (7 days), e.g. "90m", "7d" or "1d12h". Unlike
+// time.ParseDuration every number needs a unit, so a bare "24" is rejected.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	var total time.Duration
+	for rest := s; rest != ""; {
+		digits := 0
+		for digits < len(rest) && rest[digits] >= '0' && rest[digits] <= '9' {
+			digits++
+		}
+		if digits == 0 || digits == len(rest) {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+
+		unit, ok := durationUnits[rest[digits]]
+		if !ok {
+			return 0, fmt.Errorf("invalid duration %q: unknown unit %q", s, rest[digits])
+		}
+		n, err := strconv.ParseInt(rest[:digits], 10, 64)
+		if err != nil || n > int64((math.MaxInt64-total)/unit) {
+			return 0, fmt.Errorf("duration %q is too long", s)
+		}
+
+		total += time.Duration(n) * unit
+		rest = rest[digits+1:]
+	}
+	return total, nil
+}
+
+// ParseExpirationTimeWithFloor parses like ParseExpirationTime, then moves any
+// expiration sooner than now+floor to now+floor
+func ParseExpirationTimeWithFloor(expiresStr string, floor time.Duration) (time.Time, error) {
+	t, err := ParseExpirationTime(expiresStr)
+	if err != nil {
+		return t, err
+	}
+	return ApplyExpirationFloor(t, floor), nil
+}
+
+// ApplyExpirationFloor returns now+floor when t is earlier than that, so nothing
+// expires before the floor has passed
+func ApplyExpirationFloor(t time.Time, floor time.Duration) time.Time {
+	if earliest := time.Now().Add(floor); t.Before(earliest) {
+		return earliest
+	}
+	return t
+}
+
 // CalculateMD5 calculates the MD5 hash of a file and returns it as a hexadecimal string
 func CalculateMD5(filePath string) (string, error) {
+	return calculateHash(filePath, md5.New())
+}
+
+// CalculateSHA256 calculates the SHA-256 hash of a file and returns it as a hexadecimal string
+func CalculateSHA256(filePath string) (string, error) {
+	return calculateHash(filePath, sha256.New())
+}
+
+func calculateHash(filePath string, hash hash.Hash) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
-	hash := md5.New()
 	if _, err := io.Copy(hash, file); err != nil {
 		return "", fmt.Errorf("failed to read file: %w", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -72,6 +73,26 @@ func TestCalculateMD5(t *testing.T) {
 	assert.Equal(t, expectedEmptyHash, emptyHash)
 }
 
+func TestCalculateSHA256(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "test.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("hello"), 0644))
+
+	hash, err := CalculateSHA256(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", hash)
+
+	emptyFilePath := filepath.Join(tempDir, "empty.txt")
+	require.NoError(t, os.WriteFile(emptyFilePath, []byte(""), 0644))
+
+	emptyHash, err := CalculateSHA256(emptyFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", emptyHash)
+
+	_, err = CalculateSHA256(filepath.Join(tempDir, "missing.txt"))
+	assert.Error(t, err)
+}
+
 func TestCalculateMD5WithNonExistentFile(t *testing.T) {
 	hash, err := CalculateMD5("/non/existent/file.txt")
 	assert.Error(t, err)
@@ -214,3 +235,70 @@ func TestGenerateASCIITableSingleRow(t *testing.T) {
 	assert.NotContains(t, result, "┤")
 	assert.NotContains(t, result, "┼")
 }
+
+func TestParseExpirationTimeWithFloor(t *testing.T) {
+	floor := 5 * time.Minute
+
+	expires, err := ParseExpirationTimeWithFloor("0", floor)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(floor), expires, time.Second)
+
+	soon := time.Now().Add(10 * time.Second).UTC().Format(time.RFC3339)
+	expires, err = ParseExpirationTimeWithFloor(soon, floor)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(floor), expires, time.Second)
+
+	expires, err = ParseExpirationTimeWithFloor("24", floor)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), expires, time.Second)
+
+	_, err = ParseExpirationTimeWithFloor("not a date", floor)
+	assert.Error(t, err)
+}
+
+func TestParseDuration(t *testing.T) {
+	for input, want := range map[string]time.Duration{
+		"45s":   45 * time.Second,
+		"90m":   90 * time.Minute,
+		"12h":   12 * time.Hour,
+		"7d":    7 * 24 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"1d12h": 36 * time.Hour,
+		"2w3d":  17 * 24 * time.Hour,
+	} {
+		got, err := ParseDuration(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"", "7x", "24", "d", "7d3", "1.5h", "-7d", "7 d", "99999999999w"} {
+		_, err := ParseDuration(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestParseExpirationTimeDurations(t *testing.T) {
+	expires, err := ParseExpirationTime("7d")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(7*24*time.Hour), expires, time.Second)
+
+	expires, err = ParseExpirationTime("1d12h")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(36*time.Hour), expires, time.Second)
+
+	// A bare number is still hours
+	expires, err = ParseExpirationTime("24")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), expires, time.Second)
+
+	_, err = ParseExpirationTime("7x")
+	assert.Error(t, err)
+}
+
+func TestApplyExpirationFloor(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), ApplyExpirationFloor(past, time.Minute), time.Second)
+
+	later := time.Now().Add(time.Hour)
+	assert.Equal(t, later, ApplyExpirationFloor(later, time.Minute))
+}
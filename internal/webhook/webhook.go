@@ -0,0 +1,263 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marianozunino/drop/internal/config"
+	"github.com/marianozunino/drop/internal/model"
+)
+
+// Event types, selected with webhook_events
+const (
+	EventUpload = config.WebhookEventUpload
+	EventDelete = config.WebhookEventDelete
+	EventExpire = config.WebhookEventExpire
+)
+
+// SignatureHeader carries "t=<unix time>,sha256=<hex>": the timestamp of the
+// event and the HMAC-SHA256, keyed with webhook_secret, of the timestamp, a
+// dot and the body. Signing the timestamp lets receivers reject replays.
+const SignatureHeader = "X-Drop-Signature"
+
+// SignatureTolerance is how far the timestamp of a signature may be from the
+// receiver's clock before Verify rejects it as a replay
+const SignatureTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature is returned by Verify for malformed or wrong signatures
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+
+	// ErrSignatureExpired is returned by Verify for valid signatures whose
+	// timestamp is outside SignatureTolerance
+	ErrSignatureExpired = errors.New("webhook signature timestamp is outside the tolerance")
+)
+
+const (
+	// queueSize is how many events can wait for delivery. Events that don't
+	// fit are dropped, so uploads never wait for a slow receiver.
+	queueSize = 256
+
+	// deliveryAttempts is how often an event is sent before it is dropped
+	deliveryAttempts = 3
+)
+
+// retryDelay is the wait before the first retry of a failed delivery. It
+// doubles with every further attempt.
+var retryDelay = time.Second
+
+// Event is the JSON payload posted to webhook_url
+type Event struct {
+	Type        string    `json:"event"`
+	FileID      string    `json:"file_id"`
+	URL         string    `json:"url,omitempty"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	IPAddress   string    `json:"ip_address,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Notifier posts events to webhook_url in the background, one at a time
+type Notifier struct {
+	url     string
+	baseURL string
+	secret  []byte
+	events  map[string]bool
+	client  *http.Client
+
+	mu      sync.Mutex
+	closed  bool
+	queue   chan Event
+	stopped chan struct{}
+}
+
+// NewNotifier starts delivering the events listed in webhook_events. It
+// returns nil when webhook_url is not set; a nil Notifier drops every event.
+func NewNotifier(cfg *config.Config) *Notifier {
+	if cfg.WebhookURL == "" {
+		return nil
+	}
+
+	n := &Notifier{
+		url:     cfg.WebhookURL,
+		baseURL: cfg.BaseURL,
+		secret:  []byte(cfg.WebhookSecret),
+		events:  make(map[string]bool),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan Event, queueSize),
+		stopped: make(chan struct{}),
+	}
+	for _, event := range cfg.WebhookEvents {
+		n.events[strings.ToLower(strings.TrimSpace(event))] = true
+	}
+
+	go func() {
+		defer close(n.stopped)
+		for event := range n.queue {
+			n.deliver(event)
+		}
+	}()
+	return n
+}
+
+// Notify queues an event about the file or URL shortener of meta. The IP
+// address is only known when ip_tracking_enabled stored it.
+func (n *Notifier) Notify(eventType string, meta model.FileMetadata) {
+	id := meta.ResourcePath
+	if !meta.IsURLShortener {
+		id = filepath.Base(meta.ResourcePath)
+	}
+	n.NotifyEvent(Event{
+		Type:        eventType,
+		FileID:      id,
+		Size:        meta.Size,
+		ContentType: meta.ContentType,
+		IPAddress:   meta.IPAddress,
+	})
+}
+
+// NotifyEvent queues an event unless its type isn't in webhook_events
+func (n *Notifier) NotifyEvent(event Event) {
+	if n == nil || !n.events[event.Type] {
+		return
+	}
+	if event.URL == "" && event.FileID != "" {
+		event.URL = strings.TrimSuffix(n.baseURL, "/") + "/" + event.FileID
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	select {
+	case n.queue <- event:
+	default:
+		log.Printf("Warning: Webhook queue full, dropping %s event of %s", event.Type, event.FileID)
+	}
+}
+
+// Stop delivers the queued events and stops the notifier
+func (n *Notifier) Stop() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+	<-n.stopped
+}
+
+// deliver posts the event, retrying network errors, 429 and 5xx responses
+// with a growing delay
+func (n *Notifier) deliver(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error: Failed to encode %s webhook: %v", event.Type, err)
+		return
+	}
+
+	// Retries carry the same signature, the timestamp is the event's
+	var signature string
+	if len(n.secret) > 0 {
+		signature = Sign(n.secret, body, event.Timestamp)
+	}
+
+	for attempt := 1; ; attempt++ {
+		retryable, err := n.post(body, signature)
+		if err == nil {
+			return
+		}
+		if !retryable || attempt >= deliveryAttempts {
+			log.Printf("Error: Failed to deliver %s webhook of %s after %d attempt(s): %v", event.Type, event.FileID, attempt, err)
+			return
+		}
+		time.Sleep(retryDelay << (attempt - 1))
+	}
+}
+
+func (n *Notifier) post(body []byte, signature string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "drop-webhook")
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("receiver returned status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// Sign returns the SignatureHeader value of a body sent at timestamp
+func Sign(secret, body []byte, timestamp time.Time) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",sha256=" + hex.EncodeToString(signature(secret, unix, body))
+}
+
+// Verify checks a SignatureHeader value against the raw body of a webhook
+// request, and that its timestamp is within SignatureTolerance of now
+func Verify(secret, body []byte, header string, now time.Time) error {
+	var unix, sum string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			unix = value
+		case "sha256":
+			sum = value
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	got, err := hex.DecodeString(sum)
+	if err != nil || !hmac.Equal(got, signature(secret, unix, body)) {
+		return ErrInvalidSignature
+	}
+
+	if age := now.Sub(time.Unix(seconds, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+// signature is the HMAC-SHA256 of "<unix>.<body>"
+func signature(secret []byte, unix string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
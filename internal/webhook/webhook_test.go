@@ -0,0 +1,141 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/marianozunino/drop/internal/config"
+	"github.com/marianozunino/drop/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type delivery struct {
+	body      []byte
+	signature string
+}
+
+func newReceiver(t *testing.T, status func(attempt int32) int) (*httptest.Server, chan delivery) {
+	t.Helper()
+	deliveries := make(chan delivery, 10)
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		code := status(attempts.Add(1))
+		if code == http.StatusOK {
+			deliveries <- delivery{body: body, signature: r.Header.Get(SignatureHeader)}
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(server.Close)
+	return server, deliveries
+}
+
+func receive(t *testing.T, deliveries chan delivery) delivery {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+		return delivery{}
+	}
+}
+
+func TestNotifierDeliversSignedEvents(t *testing.T) {
+	server, deliveries := newReceiver(t, func(int32) int { return http.StatusOK })
+	n := NewNotifier(&config.Config{
+		WebhookURL:    server.URL,
+		WebhookEvents: []string{EventUpload, EventDelete},
+		WebhookSecret: "secret",
+		BaseURL:       "https://drop.example/",
+	})
+	defer n.Stop()
+
+	n.Notify(EventUpload, model.FileMetadata{
+		ResourcePath: "/uploads/abc.txt",
+		Size:         42,
+		ContentType:  "text/plain",
+		IPAddress:    "192.0.2.1",
+	})
+
+	d := receive(t, deliveries)
+	require.NoError(t, Verify([]byte("secret"), d.body, d.signature, time.Now()))
+
+	var event Event
+	require.NoError(t, json.Unmarshal(d.body, &event))
+	assert.Equal(t, Sign([]byte("secret"), d.body, event.Timestamp), d.signature, "signed with the payload's timestamp")
+	assert.Equal(t, EventUpload, event.Type)
+	assert.Equal(t, "abc.txt", event.FileID)
+	assert.Equal(t, "https://drop.example/abc.txt", event.URL)
+	assert.Equal(t, int64(42), event.Size)
+	assert.Equal(t, "text/plain", event.ContentType)
+	assert.Equal(t, "192.0.2.1", event.IPAddress)
+	assert.False(t, event.Timestamp.IsZero())
+}
+
+func TestNotifierSkipsUnselectedEvents(t *testing.T) {
+	server, deliveries := newReceiver(t, func(int32) int { return http.StatusOK })
+	n := NewNotifier(&config.Config{WebhookURL: server.URL, WebhookEvents: []string{EventDelete}})
+
+	n.NotifyEvent(Event{Type: EventUpload, FileID: "skipped.txt"})
+	n.NotifyEvent(Event{Type: EventDelete, FileID: "deleted.txt"})
+	n.Stop()
+
+	require.Len(t, deliveries, 1)
+	d := <-deliveries
+	assert.Empty(t, d.signature, "unsigned without a secret")
+	assert.Contains(t, string(d.body), `"file_id":"deleted.txt"`)
+}
+
+func TestNotifierRetriesFailedDeliveries(t *testing.T) {
+	defer func(delay time.Duration) { retryDelay = delay }(retryDelay)
+	retryDelay = time.Millisecond
+
+	server, deliveries := newReceiver(t, func(attempt int32) int {
+		if attempt < deliveryAttempts {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	n := NewNotifier(&config.Config{WebhookURL: server.URL, WebhookEvents: []string{EventExpire}})
+	defer n.Stop()
+
+	n.NotifyEvent(Event{Type: EventExpire, FileID: "old.txt"})
+	d := receive(t, deliveries)
+	assert.Contains(t, string(d.body), `"event":"expire"`)
+}
+
+func TestNilNotifier(t *testing.T) {
+	n := NewNotifier(&config.Config{})
+	assert.Nil(t, n)
+
+	// A disabled notifier accepts and drops events
+	n.Notify(EventUpload, model.FileMetadata{ResourcePath: "/uploads/a.txt"})
+	n.Stop()
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"event":"upload","file_id":"abc.txt"}`)
+	sentAt := time.Unix(1700000000, 0)
+	header := Sign(secret, body, sentAt)
+	assert.Equal(t, "t=1700000000,sha256=", header[:len("t=1700000000,sha256=")])
+
+	assert.NoError(t, Verify(secret, body, header, sentAt.Add(time.Minute)))
+	assert.NoError(t, Verify(secret, body, header, sentAt.Add(-time.Minute)), "clocks may be a little behind")
+
+	assert.ErrorIs(t, Verify(secret, []byte(`{"event":"delete","file_id":"abc.txt"}`), header, sentAt), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify([]byte("other"), body, header, sentAt), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(secret, body, "t=1700000001,"+header[len("t=1700000000,"):], sentAt), ErrInvalidSignature, "the timestamp is signed")
+	assert.ErrorIs(t, Verify(secret, body, "sha256="+header[len("t=1700000000,sha256="):], sentAt), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(secret, body, "", sentAt), ErrInvalidSignature)
+
+	// Replays of a captured request are rejected once it is old enough
+	assert.ErrorIs(t, Verify(secret, body, header, sentAt.Add(SignatureTolerance+time.Second)), ErrSignatureExpired)
+}
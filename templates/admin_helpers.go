@@ -1,6 +1,7 @@
 package templates
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -10,6 +11,19 @@ import (
 
 // Helper functions for admin templates
 
+type pathPrefixKey struct{}
+
+// WithPathPrefix makes templates rendered with the context link under path_prefix
+func WithPathPrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, pathPrefixKey{}, prefix)
+}
+
+// AppPath returns an absolute path under the path prefix of the context
+func AppPath(ctx context.Context, path string) string {
+	prefix, _ := ctx.Value(pathPrefixKey{}).(string)
+	return prefix + path
+}
+
 func CountExpiredFiles(files []model.AdminFileInfo) int {
 	count := 0
 	for _, file := range files {
@@ -96,15 +110,12 @@ func GetPaginationURL(sortField, sortDirection, searchQuery, cursor string, limi
 	return url
 }
 
-func GetDeleteURL(filename, token, sortField, sortDirection, searchQuery string, limit int) string {
+// GetDeleteURL is where the delete form of a file posts to. It keeps the
+// dashboard state to return to, but never the management token.
+func GetDeleteURL(filename, sortField, sortDirection, searchQuery string, limit int) string {
 	url := "/admin/file/" + filename + "/delete"
 	params := []string{}
 
-	// Always include the token for security
-	if token != "" {
-		params = append(params, "token="+token)
-	}
-
 	if searchQuery != "" {
 		params = append(params, "search="+searchQuery)
 	}
@@ -66,7 +66,7 @@ func AdminPagination(files []model.AdminFileInfo, sortField string, sortDirectio
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			var templ_7745c5c3_Var3 templ.SafeURL = templ.URL(GetPaginationURL(sortField, sortDirection, searchQuery, "", limit))
+			var templ_7745c5c3_Var3 templ.SafeURL = templ.URL(AppPath(ctx, GetPaginationURL(sortField, sortDirection, searchQuery, "", limit)))
 			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(string(templ_7745c5c3_Var3)))
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
@@ -81,7 +81,7 @@ func AdminPagination(files []model.AdminFileInfo, sortField string, sortDirectio
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			var templ_7745c5c3_Var4 templ.SafeURL = templ.URL(GetPaginationURL(sortField, sortDirection, searchQuery, nextCursor, limit))
+			var templ_7745c5c3_Var4 templ.SafeURL = templ.URL(AppPath(ctx, GetPaginationURL(sortField, sortDirection, searchQuery, nextCursor, limit)))
 			_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(string(templ_7745c5c3_Var4)))
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
@@ -29,7 +29,7 @@ func AdminScripts() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<script>\n\t\tfunction adminSettings() {\n\t\t\treturn {\n\t\t\t\tshowSettings: false,\n\t\t\t\tsettings: {\n\t\t\t\t\tnoConfirmDelete: false,\n\t\t\t\t\tautoRefresh: false,\n\t\t\t\t\tcompactView: false,\n\t\t\t\t\tshowFileSize: true,\n\t\t\t\t\tshowUploadDate: true\n\t\t\t\t},\n\t\t\t\trefreshInterval: null,\n\n\t\t\t\tinit() {\n\t\t\t\t\tthis.loadSettings();\n\t\t\t\t\tthis.setupAutoRefresh();\n\t\t\t\t},\n\n\t\t\t\tloadSettings() {\n\t\t\t\t\tconst saved = localStorage.getItem('adminSettings');\n\t\t\t\t\tif (saved) {\n\t\t\t\t\t\tthis.settings = { ...this.settings, ...JSON.parse(saved) };\n\t\t\t\t\t}\n\t\t\t\t},\n\n\t\t\t\tsaveSettings() {\n\t\t\t\t\tlocalStorage.setItem('adminSettings', JSON.stringify(this.settings));\n\t\t\t\t\tthis.setupAutoRefresh();\n\t\t\t\t},\n\n\t\t\t\tresetSettings() {\n\t\t\t\t\tthis.settings = {\n\t\t\t\t\t\tnoConfirmDelete: false,\n\t\t\t\t\t\tautoRefresh: false,\n\t\t\t\t\t\tcompactView: false,\n\t\t\t\t\t\tshowFileSize: true,\n\t\t\t\t\t\tshowUploadDate: true\n\t\t\t\t\t};\n\t\t\t\t\tlocalStorage.removeItem('adminSettings');\n\t\t\t\t\tthis.setupAutoRefresh();\n\t\t\t\t},\n\n\t\t\t\tsetupAutoRefresh() {\n\t\t\t\t\tif (this.refreshInterval) {\n\t\t\t\t\t\tclearInterval(this.refreshInterval);\n\t\t\t\t\t\tthis.refreshInterval = null;\n\t\t\t\t\t}\n\t\t\t\t\t\n\t\t\t\t\tif (this.settings.autoRefresh) {\n\t\t\t\t\t\tthis.refreshInterval = setInterval(() => {\n\t\t\t\t\t\t\twindow.location.reload();\n\t\t\t\t\t\t}, 30000);\n\t\t\t\t\t}\n\t\t\t\t},\n\n\t\t\t\tconfirmDelete(event) {\n\t\t\t\t\tif (!this.settings.noConfirmDelete) {\n\t\t\t\t\t\tif (!confirm('Are you sure you want to delete this file?')) {\n\t\t\t\t\t\t\tevent.preventDefault();\n\t\t\t\t\t\t}\n\t\t\t\t\t}\n\t\t\t\t}\n\t\t\t}\n\t\t}\n\n\t\tfunction changePageSize(newLimit) {\n\t\t\tconst url = new URL(window.location);\n\t\t\turl.searchParams.set('limit', newLimit);\n\t\t\turl.searchParams.delete('cursor'); // Reset to first page\n\t\t\twindow.location.href = url.toString();\n\t\t}\n\t</script>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<script>\n\t\tfunction adminSettings() {\n\t\t\treturn {\n\t\t\t\tshowSettings: false,\n\t\t\t\tsettings: {\n\t\t\t\t\tnoConfirmDelete: false,\n\t\t\t\t\tautoRefresh: false,\n\t\t\t\t\tcompactView: false,\n\t\t\t\t\tshowFileSize: true,\n\t\t\t\t\tshowUploadDate: true\n\t\t\t\t},\n\t\t\t\trefreshInterval: null,\n\t\t\t\tselected: [],\n\n\t\t\t\tinit() {\n\t\t\t\t\tthis.loadSettings();\n\t\t\t\t\tthis.setupAutoRefresh();\n\t\t\t\t},\n\n\t\t\t\tloadSettings() {\n\t\t\t\t\tconst saved = localStorage.getItem('adminSettings');\n\t\t\t\t\tif (saved) {\n\t\t\t\t\t\tthis.settings = { ...this.settings, ...JSON.parse(saved) };\n\t\t\t\t\t}\n\t\t\t\t},\n\n\t\t\t\tsaveSettings() {\n\t\t\t\t\tlocalStorage.setItem('adminSettings', JSON.stringify(this.settings));\n\t\t\t\t\tthis.setupAutoRefresh();\n\t\t\t\t},\n\n\t\t\t\tresetSettings() {\n\t\t\t\t\tthis.settings = {\n\t\t\t\t\t\tnoConfirmDelete: false,\n\t\t\t\t\t\tautoRefresh: false,\n\t\t\t\t\t\tcompactView: false,\n\t\t\t\t\t\tshowFileSize: true,\n\t\t\t\t\t\tshowUploadDate: true\n\t\t\t\t\t};\n\t\t\t\t\tlocalStorage.removeItem('adminSettings');\n\t\t\t\t\tthis.setupAutoRefresh();\n\t\t\t\t},\n\n\t\t\t\tsetupAutoRefresh() {\n\t\t\t\t\tif (this.refreshInterval) {\n\t\t\t\t\t\tclearInterval(this.refreshInterval);\n\t\t\t\t\t\tthis.refreshInterval = null;\n\t\t\t\t\t}\n\t\t\t\t\t\n\t\t\t\t\tif (this.settings.autoRefresh) {\n\t\t\t\t\t\tthis.refreshInterval = setInterval(() => {\n\t\t\t\t\t\t\twindow.location.reload();\n\t\t\t\t\t\t}, 30000);\n\t\t\t\t\t}\n\t\t\t\t},\n\n\t\t\t\tconfirmDelete(event) {\n\t\t\t\t\tif (!this.settings.noConfirmDelete) {\n\t\t\t\t\t\tif (!confirm('Are you sure you want to delete this file?')) {\n\t\t\t\t\t\t\tevent.preventDefault();\n\t\t\t\t\t\t}\n\t\t\t\t\t}\n\t\t\t\t},\n\n\t\t\t\tselectAll(checked) {\n\t\t\t\t\tthis.selected = checked\n\t\t\t\t\t\t? Array.from(document.querySelectorAll('.select-file'), box => box.value)\n\t\t\t\t\t\t: [];\n\t\t\t\t},\n\n\t\t\t\tasync bulkDelete(url) {\n\t\t\t\t\tif (!this.settings.noConfirmDelete &&\n\t\t\t\t\t\t!confirm(`Are you sure you want to delete ${this.selected.length} files?`)) {\n\t\t\t\t\t\treturn;\n\t\t\t\t\t}\n\t\t\t\t\tconst form = new URLSearchParams();\n\t\t\t\t\tthis.selected.forEach(token => form.append('token', token));\n\t\t\t\t\tconst response = await fetch(url, { method: 'POST', body: form });\n\t\t\t\t\tif (!response.ok) {\n\t\t\t\t\t\talert(`Bulk delete failed: ${await response.text()}`);\n\t\t\t\t\t\treturn;\n\t\t\t\t\t}\n\t\t\t\t\tconst result = await response.json();\n\t\t\t\t\tif (result.failed > 0) {\n\t\t\t\t\t\talert(`Deleted ${result.deleted} files, ${result.failed} failed.`);\n\t\t\t\t\t}\n\t\t\t\t\twindow.location.reload();\n\t\t\t\t}\n\t\t\t}\n\t\t}\n\n\t\tfunction changePageSize(newLimit) {\n\t\t\tconst url = new URL(window.location);\n\t\t\turl.searchParams.set('limit', newLimit);\n\t\t\turl.searchParams.delete('cursor'); // Reset to first page\n\t\t\twindow.location.href = url.toString();\n\t\t}\n\t</script>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -29,7 +29,7 @@ func AdminStyles() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<style>\n\t\tbody {\n\t\t\tfont-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;\n\t\t\tmargin: 0;\n\t\t\tpadding: 20px;\n\t\t\tbackground-color: white;\n\t\t\tcolor: black;\n\t\t}\n\t\t.header {\n\t\t\tborder: 1px solid #ccc;\n\t\t\tpadding: 20px;\n\t\t\tmargin-bottom: 20px;\n\t\t\tdisplay: flex;\n\t\t\tjustify-content: space-between;\n\t\t\talign-items: center;\n\t\t}\n\t\th1 {\n\t\t\tmargin: 0;\n\t\t}\n\t\t.header-actions {\n\t\t\tdisplay: flex;\n\t\t\tgap: 10px;\n\t\t}\n\t\tbutton, .btn {\n\t\t\tpadding: 8px 16px;\n\t\t\tborder: 1px solid #ccc;\n\t\t\tbackground: white;\n\t\t\tcursor: pointer;\n\t\t\ttext-decoration: none;\n\t\t\tdisplay: inline-block;\n\t\t\tcolor: black;\n\t\t}\n\t\tbutton:hover, .btn:hover {\n\t\t\tbackground: #f5f5f5;\n\t\t}\n\t\t.logout-btn {\n\t\t\tbackground: #ffebee;\n\t\t\tborder-color: #d32f2f;\n\t\t\tcolor: #d32f2f;\n\t\t}\n\t\t.logout-btn:hover {\n\t\t\tbackground: #ffcdd2;\n\t\t}\n\t\t.settings-panel {\n\t\t\tborder: 1px solid #ccc;\n\t\t\tpadding: 20px;\n\t\t\tmargin-bottom: 20px;\n\t\t}\n\t\t.settings-content {\n\t\t\tmargin-bottom: 20px;\n\t\t}\n\t\t.setting-item {\n\t\t\tmargin-bottom: 10px;\n\t\t}\n\t\t.setting-item label {\n\t\t\tdisplay: flex;\n\t\t\talign-items: center;\n\t\t\tgap: 8px;\n\t\t\tcursor: pointer;\n\t\t}\n\t\t.settings-actions {\n\t\t\tdisplay: flex;\n\t\t\tgap: 10px;\n\t\t\tjustify-content: flex-end;\n\t\t}\n\t\t.stats {\n\t\t\tdisplay: grid;\n\t\t\tgrid-template-columns: repeat(auto-fit, minmax(200px, 1fr));\n\t\t\tgap: 20px;\n\t\t\tmargin-bottom: 20px;\n\t\t}\n\t\t.stat-card {\n\t\t\tborder: 1px solid #ccc;\n\t\t\tpadding: 20px;\n\t\t\ttext-align: center;\n\t\t}\n\t\t.stat-number {\n\t\t\tfont-size: 2em;\n\t\t\tfont-weight: bold;\n\t\t}\n\t\t.stat-label {\n\t\t\tcolor: #666;\n\t\t\tmargin-top: 5px;\n\t\t}\n\t\t.files-table {\n\t\t\tborder: 1px solid #ccc;\n\t\t}\n\t\ttable {\n\t\t\twidth: 100%;\n\t\t\tborder-collapse: collapse;\n\t\t}\n\t\tth, td {\n\t\t\tpadding: 12px;\n\t\t\ttext-align: left;\n\t\t\tborder-bottom: 1px solid #eee;\n\t\t}\n\t\tth {\n\t\t\tbackground-color: #f8f8f8;\n\t\t\tfont-weight: 600;\n\t\t}\n\t\t.sortable {\n\t\t\tcursor: pointer;\n\t\t\tuser-select: none;\n\t\t}\n\t\t.sortable:hover {\n\t\t\tbackground-color: #e8e8e8;\n\t\t}\n\t\t.search-section {\n\t\t\tmargin: 20px 0;\n\t\t\tpadding: 20px;\n\t\t\tbackground-color: #f8f8f8;\n\t\t\tborder-radius: 8px;\n\t\t}\n\t\t.search-form {\n\t\t\tmargin-bottom: 10px;\n\t\t}\n\t\t.search-input-group {\n\t\t\tdisplay: flex;\n\t\t\tgap: 10px;\n\t\t\talign-items: center;\n\t\t}\n\t\t.search-input {\n\t\t\tflex: 1;\n\t\t\tpadding: 10px;\n\t\t\tborder: 1px solid #ddd;\n\t\t\tborder-radius: 4px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.search-input:focus {\n\t\t\toutline: none;\n\t\t\tborder-color: #333;\n\t\t}\n\t\t.search-btn {\n\t\t\tpadding: 10px 20px;\n\t\t\tbackground-color: #333;\n\t\t\tcolor: white;\n\t\t\tborder: none;\n\t\t\tborder-radius: 4px;\n\t\t\tcursor: pointer;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.search-btn:hover {\n\t\t\tbackground-color: #555;\n\t\t}\n\t\t.clear-search-btn {\n\t\t\tpadding: 10px 15px;\n\t\t\tbackground-color: #666;\n\t\t\tcolor: white;\n\t\t\ttext-decoration: none;\n\t\t\tborder-radius: 4px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.clear-search-btn:hover {\n\t\t\tbackground-color: #888;\n\t\t}\n\t\t.search-results-info {\n\t\t\tfont-size: 14px;\n\t\t\tcolor: #666;\n\t\t\tfont-style: italic;\n\t\t}\n\t\t.pagination-section {\n\t\t\tmargin: 20px 0;\n\t\t\tpadding: 20px;\n\t\t\tbackground-color: #f8f8f8;\n\t\t\tborder-radius: 8px;\n\t\t\tdisplay: flex;\n\t\t\tjustify-content: space-between;\n\t\t\talign-items: center;\n\t\t\tflex-wrap: wrap;\n\t\t\tgap: 15px;\n\t\t}\n\t\t.pagination-info {\n\t\t\tfont-size: 14px;\n\t\t\tcolor: #666;\n\t\t}\n\t\t.pagination-more {\n\t\t\tcolor: #333;\n\t\t\tfont-weight: 600;\n\t\t}\n\t\t.pagination-controls {\n\t\t\tdisplay: flex;\n\t\t\tgap: 10px;\n\t\t}\n\t\t.pagination-btn {\n\t\t\tpadding: 8px 16px;\n\t\t\tbackground-color: #333;\n\t\t\tcolor: white;\n\t\t\ttext-decoration: none;\n\t\t\tborder-radius: 4px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.pagination-btn:hover {\n\t\t\tbackground-color: #555;\n\t\t}\n\t\t.pagination-settings {\n\t\t\tdisplay: flex;\n\t\t\talign-items: center;\n\t\t\tgap: 8px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.pagination-settings select {\n\t\t\tpadding: 4px 8px;\n\t\t\tborder: 1px solid #ddd;\n\t\t\tborder-radius: 4px;\n\t\t}\n\t\ttr:hover {\n\t\t\tbackground-color: #f8f8f8;\n\t\t}\n\t\ttable.compact th, table.compact td {\n\t\t\tpadding: 6px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.filename {\n\t\t\tfont-family: monospace;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.size {\n\t\t\tfont-family: monospace;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.expired {\n\t\t\tcolor: #d32f2f;\n\t\t\tfont-weight: bold;\n\t\t}\n\t\t.expires-soon {\n\t\t\tcolor: #f57c00;\n\t\t\tfont-weight: bold;\n\t\t}\n\t\t.one-time {\n\t\t\tbackground-color: #e3f2fd;\n\t\t\tcolor: #1976d2;\n\t\t\tpadding: 2px 6px;\n\t\t\tborder-radius: 3px;\n\t\t\tfont-size: 12px;\n\t\t\tfont-weight: bold;\n\t\t}\n\t\t.actions {\n\t\t\tdisplay: flex;\n\t\t\tgap: 5px;\n\t\t}\n\t\t.btn-view {\n\t\t\tbackground-color: #e3f2fd;\n\t\t\tborder-color: #1976d2;\n\t\t\tcolor: #1976d2;\n\t\t}\n\t\t.btn-delete {\n\t\t\tbackground-color: #ffebee;\n\t\t\tborder-color: #d32f2f;\n\t\t\tcolor: #d32f2f;\n\t\t}\n\t\t.no-files {\n\t\t\ttext-align: center;\n\t\t\tpadding: 40px;\n\t\t\tcolor: #666;\n\t\t}\n\t</style>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<style>\n\t\tbody {\n\t\t\tfont-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;\n\t\t\tmargin: 0;\n\t\t\tpadding: 20px;\n\t\t\tbackground-color: white;\n\t\t\tcolor: black;\n\t\t}\n\t\t.header {\n\t\t\tborder: 1px solid #ccc;\n\t\t\tpadding: 20px;\n\t\t\tmargin-bottom: 20px;\n\t\t\tdisplay: flex;\n\t\t\tjustify-content: space-between;\n\t\t\talign-items: center;\n\t\t}\n\t\th1 {\n\t\t\tmargin: 0;\n\t\t}\n\t\t.header-actions {\n\t\t\tdisplay: flex;\n\t\t\tgap: 10px;\n\t\t}\n\t\tbutton, .btn {\n\t\t\tpadding: 8px 16px;\n\t\t\tborder: 1px solid #ccc;\n\t\t\tbackground: white;\n\t\t\tcursor: pointer;\n\t\t\ttext-decoration: none;\n\t\t\tdisplay: inline-block;\n\t\t\tcolor: black;\n\t\t}\n\t\tbutton:hover, .btn:hover {\n\t\t\tbackground: #f5f5f5;\n\t\t}\n\t\t.logout-btn {\n\t\t\tbackground: #ffebee;\n\t\t\tborder-color: #d32f2f;\n\t\t\tcolor: #d32f2f;\n\t\t}\n\t\t.logout-btn:hover {\n\t\t\tbackground: #ffcdd2;\n\t\t}\n\t\t.maintenance-banner {\n\t\t\tdisplay: flex;\n\t\t\tjustify-content: space-between;\n\t\t\talign-items: center;\n\t\t\tborder: 1px solid #ccc;\n\t\t\tpadding: 10px 20px;\n\t\t\tmargin-bottom: 20px;\n\t\t}\n\t\t.maintenance-banner.active {\n\t\t\tbackground: #fff8e1;\n\t\t\tborder-color: #f57c00;\n\t\t}\n\t\t.maintenance-banner form {\n\t\t\tmargin: 0;\n\t\t}\n\t\t.settings-panel {\n\t\t\tborder: 1px solid #ccc;\n\t\t\tpadding: 20px;\n\t\t\tmargin-bottom: 20px;\n\t\t}\n\t\t.settings-content {\n\t\t\tmargin-bottom: 20px;\n\t\t}\n\t\t.setting-item {\n\t\t\tmargin-bottom: 10px;\n\t\t}\n\t\t.setting-item label {\n\t\t\tdisplay: flex;\n\t\t\talign-items: center;\n\t\t\tgap: 8px;\n\t\t\tcursor: pointer;\n\t\t}\n\t\t.settings-actions {\n\t\t\tdisplay: flex;\n\t\t\tgap: 10px;\n\t\t\tjustify-content: flex-end;\n\t\t}\n\t\t.stats {\n\t\t\tdisplay: grid;\n\t\t\tgrid-template-columns: repeat(auto-fit, minmax(200px, 1fr));\n\t\t\tgap: 20px;\n\t\t\tmargin-bottom: 20px;\n\t\t}\n\t\t.stat-card {\n\t\t\tborder: 1px solid #ccc;\n\t\t\tpadding: 20px;\n\t\t\ttext-align: center;\n\t\t}\n\t\t.stat-number {\n\t\t\tfont-size: 2em;\n\t\t\tfont-weight: bold;\n\t\t}\n\t\t.stat-label {\n\t\t\tcolor: #666;\n\t\t\tmargin-top: 5px;\n\t\t}\n\t\t.files-table {\n\t\t\tborder: 1px solid #ccc;\n\t\t}\n\t\ttable {\n\t\t\twidth: 100%;\n\t\t\tborder-collapse: collapse;\n\t\t}\n\t\tth, td {\n\t\t\tpadding: 12px;\n\t\t\ttext-align: left;\n\t\t\tborder-bottom: 1px solid #eee;\n\t\t}\n\t\tth {\n\t\t\tbackground-color: #f8f8f8;\n\t\t\tfont-weight: 600;\n\t\t}\n\t\t.sortable {\n\t\t\tcursor: pointer;\n\t\t\tuser-select: none;\n\t\t}\n\t\t.sortable:hover {\n\t\t\tbackground-color: #e8e8e8;\n\t\t}\n\t\t.search-section {\n\t\t\tmargin: 20px 0;\n\t\t\tpadding: 20px;\n\t\t\tbackground-color: #f8f8f8;\n\t\t\tborder-radius: 8px;\n\t\t}\n\t\t.search-form {\n\t\t\tmargin-bottom: 10px;\n\t\t}\n\t\t.search-input-group {\n\t\t\tdisplay: flex;\n\t\t\tgap: 10px;\n\t\t\talign-items: center;\n\t\t}\n\t\t.search-input {\n\t\t\tflex: 1;\n\t\t\tpadding: 10px;\n\t\t\tborder: 1px solid #ddd;\n\t\t\tborder-radius: 4px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.search-input:focus {\n\t\t\toutline: none;\n\t\t\tborder-color: #333;\n\t\t}\n\t\t.search-btn {\n\t\t\tpadding: 10px 20px;\n\t\t\tbackground-color: #333;\n\t\t\tcolor: white;\n\t\t\tborder: none;\n\t\t\tborder-radius: 4px;\n\t\t\tcursor: pointer;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.search-btn:hover {\n\t\t\tbackground-color: #555;\n\t\t}\n\t\t.clear-search-btn {\n\t\t\tpadding: 10px 15px;\n\t\t\tbackground-color: #666;\n\t\t\tcolor: white;\n\t\t\ttext-decoration: none;\n\t\t\tborder-radius: 4px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.clear-search-btn:hover {\n\t\t\tbackground-color: #888;\n\t\t}\n\t\t.search-results-info {\n\t\t\tfont-size: 14px;\n\t\t\tcolor: #666;\n\t\t\tfont-style: italic;\n\t\t}\n\t\t.pagination-section {\n\t\t\tmargin: 20px 0;\n\t\t\tpadding: 20px;\n\t\t\tbackground-color: #f8f8f8;\n\t\t\tborder-radius: 8px;\n\t\t\tdisplay: flex;\n\t\t\tjustify-content: space-between;\n\t\t\talign-items: center;\n\t\t\tflex-wrap: wrap;\n\t\t\tgap: 15px;\n\t\t}\n\t\t.pagination-info {\n\t\t\tfont-size: 14px;\n\t\t\tcolor: #666;\n\t\t}\n\t\t.pagination-more {\n\t\t\tcolor: #333;\n\t\t\tfont-weight: 600;\n\t\t}\n\t\t.pagination-controls {\n\t\t\tdisplay: flex;\n\t\t\tgap: 10px;\n\t\t}\n\t\t.pagination-btn {\n\t\t\tpadding: 8px 16px;\n\t\t\tbackground-color: #333;\n\t\t\tcolor: white;\n\t\t\ttext-decoration: none;\n\t\t\tborder-radius: 4px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.pagination-btn:hover {\n\t\t\tbackground-color: #555;\n\t\t}\n\t\t.pagination-settings {\n\t\t\tdisplay: flex;\n\t\t\talign-items: center;\n\t\t\tgap: 8px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.pagination-settings select {\n\t\t\tpadding: 4px 8px;\n\t\t\tborder: 1px solid #ddd;\n\t\t\tborder-radius: 4px;\n\t\t}\n\t\ttr:hover {\n\t\t\tbackground-color: #f8f8f8;\n\t\t}\n\t\ttable.compact th, table.compact td {\n\t\t\tpadding: 6px;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.filename {\n\t\t\tfont-family: monospace;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.size {\n\t\t\tfont-family: monospace;\n\t\t\tfont-size: 14px;\n\t\t}\n\t\t.expired {\n\t\t\tcolor: #d32f2f;\n\t\t\tfont-weight: bold;\n\t\t}\n\t\t.expires-soon {\n\t\t\tcolor: #f57c00;\n\t\t\tfont-weight: bold;\n\t\t}\n\t\t.one-time {\n\t\t\tbackground-color: #e3f2fd;\n\t\t\tcolor: #1976d2;\n\t\t\tpadding: 2px 6px;\n\t\t\tborder-radius: 3px;\n\t\t\tfont-size: 12px;\n\t\t\tfont-weight: bold;\n\t\t}\n\t\t.actions {\n\t\t\tdisplay: flex;\n\t\t\tgap: 5px;\n\t\t}\n\t\t.btn-view {\n\t\t\tbackground-color: #e3f2fd;\n\t\t\tborder-color: #1976d2;\n\t\t\tcolor: #1976d2;\n\t\t}\n\t\t.btn-delete {\n\t\t\tbackground-color: #ffebee;\n\t\t\tborder-color: #d32f2f;\n\t\t\tcolor: #d32f2f;\n\t\t}\n\t\t.bulk-actions {\n\t\t\tmargin-bottom: 10px;\n\t\t}\n\t\t.select {\n\t\t\twidth: 24px;\n\t\t}\n\t\t.no-files {\n\t\t\ttext-align: center;\n\t\t\tpadding: 40px;\n\t\t\tcolor: #666;\n\t\t}\n\t</style>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
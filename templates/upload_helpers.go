@@ -0,0 +1,17 @@
+package templates
+
+import "time"
+
+// UploadResult describes a finished upload for the success page. ExpiresAt is
+// zero for files that don't expire. QRCode is the SVG markup of a QR code of
+// URL, empty when the URL is too long to encode.
+type UploadResult struct {
+	HomeURL   string
+	URL       string
+	Name      string
+	Size      int64
+	Token     string
+	ExpiresAt time.Time
+	OneTime   bool
+	QRCode    string
+}
@@ -0,0 +1,8 @@
+package templates
+
+// CodeToken is a piece of a highlighted line. Kind is empty for plain text,
+// otherwise one of "string", "number", "literal", "key" or "comment".
+type CodeToken struct {
+	Kind string
+	Text string
+}